@@ -0,0 +1,11 @@
+-- Удаление таблицы связей курсов и тегов
+DROP TABLE IF EXISTS ee_course_tags;
+
+-- Удаление таблицы связей курсов и категорий
+DROP TABLE IF EXISTS ee_course_categories;
+
+-- Удаление таблицы тегов
+DROP TABLE IF EXISTS ee_tags;
+
+-- Удаление таблицы категорий
+DROP TABLE IF EXISTS ee_categories;
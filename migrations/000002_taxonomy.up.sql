@@ -0,0 +1,58 @@
+-- Создание таблицы категорий курсов
+CREATE TABLE ee_categories (
+    category_id SERIAL PRIMARY KEY,
+    parent_id INTEGER REFERENCES ee_categories(category_id) ON DELETE SET NULL,
+    title VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) UNIQUE NOT NULL,
+    "order" INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Создание таблицы тегов
+CREATE TABLE ee_tags (
+    tag_id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Создание таблицы связей курсов и категорий
+CREATE TABLE ee_course_categories (
+    course_id INTEGER REFERENCES ee_courses(course_id) ON DELETE CASCADE,
+    category_id INTEGER REFERENCES ee_categories(category_id) ON DELETE CASCADE,
+    PRIMARY KEY (course_id, category_id)
+);
+
+-- Создание таблицы связей курсов и тегов
+CREATE TABLE ee_course_tags (
+    course_id INTEGER REFERENCES ee_courses(course_id) ON DELETE CASCADE,
+    tag_id INTEGER REFERENCES ee_tags(tag_id) ON DELETE CASCADE,
+    PRIMARY KEY (course_id, tag_id)
+);
+
+CREATE INDEX idx_course_categories_category ON ee_course_categories(category_id);
+CREATE INDEX idx_course_tags_tag ON ee_course_tags(tag_id);
+
+-- Комментарии для таблицы Categories
+COMMENT ON TABLE ee_categories IS 'Иерархический каталог категорий курсов';
+COMMENT ON COLUMN ee_categories.category_id IS 'Уникальный идентификатор категории';
+COMMENT ON COLUMN ee_categories.parent_id IS 'Идентификатор родительской категории';
+COMMENT ON COLUMN ee_categories.title IS 'Название категории';
+COMMENT ON COLUMN ee_categories.slug IS 'Уникальный идентификатор категории для URL';
+COMMENT ON COLUMN ee_categories.order IS 'Порядковый номер категории среди соседних';
+COMMENT ON COLUMN ee_categories.created_at IS 'Дата и время создания категории';
+COMMENT ON COLUMN ee_categories.updated_at IS 'Дата и время последнего обновления категории';
+
+-- Комментарии для таблицы Tags
+COMMENT ON TABLE ee_tags IS 'Свободные теги курсов';
+COMMENT ON COLUMN ee_tags.tag_id IS 'Уникальный идентификатор тега';
+COMMENT ON COLUMN ee_tags.title IS 'Название тега';
+COMMENT ON COLUMN ee_tags.slug IS 'Уникальный идентификатор тега для URL';
+COMMENT ON COLUMN ee_tags.created_at IS 'Дата и время создания тега';
+COMMENT ON COLUMN ee_tags.updated_at IS 'Дата и время последнего обновления тега';
+
+-- Комментарии для таблиц связей
+COMMENT ON TABLE ee_course_categories IS 'Связь курсов с категориями';
+COMMENT ON TABLE ee_course_tags IS 'Связь курсов с тегами';
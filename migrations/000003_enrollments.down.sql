@@ -0,0 +1,17 @@
+-- Восстановление таблицы владельцев курсов
+CREATE TABLE ee_course_owners (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES ee_users(user_id),
+    course_id INTEGER REFERENCES ee_courses(course_id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Доступ к курсу сохраняется только у действующих участников
+INSERT INTO ee_course_owners (user_id, course_id, created_at, updated_at)
+SELECT user_id, course_id, created_at, updated_at
+FROM ee_enrollments
+WHERE status IN ('active', 'completed');
+
+-- Удаление таблицы записей на курсы
+DROP TABLE IF EXISTS ee_enrollments;
@@ -0,0 +1,34 @@
+-- Создание таблицы записей на курсы
+CREATE TABLE ee_enrollments (
+    enrollment_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    course_id INTEGER NOT NULL REFERENCES ee_courses(course_id) ON DELETE CASCADE,
+    role VARCHAR(32) NOT NULL DEFAULT 'student',
+    status VARCHAR(32) NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, course_id),
+    CONSTRAINT ee_enrollments_role_check CHECK (role IN ('student', 'ta', 'co_instructor', 'observer')),
+    CONSTRAINT ee_enrollments_status_check CHECK (status IN ('active', 'completed', 'dropped', 'expired'))
+);
+
+CREATE INDEX idx_enrollments_course ON ee_enrollments(course_id);
+
+-- Перенос существующих владельцев курсов как активных студентов
+INSERT INTO ee_enrollments (user_id, course_id, role, status, created_at, updated_at)
+SELECT DISTINCT ON (user_id, course_id) user_id, course_id, 'student', 'active', created_at, updated_at
+FROM ee_course_owners
+WHERE user_id IS NOT NULL AND course_id IS NOT NULL
+ORDER BY user_id, course_id, created_at;
+
+DROP TABLE ee_course_owners;
+
+-- Комментарии для таблицы Enrollments
+COMMENT ON TABLE ee_enrollments IS 'Участники курсов: студенты, ассистенты, соавторы и наблюдатели';
+COMMENT ON COLUMN ee_enrollments.enrollment_id IS 'Уникальный идентификатор записи на курс';
+COMMENT ON COLUMN ee_enrollments.user_id IS 'Идентификатор пользователя';
+COMMENT ON COLUMN ee_enrollments.course_id IS 'Идентификатор курса';
+COMMENT ON COLUMN ee_enrollments.role IS 'Роль участника: student, ta, co_instructor, observer';
+COMMENT ON COLUMN ee_enrollments.status IS 'Состояние записи: active, completed, dropped, expired';
+COMMENT ON COLUMN ee_enrollments.created_at IS 'Дата и время записи на курс';
+COMMENT ON COLUMN ee_enrollments.updated_at IS 'Дата и время последнего изменения записи';
@@ -0,0 +1,14 @@
+-- Заявки и лист ожидания не имеют аналога в прежней схеме
+DELETE FROM ee_enrollments WHERE status IN ('pending', 'waitlisted');
+
+DROP INDEX IF EXISTS idx_enrollments_waitlist;
+
+ALTER TABLE ee_enrollments
+    DROP COLUMN waitlisted_at,
+    DROP CONSTRAINT ee_enrollments_status_check,
+    ADD CONSTRAINT ee_enrollments_status_check CHECK (status IN ('active', 'completed', 'dropped', 'expired'));
+
+ALTER TABLE ee_courses
+    DROP COLUMN enrollment_policy,
+    DROP COLUMN enrollment_key,
+    DROP COLUMN capacity;
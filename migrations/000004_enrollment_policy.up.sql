@@ -0,0 +1,20 @@
+-- Политика записи и вместимость курса
+ALTER TABLE ee_courses
+    ADD COLUMN enrollment_policy VARCHAR(32) NOT NULL DEFAULT 'approval',
+    ADD COLUMN enrollment_key VARCHAR(255),
+    ADD COLUMN capacity INTEGER NOT NULL DEFAULT 0,
+    ADD CONSTRAINT ee_courses_enrollment_policy_check CHECK (enrollment_policy IN ('open', 'approval', 'key')),
+    ADD CONSTRAINT ee_courses_capacity_check CHECK (capacity >= 0);
+
+-- Заявки на одобрение и лист ожидания
+ALTER TABLE ee_enrollments
+    ADD COLUMN waitlisted_at TIMESTAMP WITH TIME ZONE,
+    DROP CONSTRAINT ee_enrollments_status_check,
+    ADD CONSTRAINT ee_enrollments_status_check CHECK (status IN ('active', 'completed', 'dropped', 'expired', 'pending', 'waitlisted'));
+
+CREATE INDEX idx_enrollments_waitlist ON ee_enrollments(course_id, waitlisted_at) WHERE status = 'waitlisted';
+
+COMMENT ON COLUMN ee_courses.enrollment_policy IS 'Политика записи: open, approval, key';
+COMMENT ON COLUMN ee_courses.enrollment_key IS 'Кодовое слово для записи при политике key';
+COMMENT ON COLUMN ee_courses.capacity IS 'Количество мест для студентов, 0 - без ограничений';
+COMMENT ON COLUMN ee_enrollments.waitlisted_at IS 'Дата и время постановки в лист ожидания, определяет очередь';
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_enrollments_cohort;
+
+ALTER TABLE ee_enrollments DROP COLUMN IF EXISTS cohort_id;
+
+-- Удаление таблицы преподавателей потоков
+DROP TABLE IF EXISTS ee_cohort_instructors;
+
+-- Удаление таблицы потоков
+DROP TABLE IF EXISTS ee_cohorts;
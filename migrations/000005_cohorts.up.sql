@@ -0,0 +1,43 @@
+-- Создание таблицы потоков курса
+CREATE TABLE ee_cohorts (
+    cohort_id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES ee_courses(course_id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    enrollment_opens_at TIMESTAMP WITH TIME ZONE,
+    enrollment_closes_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ee_cohorts_dates_check CHECK (ends_at IS NULL OR starts_at IS NULL OR ends_at > starts_at),
+    CONSTRAINT ee_cohorts_enrollment_check CHECK (enrollment_closes_at IS NULL OR enrollment_opens_at IS NULL OR enrollment_closes_at > enrollment_opens_at)
+);
+
+CREATE INDEX idx_cohorts_course ON ee_cohorts(course_id);
+
+-- Создание таблицы преподавателей потоков
+CREATE TABLE ee_cohort_instructors (
+    cohort_id INTEGER REFERENCES ee_cohorts(cohort_id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    PRIMARY KEY (cohort_id, user_id)
+);
+
+-- Поток, в котором учится участник курса
+ALTER TABLE ee_enrollments ADD COLUMN cohort_id INTEGER REFERENCES ee_cohorts(cohort_id) ON DELETE SET NULL;
+
+CREATE INDEX idx_enrollments_cohort ON ee_enrollments(cohort_id);
+
+-- Комментарии для таблицы Cohorts
+COMMENT ON TABLE ee_cohorts IS 'Потоки курса: группы студентов с собственным расписанием';
+COMMENT ON COLUMN ee_cohorts.cohort_id IS 'Уникальный идентификатор потока';
+COMMENT ON COLUMN ee_cohorts.course_id IS 'Идентификатор курса, к которому относится поток';
+COMMENT ON COLUMN ee_cohorts.title IS 'Название потока';
+COMMENT ON COLUMN ee_cohorts.starts_at IS 'Дата и время начала обучения потока';
+COMMENT ON COLUMN ee_cohorts.ends_at IS 'Дата и время окончания обучения потока';
+COMMENT ON COLUMN ee_cohorts.enrollment_opens_at IS 'Начало приёма заявок в поток';
+COMMENT ON COLUMN ee_cohorts.enrollment_closes_at IS 'Окончание приёма заявок в поток';
+COMMENT ON COLUMN ee_cohorts.created_at IS 'Дата и время создания потока';
+COMMENT ON COLUMN ee_cohorts.updated_at IS 'Дата и время последнего обновления потока';
+
+COMMENT ON TABLE ee_cohort_instructors IS 'Преподаватели, ведущие поток';
+COMMENT ON COLUMN ee_enrollments.cohort_id IS 'Идентификатор потока участника';
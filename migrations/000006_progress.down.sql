@@ -0,0 +1,9 @@
+ALTER TABLE ee_enrollments DROP COLUMN IF EXISTS completed_at;
+
+ALTER TABLE ee_courses
+    DROP COLUMN completion_requires_lessons,
+    DROP COLUMN completion_requires_quizzes,
+    DROP COLUMN quiz_pass_percent;
+
+-- Удаление таблицы прогресса по урокам
+DROP TABLE IF EXISTS ee_lesson_progress;
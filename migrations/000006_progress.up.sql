@@ -0,0 +1,33 @@
+-- Создание таблицы прогресса по урокам
+CREATE TABLE ee_lesson_progress (
+    user_id INTEGER REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    lesson_id INTEGER REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, lesson_id)
+);
+
+CREATE INDEX idx_lesson_progress_lesson ON ee_lesson_progress(lesson_id);
+
+-- Правила завершения курса
+ALTER TABLE ee_courses
+    ADD COLUMN completion_requires_lessons BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN completion_requires_quizzes BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN quiz_pass_percent INTEGER NOT NULL DEFAULT 60,
+    ADD CONSTRAINT ee_courses_quiz_pass_percent_check CHECK (quiz_pass_percent BETWEEN 0 AND 100);
+
+ALTER TABLE ee_enrollments ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+
+-- Комментарии для таблицы LessonProgress
+COMMENT ON TABLE ee_lesson_progress IS 'Прогресс пользователей по урокам';
+COMMENT ON COLUMN ee_lesson_progress.user_id IS 'Идентификатор пользователя';
+COMMENT ON COLUMN ee_lesson_progress.lesson_id IS 'Идентификатор урока';
+COMMENT ON COLUMN ee_lesson_progress.started_at IS 'Дата и время первого открытия урока';
+COMMENT ON COLUMN ee_lesson_progress.completed_at IS 'Дата и время завершения урока';
+COMMENT ON COLUMN ee_lesson_progress.last_seen_at IS 'Дата и время последнего просмотра урока';
+
+COMMENT ON COLUMN ee_courses.completion_requires_lessons IS 'Для завершения курса нужно пройти все уроки';
+COMMENT ON COLUMN ee_courses.completion_requires_quizzes IS 'Для завершения курса нужно сдать все тесты';
+COMMENT ON COLUMN ee_courses.quiz_pass_percent IS 'Процент верных ответов, при котором тест считается сданным';
+COMMENT ON COLUMN ee_enrollments.completed_at IS 'Дата и время завершения курса участником';
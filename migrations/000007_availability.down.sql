@@ -0,0 +1,7 @@
+ALTER TABLE ee_lessons
+    DROP COLUMN available_from,
+    DROP COLUMN available_after_days;
+
+ALTER TABLE ee_course_sections
+    DROP COLUMN available_from,
+    DROP COLUMN available_after_days;
@@ -0,0 +1,15 @@
+-- Правила открытия разделов и уроков
+ALTER TABLE ee_course_sections
+    ADD COLUMN available_from TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN available_after_days INTEGER,
+    ADD CONSTRAINT ee_course_sections_available_after_days_check CHECK (available_after_days >= 0);
+
+ALTER TABLE ee_lessons
+    ADD COLUMN available_from TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN available_after_days INTEGER,
+    ADD CONSTRAINT ee_lessons_available_after_days_check CHECK (available_after_days >= 0);
+
+COMMENT ON COLUMN ee_course_sections.available_from IS 'Дата и время, с которых раздел доступен студентам';
+COMMENT ON COLUMN ee_course_sections.available_after_days IS 'Через сколько дней после начала обучения открывается раздел';
+COMMENT ON COLUMN ee_lessons.available_from IS 'Дата и время, с которых урок доступен студентам';
+COMMENT ON COLUMN ee_lessons.available_after_days IS 'Через сколько дней после начала обучения открывается урок';
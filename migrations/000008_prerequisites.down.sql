@@ -0,0 +1,2 @@
+-- Удаление таблицы предварительных условий
+DROP TABLE IF EXISTS ee_prerequisites;
@@ -0,0 +1,26 @@
+-- Создание таблицы предварительных условий
+CREATE TABLE ee_prerequisites (
+    prerequisite_id SERIAL PRIMARY KEY,
+    lesson_id INTEGER REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    section_id INTEGER REFERENCES ee_course_sections(section_id) ON DELETE CASCADE,
+    required_lesson_id INTEGER REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    required_quiz_id INTEGER REFERENCES ee_quizzes(quiz_id) ON DELETE CASCADE,
+    min_score INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ee_prerequisites_target_check CHECK ((lesson_id IS NULL) <> (section_id IS NULL)),
+    CONSTRAINT ee_prerequisites_requirement_check CHECK ((required_lesson_id IS NULL) <> (required_quiz_id IS NULL)),
+    CONSTRAINT ee_prerequisites_min_score_check CHECK (min_score BETWEEN 0 AND 100)
+);
+
+CREATE INDEX idx_prerequisites_lesson ON ee_prerequisites(lesson_id);
+CREATE INDEX idx_prerequisites_section ON ee_prerequisites(section_id);
+
+-- Комментарии для таблицы Prerequisites
+COMMENT ON TABLE ee_prerequisites IS 'Условия открытия уроков и разделов';
+COMMENT ON COLUMN ee_prerequisites.prerequisite_id IS 'Уникальный идентификатор условия';
+COMMENT ON COLUMN ee_prerequisites.lesson_id IS 'Урок, который открывается по условию';
+COMMENT ON COLUMN ee_prerequisites.section_id IS 'Раздел, который открывается по условию';
+COMMENT ON COLUMN ee_prerequisites.required_lesson_id IS 'Урок, который нужно завершить';
+COMMENT ON COLUMN ee_prerequisites.required_quiz_id IS 'Тест, который нужно сдать';
+COMMENT ON COLUMN ee_prerequisites.min_score IS 'Минимальный процент верных ответов в тесте';
+COMMENT ON COLUMN ee_prerequisites.created_at IS 'Дата и время создания условия';
@@ -0,0 +1,4 @@
+COMMENT ON COLUMN ee_lessons.content_text IS 'Текстовое содержимое урока, если применимо';
+
+-- Удаление таблицы блоков содержимого уроков
+DROP TABLE IF EXISTS ee_lesson_blocks;
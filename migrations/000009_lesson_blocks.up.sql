@@ -0,0 +1,30 @@
+-- Создание таблицы блоков содержимого уроков
+CREATE TABLE ee_lesson_blocks (
+    block_id SERIAL PRIMARY KEY,
+    lesson_id INTEGER NOT NULL REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    type VARCHAR(32) NOT NULL,
+    "order" INTEGER NOT NULL,
+    data JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ee_lesson_blocks_type_check CHECK (type IN ('text', 'code', 'image', 'embed', 'callout', 'quiz'))
+);
+
+CREATE INDEX idx_lesson_blocks_lesson ON ee_lesson_blocks(lesson_id, "order");
+
+-- Существующий текст уроков становится первым текстовым блоком
+INSERT INTO ee_lesson_blocks (lesson_id, type, "order", data)
+SELECT lesson_id, 'text', 0, jsonb_build_object('format', 'html', 'text', content_text)
+FROM ee_lessons
+WHERE content_text IS NOT NULL AND content_text <> '';
+
+-- Комментарии для таблицы LessonBlocks
+COMMENT ON TABLE ee_lesson_blocks IS 'Блоки содержимого уроков';
+COMMENT ON COLUMN ee_lesson_blocks.block_id IS 'Уникальный идентификатор блока';
+COMMENT ON COLUMN ee_lesson_blocks.lesson_id IS 'Идентификатор урока';
+COMMENT ON COLUMN ee_lesson_blocks.type IS 'Тип блока: text, code, image, embed, callout, quiz';
+COMMENT ON COLUMN ee_lesson_blocks."order" IS 'Порядковый номер блока в уроке';
+COMMENT ON COLUMN ee_lesson_blocks.data IS 'Содержимое блока, структура зависит от типа';
+COMMENT ON COLUMN ee_lesson_blocks.created_at IS 'Дата и время создания блока';
+COMMENT ON COLUMN ee_lesson_blocks.updated_at IS 'Дата и время последнего обновления блока';
+COMMENT ON COLUMN ee_lessons.content_text IS 'Устаревшее поле, содержимое урока хранится в ee_lesson_blocks';
@@ -0,0 +1,14 @@
+ALTER TABLE ee_lessons DROP CONSTRAINT IF EXISTS ee_lessons_video_id_fkey;
+
+-- Удаление таблицы субтитров
+DROP TABLE IF EXISTS ee_video_captions;
+
+ALTER TABLE ee_videos
+    DROP CONSTRAINT ee_videos_lesson_id_fkey,
+    ADD CONSTRAINT ee_videos_lesson_id_fkey FOREIGN KEY (lesson_id) REFERENCES ee_lessons(lesson_id),
+    DROP COLUMN provider,
+    DROP COLUMN external_id,
+    DROP COLUMN title,
+    DROP COLUMN duration,
+    DROP COLUMN poster_url,
+    ALTER COLUMN url TYPE VARCHAR(255);
@@ -0,0 +1,49 @@
+-- Сведения о видеохостинге, длительность и обложка
+ALTER TABLE ee_videos
+    ALTER COLUMN url TYPE VARCHAR(1024),
+    ADD COLUMN provider VARCHAR(32) NOT NULL DEFAULT 'self_hosted',
+    ADD COLUMN external_id VARCHAR(255),
+    ADD COLUMN title VARCHAR(255),
+    ADD COLUMN duration INTEGER,
+    ADD COLUMN poster_url VARCHAR(1024),
+    ADD CONSTRAINT ee_videos_provider_check CHECK (provider IN ('self_hosted', 'youtube', 'rutube', 'vk')),
+    ADD CONSTRAINT ee_videos_duration_check CHECK (duration >= 0),
+    DROP CONSTRAINT ee_videos_lesson_id_fkey,
+    ADD CONSTRAINT ee_videos_lesson_id_fkey FOREIGN KEY (lesson_id) REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE;
+
+-- Создание таблицы субтитров
+CREATE TABLE ee_video_captions (
+    caption_id SERIAL PRIMARY KEY,
+    video_id INTEGER NOT NULL REFERENCES ee_videos(video_id) ON DELETE CASCADE,
+    language VARCHAR(16) NOT NULL,
+    label VARCHAR(255) NOT NULL,
+    url VARCHAR(1024) NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (video_id, language)
+);
+
+-- Ссылка урока на видео должна совпадать с ee_videos.lesson_id
+UPDATE ee_lessons SET video_id = NULL;
+UPDATE ee_lessons SET video_id = ee_videos.video_id FROM ee_videos WHERE ee_videos.lesson_id = ee_lessons.lesson_id;
+
+ALTER TABLE ee_lessons
+    ADD CONSTRAINT ee_lessons_video_id_fkey FOREIGN KEY (video_id) REFERENCES ee_videos(video_id) ON DELETE SET NULL;
+
+COMMENT ON COLUMN ee_videos.provider IS 'Видеохостинг: self_hosted, youtube, rutube, vk';
+COMMENT ON COLUMN ee_videos.external_id IS 'Идентификатор видео на видеохостинге';
+COMMENT ON COLUMN ee_videos.title IS 'Название видео';
+COMMENT ON COLUMN ee_videos.duration IS 'Длительность видео в секундах';
+COMMENT ON COLUMN ee_videos.poster_url IS 'URL обложки видео';
+
+-- Комментарии для таблицы VideoCaptions
+COMMENT ON TABLE ee_video_captions IS 'Дорожки субтитров видео';
+COMMENT ON COLUMN ee_video_captions.caption_id IS 'Уникальный идентификатор дорожки';
+COMMENT ON COLUMN ee_video_captions.video_id IS 'Идентификатор видео';
+COMMENT ON COLUMN ee_video_captions.language IS 'Язык дорожки (BCP 47), например ru или en';
+COMMENT ON COLUMN ee_video_captions.label IS 'Название дорожки для плеера';
+COMMENT ON COLUMN ee_video_captions.url IS 'URL файла субтитров WebVTT';
+COMMENT ON COLUMN ee_video_captions.is_default IS 'Дорожка включается по умолчанию';
+COMMENT ON COLUMN ee_video_captions.created_at IS 'Дата и время создания дорожки';
+COMMENT ON COLUMN ee_video_captions.updated_at IS 'Дата и время последнего обновления дорожки';
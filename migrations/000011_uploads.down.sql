@@ -0,0 +1,4 @@
+ALTER TABLE ee_videos DROP COLUMN IF EXISTS upload_id;
+
+-- Удаление таблицы загрузок
+DROP TABLE IF EXISTS ee_uploads;
@@ -0,0 +1,46 @@
+-- Создание таблицы загрузок файлов
+CREATE TABLE ee_uploads (
+    upload_id VARCHAR(36) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    course_id INTEGER NOT NULL REFERENCES ee_courses(course_id) ON DELETE CASCADE,
+    lesson_id INTEGER REFERENCES ee_lessons(lesson_id) ON DELETE SET NULL,
+    purpose VARCHAR(32) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    received BIGINT NOT NULL DEFAULT 0,
+    sha256 CHAR(64),
+    blob_key VARCHAR(1024),
+    status VARCHAR(16) NOT NULL DEFAULT 'uploading',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT ee_uploads_purpose_check CHECK (purpose IN ('video', 'attachment')),
+    CONSTRAINT ee_uploads_status_check CHECK (status IN ('uploading', 'complete')),
+    CONSTRAINT ee_uploads_received_check CHECK (received >= 0 AND received <= size)
+);
+
+CREATE INDEX idx_uploads_user ON ee_uploads(user_id);
+
+-- Видео может ссылаться на загруженный файл
+ALTER TABLE ee_videos
+    ADD COLUMN upload_id VARCHAR(36) REFERENCES ee_uploads(upload_id) ON DELETE SET NULL;
+
+-- Комментарии для таблицы Uploads
+COMMENT ON TABLE ee_uploads IS 'Возобновляемые загрузки файлов в хранилище (протокол tus)';
+COMMENT ON COLUMN ee_uploads.upload_id IS 'Уникальный идентификатор загрузки (UUID)';
+COMMENT ON COLUMN ee_uploads.user_id IS 'Идентификатор пользователя, загружающего файл';
+COMMENT ON COLUMN ee_uploads.course_id IS 'Идентификатор курса, к которому относится файл';
+COMMENT ON COLUMN ee_uploads.lesson_id IS 'Идентификатор урока, к которому относится файл';
+COMMENT ON COLUMN ee_uploads.purpose IS 'Назначение файла: video, attachment';
+COMMENT ON COLUMN ee_uploads.filename IS 'Исходное имя файла';
+COMMENT ON COLUMN ee_uploads.mime_type IS 'MIME-тип файла';
+COMMENT ON COLUMN ee_uploads.size IS 'Объявленный размер файла в байтах';
+COMMENT ON COLUMN ee_uploads.received IS 'Количество уже полученных байт';
+COMMENT ON COLUMN ee_uploads.sha256 IS 'Контрольная сумма SHA-256 файла в hex';
+COMMENT ON COLUMN ee_uploads.blob_key IS 'Ключ файла в хранилище после завершения загрузки';
+COMMENT ON COLUMN ee_uploads.status IS 'Состояние загрузки: uploading, complete';
+COMMENT ON COLUMN ee_uploads.created_at IS 'Дата и время начала загрузки';
+COMMENT ON COLUMN ee_uploads.updated_at IS 'Дата и время получения последней части';
+COMMENT ON COLUMN ee_uploads.completed_at IS 'Дата и время завершения загрузки';
+COMMENT ON COLUMN ee_videos.upload_id IS 'Идентификатор загрузки, если видео хранится у нас';
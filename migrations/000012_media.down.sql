@@ -0,0 +1,4 @@
+-- Удаление журнала доступа к медиафайлам
+DROP TABLE IF EXISTS ee_media_access_log;
+
+ALTER TABLE ee_courses DROP COLUMN IF EXISTS media_download_policy;
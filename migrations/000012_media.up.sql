@@ -0,0 +1,40 @@
+-- Политика скачивания медиафайлов курса
+ALTER TABLE ee_courses
+    ADD COLUMN media_download_policy VARCHAR(16) NOT NULL DEFAULT 'stream_only',
+    ADD CONSTRAINT ee_courses_media_download_policy_check CHECK (media_download_policy IN ('allow', 'stream_only', 'none'));
+
+-- Создание журнала доступа к медиафайлам
+CREATE TABLE ee_media_access_log (
+    log_id BIGSERIAL PRIMARY KEY,
+    upload_id VARCHAR(36) REFERENCES ee_uploads(upload_id) ON DELETE SET NULL,
+    course_id INTEGER NOT NULL REFERENCES ee_courses(course_id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES ee_users(user_id) ON DELETE SET NULL,
+    action VARCHAR(16) NOT NULL,
+    download BOOLEAN NOT NULL DEFAULT FALSE,
+    range_start BIGINT,
+    range_end BIGINT,
+    status INTEGER NOT NULL,
+    ip VARCHAR(64),
+    user_agent VARCHAR(512),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ee_media_access_log_action_check CHECK (action IN ('issue', 'stream'))
+);
+
+CREATE INDEX idx_media_access_log_course ON ee_media_access_log(course_id, created_at);
+
+COMMENT ON COLUMN ee_courses.media_download_policy IS 'Скачивание медиафайлов: allow - всё, stream_only - видео только просмотр, none - только просмотр';
+
+-- Комментарии для таблицы MediaAccessLog
+COMMENT ON TABLE ee_media_access_log IS 'Журнал выдачи подписанных ссылок и обращений к медиафайлам';
+COMMENT ON COLUMN ee_media_access_log.log_id IS 'Уникальный идентификатор записи';
+COMMENT ON COLUMN ee_media_access_log.upload_id IS 'Идентификатор загруженного файла';
+COMMENT ON COLUMN ee_media_access_log.course_id IS 'Идентификатор курса';
+COMMENT ON COLUMN ee_media_access_log.user_id IS 'Идентификатор пользователя, которому выдана ссылка';
+COMMENT ON COLUMN ee_media_access_log.action IS 'Действие: issue - выдача ссылки, stream - обращение по ссылке';
+COMMENT ON COLUMN ee_media_access_log.download IS 'Файл запрошен для скачивания, а не просмотра';
+COMMENT ON COLUMN ee_media_access_log.range_start IS 'Начало запрошенного диапазона байт';
+COMMENT ON COLUMN ee_media_access_log.range_end IS 'Конец запрошенного диапазона байт включительно';
+COMMENT ON COLUMN ee_media_access_log.status IS 'HTTP статус ответа';
+COMMENT ON COLUMN ee_media_access_log.ip IS 'IP адрес клиента';
+COMMENT ON COLUMN ee_media_access_log.user_agent IS 'User-Agent клиента';
+COMMENT ON COLUMN ee_media_access_log.created_at IS 'Дата и время обращения';
@@ -0,0 +1,8 @@
+DELETE FROM ee_media_access_log WHERE action = 'archive';
+
+ALTER TABLE ee_media_access_log
+    DROP CONSTRAINT ee_media_access_log_action_check,
+    ADD CONSTRAINT ee_media_access_log_action_check CHECK (action IN ('issue', 'stream'));
+
+-- Удаление таблицы вложений
+DROP TABLE IF EXISTS ee_attachments;
@@ -0,0 +1,32 @@
+-- Создание таблицы вложений уроков и курсов
+CREATE TABLE ee_attachments (
+    attachment_id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES ee_courses(course_id) ON DELETE CASCADE,
+    lesson_id INTEGER REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    upload_id VARCHAR(36) NOT NULL UNIQUE REFERENCES ee_uploads(upload_id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    "order" INTEGER NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_attachments_scope ON ee_attachments(course_id, lesson_id, "order");
+
+-- Скачивание вложений архивом тоже попадает в журнал доступа
+ALTER TABLE ee_media_access_log
+    DROP CONSTRAINT ee_media_access_log_action_check,
+    ADD CONSTRAINT ee_media_access_log_action_check CHECK (action IN ('issue', 'stream', 'archive'));
+
+-- Комментарии для таблицы Attachments
+COMMENT ON TABLE ee_attachments IS 'Вложения уроков и курсов: методички, слайды, наборы данных, изображения';
+COMMENT ON COLUMN ee_attachments.attachment_id IS 'Уникальный идентификатор вложения';
+COMMENT ON COLUMN ee_attachments.course_id IS 'Идентификатор курса';
+COMMENT ON COLUMN ee_attachments.lesson_id IS 'Идентификатор урока, NULL - вложение всего курса';
+COMMENT ON COLUMN ee_attachments.upload_id IS 'Идентификатор загруженного файла';
+COMMENT ON COLUMN ee_attachments.title IS 'Название вложения';
+COMMENT ON COLUMN ee_attachments.description IS 'Описание вложения';
+COMMENT ON COLUMN ee_attachments."order" IS 'Порядковый номер вложения в уроке или курсе';
+COMMENT ON COLUMN ee_attachments.created_at IS 'Дата и время добавления вложения';
+COMMENT ON COLUMN ee_attachments.updated_at IS 'Дата и время последнего обновления вложения';
+COMMENT ON COLUMN ee_media_access_log.action IS 'Действие: issue - выдача ссылки, stream - обращение по ссылке, archive - скачивание архивом';
@@ -0,0 +1,8 @@
+-- Удаление таблицы жалоб на комментарии
+DROP TABLE IF EXISTS ee_comment_reports;
+
+-- Удаление таблицы реакций на комментарии
+DROP TABLE IF EXISTS ee_comment_reactions;
+
+-- Удаление таблицы комментариев
+DROP TABLE IF EXISTS ee_comments;
@@ -0,0 +1,89 @@
+-- Создание таблицы комментариев к урокам
+CREATE TABLE ee_comments (
+    comment_id SERIAL PRIMARY KEY,
+    lesson_id INTEGER NOT NULL REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES ee_users(user_id) ON DELETE SET NULL,
+    parent_id INTEGER REFERENCES ee_comments(comment_id) ON DELETE CASCADE,
+    root_id INTEGER REFERENCES ee_comments(comment_id) ON DELETE CASCADE,
+    depth INTEGER NOT NULL DEFAULT 0,
+    body TEXT NOT NULL,
+    is_staff BOOLEAN NOT NULL DEFAULT FALSE,
+    is_pinned BOOLEAN NOT NULL DEFAULT FALSE,
+    is_accepted BOOLEAN NOT NULL DEFAULT FALSE,
+    is_hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    is_locked BOOLEAN NOT NULL DEFAULT FALSE,
+    edited_at TIMESTAMP WITH TIME ZONE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ee_comments_thread_check CHECK ((parent_id IS NULL) = (root_id IS NULL))
+);
+
+CREATE INDEX idx_comments_lesson ON ee_comments(lesson_id, comment_id) WHERE parent_id IS NULL;
+CREATE INDEX idx_comments_root ON ee_comments(root_id, comment_id);
+
+-- В ветке может быть только один принятый ответ
+CREATE UNIQUE INDEX idx_comments_accepted ON ee_comments(root_id) WHERE is_accepted;
+
+-- Создание таблицы реакций на комментарии
+CREATE TABLE ee_comment_reactions (
+    comment_id INTEGER NOT NULL REFERENCES ee_comments(comment_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    reaction VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id, reaction),
+    CONSTRAINT ee_comment_reactions_reaction_check CHECK (reaction IN ('like', 'thanks', 'insightful', 'confused'))
+);
+
+-- Создание таблицы жалоб на комментарии
+CREATE TABLE ee_comment_reports (
+    report_id SERIAL PRIMARY KEY,
+    comment_id INTEGER NOT NULL REFERENCES ee_comments(comment_id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES ee_users(user_id) ON DELETE SET NULL,
+    reason VARCHAR(32) NOT NULL,
+    details TEXT,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolved_by INTEGER REFERENCES ee_users(user_id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (comment_id, user_id),
+    CONSTRAINT ee_comment_reports_reason_check CHECK (reason IN ('spam', 'abuse', 'off_topic', 'other'))
+);
+
+CREATE INDEX idx_comment_reports_open ON ee_comment_reports(comment_id) WHERE resolved_at IS NULL;
+
+-- Комментарии для таблицы Comments
+COMMENT ON TABLE ee_comments IS 'Обсуждения уроков: вопросы, ответы и комментарии';
+COMMENT ON COLUMN ee_comments.comment_id IS 'Уникальный идентификатор комментария';
+COMMENT ON COLUMN ee_comments.lesson_id IS 'Идентификатор урока';
+COMMENT ON COLUMN ee_comments.user_id IS 'Идентификатор автора';
+COMMENT ON COLUMN ee_comments.parent_id IS 'Комментарий, на который дан ответ, NULL - начало ветки';
+COMMENT ON COLUMN ee_comments.root_id IS 'Первый комментарий ветки, NULL - начало ветки';
+COMMENT ON COLUMN ee_comments.depth IS 'Уровень вложенности, 0 - начало ветки';
+COMMENT ON COLUMN ee_comments.body IS 'Текст комментария в Markdown';
+COMMENT ON COLUMN ee_comments.is_staff IS 'Автор был преподавателем курса в момент публикации';
+COMMENT ON COLUMN ee_comments.is_pinned IS 'Ветка закреплена преподавателем';
+COMMENT ON COLUMN ee_comments.is_accepted IS 'Ответ отмечен как решение вопроса';
+COMMENT ON COLUMN ee_comments.is_hidden IS 'Комментарий скрыт модератором';
+COMMENT ON COLUMN ee_comments.is_locked IS 'Ветка закрыта для новых ответов';
+COMMENT ON COLUMN ee_comments.edited_at IS 'Дата и время последнего редактирования текста';
+COMMENT ON COLUMN ee_comments.deleted_at IS 'Дата и время удаления, текст удалённого комментария не хранится';
+COMMENT ON COLUMN ee_comments.created_at IS 'Дата и время публикации';
+COMMENT ON COLUMN ee_comments.updated_at IS 'Дата и время последнего изменения';
+
+-- Комментарии для таблицы CommentReactions
+COMMENT ON TABLE ee_comment_reactions IS 'Реакции пользователей на комментарии';
+COMMENT ON COLUMN ee_comment_reactions.comment_id IS 'Идентификатор комментария';
+COMMENT ON COLUMN ee_comment_reactions.user_id IS 'Идентификатор пользователя';
+COMMENT ON COLUMN ee_comment_reactions.reaction IS 'Реакция: like, thanks, insightful, confused';
+COMMENT ON COLUMN ee_comment_reactions.created_at IS 'Дата и время реакции';
+
+-- Комментарии для таблицы CommentReports
+COMMENT ON TABLE ee_comment_reports IS 'Жалобы на комментарии для модерации';
+COMMENT ON COLUMN ee_comment_reports.report_id IS 'Уникальный идентификатор жалобы';
+COMMENT ON COLUMN ee_comment_reports.comment_id IS 'Идентификатор комментария';
+COMMENT ON COLUMN ee_comment_reports.user_id IS 'Идентификатор пожаловавшегося пользователя';
+COMMENT ON COLUMN ee_comment_reports.reason IS 'Причина: spam, abuse, off_topic, other';
+COMMENT ON COLUMN ee_comment_reports.details IS 'Пояснение к жалобе';
+COMMENT ON COLUMN ee_comment_reports.resolved_at IS 'Дата и время рассмотрения жалобы';
+COMMENT ON COLUMN ee_comment_reports.resolved_by IS 'Идентификатор рассмотревшего модератора';
+COMMENT ON COLUMN ee_comment_reports.created_at IS 'Дата и время жалобы';
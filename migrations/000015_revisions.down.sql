@@ -0,0 +1,2 @@
+-- Удаление журнала правок
+DROP TABLE IF EXISTS ee_revisions;
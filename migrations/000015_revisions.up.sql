@@ -0,0 +1,23 @@
+-- Создание журнала правок уроков, разделов и курсов
+CREATE TABLE ee_revisions (
+    revision_id SERIAL PRIMARY KEY,
+    entity VARCHAR(16) NOT NULL CHECK (entity IN ('course', 'section', 'lesson')),
+    entity_id INTEGER NOT NULL,
+    number INTEGER NOT NULL,
+    user_id INTEGER REFERENCES ee_users(user_id) ON DELETE SET NULL,
+    summary TEXT NOT NULL DEFAULT '',
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (entity, entity_id, number)
+);
+
+-- Комментарии для таблицы Revisions
+COMMENT ON TABLE ee_revisions IS 'Журнал правок: каждая запись хранит полное состояние отслеживаемых полей, записи только добавляются';
+COMMENT ON COLUMN ee_revisions.revision_id IS 'Уникальный идентификатор правки';
+COMMENT ON COLUMN ee_revisions.entity IS 'Тип объекта: course, section или lesson';
+COMMENT ON COLUMN ee_revisions.entity_id IS 'Идентификатор курса, раздела или урока';
+COMMENT ON COLUMN ee_revisions.number IS 'Порядковый номер правки объекта, начиная с 1';
+COMMENT ON COLUMN ee_revisions.user_id IS 'Автор правки, NULL - исходное состояние до ведения журнала';
+COMMENT ON COLUMN ee_revisions.summary IS 'Описание изменения';
+COMMENT ON COLUMN ee_revisions.snapshot IS 'Значения отслеживаемых полей после правки';
+COMMENT ON COLUMN ee_revisions.created_at IS 'Дата и время правки';
@@ -0,0 +1,6 @@
+-- Удаление таблицы блокировок редактирования
+DROP TABLE IF EXISTS ee_edit_locks;
+
+-- Удаление версий
+ALTER TABLE ee_lessons DROP COLUMN IF EXISTS version;
+ALTER TABLE ee_courses DROP COLUMN IF EXISTS version;
@@ -0,0 +1,26 @@
+-- Версии для оптимистической блокировки при правке
+ALTER TABLE ee_courses ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE ee_lessons ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+COMMENT ON COLUMN ee_courses.version IS 'Версия курса, растёт при каждой правке и передаётся в ETag';
+COMMENT ON COLUMN ee_lessons.version IS 'Версия урока, растёт при каждой правке и передаётся в ETag';
+
+-- Создание таблицы отметок о том, кто сейчас редактирует объект
+CREATE TABLE ee_edit_locks (
+    entity VARCHAR(16) NOT NULL CHECK (entity IN ('course', 'lesson')),
+    entity_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    acquired_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    heartbeat_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (entity, entity_id)
+);
+
+-- Комментарии для таблицы EditLocks
+COMMENT ON TABLE ee_edit_locks IS 'Мягкие блокировки редактирования: только показывают другим редакторам, кто правит объект';
+COMMENT ON COLUMN ee_edit_locks.entity IS 'Тип объекта: course или lesson';
+COMMENT ON COLUMN ee_edit_locks.entity_id IS 'Идентификатор курса или урока';
+COMMENT ON COLUMN ee_edit_locks.user_id IS 'Кто редактирует объект';
+COMMENT ON COLUMN ee_edit_locks.acquired_at IS 'Когда редактор начал правку';
+COMMENT ON COLUMN ee_edit_locks.heartbeat_at IS 'Последний сигнал от редактора';
+COMMENT ON COLUMN ee_edit_locks.expires_at IS 'Когда блокировка освободится без новых сигналов';
@@ -0,0 +1,5 @@
+-- Удаление таблицы заметок
+DROP TABLE IF EXISTS ee_notes;
+
+-- Удаление таблицы закладок
+DROP TABLE IF EXISTS ee_bookmarks;
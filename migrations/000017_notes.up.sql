@@ -0,0 +1,51 @@
+-- Создание таблицы закладок на уроки
+CREATE TABLE ee_bookmarks (
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    lesson_id INTEGER NOT NULL REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, lesson_id)
+);
+
+-- Создание таблицы личных заметок к урокам
+CREATE TABLE ee_notes (
+    note_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    lesson_id INTEGER NOT NULL REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    anchor_type VARCHAR(16) NOT NULL DEFAULT 'none' CHECK (anchor_type IN ('none', 'text', 'video')),
+    block_id INTEGER REFERENCES ee_lesson_blocks(block_id) ON DELETE SET NULL,
+    anchor_start INTEGER,
+    anchor_end INTEGER,
+    anchor_quote TEXT NOT NULL DEFAULT '',
+    video_time DOUBLE PRECISION,
+    search TSVECTOR GENERATED ALWAYS AS (to_tsvector('russian', anchor_quote || ' ' || body)) STORED,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (anchor_type <> 'text' OR (anchor_start >= 0 AND anchor_end >= anchor_start)),
+    CHECK (anchor_type <> 'video' OR video_time >= 0)
+);
+
+CREATE INDEX idx_notes_user_lesson ON ee_notes(user_id, lesson_id);
+CREATE INDEX idx_notes_search ON ee_notes USING GIN(search);
+
+-- Комментарии для таблицы Bookmarks
+COMMENT ON TABLE ee_bookmarks IS 'Закладки пользователей на уроки';
+COMMENT ON COLUMN ee_bookmarks.user_id IS 'Владелец закладки';
+COMMENT ON COLUMN ee_bookmarks.lesson_id IS 'Идентификатор урока';
+COMMENT ON COLUMN ee_bookmarks.created_at IS 'Дата и время добавления закладки';
+
+-- Комментарии для таблицы Notes
+COMMENT ON TABLE ee_notes IS 'Личные заметки к урокам, видны только владельцу';
+COMMENT ON COLUMN ee_notes.note_id IS 'Уникальный идентификатор заметки';
+COMMENT ON COLUMN ee_notes.user_id IS 'Владелец заметки';
+COMMENT ON COLUMN ee_notes.lesson_id IS 'Идентификатор урока';
+COMMENT ON COLUMN ee_notes.body IS 'Текст заметки в Markdown';
+COMMENT ON COLUMN ee_notes.anchor_type IS 'Привязка: none - к уроку целиком, text - к фрагменту текста, video - к моменту видео';
+COMMENT ON COLUMN ee_notes.block_id IS 'Блок урока с фрагментом, NULL - текст урока';
+COMMENT ON COLUMN ee_notes.anchor_start IS 'Начало фрагмента в символах';
+COMMENT ON COLUMN ee_notes.anchor_end IS 'Конец фрагмента в символах';
+COMMENT ON COLUMN ee_notes.anchor_quote IS 'Текст фрагмента на момент создания, чтобы найти его после правки урока';
+COMMENT ON COLUMN ee_notes.video_time IS 'Момент видео в секундах';
+COMMENT ON COLUMN ee_notes.search IS 'Поисковый вектор по тексту заметки и фрагмента';
+COMMENT ON COLUMN ee_notes.created_at IS 'Дата и время создания заметки';
+COMMENT ON COLUMN ee_notes.updated_at IS 'Дата и время последнего изменения заметки';
@@ -0,0 +1,13 @@
+-- Удаление загрузок ответов и возврат ограничения назначения файлов
+DELETE FROM ee_uploads WHERE purpose = 'submission';
+ALTER TABLE ee_uploads
+    DROP CONSTRAINT ee_uploads_purpose_check,
+    ADD CONSTRAINT ee_uploads_purpose_check CHECK (purpose IN ('video', 'attachment'));
+
+-- Удаление таблиц заданий
+DROP TABLE IF EXISTS ee_submission_comments;
+DROP TABLE IF EXISTS ee_submission_scores;
+DROP TABLE IF EXISTS ee_submission_files;
+DROP TABLE IF EXISTS ee_submissions;
+DROP TABLE IF EXISTS ee_assignment_criteria;
+DROP TABLE IF EXISTS ee_assignments;
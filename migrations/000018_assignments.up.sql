@@ -0,0 +1,142 @@
+-- Создание таблицы заданий: урок с заданием сдаётся файлами или текстом
+CREATE TABLE ee_assignments (
+    assignment_id SERIAL PRIMARY KEY,
+    lesson_id INTEGER NOT NULL UNIQUE REFERENCES ee_lessons(lesson_id) ON DELETE CASCADE,
+    instructions TEXT NOT NULL DEFAULT '',
+    due_at TIMESTAMP WITH TIME ZONE,
+    late_policy VARCHAR(16) NOT NULL DEFAULT 'accept' CHECK (late_policy IN ('accept', 'penalty', 'reject')),
+    late_penalty INTEGER NOT NULL DEFAULT 0 CHECK (late_penalty BETWEEN 0 AND 100),
+    late_until TIMESTAMP WITH TIME ZONE,
+    allow_text BOOLEAN NOT NULL DEFAULT TRUE,
+    allow_files BOOLEAN NOT NULL DEFAULT TRUE,
+    allowed_types JSONB NOT NULL DEFAULT '[]',
+    max_files INTEGER NOT NULL DEFAULT 5 CHECK (max_files >= 0),
+    max_attempts INTEGER NOT NULL DEFAULT 0 CHECK (max_attempts >= 0),
+    max_score NUMERIC(7, 2) NOT NULL DEFAULT 100 CHECK (max_score > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (allow_text OR allow_files)
+);
+
+-- Создание таблицы критериев оценивания
+CREATE TABLE ee_assignment_criteria (
+    criterion_id SERIAL PRIMARY KEY,
+    assignment_id INTEGER NOT NULL REFERENCES ee_assignments(assignment_id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    max_points NUMERIC(7, 2) NOT NULL CHECK (max_points > 0),
+    "order" INTEGER NOT NULL
+);
+
+CREATE INDEX idx_assignment_criteria_assignment ON ee_assignment_criteria(assignment_id, "order");
+
+-- Создание таблицы ответов на задания
+CREATE TABLE ee_submissions (
+    submission_id SERIAL PRIMARY KEY,
+    assignment_id INTEGER NOT NULL REFERENCES ee_assignments(assignment_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    text_body TEXT NOT NULL DEFAULT '',
+    late_days INTEGER NOT NULL DEFAULT 0,
+    raw_score NUMERIC(7, 2),
+    penalty NUMERIC(5, 2) NOT NULL DEFAULT 0,
+    score NUMERIC(7, 2),
+    feedback TEXT NOT NULL DEFAULT '',
+    graded_by INTEGER REFERENCES ee_users(user_id) ON DELETE SET NULL,
+    graded_at TIMESTAMP WITH TIME ZONE,
+    released_at TIMESTAMP WITH TIME ZONE,
+    submitted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (assignment_id, user_id, attempt)
+);
+
+CREATE INDEX idx_submissions_inbox ON ee_submissions(assignment_id, graded_at);
+
+-- Создание таблицы файлов ответа
+CREATE TABLE ee_submission_files (
+    submission_id INTEGER NOT NULL REFERENCES ee_submissions(submission_id) ON DELETE CASCADE,
+    upload_id VARCHAR(36) NOT NULL REFERENCES ee_uploads(upload_id) ON DELETE CASCADE,
+    "order" INTEGER NOT NULL,
+    PRIMARY KEY (submission_id, upload_id)
+);
+
+-- Создание таблицы баллов по критериям
+CREATE TABLE ee_submission_scores (
+    submission_id INTEGER NOT NULL REFERENCES ee_submissions(submission_id) ON DELETE CASCADE,
+    criterion_id INTEGER NOT NULL REFERENCES ee_assignment_criteria(criterion_id) ON DELETE CASCADE,
+    points NUMERIC(7, 2) NOT NULL CHECK (points >= 0),
+    comment TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (submission_id, criterion_id)
+);
+
+-- Создание таблицы замечаний преподавателя к месту в ответе
+CREATE TABLE ee_submission_comments (
+    comment_id SERIAL PRIMARY KEY,
+    submission_id INTEGER NOT NULL REFERENCES ee_submissions(submission_id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES ee_users(user_id) ON DELETE SET NULL,
+    upload_id VARCHAR(36) REFERENCES ee_uploads(upload_id) ON DELETE CASCADE,
+    anchor_start INTEGER,
+    anchor_end INTEGER,
+    location VARCHAR(255) NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (anchor_start IS NULL OR (anchor_start >= 0 AND anchor_end >= anchor_start))
+);
+
+CREATE INDEX idx_submission_comments_submission ON ee_submission_comments(submission_id);
+
+-- Студенты загружают файлы ответов
+ALTER TABLE ee_uploads
+    DROP CONSTRAINT ee_uploads_purpose_check,
+    ADD CONSTRAINT ee_uploads_purpose_check CHECK (purpose IN ('video', 'attachment', 'submission'));
+
+-- Комментарии для таблицы Assignments
+COMMENT ON TABLE ee_assignments IS 'Задания: урок, который сдаётся файлами или текстом и оценивается преподавателем';
+COMMENT ON COLUMN ee_assignments.assignment_id IS 'Уникальный идентификатор задания';
+COMMENT ON COLUMN ee_assignments.lesson_id IS 'Урок с заданием';
+COMMENT ON COLUMN ee_assignments.instructions IS 'Условие задания в Markdown';
+COMMENT ON COLUMN ee_assignments.due_at IS 'Срок сдачи, NULL - без срока';
+COMMENT ON COLUMN ee_assignments.late_policy IS 'Сдача после срока: accept - принимается, penalty - со штрафом, reject - не принимается';
+COMMENT ON COLUMN ee_assignments.late_penalty IS 'Штраф в процентах за каждый день опоздания';
+COMMENT ON COLUMN ee_assignments.late_until IS 'Крайний срок для опоздавших, NULL - без ограничения';
+COMMENT ON COLUMN ee_assignments.allow_text IS 'Можно ли сдать ответ текстом';
+COMMENT ON COLUMN ee_assignments.allow_files IS 'Можно ли прикладывать файлы';
+COMMENT ON COLUMN ee_assignments.allowed_types IS 'Допустимые MIME-типы файлов, пустой список - все типы для ответов';
+COMMENT ON COLUMN ee_assignments.max_files IS 'Наибольшее число файлов в одном ответе';
+COMMENT ON COLUMN ee_assignments.max_attempts IS 'Наибольшее число попыток, 0 - без ограничения';
+COMMENT ON COLUMN ee_assignments.max_score IS 'Наибольший балл, если нет критериев';
+COMMENT ON COLUMN ee_assignments.created_at IS 'Дата и время создания задания';
+COMMENT ON COLUMN ee_assignments.updated_at IS 'Дата и время последнего обновления задания';
+
+-- Комментарии для таблицы AssignmentCriteria
+COMMENT ON TABLE ee_assignment_criteria IS 'Критерии оценивания задания (рубрика)';
+COMMENT ON COLUMN ee_assignment_criteria.criterion_id IS 'Уникальный идентификатор критерия';
+COMMENT ON COLUMN ee_assignment_criteria.assignment_id IS 'Идентификатор задания';
+COMMENT ON COLUMN ee_assignment_criteria.title IS 'Название критерия';
+COMMENT ON COLUMN ee_assignment_criteria.description IS 'Что проверяется по критерию';
+COMMENT ON COLUMN ee_assignment_criteria.max_points IS 'Наибольший балл по критерию';
+COMMENT ON COLUMN ee_assignment_criteria."order" IS 'Порядковый номер критерия';
+
+-- Комментарии для таблицы Submissions
+COMMENT ON TABLE ee_submissions IS 'Ответы на задания, каждая повторная сдача - новая попытка';
+COMMENT ON COLUMN ee_submissions.submission_id IS 'Уникальный идентификатор ответа';
+COMMENT ON COLUMN ee_submissions.assignment_id IS 'Идентификатор задания';
+COMMENT ON COLUMN ee_submissions.user_id IS 'Студент';
+COMMENT ON COLUMN ee_submissions.attempt IS 'Номер попытки, начиная с 1';
+COMMENT ON COLUMN ee_submissions.text_body IS 'Текст ответа';
+COMMENT ON COLUMN ee_submissions.late_days IS 'На сколько дней ответ опоздал, 0 - сдан в срок';
+COMMENT ON COLUMN ee_submissions.raw_score IS 'Балл до штрафа за опоздание, NULL - не проверен';
+COMMENT ON COLUMN ee_submissions.penalty IS 'Штраф за опоздание в процентах';
+COMMENT ON COLUMN ee_submissions.score IS 'Итоговый балл';
+COMMENT ON COLUMN ee_submissions.feedback IS 'Общий отзыв преподавателя';
+COMMENT ON COLUMN ee_submissions.graded_by IS 'Кто проверил ответ';
+COMMENT ON COLUMN ee_submissions.graded_at IS 'Когда ответ проверен';
+COMMENT ON COLUMN ee_submissions.released_at IS 'Когда оценка открыта студенту, NULL - скрыта';
+COMMENT ON COLUMN ee_submissions.submitted_at IS 'Дата и время сдачи';
+
+COMMENT ON TABLE ee_submission_files IS 'Файлы, приложенные к ответу';
+COMMENT ON TABLE ee_submission_scores IS 'Баллы ответа по критериям рубрики';
+COMMENT ON TABLE ee_submission_comments IS 'Замечания преподавателя к месту в тексте ответа или в файле';
+COMMENT ON COLUMN ee_submission_comments.upload_id IS 'Файл, к которому относится замечание, NULL - текст ответа';
+COMMENT ON COLUMN ee_submission_comments.anchor_start IS 'Начало фрагмента текста в символах';
+COMMENT ON COLUMN ee_submission_comments.anchor_end IS 'Конец фрагмента текста в символах';
+COMMENT ON COLUMN ee_submission_comments.location IS 'Место в файле в свободной форме, например страница или строка';
@@ -0,0 +1,12 @@
+-- Удаление таблиц рецензий
+DROP TABLE IF EXISTS ee_peer_review_scores;
+DROP TABLE IF EXISTS ee_peer_reviews;
+
+ALTER TABLE ee_submissions
+    DROP COLUMN IF EXISTS grade_source,
+    DROP COLUMN IF EXISTS peer_score;
+
+ALTER TABLE ee_assignments
+    DROP COLUMN IF EXISTS peer_allocated_at,
+    DROP COLUMN IF EXISTS peer_due_at,
+    DROP COLUMN IF EXISTS peer_reviewers;
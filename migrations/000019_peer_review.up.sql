@@ -0,0 +1,58 @@
+-- Настройки взаимного оценивания в задании
+ALTER TABLE ee_assignments
+    ADD COLUMN peer_reviewers INTEGER NOT NULL DEFAULT 0 CHECK (peer_reviewers BETWEEN 0 AND 10),
+    ADD COLUMN peer_due_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN peer_allocated_at TIMESTAMP WITH TIME ZONE;
+
+COMMENT ON COLUMN ee_assignments.peer_reviewers IS 'Сколько рецензентов получает каждый ответ, 0 - без взаимного оценивания';
+COMMENT ON COLUMN ee_assignments.peer_due_at IS 'Срок сдачи рецензий, NULL - без срока';
+COMMENT ON COLUMN ee_assignments.peer_allocated_at IS 'Когда рецензенты распределены, NULL - ещё не распределены';
+
+-- Происхождение оценки ответа
+ALTER TABLE ee_submissions
+    ADD COLUMN peer_score NUMERIC(7, 2),
+    ADD COLUMN grade_source VARCHAR(16) CHECK (grade_source IN ('instructor', 'peer'));
+
+COMMENT ON COLUMN ee_submissions.peer_score IS 'Балл по рецензиям до штрафа за опоздание, NULL - рецензий нет';
+COMMENT ON COLUMN ee_submissions.grade_source IS 'Кто выставил оценку: instructor - преподаватель, peer - рецензенты';
+
+UPDATE ee_submissions SET grade_source = 'instructor' WHERE graded_at IS NOT NULL;
+
+-- Создание таблицы рецензий
+CREATE TABLE ee_peer_reviews (
+    review_id SERIAL PRIMARY KEY,
+    assignment_id INTEGER NOT NULL REFERENCES ee_assignments(assignment_id) ON DELETE CASCADE,
+    submission_id INTEGER NOT NULL REFERENCES ee_submissions(submission_id) ON DELETE CASCADE,
+    reviewer_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    raw_score NUMERIC(7, 2),
+    feedback TEXT NOT NULL DEFAULT '',
+    excluded BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    submitted_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (submission_id, reviewer_id)
+);
+
+CREATE INDEX idx_peer_reviews_reviewer ON ee_peer_reviews(assignment_id, reviewer_id);
+
+-- Создание таблицы баллов рецензии по критериям
+CREATE TABLE ee_peer_review_scores (
+    review_id INTEGER NOT NULL REFERENCES ee_peer_reviews(review_id) ON DELETE CASCADE,
+    criterion_id INTEGER NOT NULL REFERENCES ee_assignment_criteria(criterion_id) ON DELETE CASCADE,
+    points NUMERIC(7, 2) NOT NULL CHECK (points >= 0),
+    comment TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (review_id, criterion_id)
+);
+
+-- Комментарии для таблицы PeerReviews
+COMMENT ON TABLE ee_peer_reviews IS 'Анонимные рецензии студентов на ответы однокурсников';
+COMMENT ON COLUMN ee_peer_reviews.review_id IS 'Уникальный идентификатор рецензии';
+COMMENT ON COLUMN ee_peer_reviews.assignment_id IS 'Идентификатор задания';
+COMMENT ON COLUMN ee_peer_reviews.submission_id IS 'Рецензируемый ответ';
+COMMENT ON COLUMN ee_peer_reviews.reviewer_id IS 'Рецензент';
+COMMENT ON COLUMN ee_peer_reviews.raw_score IS 'Балл рецензента, NULL - рецензия не сдана';
+COMMENT ON COLUMN ee_peer_reviews.feedback IS 'Отзыв рецензента';
+COMMENT ON COLUMN ee_peer_reviews.excluded IS 'Балл сильно отличается от остальных и не учтён в оценке';
+COMMENT ON COLUMN ee_peer_reviews.created_at IS 'Когда рецензент назначен';
+COMMENT ON COLUMN ee_peer_reviews.submitted_at IS 'Когда рецензия сдана';
+
+COMMENT ON TABLE ee_peer_review_scores IS 'Баллы рецензии по критериям рубрики';
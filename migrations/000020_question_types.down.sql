@@ -0,0 +1,19 @@
+-- Возврат к вопросам с одним правильным ответом
+ALTER TABLE ee_quiz_answers ADD COLUMN answer_text TEXT NOT NULL DEFAULT '';
+
+UPDATE ee_quiz_answers
+SET answer_text = CASE WHEN jsonb_typeof(response) = 'string' THEN response #>> '{}' ELSE response::text END;
+
+ALTER TABLE ee_quiz_answers
+    DROP COLUMN IF EXISTS credit,
+    DROP COLUMN IF EXISTS response;
+
+ALTER TABLE ee_quiz_questions ADD COLUMN correct_answer TEXT NOT NULL DEFAULT '';
+
+UPDATE ee_quiz_questions
+SET correct_answer = COALESCE(options #>> '{variants,0}', options ->> 'correct', '');
+
+ALTER TABLE ee_quiz_questions
+    DROP COLUMN IF EXISTS points,
+    DROP COLUMN IF EXISTS options,
+    DROP COLUMN IF EXISTS type;
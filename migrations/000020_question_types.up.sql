@@ -0,0 +1,35 @@
+-- Типы вопросов: варианты и правильные ответы хранятся в options по схеме своего типа
+ALTER TABLE ee_quiz_questions
+    ADD COLUMN type VARCHAR(32) NOT NULL DEFAULT 'short_text'
+        CHECK (type IN ('single_choice', 'multiple_choice', 'true_false', 'numeric', 'short_text', 'ordering', 'matching', 'fill_blanks')),
+    ADD COLUMN options JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN points NUMERIC(7, 2) NOT NULL DEFAULT 1 CHECK (points > 0);
+
+-- Прежние вопросы сравнивали ответ с правильным посимвольно
+UPDATE ee_quiz_questions
+SET options = jsonb_build_object('variants', jsonb_build_array(correct_answer), 'case_sensitive', true);
+
+ALTER TABLE ee_quiz_questions
+    ALTER COLUMN type DROP DEFAULT,
+    DROP COLUMN correct_answer;
+
+COMMENT ON COLUMN ee_quiz_questions.type IS 'Тип вопроса: single_choice, multiple_choice, true_false, numeric, short_text, ordering, matching, fill_blanks';
+COMMENT ON COLUMN ee_quiz_questions.options IS 'Варианты и правильные ответы по схеме типа вопроса';
+COMMENT ON COLUMN ee_quiz_questions.points IS 'Сколько баллов стоит вопрос';
+
+-- Ответ хранится в виде, который задаёт тип вопроса
+ALTER TABLE ee_quiz_answers
+    ADD COLUMN response JSONB,
+    ADD COLUMN credit NUMERIC(5, 4) NOT NULL DEFAULT 0 CHECK (credit BETWEEN 0 AND 1);
+
+UPDATE ee_quiz_answers
+SET response = to_jsonb(answer_text),
+    credit = CASE WHEN is_correct THEN 1 ELSE 0 END;
+
+ALTER TABLE ee_quiz_answers
+    ALTER COLUMN response SET NOT NULL,
+    DROP COLUMN answer_text;
+
+COMMENT ON COLUMN ee_quiz_answers.response IS 'Ответ пользователя в формате типа вопроса';
+COMMENT ON COLUMN ee_quiz_answers.credit IS 'Доля баллов вопроса за ответ, от 0 до 1';
+COMMENT ON COLUMN ee_quiz_answers.is_correct IS 'Ответ полностью верный';
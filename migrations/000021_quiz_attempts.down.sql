@@ -0,0 +1,19 @@
+-- Остаётся только последний ответ пользователя на каждый вопрос
+DELETE FROM ee_quiz_answers a
+USING ee_quiz_answers b
+WHERE a.question_id = b.question_id AND a.user_id = b.user_id AND a.answer_id < b.answer_id;
+
+DROP INDEX IF EXISTS idx_quiz_answers_user;
+
+ALTER TABLE ee_quiz_answers
+    DROP CONSTRAINT IF EXISTS ee_quiz_answers_attempt_id_question_id_key,
+    DROP COLUMN IF EXISTS attempt_id,
+    ADD CONSTRAINT ee_quiz_answers_question_id_user_id_key UNIQUE (question_id, user_id);
+
+-- Удаление таблицы попыток
+DROP TABLE IF EXISTS ee_quiz_attempts;
+
+ALTER TABLE ee_quizzes
+    DROP COLUMN IF EXISTS scoring_policy,
+    DROP COLUMN IF EXISTS cooldown_minutes,
+    DROP COLUMN IF EXISTS max_attempts;
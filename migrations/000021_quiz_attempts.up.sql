@@ -0,0 +1,67 @@
+-- Правила пересдачи теста
+ALTER TABLE ee_quizzes
+    ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 0 CHECK (max_attempts BETWEEN 0 AND 100),
+    ADD COLUMN cooldown_minutes INTEGER NOT NULL DEFAULT 0 CHECK (cooldown_minutes BETWEEN 0 AND 525600),
+    ADD COLUMN scoring_policy VARCHAR(16) NOT NULL DEFAULT 'highest' CHECK (scoring_policy IN ('highest', 'latest', 'average'));
+
+COMMENT ON COLUMN ee_quizzes.max_attempts IS 'Сколько попыток можно сдать, 0 - без ограничения';
+COMMENT ON COLUMN ee_quizzes.cooldown_minutes IS 'Сколько минут ждать после сдачи попытки, прежде чем начать следующую';
+COMMENT ON COLUMN ee_quizzes.scoring_policy IS 'Какая попытка идёт в оценку: highest - лучшая, latest - последняя, average - среднее';
+
+-- Создание таблицы попыток
+CREATE TABLE ee_quiz_attempts (
+    attempt_id SERIAL PRIMARY KEY,
+    quiz_id INTEGER NOT NULL REFERENCES ee_quizzes(quiz_id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    number INTEGER NOT NULL CHECK (number > 0),
+    points NUMERIC(9, 2),
+    earned NUMERIC(9, 2),
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    submitted_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (quiz_id, user_id, number)
+);
+
+-- Незавершённая попытка у пользователя может быть только одна
+CREATE UNIQUE INDEX idx_quiz_attempts_open ON ee_quiz_attempts(quiz_id, user_id) WHERE submitted_at IS NULL;
+
+-- Ответы без пользователя или вопроса не относятся ни к одной попытке и ни на что не влияли
+-- (прогресс считается по пользователю), поэтому удаляются, а не переносятся. Откат их не возвращает
+DELETE FROM ee_quiz_answers WHERE user_id IS NULL OR question_id IS NULL;
+
+-- Прежние ответы становятся первой сданной попыткой
+INSERT INTO ee_quiz_attempts (quiz_id, user_id, number, points, earned, started_at, submitted_at)
+SELECT q.quiz_id, a.user_id, 1,
+       (SELECT SUM(points) FROM ee_quiz_questions WHERE quiz_id = q.quiz_id),
+       SUM(a.credit * q.points),
+       MIN(a.created_at), MAX(a.created_at)
+FROM ee_quiz_answers a
+JOIN ee_quiz_questions q ON q.question_id = a.question_id
+WHERE a.user_id IS NOT NULL
+GROUP BY q.quiz_id, a.user_id;
+
+ALTER TABLE ee_quiz_answers ADD COLUMN attempt_id INTEGER REFERENCES ee_quiz_attempts(attempt_id) ON DELETE CASCADE;
+
+UPDATE ee_quiz_answers a
+SET attempt_id = t.attempt_id
+FROM ee_quiz_questions q, ee_quiz_attempts t
+WHERE q.question_id = a.question_id AND t.quiz_id = q.quiz_id AND t.user_id = a.user_id;
+
+ALTER TABLE ee_quiz_answers
+    ALTER COLUMN attempt_id SET NOT NULL,
+    DROP CONSTRAINT IF EXISTS ee_quiz_answers_question_id_user_id_key,
+    ADD CONSTRAINT ee_quiz_answers_attempt_id_question_id_key UNIQUE (attempt_id, question_id);
+
+CREATE INDEX idx_quiz_answers_user ON ee_quiz_answers(user_id, question_id);
+
+-- Комментарии для таблицы QuizAttempts
+COMMENT ON TABLE ee_quiz_attempts IS 'Попытки прохождения тестов';
+COMMENT ON COLUMN ee_quiz_attempts.attempt_id IS 'Уникальный идентификатор попытки';
+COMMENT ON COLUMN ee_quiz_attempts.quiz_id IS 'Идентификатор теста';
+COMMENT ON COLUMN ee_quiz_attempts.user_id IS 'Идентификатор пользователя';
+COMMENT ON COLUMN ee_quiz_attempts.number IS 'Номер попытки пользователя по этому тесту, с 1';
+COMMENT ON COLUMN ee_quiz_attempts.points IS 'Сумма баллов за вопросы теста на момент сдачи';
+COMMENT ON COLUMN ee_quiz_attempts.earned IS 'Набранные баллы, NULL - попытка не сдана';
+COMMENT ON COLUMN ee_quiz_attempts.started_at IS 'Когда попытка начата';
+COMMENT ON COLUMN ee_quiz_attempts.submitted_at IS 'Когда попытка сдана, NULL - ещё идёт';
+
+COMMENT ON COLUMN ee_quiz_answers.attempt_id IS 'Попытка, в которой дан ответ';
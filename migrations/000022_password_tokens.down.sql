@@ -0,0 +1,2 @@
+-- Удаление таблицы одноразовых ссылок для установки пароля
+DROP TABLE IF EXISTS ee_password_tokens;
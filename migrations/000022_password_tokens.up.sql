@@ -0,0 +1,19 @@
+-- Создание таблицы одноразовых ссылок для установки пароля
+CREATE TABLE ee_password_tokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES ee_users(user_id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_password_tokens_user ON ee_password_tokens(user_id);
+
+COMMENT ON TABLE ee_password_tokens IS 'Одноразовые ссылки для установки пароля из приглашений';
+COMMENT ON COLUMN ee_password_tokens.token_id IS 'Уникальный идентификатор ссылки';
+COMMENT ON COLUMN ee_password_tokens.user_id IS 'Пользователь, которому выдана ссылка';
+COMMENT ON COLUMN ee_password_tokens.token_hash IS 'SHA-256 токена, сам токен хранится только в письме';
+COMMENT ON COLUMN ee_password_tokens.expires_at IS 'Срок действия ссылки';
+COMMENT ON COLUMN ee_password_tokens.used_at IS 'Когда ссылка использована, NULL - ещё не использована';
+COMMENT ON COLUMN ee_password_tokens.created_at IS 'Дата выдачи ссылки';
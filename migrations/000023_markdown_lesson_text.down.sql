@@ -0,0 +1,9 @@
+-- Возврат текстовых блоков, созданных из текста урока, к формату HTML
+UPDATE ee_lesson_blocks AS b
+SET data = jsonb_set(b.data, '{format}', '"html"')
+FROM ee_lessons AS l
+WHERE b.lesson_id = l.lesson_id
+  AND b.type = 'text'
+  AND b.data->>'format' = 'markdown'
+  AND b.data->>'text' = l.content_text
+  AND ltrim(l.content_text) NOT LIKE '<%';
@@ -0,0 +1,10 @@
+-- Текст уроков, перенесённый в блоки как HTML, написан в Markdown.
+-- HTML из импортированных пакетов начинается с тега и остаётся как есть
+UPDATE ee_lesson_blocks AS b
+SET data = jsonb_set(b.data, '{format}', '"markdown"')
+FROM ee_lessons AS l
+WHERE b.lesson_id = l.lesson_id
+  AND b.type = 'text'
+  AND b.data->>'format' = 'html'
+  AND b.data->>'text' = l.content_text
+  AND ltrim(l.content_text) NOT LIKE '<%';
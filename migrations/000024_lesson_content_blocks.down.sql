@@ -0,0 +1,12 @@
+-- Текст урока снова дублирует первый текстовый блок
+UPDATE ee_lessons AS l
+SET content_text = b.data->>'text'
+FROM (
+    SELECT DISTINCT ON (lesson_id) lesson_id, data
+    FROM ee_lesson_blocks
+    WHERE type = 'text'
+    ORDER BY lesson_id, "order", block_id
+) AS b
+WHERE b.lesson_id = l.lesson_id;
+
+COMMENT ON COLUMN ee_lessons.content_text IS 'Устаревшее поле, содержимое урока хранится в ee_lesson_blocks';
@@ -0,0 +1,16 @@
+-- Содержимое урока хранится только в блоках.
+-- Текст, изменённый через content_text после переноса в блоки, добавляется в конец урока отдельным блоком
+INSERT INTO ee_lesson_blocks (lesson_id, type, "order", data)
+SELECT l.lesson_id, 'text',
+       (SELECT COUNT(*) FROM ee_lesson_blocks AS b WHERE b.lesson_id = l.lesson_id),
+       jsonb_build_object('format', 'markdown', 'text', l.content_text)
+FROM ee_lessons AS l
+WHERE l.content_text IS NOT NULL AND l.content_text <> ''
+  AND NOT EXISTS (
+      SELECT 1 FROM ee_lesson_blocks AS b
+      WHERE b.lesson_id = l.lesson_id AND b.type = 'text' AND b.data->>'text' = l.content_text
+  );
+
+UPDATE ee_lessons SET content_text = '' WHERE content_text IS NULL OR content_text <> '';
+
+COMMENT ON COLUMN ee_lessons.content_text IS 'Не используется, содержимое урока хранится в ee_lesson_blocks';
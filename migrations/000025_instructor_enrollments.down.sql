@@ -0,0 +1,8 @@
+-- Автор курса снова определяется только по ee_courses.instructor_id
+DELETE FROM ee_enrollments WHERE role = 'instructor';
+
+ALTER TABLE ee_enrollments
+    DROP CONSTRAINT ee_enrollments_role_check,
+    ADD CONSTRAINT ee_enrollments_role_check CHECK (role IN ('student', 'ta', 'co_instructor', 'observer'));
+
+COMMENT ON COLUMN ee_enrollments.role IS 'Роль участника: student, ta, co_instructor, observer';
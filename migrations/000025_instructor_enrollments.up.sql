@@ -0,0 +1,14 @@
+-- Автор курса становится участником с ролью instructor: доступ к курсу проверяется только по записям
+ALTER TABLE ee_enrollments
+    DROP CONSTRAINT ee_enrollments_role_check,
+    ADD CONSTRAINT ee_enrollments_role_check CHECK (role IN ('instructor', 'student', 'ta', 'co_instructor', 'observer'));
+
+-- Если автор уже был записан на свой курс, его запись становится записью автора
+INSERT INTO ee_enrollments (user_id, course_id, role, status, created_at, updated_at)
+SELECT instructor_id, course_id, 'instructor', 'active', created_at, CURRENT_TIMESTAMP
+FROM ee_courses
+WHERE instructor_id IS NOT NULL
+ON CONFLICT (user_id, course_id) DO UPDATE
+SET role = 'instructor', status = 'active', waitlisted_at = NULL, updated_at = CURRENT_TIMESTAMP;
+
+COMMENT ON COLUMN ee_enrollments.role IS 'Роль участника: instructor, student, ta, co_instructor, observer';
@@ -0,0 +1,129 @@
+package assignments
+
+import (
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"time"
+)
+
+// Сдача после срока
+const (
+	LateAccept  = "accept"
+	LatePenalty = "penalty"
+	LateReject  = "reject"
+)
+
+// Кто выставил оценку ответу
+const (
+	GradeInstructor = "instructor"
+	GradePeer       = "peer"
+)
+
+// Фильтр входящих ответов
+const (
+	StatusUngraded = "ungraded"
+	StatusGraded   = "graded"
+	StatusAll      = "all"
+)
+
+const (
+	maxTextRunes     = 100000
+	maxCommentRunes  = 10000
+	maxLocationRunes = 255
+	defaultMaxFiles  = 5
+	maxFilesLimit    = 20
+	maxPeerReviewers = 10
+)
+
+type CriterionInfo struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	MaxPoints   float64 `json:"max_points"`
+}
+
+// AssignmentInfo - настройки задания целиком, критерии заменяют существующие
+type AssignmentInfo struct {
+	Instructions string          `json:"instructions"`
+	DueAt        *time.Time      `json:"due_at"`
+	LatePolicy   string          `json:"late_policy"` // Пусто - accept
+	LatePenalty  int             `json:"late_penalty"`
+	LateUntil    *time.Time      `json:"late_until"`
+	AllowText    *bool           `json:"allow_text"`  // nil - true
+	AllowFiles   *bool           `json:"allow_files"` // nil - true
+	AllowedTypes []string        `json:"allowed_types"`
+	MaxFiles     *int            `json:"max_files"` // nil - 5
+	MaxAttempts  int             `json:"max_attempts"`
+	MaxScore     float64         `json:"max_score"` // 0 - 100, без критериев
+	Criteria     []CriterionInfo `json:"criteria"`
+
+	PeerReviewers int        `json:"peer_reviewers"` // 0 - без взаимного оценивания
+	PeerDueAt     *time.Time `json:"peer_due_at"`
+}
+
+// Assignment - задание с критериями и сведениями о приёме ответов сейчас
+type Assignment struct {
+	storage.EeAssignment
+	InstructionsHTML *render.Document                `json:"instructions_html,omitempty"` // Только при ?format=html
+	Criteria         []storage.EeAssignmentCriterion `json:"criteria"`
+	TotalScore       float64                         `json:"total_score"` // Сумма критериев или max_score
+	Accepting        bool                            `json:"accepting"`   // Можно ли сдать ответ прямо сейчас
+	Late             bool                            `json:"late"`        // Ответ, сданный сейчас, будет считаться опоздавшим
+}
+
+type SubmitInfo struct {
+	Text      string   `json:"text"`
+	UploadIDs []string `json:"upload_ids"`
+}
+
+type ScoreInfo struct {
+	CriterionID uint    `json:"criterion_id"`
+	Points      float64 `json:"points"`
+	Comment     string  `json:"comment"`
+}
+
+// GradeInfo - оценка по критериям или, если их нет, одним баллом
+type GradeInfo struct {
+	Scores   []ScoreInfo `json:"scores"`
+	Score    *float64    `json:"score"`
+	Feedback string      `json:"feedback"`
+	Release  bool        `json:"release"` // Сразу открыть оценку студенту
+}
+
+type CommentInfo struct {
+	Body        string  `json:"body"`
+	UploadID    *string `json:"upload_id"` // nil - замечание к тексту ответа
+	AnchorStart *int    `json:"anchor_start"`
+	AnchorEnd   *int    `json:"anchor_end"`
+	Location    string  `json:"location"`
+}
+
+type ReleaseInfo struct {
+	Released bool `json:"released"`
+}
+
+type SubmissionFile struct {
+	UploadID string `json:"upload_id"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url"`
+	Order    int    `json:"-"`
+}
+
+// Submission - ответ с файлами. Пока оценка не открыта, студент не видит баллов и замечаний
+type Submission struct {
+	storage.EeSubmission
+	Username string                        `json:"username"`
+	Files    []SubmissionFile              `json:"files"`
+	Scores   []storage.EeSubmissionScore   `json:"scores"`
+	Comments []storage.EeSubmissionComment `json:"comments"`
+}
+
+// InboxItem - последняя попытка студента во входящих преподавателя
+type InboxItem struct {
+	storage.EeSubmission
+	Username    string `json:"username"`
+	LessonID    uint   `json:"lesson_id"`
+	LessonTitle string `json:"lesson_title"`
+	Attempts    int    `json:"attempts"`
+}
@@ -0,0 +1,62 @@
+package peer
+
+import (
+	"ekb-edu/src/api/assignments"
+	"ekb-edu/src/database/storage"
+	"time"
+)
+
+// Выбросы отбрасываются, только если рецензий хватает, чтобы было с чем сравнивать.
+// Балл считается выбросом, если отстоит от медианы больше чем на outlierMADs медианных
+// отклонений и больше чем на outlierShare от наибольшего балла
+const (
+	minForOutliers = 3
+	outlierMADs    = 2.5
+	outlierShare   = 0.1
+)
+
+type ReviewInfo struct {
+	Scores   []assignments.ScoreInfo `json:"scores"`
+	Score    *float64                `json:"score"` // Если у задания нет критериев
+	Feedback string                  `json:"feedback"`
+}
+
+// Task - рецензия глазами рецензента: ответ без имени автора
+type Task struct {
+	ReviewID    uint                         `json:"review_id"`
+	Label       string                       `json:"label"` // «A», «B»... вместо автора
+	Text        string                       `json:"text_body"`
+	Files       []assignments.SubmissionFile `json:"files"`
+	RawScore    *float64                     `json:"raw_score"`
+	Feedback    string                       `json:"feedback"`
+	Scores      []storage.EePeerReviewScore  `json:"scores"`
+	SubmittedAt *time.Time                   `json:"submitted_at"` // null - рецензия ещё не сдана
+}
+
+// Received - сданная рецензия на ответ. Автору рецензент не раскрывается
+type Received struct {
+	ReviewID    uint                        `json:"review_id"`
+	Label       string                      `json:"label"` // «Reviewer 1», «Reviewer 2»...
+	ReviewerID  *uint                       `json:"reviewer_id,omitempty"`
+	Reviewer    string                      `json:"reviewer,omitempty"`
+	RawScore    *float64                    `json:"raw_score"`
+	Feedback    string                      `json:"feedback"`
+	Excluded    bool                        `json:"excluded"`
+	Scores      []storage.EePeerReviewScore `json:"scores"`
+	SubmittedAt *time.Time                  `json:"submitted_at"`
+}
+
+// ReviewRow - рецензия в сводке преподавателя
+type ReviewRow struct {
+	storage.EePeerReview
+	Reviewer string `json:"reviewer"`
+	AuthorID uint   `json:"author_id"`
+	Author   string `json:"author"`
+}
+
+type Allocation struct {
+	AllocatedAt *time.Time `json:"allocated_at"`
+	Submissions int        `json:"submissions"`
+	Reviewers   int        `json:"reviewers"` // На ответ; меньше peer_reviewers, если ответов мало
+	Reviews     int        `json:"reviews"`
+}
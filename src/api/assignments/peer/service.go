@@ -0,0 +1,786 @@
+package peer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"ekb-edu/src/api/assignments"
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxFeedbackRunes = 20000
+
+// order выстраивает участников в порядке, который зависит только от seed и их идентификаторов,
+// но не совпадает с порядком регистрации, чтобы соседи по списку не рецензировали друг друга
+func order(userIDs []uint, seed uint) []uint {
+	keys := make(map[uint][32]byte, len(userIDs))
+	for _, userID := range userIDs {
+		keys[userID] = sha256.Sum256([]byte(fmt.Sprintf("%d:%d", seed, userID)))
+	}
+
+	result := slices.Clone(userIDs)
+	sort.Slice(result, func(i, j int) bool {
+		a, b := keys[result[i]], keys[result[j]]
+		if cmp := bytes.Compare(a[:], b[:]); cmp != 0 {
+			return cmp < 0
+		}
+		return result[i] < result[j]
+	})
+
+	return result
+}
+
+// Allocate назначает каждому автору n рецензентов из числа тех же авторов. Участники
+// встают в круг в порядке order, и каждый рецензирует n следующих за ним. Так никто
+// не проверяет свой ответ, каждый ответ получает ровно n рецензий и каждый рецензент
+// пишет ровно n. Если авторов не больше n, рецензентов у ответа на одного меньше, чем авторов.
+// Результат зависит только от списка авторов, n и seed
+func Allocate(authors []uint, n int, seed uint) map[uint][]uint {
+	unique := slices.Clone(authors)
+	slices.Sort(unique)
+	ring := order(slices.Compact(unique), seed)
+
+	n = min(n, len(ring)-1)
+	result := make(map[uint][]uint, len(ring))
+	if n <= 0 {
+		return result
+	}
+
+	for i, author := range ring {
+		reviewers := make([]uint, n)
+		for k := 1; k <= n; k++ {
+			reviewers[k-1] = ring[(i-k+len(ring))%len(ring)]
+		}
+		slices.Sort(reviewers)
+		result[author] = reviewers
+	}
+
+	return result
+}
+
+func median(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// Aggregate сводит баллы рецензентов в одну оценку: среднее без выбросов, см. minForOutliers.
+// Медианное отклонение устойчиво к самим выбросам, поэтому отброшено всегда меньше половины баллов
+func Aggregate(scores []float64, total float64) (float64, []bool) {
+	excluded := make([]bool, len(scores))
+	if len(scores) == 0 {
+		return 0, excluded
+	}
+
+	if len(scores) >= minForOutliers {
+		center := median(scores)
+		deviations := make([]float64, len(scores))
+		for i, score := range scores {
+			deviations[i] = math.Abs(score - center)
+		}
+
+		limit := max(outlierMADs*median(deviations), outlierShare*total)
+		for i, deviation := range deviations {
+			excluded[i] = deviation > limit
+		}
+	}
+
+	sum, count := 0.0, 0
+	for i, score := range scores {
+		if !excluded[i] {
+			sum += score
+			count++
+		}
+	}
+
+	return math.Round(sum/float64(count)*100) / 100, excluded
+}
+
+func totalScore(assignment *storage.EeAssignment, criteria []storage.EeAssignmentCriterion) float64 {
+	if len(criteria) == 0 {
+		return assignment.MaxScore
+	}
+
+	total := 0.0
+	for _, criterion := range criteria {
+		total += criterion.MaxPoints
+	}
+	return total
+}
+
+// latest - последние попытки студентов, они и идут на рецензию
+func latest(tx *gorm.DB, assignmentID uint) ([]storage.EeSubmission, error) {
+	var list []storage.EeSubmission
+	err := tx.Table("ee_submissions").
+		Select("DISTINCT ON (user_id) *").
+		Where("assignment_id = ?", assignmentID).
+		Order("user_id, attempt DESC").
+		Scan(&list).Error
+	return list, err
+}
+
+// allocate распределяет рецензентов по ответам, сданным к этому моменту
+func allocate(tx *gorm.DB, assignment *storage.EeAssignment) error {
+	list, err := latest(tx, assignment.AssignmentID)
+	if err != nil {
+		return err
+	}
+
+	authors := make([]uint, len(list))
+	for i, submission := range list {
+		authors[i] = submission.UserID
+	}
+
+	plan := Allocate(authors, assignment.PeerReviewers, assignment.AssignmentID)
+	reviews := []storage.EePeerReview{}
+	for _, submission := range list {
+		for _, reviewerID := range plan[submission.UserID] {
+			reviews = append(reviews, storage.EePeerReview{
+				AssignmentID: assignment.AssignmentID,
+				SubmissionID: submission.SubmissionID,
+				ReviewerID:   reviewerID,
+			})
+		}
+	}
+
+	if len(reviews) > 0 {
+		if err := tx.Create(&reviews).Error; err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	assignment.PeerAllocatedAt = &now
+	return tx.Model(&storage.EeAssignment{}).Where("assignment_id = ?", assignment.AssignmentID).Update("peer_allocated_at", now).Error
+}
+
+// ensure распределяет рецензентов, если срок сдачи прошёл, а распределения ещё не было
+func ensure(assignment *storage.EeAssignment) error {
+	if assignment.PeerReviewers == 0 || assignment.PeerAllocatedAt != nil || assignment.DueAt == nil || time.Now().Before(*assignment.DueAt) {
+		return nil
+	}
+
+	return storage.DB.Transaction(func(tx *gorm.DB) error {
+		// Распределение выполняется один раз, даже если его запустили несколько запросов сразу
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("assignment_id = ?", assignment.AssignmentID).First(assignment).Error
+		if err != nil || assignment.PeerAllocatedAt != nil {
+			return err
+		}
+
+		return allocate(tx, assignment)
+	})
+}
+
+// recompute пересчитывает балл ответа по сданным рецензиям. Оценкой ответа он становится,
+// когда сданы все рецензии или force, и только если преподаватель не выставил свою
+func recompute(tx *gorm.DB, assignment *storage.EeAssignment, submissionID uint, force bool) (bool, error) {
+	criteria, err := assignments.Rubric(tx, assignment.AssignmentID)
+	if err != nil {
+		return false, err
+	}
+
+	var reviews []storage.EePeerReview
+	if err := tx.Where("submission_id = ?", submissionID).Order("review_id").Find(&reviews).Error; err != nil {
+		return false, err
+	}
+
+	done := []storage.EePeerReview{}
+	scores := []float64{}
+	for _, review := range reviews {
+		if review.SubmittedAt != nil && review.RawScore != nil {
+			done = append(done, review)
+			scores = append(scores, *review.RawScore)
+		}
+	}
+
+	value, excluded := Aggregate(scores, totalScore(assignment, criteria))
+	for i, review := range done {
+		if review.Excluded != excluded[i] {
+			if err := tx.Model(&storage.EePeerReview{}).Where("review_id = ?", review.ReviewID).Update("excluded", excluded[i]).Error; err != nil {
+				return false, err
+			}
+		}
+	}
+
+	var submission storage.EeSubmission
+	if err := tx.Where("submission_id = ?", submissionID).First(&submission).Error; err != nil {
+		return false, err
+	}
+
+	updates := map[string]interface{}{"peer_score": nil}
+	if len(done) > 0 {
+		updates["peer_score"] = value
+	}
+
+	graded := len(done) > 0 && (len(done) == len(reviews) || force) &&
+		(submission.GradeSource == nil || *submission.GradeSource == assignments.GradePeer)
+	if graded {
+		rate, score := assignments.Final(assignment, submission.LateDays, value)
+		updates["raw_score"] = value
+		updates["penalty"] = rate
+		updates["score"] = score
+		updates["graded_by"] = nil
+		updates["graded_at"] = time.Now()
+		updates["grade_source"] = assignments.GradePeer
+	}
+
+	return graded, tx.Model(&storage.EeSubmission{}).Where("submission_id = ?", submissionID).Updates(updates).Error
+}
+
+// finalize выставляет оценки по уже сданным рецензиям всем непроверенным ответам
+func finalize(assignment *storage.EeAssignment) (int, error) {
+	var submissionIDs []uint
+	err := storage.DB.Model(&storage.EeSubmission{}).
+		Where("assignment_id = ? AND graded_at IS NULL", assignment.AssignmentID).
+		Where("submission_id IN (?)", storage.DB.Model(&storage.EePeerReview{}).Select("submission_id").Where("submitted_at IS NOT NULL")).
+		Pluck("submission_id", &submissionIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, submissionID := range submissionIDs {
+		err := storage.DB.Transaction(func(tx *gorm.DB) error {
+			graded, err := recompute(tx, assignment, submissionID, true)
+			if graded {
+				count++
+			}
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// Process распределяет рецензентов там, где прошёл срок сдачи, и выставляет оценки по рецензиям
+// там, где прошёл срок рецензирования. Запускается по расписанию, повторный запуск ничего не меняет
+func Process() (int, int, error) {
+	now := time.Now()
+
+	var due []storage.EeAssignment
+	err := storage.DB.Where("peer_reviewers > 0 AND peer_allocated_at IS NULL AND due_at <= ?", now).Find(&due).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	allocated := 0
+	for i := range due {
+		if err := ensure(&due[i]); err != nil {
+			return allocated, 0, err
+		}
+		allocated++
+	}
+
+	var closed []storage.EeAssignment
+	err = storage.DB.Where("peer_allocated_at IS NOT NULL AND peer_due_at <= ?", now).Find(&closed).Error
+	if err != nil {
+		return allocated, 0, err
+	}
+
+	graded := 0
+	for i := range closed {
+		count, err := finalize(&closed[i])
+		graded += count
+		if err != nil {
+			return allocated, graded, err
+		}
+	}
+
+	return allocated, graded, nil
+}
+
+// find загружает задание из :id, при ошибке возвращает nil и уже отправленный ответ
+func find(c *fiber.Ctx) (*storage.EeAssignment, uint, error) {
+	var assignment storage.EeAssignment
+	err := storage.DB.Where("assignment_id = ?", c.Params("id")).First(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "assignment not found"})
+	} else if err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(assignment.LessonID)
+	if err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if assignment.PeerReviewers == 0 {
+		return nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "assignment has no peer review"})
+	}
+
+	return &assignment, courseID, nil
+}
+
+// canRead пускает к рецензиям только тех, кому открыт урок с заданием
+func canRead(c *fiber.Ctx, courseID, lessonID uint) (bool, error) {
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, lessonID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return false, availability.Deny(c, status)
+	}
+
+	return true, nil
+}
+
+func reviewScores(reviewIDs []uint) (map[uint][]storage.EePeerReviewScore, error) {
+	var scores []storage.EePeerReviewScore
+	if err := storage.DB.Where("review_id IN ?", reviewIDs).Find(&scores).Error; err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint][]storage.EePeerReviewScore, len(reviewIDs))
+	for _, reviewID := range reviewIDs {
+		result[reviewID] = []storage.EePeerReviewScore{}
+	}
+	for _, score := range scores {
+		result[score.ReviewID] = append(result[score.ReviewID], score)
+	}
+
+	return result, nil
+}
+
+// tasks показывает рецензенту доставшиеся ему ответы без имён авторов
+func tasks(c *fiber.Ctx, reviews []storage.EePeerReview) ([]Task, error) {
+	result := make([]Task, len(reviews))
+	if len(reviews) == 0 {
+		return result, nil
+	}
+
+	reviewIDs := make([]uint, len(reviews))
+	submissionIDs := make([]uint, len(reviews))
+	for i, review := range reviews {
+		reviewIDs[i] = review.ReviewID
+		submissionIDs[i] = review.SubmissionID
+	}
+
+	var submissions []storage.EeSubmission
+	if err := storage.DB.Where("submission_id IN ?", submissionIDs).Find(&submissions).Error; err != nil {
+		return nil, err
+	}
+	texts := make(map[uint]string, len(submissions))
+	for _, submission := range submissions {
+		texts[submission.SubmissionID] = submission.TextBody
+	}
+
+	files, err := assignments.Files(c, submissionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	scores, err := reviewScores(reviewIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, review := range reviews {
+		result[i] = Task{
+			ReviewID:    review.ReviewID,
+			Label:       fmt.Sprintf("%c", 'A'+i),
+			Text:        texts[review.SubmissionID],
+			Files:       files[review.SubmissionID],
+			RawScore:    review.RawScore,
+			Feedback:    review.Feedback,
+			Scores:      scores[review.ReviewID],
+			SubmittedAt: review.SubmittedAt,
+		}
+	}
+
+	return result, nil
+}
+
+// myReviews - ответы, которые текущему пользователю нужно отрецензировать.
+// Первое обращение после срока сдачи распределяет рецензентов, если это ещё не сделано
+func myReviews(c *fiber.Ctx) error {
+	assignment, courseID, err := find(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, assignment.LessonID); !ok {
+		return err
+	}
+
+	if err := ensure(assignment); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var reviews []storage.EePeerReview
+	err = storage.DB.Where("assignment_id = ? AND reviewer_id = ?", assignment.AssignmentID, middleware.UserID(c)).Order("review_id").Find(&reviews).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result, err := tasks(c, reviews)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(result)
+}
+
+// submitReview сохраняет рецензию. До срока рецензирования её можно переписать
+func submitReview(c *fiber.Ctx) error {
+	var review storage.EePeerReview
+	err := storage.DB.Where("review_id = ? AND reviewer_id = ?", c.Params("id"), middleware.UserID(c)).First(&review).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "review not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var assignment storage.EeAssignment
+	if err := storage.DB.Where("assignment_id = ?", review.AssignmentID).First(&assignment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(assignment.LessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := canRead(c, courseID, assignment.LessonID); !ok {
+		return err
+	}
+
+	if assignment.PeerDueAt != nil && time.Now().After(*assignment.PeerDueAt) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "peer review is closed"})
+	}
+
+	info := ReviewInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse review data"})
+	}
+
+	criteria, err := assignments.Rubric(storage.DB, assignment.AssignmentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	raw, given, err := assignments.Evaluate(criteria, assignment.MaxScore, info.Scores, info.Score)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	feedback := strings.TrimSpace(info.Feedback)
+	if len([]rune(feedback)) > maxFeedbackRunes {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("feedback is longer than %d characters", maxFeedbackRunes)})
+	}
+
+	scores := make([]storage.EePeerReviewScore, len(given))
+	for i, score := range given {
+		scores[i] = storage.EePeerReviewScore{ReviewID: review.ReviewID, CriterionID: score.CriterionID, Points: score.Points, Comment: score.Comment}
+	}
+
+	now := time.Now()
+	review.RawScore, review.Feedback, review.SubmittedAt = &raw, feedback, &now
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("review_id = ?", review.ReviewID).Delete(&storage.EePeerReviewScore{}).Error; err != nil {
+			return err
+		}
+		if len(scores) > 0 {
+			if err := tx.Create(&scores).Error; err != nil {
+				return err
+			}
+		}
+
+		err := tx.Model(&review).Updates(map[string]interface{}{"raw_score": raw, "feedback": feedback, "submitted_at": now}).Error
+		if err != nil {
+			return err
+		}
+
+		_, err = recompute(tx, &assignment, review.SubmissionID, false)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result, err := tasks(c, []storage.EePeerReview{review})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(result[0])
+}
+
+// receivedReviews - сданные рецензии на ответ. Автор видит их после открытия оценки и без имён рецензентов
+func receivedReviews(c *fiber.Ctx) error {
+	var submission storage.EeSubmission
+	err := storage.DB.Where("submission_id = ?", c.Params("id")).First(&submission).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "submission not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var assignment storage.EeAssignment
+	if err := storage.DB.Where("assignment_id = ?", submission.AssignmentID).First(&assignment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(assignment.LessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if !staff && submission.UserID != middleware.UserID(c) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "submission not found"})
+	}
+
+	result := []Received{}
+	if !staff && submission.ReleasedAt == nil {
+		return c.JSON(result)
+	}
+
+	var reviews []storage.EePeerReview
+	err = storage.DB.Where("submission_id = ? AND submitted_at IS NOT NULL", submission.SubmissionID).Order("review_id").Find(&reviews).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	reviewIDs := make([]uint, len(reviews))
+	reviewerIDs := make([]uint, len(reviews))
+	for i, review := range reviews {
+		reviewIDs[i] = review.ReviewID
+		reviewerIDs[i] = review.ReviewerID
+	}
+
+	scores, err := reviewScores(reviewIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	usernames := make(map[uint]string)
+	if staff && len(reviewerIDs) > 0 {
+		var users []storage.EeUser
+		if err := storage.DB.Select("user_id, username").Where("user_id IN ?", reviewerIDs).Find(&users).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+		for _, user := range users {
+			usernames[user.UserID] = user.Username
+		}
+	}
+
+	for i, review := range reviews {
+		item := Received{
+			ReviewID:    review.ReviewID,
+			Label:       fmt.Sprintf("Reviewer %d", i+1),
+			RawScore:    review.RawScore,
+			Feedback:    review.Feedback,
+			Excluded:    review.Excluded,
+			Scores:      scores[review.ReviewID],
+			SubmittedAt: review.SubmittedAt,
+		}
+		if staff {
+			item.ReviewerID = &reviews[i].ReviewerID
+			item.Reviewer = usernames[review.ReviewerID]
+		}
+		result = append(result, item)
+	}
+
+	return c.JSON(result)
+}
+
+// getReviews - все рецензии задания для преподавателя. ?status=pending, submitted или all (по умолчанию)
+func getReviews(c *fiber.Ctx) error {
+	assignment, courseID, err := find(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	query := storage.DB.Table("ee_peer_reviews").
+		Select("ee_peer_reviews.*, reviewers.username AS reviewer, ee_submissions.user_id AS author_id, authors.username AS author").
+		Joins("JOIN ee_users AS reviewers ON reviewers.user_id = ee_peer_reviews.reviewer_id").
+		Joins("JOIN ee_submissions ON ee_submissions.submission_id = ee_peer_reviews.submission_id").
+		Joins("JOIN ee_users AS authors ON authors.user_id = ee_submissions.user_id").
+		Where("ee_peer_reviews.assignment_id = ?", assignment.AssignmentID).
+		Order("ee_peer_reviews.submission_id, ee_peer_reviews.review_id")
+
+	switch c.Query("status", "all") {
+	case "pending":
+		query = query.Where("ee_peer_reviews.submitted_at IS NULL")
+	case "submitted":
+		query = query.Where("ee_peer_reviews.submitted_at IS NOT NULL")
+	case "all":
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "status must be one of pending, submitted, all"})
+	}
+
+	rows := []ReviewRow{}
+	if err := query.Scan(&rows).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(rows)
+}
+
+// allocateReviews распределяет рецензентов сразу после срока сдачи, не дожидаясь расписания
+func allocateReviews(c *fiber.Ctx) error {
+	assignment, courseID, err := find(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	if time.Now().Before(*assignment.DueAt) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "reviewers are allocated after the deadline"})
+	}
+
+	if err := ensure(assignment); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var counts struct {
+		Submissions int
+		Reviews     int
+	}
+	err = storage.DB.Model(&storage.EePeerReview{}).
+		Select("COUNT(DISTINCT submission_id) AS submissions, COUNT(*) AS reviews").
+		Where("assignment_id = ?", assignment.AssignmentID).
+		Scan(&counts).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result := Allocation{AllocatedAt: assignment.PeerAllocatedAt, Submissions: counts.Submissions, Reviews: counts.Reviews}
+	if counts.Submissions > 0 {
+		result.Reviewers = counts.Reviews / counts.Submissions
+	}
+
+	return c.JSON(result)
+}
+
+// finalizeReviews выставляет оценки по сданным рецензиям, не дожидаясь остальных
+func finalizeReviews(c *fiber.Ctx) error {
+	assignment, courseID, err := find(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	if assignment.PeerAllocatedAt == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "reviewers have not been allocated yet"})
+	}
+
+	graded, err := finalize(assignment)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(fiber.Map{"graded": graded})
+}
+
+// usePeerGrade отменяет оценку преподавателя и возвращает ответу оценку по рецензиям
+func usePeerGrade(c *fiber.Ctx) error {
+	var submission storage.EeSubmission
+	err := storage.DB.Where("submission_id = ?", c.Params("id")).First(&submission).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "submission not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var assignment storage.EeAssignment
+	if err := storage.DB.Where("assignment_id = ?", submission.AssignmentID).First(&assignment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(assignment.LessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	if submission.PeerScore == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "submission has no peer reviews yet"})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("submission_id = ?", submission.SubmissionID).Delete(&storage.EeSubmissionScore{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&submission).Update("grade_source", assignments.GradePeer).Error; err != nil {
+			return err
+		}
+
+		_, err := recompute(tx, &assignment, submission.SubmissionID, true)
+		return err
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if err := storage.DB.Where("submission_id = ?", submission.SubmissionID).First(&submission).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&submission)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/assignments", middleware.TokenRequired)
+	{
+		g.Get("/:id/peer_reviews", getReviews)
+		g.Get("/:id/peer_reviews/mine", myReviews)
+		g.Post("/:id/peer_reviews/allocate", allocateReviews)
+		g.Post("/:id/peer_reviews/finalize", finalizeReviews)
+	}
+
+	app.Put("/peer_reviews/:id", middleware.TokenRequired, submitReview)
+	app.Get("/submissions/:id/peer_reviews", middleware.TokenRequired, receivedReviews)
+	app.Post("/submissions/:id/peer_grade", middleware.TokenRequired, usePeerGrade)
+}
@@ -0,0 +1,142 @@
+package peer
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name      string
+		authors   []uint
+		n         int
+		reviewers int // Ожидаемое число рецензентов у каждого ответа
+	}{
+		{"no authors", nil, 2, 0},
+		{"single author", []uint{7}, 2, 0},
+		{"no reviews requested", []uint{1, 2, 3}, 0, 0},
+		{"two authors review each other", []uint{1, 2}, 3, 1},
+		{"fewer authors than reviewers", []uint{1, 2, 3}, 5, 2},
+		{"regular", []uint{4, 8, 15, 16, 23, 42}, 2, 2},
+		{"duplicate authors", []uint{5, 3, 5, 9, 3, 11}, 2, 2},
+		{"large group", []uint{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Allocate(tt.authors, tt.n, 99)
+
+			unique := slices.Clone(tt.authors)
+			slices.Sort(unique)
+			unique = slices.Compact(unique)
+			if tt.reviewers == 0 {
+				if len(plan) != 0 {
+					t.Fatalf("expected empty plan, got %v", plan)
+				}
+				return
+			}
+
+			if len(plan) != len(unique) {
+				t.Fatalf("plan covers %d authors, want %d", len(plan), len(unique))
+			}
+
+			written := make(map[uint]int)
+			for _, author := range unique {
+				reviewers := plan[author]
+				if len(reviewers) != tt.reviewers {
+					t.Errorf("author %d has %d reviewers, want %d", author, len(reviewers), tt.reviewers)
+				}
+				if !slices.IsSorted(reviewers) {
+					t.Errorf("reviewers of %d are not sorted: %v", author, reviewers)
+				}
+				if len(slices.Compact(slices.Clone(reviewers))) != len(reviewers) {
+					t.Errorf("author %d has duplicate reviewers: %v", author, reviewers)
+				}
+
+				for _, reviewer := range reviewers {
+					if reviewer == author {
+						t.Errorf("author %d reviews their own answer", author)
+					}
+					if !slices.Contains(unique, reviewer) {
+						t.Errorf("reviewer %d of %d is not an author", reviewer, author)
+					}
+					written[reviewer]++
+				}
+			}
+
+			for _, author := range unique {
+				if written[author] != tt.reviewers {
+					t.Errorf("author %d writes %d reviews, want %d", author, written[author], tt.reviewers)
+				}
+			}
+		})
+	}
+}
+
+func TestAllocateDeterministic(t *testing.T) {
+	authors := []uint{3, 14, 15, 92, 65, 35, 89, 79}
+	shuffled := []uint{89, 3, 79, 15, 35, 92, 14, 65}
+
+	first := Allocate(authors, 3, 12)
+	if second := Allocate(shuffled, 3, 12); !reflect.DeepEqual(first, second) {
+		t.Errorf("allocation depends on the order of authors:\n%v\n%v", first, second)
+	}
+
+	if again := Allocate(authors, 3, 12); !reflect.DeepEqual(first, again) {
+		t.Errorf("allocation is not repeatable:\n%v\n%v", first, again)
+	}
+
+	// Другое задание - другой круг, хотя бы для одного автора рецензенты меняются
+	if other := Allocate(authors, 3, 13); reflect.DeepEqual(first, other) {
+		t.Errorf("allocation does not depend on the seed: %v", first)
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name     string
+		scores   []float64
+		total    float64
+		want     float64
+		excluded []bool
+	}{
+		{"no scores", nil, 10, 0, []bool{}},
+		{"single score", []float64{7}, 10, 7, []bool{false}},
+		{"too few to drop outliers", []float64{1, 10}, 10, 5.5, []bool{false, false}},
+		{"agreeing reviewers", []float64{8, 8, 9}, 10, 8.33, []bool{false, false, false}},
+		{"low outlier", []float64{8, 8.5, 9, 1}, 10, 8.5, []bool{false, false, false, true}},
+		{"high outlier", []float64{2, 3, 2.5, 10}, 10, 2.5, []bool{false, false, false, true}},
+		{"spread within share of total", []float64{70, 75, 80}, 100, 75, []bool{false, false, false}},
+		{"identical scores", []float64{5, 5, 5, 5}, 10, 5, []bool{false, false, false, false}},
+		{"rounding to cents", []float64{1, 1, 2}, 10, 1.33, []bool{false, false, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, excluded := Aggregate(tt.scores, tt.total)
+			if got != tt.want {
+				t.Errorf("Aggregate(%v) = %v, want %v", tt.scores, got, tt.want)
+			}
+			if !reflect.DeepEqual(excluded, tt.excluded) {
+				t.Errorf("Aggregate(%v) excluded %v, want %v", tt.scores, excluded, tt.excluded)
+			}
+		})
+	}
+}
+
+func TestAggregateKeepsMajority(t *testing.T) {
+	scores := []float64{0, 0, 10, 10, 10}
+	_, excluded := Aggregate(scores, 10)
+
+	dropped := 0
+	for _, e := range excluded {
+		if e {
+			dropped++
+		}
+	}
+
+	if dropped*2 >= len(scores) {
+		t.Errorf("dropped %d of %d scores: %v", dropped, len(scores), excluded)
+	}
+}
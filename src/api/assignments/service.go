@@ -0,0 +1,1104 @@
+package assignments
+
+import (
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/media"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/uploads"
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errRubricGraded  = errors.New("rubric cannot be changed after grading has started, only titles and descriptions")
+	errNoAttempts    = errors.New("no attempts left")
+	errReviewStarted = errors.New("submissions are closed, peer reviewers have been allocated")
+	errAllocated     = errors.New("peer_reviewers cannot be changed after reviewers have been allocated")
+)
+
+func lessonCourse(c *fiber.Ctx) (uint, uint, error) {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	return uint(lessonID), courseID, nil
+}
+
+// canRead пускает к заданию только тех, кому открыт урок
+func canRead(c *fiber.Ctx, courseID, lessonID uint) (bool, error) {
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, lessonID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return false, availability.Deny(c, status)
+	}
+
+	return true, nil
+}
+
+// round оставляет два знака после запятой, как в numeric(7,2)
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// lateness возвращает, на сколько дней опоздает ответ, сданный в момент now,
+// или ошибку, если задание его уже не примет
+func lateness(assignment *storage.EeAssignment, now time.Time) (int, error) {
+	if assignment.DueAt == nil || !now.After(*assignment.DueAt) {
+		return 0, nil
+	}
+
+	if assignment.LatePolicy == LateReject {
+		return 0, errors.New("the deadline has passed")
+	} else if assignment.LateUntil != nil && now.After(*assignment.LateUntil) {
+		return 0, errors.New("late submissions are closed")
+	}
+
+	return int(math.Ceil(now.Sub(*assignment.DueAt).Hours() / 24)), nil
+}
+
+// Final возвращает штраф в процентах за опоздание на days дней и итоговый балл с его учётом
+func Final(assignment *storage.EeAssignment, days int, raw float64) (float64, float64) {
+	penalty := 0.0
+	if assignment.LatePolicy == LatePenalty {
+		penalty = float64(min(100, days*assignment.LatePenalty))
+	}
+
+	return penalty, round(raw * (100 - penalty) / 100)
+}
+
+// accepts проверяет тип файла по списку задания, пустой список принимает всё
+func accepts(assignment *storage.EeAssignment, mimeType string) bool {
+	var types []string
+	if err := json.Unmarshal(assignment.AllowedTypes, &types); err != nil || len(types) == 0 {
+		return true
+	}
+
+	return slices.Contains(types, mimeType)
+}
+
+func Rubric(tx *gorm.DB, assignmentID uint) ([]storage.EeAssignmentCriterion, error) {
+	items := []storage.EeAssignmentCriterion{}
+	err := tx.Where("assignment_id = ?", assignmentID).Order(`"order"`).Find(&items).Error
+	return items, err
+}
+
+// Evaluate проверяет баллы по рубрике или, если критериев нет, один балл до maxScore.
+// Возвращает сумму и баллы по критериям в порядке рубрики
+func Evaluate(criteria []storage.EeAssignmentCriterion, maxScore float64, scores []ScoreInfo, score *float64) (float64, []ScoreInfo, error) {
+	if len(criteria) == 0 {
+		if score == nil || len(scores) > 0 {
+			return 0, nil, errors.New("assignment has no criteria, send a single score")
+		} else if *score < 0 || *score > maxScore {
+			return 0, nil, fmt.Errorf("score must be between 0 and %g", maxScore)
+		}
+		return round(*score), []ScoreInfo{}, nil
+	}
+
+	if score != nil {
+		return 0, nil, errors.New("assignment is graded by criteria, send scores")
+	}
+
+	given := make(map[uint]ScoreInfo, len(scores))
+	for _, item := range scores {
+		if _, ok := given[item.CriterionID]; ok {
+			return 0, nil, fmt.Errorf("criterion %d is scored twice", item.CriterionID)
+		}
+		given[item.CriterionID] = item
+	}
+
+	var raw float64
+	result := make([]ScoreInfo, len(criteria))
+	for i, criterion := range criteria {
+		item, ok := given[criterion.CriterionID]
+		if !ok {
+			return 0, nil, fmt.Errorf("criterion %d is not scored", criterion.CriterionID)
+		} else if item.Points < 0 || item.Points > criterion.MaxPoints {
+			return 0, nil, fmt.Errorf("points for criterion %d must be between 0 and %g", criterion.CriterionID, criterion.MaxPoints)
+		} else if len([]rune(item.Comment)) > maxCommentRunes {
+			return 0, nil, fmt.Errorf("comment for criterion %d is longer than %d characters", criterion.CriterionID, maxCommentRunes)
+		}
+
+		delete(given, criterion.CriterionID)
+		result[i] = ScoreInfo{CriterionID: criterion.CriterionID, Points: round(item.Points), Comment: strings.TrimSpace(item.Comment)}
+		raw += result[i].Points
+	}
+
+	if len(given) > 0 {
+		return 0, nil, errors.New("scores mention criteria that do not belong to the assignment")
+	}
+
+	return raw, result, nil
+}
+
+func describe(assignment storage.EeAssignment, asHTML bool) (*Assignment, error) {
+	result := &Assignment{EeAssignment: assignment, TotalScore: assignment.MaxScore}
+
+	var err error
+	if result.Criteria, err = Rubric(storage.DB, assignment.AssignmentID); err != nil {
+		return nil, err
+	}
+
+	if len(result.Criteria) > 0 {
+		result.TotalScore = 0
+		for _, criterion := range result.Criteria {
+			result.TotalScore += criterion.MaxPoints
+		}
+	}
+
+	now := time.Now()
+	_, err = lateness(&assignment, now)
+	result.Accepting = err == nil
+	result.Late = result.Accepting && assignment.DueAt != nil && now.After(*assignment.DueAt)
+
+	if asHTML && assignment.Instructions != "" {
+		if result.InstructionsHTML, err = render.Cached(render.Key("assignment", assignment.AssignmentID), render.FormatMarkdown, assignment.Instructions); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// Load возвращает задание урока или nil, если урок не является заданием
+func Load(lessonID uint, asHTML bool) (*Assignment, error) {
+	var assignment storage.EeAssignment
+	err := storage.DB.Where("lesson_id = ?", lessonID).First(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return describe(assignment, asHTML)
+}
+
+func GetAssignment(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, lessonID); !ok {
+		return err
+	}
+
+	assignment, err := Load(lessonID, c.Query("format") == "html")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if assignment == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson has no assignment"})
+	}
+
+	return c.JSON(assignment)
+}
+
+// validate проверяет настройки задания и собирает из них запись и критерии
+func validate(info *AssignmentInfo) (storage.EeAssignment, []storage.EeAssignmentCriterion, error) {
+	assignment := storage.EeAssignment{
+		Instructions: strings.TrimSpace(info.Instructions),
+		DueAt:        info.DueAt,
+		LatePolicy:   info.LatePolicy,
+		LatePenalty:  info.LatePenalty,
+		LateUntil:    info.LateUntil,
+		AllowText:    info.AllowText == nil || *info.AllowText,
+		AllowFiles:   info.AllowFiles == nil || *info.AllowFiles,
+		MaxFiles:     defaultMaxFiles,
+		MaxAttempts:  info.MaxAttempts,
+		MaxScore:     round(info.MaxScore),
+
+		PeerReviewers: info.PeerReviewers,
+		PeerDueAt:     info.PeerDueAt,
+	}
+
+	if assignment.LatePolicy == "" {
+		assignment.LatePolicy = LateAccept
+	}
+	if info.MaxFiles != nil {
+		assignment.MaxFiles = *info.MaxFiles
+	}
+	if assignment.MaxScore == 0 {
+		assignment.MaxScore = 100
+	}
+
+	switch {
+	case assignment.LatePolicy != LateAccept && assignment.LatePolicy != LatePenalty && assignment.LatePolicy != LateReject:
+		return assignment, nil, fmt.Errorf("late_policy must be one of %s, %s, %s", LateAccept, LatePenalty, LateReject)
+	case assignment.LatePenalty < 0 || assignment.LatePenalty > 100:
+		return assignment, nil, errors.New("late_penalty must be between 0 and 100")
+	case assignment.LateUntil != nil && (assignment.DueAt == nil || assignment.LateUntil.Before(*assignment.DueAt)):
+		return assignment, nil, errors.New("late_until must not be earlier than due_at")
+	case !assignment.AllowText && !assignment.AllowFiles:
+		return assignment, nil, errors.New("assignment must accept text or files")
+	case assignment.MaxFiles < 1 || assignment.MaxFiles > maxFilesLimit:
+		return assignment, nil, fmt.Errorf("max_files must be between 1 and %d", maxFilesLimit)
+	case assignment.MaxAttempts < 0:
+		return assignment, nil, errors.New("max_attempts must not be negative")
+	case assignment.MaxScore < 0 || assignment.MaxScore > 99999:
+		return assignment, nil, errors.New("max_score must be between 0 and 99999")
+	case assignment.PeerReviewers < 0 || assignment.PeerReviewers > maxPeerReviewers:
+		return assignment, nil, fmt.Errorf("peer_reviewers must be between 0 and %d", maxPeerReviewers)
+	case assignment.PeerReviewers > 0 && assignment.DueAt == nil:
+		return assignment, nil, errors.New("peer review needs due_at: reviewers are allocated when it passes")
+	case assignment.PeerDueAt != nil && (assignment.DueAt == nil || !assignment.PeerDueAt.After(*assignment.DueAt)):
+		return assignment, nil, errors.New("peer_due_at must be later than due_at")
+	}
+
+	if assignment.PeerReviewers == 0 {
+		assignment.PeerDueAt = nil
+	}
+
+	if assignment.LatePolicy != LatePenalty {
+		assignment.LatePenalty = 0
+	}
+	if assignment.LatePolicy == LateReject {
+		assignment.LateUntil = nil
+	}
+
+	types := []string{}
+	for _, mimeType := range info.AllowedTypes {
+		mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+		if !uploads.IsAllowedType(uploads.PurposeSubmission, mimeType) {
+			return assignment, nil, fmt.Errorf("file type %q cannot be uploaded as a submission", mimeType)
+		}
+		if !slices.Contains(types, mimeType) {
+			types = append(types, mimeType)
+		}
+	}
+	assignment.AllowedTypes, _ = json.Marshal(types)
+
+	criteria := make([]storage.EeAssignmentCriterion, len(info.Criteria))
+	for i, item := range info.Criteria {
+		criteria[i] = storage.EeAssignmentCriterion{
+			Title:       strings.TrimSpace(item.Title),
+			Description: strings.TrimSpace(item.Description),
+			MaxPoints:   round(item.MaxPoints),
+			Order:       i + 1,
+		}
+
+		if criteria[i].Title == "" || len([]rune(criteria[i].Title)) > 255 {
+			return assignment, nil, fmt.Errorf("criterion %d needs a title up to 255 characters", i+1)
+		} else if criteria[i].MaxPoints <= 0 || criteria[i].MaxPoints > 99999 {
+			return assignment, nil, fmt.Errorf("criterion %d needs max_points between 0 and 99999", i+1)
+		}
+	}
+
+	return assignment, criteria, nil
+}
+
+// replaceRubric заменяет критерии задания. После начала проверки меняются только
+// названия и описания, иначе выставленные баллы потеряли бы смысл
+func replaceRubric(tx *gorm.DB, assignmentID uint, criteria []storage.EeAssignmentCriterion) error {
+	current, err := Rubric(tx, assignmentID)
+	if err != nil {
+		return err
+	}
+
+	same := len(current) == len(criteria)
+	for i := 0; same && i < len(criteria); i++ {
+		same = current[i].MaxPoints == criteria[i].MaxPoints
+	}
+
+	if same {
+		for i := range criteria {
+			criteria[i].CriterionID = current[i].CriterionID
+			criteria[i].AssignmentID = assignmentID
+			if err := tx.Save(&criteria[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var graded int64
+	err = tx.Model(&storage.EeSubmission{}).Where("assignment_id = ? AND graded_at IS NOT NULL", assignmentID).Count(&graded).Error
+	if err != nil {
+		return err
+	} else if graded > 0 {
+		return errRubricGraded
+	}
+
+	if err := tx.Where("assignment_id = ?", assignmentID).Delete(&storage.EeAssignmentCriterion{}).Error; err != nil {
+		return err
+	}
+
+	for i := range criteria {
+		criteria[i].AssignmentID = assignmentID
+	}
+	if len(criteria) == 0 {
+		return nil
+	}
+
+	return tx.Create(&criteria).Error
+}
+
+func PutAssignment(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := AssignmentInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse assignment data"})
+	}
+
+	assignment, criteria, err := validate(&info)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	assignment.LessonID = lessonID
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		var existing storage.EeAssignment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("lesson_id = ?", lessonID).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := tx.Create(&assignment).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else {
+			if existing.PeerAllocatedAt != nil && existing.PeerReviewers != assignment.PeerReviewers {
+				return errAllocated
+			}
+
+			assignment.AssignmentID = existing.AssignmentID
+			assignment.PeerAllocatedAt = existing.PeerAllocatedAt
+			assignment.CreatedAt = existing.CreatedAt
+			if err := tx.Save(&assignment).Error; err != nil {
+				return err
+			}
+		}
+
+		return replaceRubric(tx, assignment.AssignmentID, criteria)
+	})
+	if errors.Is(err, errRubricGraded) || errors.Is(err, errAllocated) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result, err := Load(lessonID, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(result)
+}
+
+// DeleteAssignment удаляет задание вместе с ответами, их файлы удалит очистка загрузок
+func DeleteAssignment(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	result := storage.DB.Where("lesson_id = ?", lessonID).Delete(&storage.EeAssignment{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	} else if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson has no assignment"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// findAssignment загружает задание из :id, при ошибке возвращает nil и уже отправленный ответ
+func findAssignment(c *fiber.Ctx) (*storage.EeAssignment, uint, error) {
+	var assignment storage.EeAssignment
+	err := storage.DB.Where("assignment_id = ?", c.Params("id")).First(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "assignment not found"})
+	} else if err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(assignment.LessonID)
+	if err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return &assignment, courseID, nil
+}
+
+// findSubmission загружает ответ из :id вместе с заданием. Чужие ответы видят только преподаватели
+func findSubmission(c *fiber.Ctx, submission *storage.EeSubmission) (*storage.EeAssignment, uint, error) {
+	err := storage.DB.Where("submission_id = ?", c.Params("id")).First(submission).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "submission not found"})
+	} else if err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var assignment storage.EeAssignment
+	if err := storage.DB.Where("assignment_id = ?", submission.AssignmentID).First(&assignment).Error; err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(assignment.LessonID)
+	if err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if submission.UserID != middleware.UserID(c) {
+		if staff, err := enrollments.CanManage(c, courseID); err != nil {
+			return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if !staff {
+			return nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "submission not found"})
+		}
+	}
+
+	return &assignment, courseID, nil
+}
+
+// Files возвращает файлы ответов по порядку с подписанными для текущего пользователя ссылками.
+// Доступ к ответам проверяет вызывающий
+func Files(c *fiber.Ctx, submissionIDs []uint) (map[uint][]SubmissionFile, error) {
+	var rows []struct {
+		SubmissionFile
+		SubmissionID uint
+	}
+	err := storage.DB.Table("ee_submission_files").
+		Select(`ee_submission_files.submission_id, ee_submission_files."order", ee_uploads.upload_id, ee_uploads.filename, ee_uploads.mime_type, ee_uploads.size`).
+		Joins("JOIN ee_uploads ON ee_uploads.upload_id = ee_submission_files.upload_id").
+		Where("ee_submission_files.submission_id IN ?", submissionIDs).
+		Order(`ee_submission_files."order"`).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint][]SubmissionFile, len(submissionIDs))
+	for _, submissionID := range submissionIDs {
+		result[submissionID] = []SubmissionFile{}
+	}
+
+	userID := middleware.UserID(c)
+	for _, row := range rows {
+		row.URL = media.Sign(row.UploadID, userID, true).URL
+		result[row.SubmissionID] = append(result[row.SubmissionID], row.SubmissionFile)
+	}
+
+	return result, nil
+}
+
+// details дополняет ответы файлами, баллами и замечаниями. Студенту оценка
+// показывается только после того, как преподаватель её откроет
+func details(c *fiber.Ctx, list []storage.EeSubmission, staff bool) ([]Submission, error) {
+	result := make([]Submission, len(list))
+	if len(list) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uint, len(list))
+	userIDs := make([]uint, len(list))
+	for i, submission := range list {
+		ids[i] = submission.SubmissionID
+		userIDs[i] = submission.UserID
+	}
+
+	files, err := Files(c, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []storage.EeUser
+	if err := storage.DB.Select("user_id, username").Where("user_id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.UserID] = user.Username
+	}
+
+	var scores []storage.EeSubmissionScore
+	var comments []storage.EeSubmissionComment
+	if err := storage.DB.Where("submission_id IN ?", ids).Find(&scores).Error; err != nil {
+		return nil, err
+	}
+	if err := storage.DB.Where("submission_id IN ?", ids).Order("comment_id").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+
+	index := make(map[uint]int, len(list))
+	for i, submission := range list {
+		index[submission.SubmissionID] = i
+		result[i] = Submission{
+			EeSubmission: submission,
+			Username:     usernames[submission.UserID],
+			Files:        files[submission.SubmissionID],
+			Scores:       []storage.EeSubmissionScore{},
+			Comments:     []storage.EeSubmissionComment{},
+		}
+
+		if !staff && submission.ReleasedAt == nil {
+			result[i].RawScore, result[i].Score, result[i].Penalty = nil, nil, 0
+			result[i].Feedback, result[i].GradedBy, result[i].GradedAt = "", nil, nil
+			result[i].PeerScore, result[i].GradeSource = nil, nil
+		}
+	}
+
+	visible := func(submissionID uint) bool {
+		return staff || result[index[submissionID]].ReleasedAt != nil
+	}
+
+	for _, score := range scores {
+		if visible(score.SubmissionID) {
+			i := index[score.SubmissionID]
+			result[i].Scores = append(result[i].Scores, score)
+		}
+	}
+	for _, comment := range comments {
+		if visible(comment.SubmissionID) {
+			i := index[comment.SubmissionID]
+			result[i].Comments = append(result[i].Comments, comment)
+		}
+	}
+
+	return result, nil
+}
+
+func respond(c *fiber.Ctx, status int, submissionID uint, staff bool) error {
+	var submission storage.EeSubmission
+	if err := storage.DB.Where("submission_id = ?", submissionID).First(&submission).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result, err := details(c, []storage.EeSubmission{submission}, staff)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.Status(status).JSON(result[0])
+}
+
+// submit принимает новую попытку: текст и файлы, заранее загруженные с назначением submission
+func submit(c *fiber.Ctx) error {
+	assignment, courseID, err := findAssignment(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, assignment.LessonID); !ok {
+		return err
+	}
+
+	// Персонал и преподаватели потоков видят задание, но ответы сдают только студенты
+	if student, err := enrollments.IsStudent(middleware.UserID(c), courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !student {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only students of the course can submit answers"})
+	}
+
+	info := SubmitInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse submission data"})
+	}
+
+	text := strings.TrimSpace(info.Text)
+	uploadIDs := []string{}
+	for _, uploadID := range info.UploadIDs {
+		if !slices.Contains(uploadIDs, uploadID) {
+			uploadIDs = append(uploadIDs, uploadID)
+		}
+	}
+
+	switch {
+	case text == "" && len(uploadIDs) == 0:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "submission needs text or files"})
+	case text != "" && !assignment.AllowText:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "assignment does not accept text answers"})
+	case len([]rune(text)) > maxTextRunes:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("text is longer than %d characters", maxTextRunes)})
+	case len(uploadIDs) > 0 && !assignment.AllowFiles:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "assignment does not accept files"})
+	case len(uploadIDs) > assignment.MaxFiles:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("assignment accepts at most %d files", assignment.MaxFiles)})
+	}
+
+	now := time.Now()
+	lateDays, err := lateness(assignment, now)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Приложить можно только свои завершённые загрузки для этого задания
+	var files []storage.EeUpload
+	if err := storage.DB.Where("upload_id IN ?", uploadIDs).Find(&files).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+	found := make(map[string]storage.EeUpload, len(files))
+	for _, file := range files {
+		found[file.UploadID] = file
+	}
+	for _, uploadID := range uploadIDs {
+		file, ok := found[uploadID]
+		if !ok || file.UserID != middleware.UserID(c) || file.Purpose != uploads.PurposeSubmission ||
+			file.LessonID == nil || *file.LessonID != assignment.LessonID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("upload %s cannot be attached to the submission", uploadID)})
+		} else if file.Status != uploads.StatusComplete {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("upload %s is not finished", uploadID)})
+		} else if !accepts(assignment, file.MimeType) {
+			return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": fmt.Sprintf("file type %q is not accepted by the assignment", file.MimeType)})
+		}
+	}
+
+	submission := storage.EeSubmission{
+		AssignmentID: assignment.AssignmentID,
+		UserID:       middleware.UserID(c),
+		TextBody:     text,
+		LateDays:     lateDays,
+		SubmittedAt:  now,
+	}
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		// Блокировка задания не даёт двум одновременным сдачам получить один номер попытки
+		var locked storage.EeAssignment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("assignment_id = ?", assignment.AssignmentID).First(&locked).Error; err != nil {
+			return err
+		}
+
+		// Рецензенты распределены по уже сданным ответам, новая попытка осталась бы без рецензий
+		if locked.PeerReviewers > 0 && locked.PeerAllocatedAt != nil {
+			return errReviewStarted
+		}
+
+		var attempts int64
+		if err := tx.Model(&storage.EeSubmission{}).Where("assignment_id = ? AND user_id = ?", assignment.AssignmentID, submission.UserID).Count(&attempts).Error; err != nil {
+			return err
+		} else if assignment.MaxAttempts > 0 && int(attempts) >= assignment.MaxAttempts {
+			return errNoAttempts
+		}
+
+		submission.Attempt = int(attempts) + 1
+		if err := tx.Create(&submission).Error; err != nil {
+			return err
+		}
+
+		for i, uploadID := range uploadIDs {
+			file := storage.EeSubmissionFile{SubmissionID: submission.SubmissionID, UploadID: uploadID, Order: i + 1}
+			if err := tx.Create(&file).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if errors.Is(err, errNoAttempts) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("assignment allows at most %d attempts", assignment.MaxAttempts)})
+	} else if errors.Is(err, errReviewStarted) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusCreated, submission.SubmissionID, false)
+}
+
+// mySubmissions - история попыток текущего пользователя, новые первыми
+func mySubmissions(c *fiber.Ctx) error {
+	assignment, courseID, err := findAssignment(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, assignment.LessonID); !ok {
+		return err
+	}
+
+	var list []storage.EeSubmission
+	err = storage.DB.Where("assignment_id = ? AND user_id = ?", assignment.AssignmentID, middleware.UserID(c)).Order("attempt DESC").Find(&list).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result, err := details(c, list, staff)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(result)
+}
+
+// inbox - последние попытки студентов по заданию или по всем заданиям курса, старые первыми.
+// ?status=ungraded (по умолчанию), graded или all
+func inbox(c *fiber.Ctx, courseID, assignmentID uint) error {
+	latest := storage.DB.Table("ee_submissions").
+		Select("DISTINCT ON (ee_submissions.assignment_id, ee_submissions.user_id) ee_submissions.*, " +
+			"COUNT(*) OVER (PARTITION BY ee_submissions.assignment_id, ee_submissions.user_id) AS attempts").
+		Order("ee_submissions.assignment_id, ee_submissions.user_id, ee_submissions.attempt DESC")
+	if assignmentID != 0 {
+		latest = latest.Where("ee_submissions.assignment_id = ?", assignmentID)
+	} else {
+		latest = latest.
+			Joins("JOIN ee_assignments ON ee_assignments.assignment_id = ee_submissions.assignment_id").
+			Joins("JOIN ee_lessons ON ee_lessons.lesson_id = ee_assignments.lesson_id").
+			Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+			Where("ee_course_sections.course_id = ?", courseID)
+	}
+
+	query := storage.DB.Table("(?) AS latest", latest).
+		Select("latest.*, ee_users.username, ee_lessons.lesson_id, ee_lessons.title AS lesson_title").
+		Joins("JOIN ee_users ON ee_users.user_id = latest.user_id").
+		Joins("JOIN ee_assignments ON ee_assignments.assignment_id = latest.assignment_id").
+		Joins("JOIN ee_lessons ON ee_lessons.lesson_id = ee_assignments.lesson_id").
+		Order("latest.submitted_at, latest.submission_id")
+
+	switch c.Query("status", StatusUngraded) {
+	case StatusUngraded:
+		query = query.Where("latest.graded_at IS NULL")
+	case StatusGraded:
+		query = query.Where("latest.graded_at IS NOT NULL")
+	case StatusAll:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("status must be one of %s, %s, %s", StatusUngraded, StatusGraded, StatusAll)})
+	}
+
+	items := []InboxItem{}
+	if err := query.Scan(&items).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(items)
+}
+
+func getInbox(c *fiber.Ctx) error {
+	assignment, courseID, err := findAssignment(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return inbox(c, courseID, assignment.AssignmentID)
+}
+
+// GetCourseInbox - входящие ответы по всем заданиям курса
+func GetCourseInbox(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	if ok, err := enrollments.CanManage(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return inbox(c, uint(courseID), 0)
+}
+
+func getSubmission(c *fiber.Ctx) error {
+	var submission storage.EeSubmission
+	assignment, courseID, err := findSubmission(c, &submission)
+	if assignment == nil {
+		return err
+	}
+
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, submission.SubmissionID, staff)
+}
+
+// gradeSubmission выставляет оценку. Итоговый балл учитывает штраф за опоздание по текущим правилам задания
+func gradeSubmission(c *fiber.Ctx) error {
+	var submission storage.EeSubmission
+	assignment, courseID, err := findSubmission(c, &submission)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := GradeInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse grade data"})
+	}
+
+	criteria, err := Rubric(storage.DB, assignment.AssignmentID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	raw, given, err := Evaluate(criteria, assignment.MaxScore, info.Scores, info.Score)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	scores := make([]storage.EeSubmissionScore, len(given))
+	for i, score := range given {
+		scores[i] = storage.EeSubmissionScore{
+			SubmissionID: submission.SubmissionID,
+			CriterionID:  score.CriterionID,
+			Points:       score.Points,
+			Comment:      score.Comment,
+		}
+	}
+
+	feedback := strings.TrimSpace(info.Feedback)
+	if len([]rune(feedback)) > maxTextRunes {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("feedback is longer than %d characters", maxTextRunes)})
+	}
+
+	rate, score := Final(assignment, submission.LateDays, raw)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"raw_score":    raw,
+		"penalty":      rate,
+		"score":        score,
+		"feedback":     feedback,
+		"graded_by":    middleware.UserID(c),
+		"graded_at":    now,
+		"grade_source": GradeInstructor,
+	}
+	if info.Release && submission.ReleasedAt == nil {
+		updates["released_at"] = now
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("submission_id = ?", submission.SubmissionID).Delete(&storage.EeSubmissionScore{}).Error; err != nil {
+			return err
+		}
+		if len(scores) > 0 {
+			if err := tx.Create(&scores).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&storage.EeSubmission{}).Where("submission_id = ?", submission.SubmissionID).Updates(updates).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, submission.SubmissionID, true)
+}
+
+// releaseSubmission открывает оценку студенту или снова скрывает её
+func releaseSubmission(c *fiber.Ctx) error {
+	var submission storage.EeSubmission
+	assignment, courseID, err := findSubmission(c, &submission)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := ReleaseInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse release data"})
+	}
+
+	var releasedAt *time.Time
+	if info.Released {
+		if submission.GradedAt == nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "submission is not graded yet"})
+		}
+
+		now := time.Now()
+		releasedAt = &now
+		if submission.ReleasedAt != nil {
+			releasedAt = submission.ReleasedAt
+		}
+	}
+
+	if err := storage.DB.Model(&submission).Update("released_at", releasedAt).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, submission.SubmissionID, true)
+}
+
+// releaseAll открывает все проверенные оценки задания или скрывает все открытые
+func releaseAll(c *fiber.Ctx) error {
+	assignment, courseID, err := findAssignment(c)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := ReleaseInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse release data"})
+	}
+
+	query := storage.DB.Model(&storage.EeSubmission{}).Where("assignment_id = ?", assignment.AssignmentID)
+	var result *gorm.DB
+	if info.Released {
+		result = query.Where("graded_at IS NOT NULL AND released_at IS NULL").Update("released_at", time.Now())
+	} else {
+		result = query.Where("released_at IS NOT NULL").Update("released_at", nil)
+	}
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	}
+
+	return c.JSON(fiber.Map{"updated": result.RowsAffected})
+}
+
+// addComment оставляет замечание к фрагменту текста ответа или к месту в файле
+func addComment(c *fiber.Ctx) error {
+	var submission storage.EeSubmission
+	assignment, courseID, err := findSubmission(c, &submission)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := CommentInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse comment data"})
+	}
+
+	userID := middleware.UserID(c)
+	comment := storage.EeSubmissionComment{
+		SubmissionID: submission.SubmissionID,
+		UserID:       &userID,
+		UploadID:     info.UploadID,
+		AnchorStart:  info.AnchorStart,
+		AnchorEnd:    info.AnchorEnd,
+		Location:     strings.TrimSpace(info.Location),
+		Body:         strings.TrimSpace(info.Body),
+	}
+
+	switch {
+	case comment.Body == "":
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "comment body is required"})
+	case len([]rune(comment.Body)) > maxCommentRunes:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("comment is longer than %d characters", maxCommentRunes)})
+	case len([]rune(comment.Location)) > maxLocationRunes:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("location is longer than %d characters", maxLocationRunes)})
+	case (comment.AnchorStart == nil) != (comment.AnchorEnd == nil):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "anchor_start and anchor_end go together"})
+	case comment.AnchorStart != nil && (*comment.AnchorStart < 0 || *comment.AnchorEnd < *comment.AnchorStart):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "anchor needs 0 <= anchor_start <= anchor_end"})
+	case comment.UploadID == nil && comment.AnchorEnd != nil && *comment.AnchorEnd > len([]rune(submission.TextBody)):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "anchor is outside of the submission text"})
+	}
+
+	if comment.UploadID != nil {
+		var count int64
+		err := storage.DB.Model(&storage.EeSubmissionFile{}).Where("submission_id = ? AND upload_id = ?", submission.SubmissionID, *comment.UploadID).Count(&count).Error
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if count == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file does not belong to the submission"})
+		}
+	}
+
+	if err := storage.DB.Create(&comment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&comment)
+}
+
+func deleteComment(c *fiber.Ctx) error {
+	var submission storage.EeSubmission
+	assignment, courseID, err := findSubmission(c, &submission)
+	if assignment == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	result := storage.DB.Where("comment_id = ? AND submission_id = ?", c.Params("comment_id"), submission.SubmissionID).Delete(&storage.EeSubmissionComment{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	} else if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "comment not found"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/assignments", middleware.TokenRequired)
+	{
+		g.Get("/:id/submissions", getInbox)
+		g.Post("/:id/submissions", submit)
+		g.Get("/:id/submissions/mine", mySubmissions)
+		g.Put("/:id/release", releaseAll)
+	}
+
+	s := app.Group("/submissions", middleware.TokenRequired)
+	{
+		s.Get("/:id", getSubmission)
+		s.Put("/:id/grade", gradeSubmission)
+		s.Put("/:id/release", releaseSubmission)
+		s.Post("/:id/comments", addComment)
+		s.Delete("/:id/comments/:comment_id", deleteComment)
+	}
+}
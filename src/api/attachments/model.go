@@ -0,0 +1,44 @@
+package attachments
+
+import (
+	"ekb-edu/src/database/storage"
+	"errors"
+)
+
+// Архив собирается на лету, поэтому его размер ограничен
+const maxArchiveSize = 2 << 30
+
+var errInvalidOrder = errors.New("attachment_ids must list every attachment exactly once")
+
+type AttachmentInfo struct {
+	UploadID    string `json:"upload_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Position    *int   `json:"position"` // nil - в конец списка
+}
+
+type UpdateInfo struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Position    *int    `json:"position"`
+}
+
+type ReorderInfo struct {
+	AttachmentIDs []uint `json:"attachment_ids"`
+}
+
+// Вложение со сведениями о файле и подписанной ссылкой для текущего пользователя
+type Attachment struct {
+	storage.EeAttachment
+	Filename string `json:"filename"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	BlobKey  string `json:"-"`
+	URL      string `json:"url"`
+	Download bool   `json:"download"` // false - файл только просматривается по политике курса
+}
+
+type archiveEntry struct {
+	Path       string
+	Attachment *Attachment
+}
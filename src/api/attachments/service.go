@@ -0,0 +1,642 @@
+package attachments
+
+import (
+	"archive/zip"
+	"bufio"
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/media"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/uploads"
+	"ekb-edu/src/database/files"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// scope ограничивает запрос вложениями урока или, если lessonID == nil, самого курса
+func scope(tx *gorm.DB, courseID uint, lessonID *uint) *gorm.DB {
+	query := tx.Where("ee_attachments.course_id = ?", courseID)
+	if lessonID == nil {
+		return query.Where("ee_attachments.lesson_id IS NULL")
+	}
+
+	return query.Where("ee_attachments.lesson_id = ?", *lessonID)
+}
+
+func withFiles(tx *gorm.DB) *gorm.DB {
+	return tx.Table("ee_attachments").
+		Select("ee_attachments.*, ee_uploads.filename, ee_uploads.mime_type, ee_uploads.size, ee_uploads.blob_key").
+		Joins("JOIN ee_uploads ON ee_uploads.upload_id = ee_attachments.upload_id").
+		Order(`ee_attachments."order", ee_attachments.attachment_id`)
+}
+
+func list(courseID uint, lessonID *uint) ([]Attachment, error) {
+	items := []Attachment{}
+	err := scope(withFiles(storage.DB), courseID, lessonID).Scan(&items).Error
+	return items, err
+}
+
+// sign выдаёт ссылки на файлы, скачивание - если позволяет политика курса
+func sign(c *fiber.Ctx, courseID uint, items []Attachment) error {
+	download, err := media.CanDownload(c, &storage.EeUpload{CourseID: courseID, Purpose: uploads.PurposeAttachment})
+	if err != nil {
+		return err
+	}
+
+	userID := middleware.UserID(c)
+	for i := range items {
+		items[i].Download = download
+		items[i].URL = media.Sign(items[i].UploadID, userID, download).URL
+	}
+
+	return nil
+}
+
+// ForLesson возвращает вложения урока с подписанными ссылками для текущего пользователя
+func ForLesson(c *fiber.Ctx, lessonID uint) ([]Attachment, error) {
+	courseID, err := enrollments.CourseIDByLesson(lessonID)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := list(courseID, &lessonID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, sign(c, courseID, items)
+}
+
+func ids(tx *gorm.DB, courseID uint, lessonID *uint) ([]uint, error) {
+	var attachmentIDs []uint
+	err := scope(tx.Model(&storage.EeAttachment{}), courseID, lessonID).
+		Order(`"order", attachment_id`).
+		Pluck("attachment_id", &attachmentIDs).Error
+	return attachmentIDs, err
+}
+
+func renumber(tx *gorm.DB, attachmentIDs []uint) error {
+	for i, attachmentID := range attachmentIDs {
+		if err := tx.Model(&storage.EeAttachment{}).Where("attachment_id = ? AND \"order\" <> ?", attachmentID, i).Update("order", i).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ставит вложение на позицию position (nil - в конец), остальные сдвигаются
+func place(tx *gorm.DB, attachment *storage.EeAttachment, position *int) error {
+	attachmentIDs, err := ids(tx, attachment.CourseID, attachment.LessonID)
+	if err != nil {
+		return err
+	}
+
+	others := make([]uint, 0, len(attachmentIDs))
+	for _, attachmentID := range attachmentIDs {
+		if attachmentID != attachment.AttachmentID {
+			others = append(others, attachmentID)
+		}
+	}
+
+	index := len(others)
+	if position != nil {
+		index = min(max(*position, 0), len(others))
+	}
+
+	ordered := append(append(append([]uint{}, others[:index]...), attachment.AttachmentID), others[index:]...)
+	attachment.Order = index
+
+	return renumber(tx, ordered)
+}
+
+// target разбирает :id как урок или курс. При ошибке ответ уже отправлен и courseID == 0
+func target(c *fiber.Ctx, lesson bool) (uint, *uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid id"})
+	}
+
+	if !lesson {
+		var count int64
+		if err := storage.DB.Model(&storage.EeCourse{}).Where("course_id = ?", id).Count(&count).Error; err != nil {
+			return 0, nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if count == 0 {
+			return 0, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+		}
+
+		return uint(id), nil, nil
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(id))
+	if err != nil {
+		return 0, nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	lessonID := uint(id)
+	return courseID, &lessonID, nil
+}
+
+// canRead проверяет запись на курс и доступность урока. При отказе ответ уже отправлен
+func canRead(c *fiber.Ctx, courseID uint, lessonID *uint) (bool, error) {
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	if lessonID != nil {
+		status, err := availability.ForLessonID(c, *lessonID)
+		if err != nil {
+			return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if status.Locked {
+			return false, availability.Deny(c, status)
+		}
+	}
+
+	return true, nil
+}
+
+func getAttachments(c *fiber.Ctx, lesson bool) error {
+	courseID, lessonID, err := target(c, lesson)
+	if courseID == 0 {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, lessonID); !ok {
+		return err
+	}
+
+	items, err := list(courseID, lessonID)
+	if err == nil {
+		err = sign(c, courseID, items)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(items)
+}
+
+func createAttachment(c *fiber.Ctx, lesson bool) error {
+	courseID, lessonID, err := target(c, lesson)
+	if courseID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := AttachmentInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse attachment data"})
+	}
+
+	// Файл должен быть полностью загружен для этого же курса и урока
+	var upload storage.EeUpload
+	err = storage.DB.Where("upload_id = ? AND status = ? AND purpose = ?", info.UploadID, uploads.StatusComplete, uploads.PurposeAttachment).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "upload_id must reference a completed attachment upload"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if upload.CourseID != courseID || (upload.LessonID != nil && (lessonID == nil || *upload.LessonID != *lessonID)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file was uploaded for another course or lesson"})
+	}
+
+	var attached int64
+	if err := storage.DB.Model(&storage.EeAttachment{}).Where("upload_id = ?", upload.UploadID).Count(&attached).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if attached > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "file is already attached"})
+	}
+
+	info.Title = strings.TrimSpace(info.Title)
+	if info.Title == "" {
+		info.Title = upload.Filename
+	}
+	if len([]rune(info.Title)) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "title is longer than 255 characters"})
+	}
+
+	attachment := storage.EeAttachment{
+		CourseID:    courseID,
+		LessonID:    lessonID,
+		UploadID:    upload.UploadID,
+		Title:       info.Title,
+		Description: info.Description,
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attachment).Error; err != nil {
+			return err
+		}
+
+		return place(tx, &attachment, info.Position)
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&attachment)
+}
+
+func reorderAttachments(c *fiber.Ctx, lesson bool) error {
+	courseID, lessonID, err := target(c, lesson)
+	if courseID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := ReorderInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse attachment order"})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		attachmentIDs, err := ids(tx, courseID, lessonID)
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[uint]bool, len(attachmentIDs))
+		for _, attachmentID := range attachmentIDs {
+			existing[attachmentID] = true
+		}
+
+		if len(info.AttachmentIDs) != len(attachmentIDs) {
+			return errInvalidOrder
+		}
+		for _, attachmentID := range info.AttachmentIDs {
+			if !existing[attachmentID] {
+				return errInvalidOrder
+			}
+			delete(existing, attachmentID)
+		}
+
+		return renumber(tx, info.AttachmentIDs)
+	})
+
+	if errors.Is(err, errInvalidOrder) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	items, err := list(courseID, lessonID)
+	if err == nil {
+		err = sign(c, courseID, items)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(items)
+}
+
+func GetLessonAttachments(c *fiber.Ctx) error {
+	return getAttachments(c, true)
+}
+
+func CreateLessonAttachment(c *fiber.Ctx) error {
+	return createAttachment(c, true)
+}
+
+func ReorderLessonAttachments(c *fiber.Ctx) error {
+	return reorderAttachments(c, true)
+}
+
+func GetCourseAttachments(c *fiber.Ctx) error {
+	return getAttachments(c, false)
+}
+
+func CreateCourseAttachment(c *fiber.Ctx) error {
+	return createAttachment(c, false)
+}
+
+func ReorderCourseAttachments(c *fiber.Ctx) error {
+	return reorderAttachments(c, false)
+}
+
+func findAttachment(c *fiber.Ctx, attachment *storage.EeAttachment) (bool, error) {
+	err := storage.DB.Where("attachment_id = ?", c.Params("id")).First(attachment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "attachment not found"})
+	} else if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := enrollments.CanManage(c, attachment.CourseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return true, nil
+}
+
+func updateAttachment(c *fiber.Ctx) error {
+	var attachment storage.EeAttachment
+	if ok, err := findAttachment(c, &attachment); !ok {
+		return err
+	}
+
+	info := UpdateInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse attachment data"})
+	}
+
+	if info.Title != nil {
+		title := strings.TrimSpace(*info.Title)
+		if title == "" || len([]rune(title)) > 255 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "title must be 1 to 255 characters long"})
+		}
+		attachment.Title = title
+	}
+	if info.Description != nil {
+		attachment.Description = *info.Description
+	}
+
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&attachment).Error; err != nil {
+			return err
+		}
+
+		if info.Position == nil {
+			return nil
+		}
+
+		return place(tx, &attachment, info.Position)
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&attachment)
+}
+
+// deleteAttachment удаляет вложение вместе с файлом, освобождая квоту загрузившего
+func deleteAttachment(c *fiber.Ctx) error {
+	var attachment storage.EeAttachment
+	if ok, err := findAttachment(c, &attachment); !ok {
+		return err
+	}
+
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&attachment).Error; err != nil {
+			return err
+		}
+
+		attachmentIDs, err := ids(tx, attachment.CourseID, attachment.LessonID)
+		if err != nil {
+			return err
+		}
+
+		return renumber(tx, attachmentIDs)
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var upload storage.EeUpload
+	if err := storage.DB.Where("upload_id = ?", attachment.UploadID).First(&upload).Error; err == nil {
+		if err := uploads.Remove(&upload); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// safeName делает из названия урока или курса имя файла или папки внутри архива
+func safeName(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return fallback
+	}
+
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+
+	return name
+}
+
+// archivePath добавляет номер к имени, если такой файл в папке уже есть
+func archivePath(used map[string]bool, folder, filename string) string {
+	candidate := folder + filename
+	ext := path.Ext(filename)
+	for n := 2; used[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s%s (%d)%s", folder, strings.TrimSuffix(filename, ext), n, ext)
+	}
+
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// Уже сжатые форматы (PDF, изображения, документы Office) сохраняются без повторного сжатия
+func compression(mimeType string) uint16 {
+	if strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" {
+		return zip.Deflate
+	}
+
+	return zip.Store
+}
+
+// sendArchive отдаёт вложения одним ZIP-архивом, который собирается во время отправки
+func sendArchive(c *fiber.Ctx, courseID uint, name string, entries []archiveEntry) error {
+	if len(entries) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "there are no attachments to download"})
+	}
+
+	download, err := media.CanDownload(c, &storage.EeUpload{CourseID: courseID, Purpose: uploads.PurposeAttachment})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !download {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "downloading attachments is not allowed by the course policy"})
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Attachment.Size
+	}
+	if total > maxArchiveSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "attachments are too large to download as one archive"})
+	}
+
+	userID := middleware.UserID(c)
+	for _, entry := range entries {
+		media.Record(c, storage.EeMediaAccessLog{
+			UploadID: &entry.Attachment.UploadID,
+			CourseID: courseID,
+			UserID:   &userID,
+			Action:   media.ActionArchive,
+			Download: true,
+			Status:   fiber.StatusOK,
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	c.Set(fiber.HeaderCacheControl, "private, no-store")
+
+	now := time.Now()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		archive := zip.NewWriter(w)
+		for _, entry := range entries {
+			err := func() error {
+				reader, err := files.Store.Open(entry.Attachment.BlobKey)
+				if err != nil {
+					return err
+				}
+				defer reader.Close()
+
+				writer, err := archive.CreateHeader(&zip.FileHeader{
+					Name:     entry.Path,
+					Method:   compression(entry.Attachment.MimeType),
+					Modified: now,
+				})
+				if err != nil {
+					return err
+				}
+
+				_, err = io.Copy(writer, reader)
+				return err
+			}()
+
+			// Заголовки уже отправлены, остаётся только прервать архив
+			if err != nil {
+				log.Printf("cannot add %s to archive: %s", entry.Path, err)
+				return
+			}
+		}
+
+		if err := archive.Close(); err != nil {
+			log.Printf("cannot finish archive: %s", err)
+		}
+	})
+
+	return nil
+}
+
+func LessonArchive(c *fiber.Ctx) error {
+	courseID, lessonID, err := target(c, true)
+	if courseID == 0 {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, lessonID); !ok {
+		return err
+	}
+
+	var lesson storage.EeLesson
+	if err := storage.DB.Where("lesson_id = ?", *lessonID).First(&lesson).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	items, err := list(courseID, lessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	used := make(map[string]bool)
+	entries := make([]archiveEntry, len(items))
+	for i := range items {
+		entries[i] = archiveEntry{Path: archivePath(used, "", items[i].Filename), Attachment: &items[i]}
+	}
+
+	return sendArchive(c, courseID, safeName(lesson.Title, "lesson"), entries)
+}
+
+// SectionArchive собирает вложения открытых уроков раздела, по папке на урок
+func SectionArchive(c *fiber.Ctx) error {
+	var section storage.EeCourseSection
+	err := storage.DB.Where("section_id = ?", c.Params("id")).First(&section).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "section not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := enrollments.CanAccess(c, section.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	var lessons []storage.EeLesson
+	if err := storage.DB.Where("section_id = ?", section.SectionID).Order(`"order", lesson_id`).Find(&lessons).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	resolver, err := availability.For(c, section.CourseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+	resolver.Remember(&section)
+
+	used := make(map[string]bool)
+	var entries []archiveEntry
+	for i, lesson := range lessons {
+		status, err := resolver.Lesson(&lesson)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if status.Locked {
+			continue
+		}
+
+		items, err := list(section.CourseID, &lesson.LessonID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		folder := fmt.Sprintf("%02d. %s/", i+1, safeName(lesson.Title, "lesson"))
+		for j := range items {
+			entries = append(entries, archiveEntry{Path: archivePath(used, folder, items[j].Filename), Attachment: &items[j]})
+		}
+	}
+
+	return sendArchive(c, section.CourseID, safeName(section.Title, "section"), entries)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/attachments", middleware.TokenRequired)
+	{
+		g.Patch("/:id", updateAttachment)
+		g.Delete("/:id", deleteAttachment)
+	}
+}
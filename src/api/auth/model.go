@@ -10,3 +10,8 @@ type ChangePasswordInfo struct {
 	OldPassword string `json:"old_password"`
 	NewPassword string `json:"new_password"`
 }
+
+type ResetPasswordInfo struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
@@ -1,23 +1,48 @@
 package auth
 
 import (
+	"crypto/rand"
 	"crypto/sha256"
 	"ekb-edu/src/api/middleware"
 	"ekb-edu/src/database/storage"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func getPasswordHash(password string) string {
+// Срок действия ссылки для установки пароля
+const passwordTokenTTL = 7 * 24 * time.Hour
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+func GetPasswordHash(password string) string {
 	sum := sha256.Sum256([]byte(password))
 	return hex.EncodeToString(sum[:])
 }
 
+// IssuePasswordToken выдаёт одноразовый токен для установки пароля. В базе хранится только его хеш.
+func IssuePasswordToken(tx *gorm.DB, userID uint) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	err := tx.Create(&storage.EePasswordToken{
+		UserID:    userID,
+		TokenHash: GetPasswordHash(token),
+		ExpiresAt: time.Now().Add(passwordTokenTTL),
+	}).Error
+
+	return token, err
+}
+
 func getClaims(user storage.EeUser) jwt.MapClaims {
 	return jwt.MapClaims{
 		"name":  user.Username,
@@ -45,7 +70,7 @@ func register(c *fiber.Ctx) error {
 	user := storage.EeUser{
 		Username:     userInfo.Username,
 		Email:        userInfo.Email,
-		PasswordHash: getPasswordHash(userInfo.Password),
+		PasswordHash: GetPasswordHash(userInfo.Password),
 	}
 
 	result := storage.DB.Create(&user)
@@ -84,6 +109,45 @@ func changePasswordFromUser(c *fiber.Ctx) error {
 	return c.SendStatus(fiber.StatusOK)
 }
 
+// Устанавливает пароль по одноразовому токену из приглашения
+func resetPassword(c *fiber.Ctx) error {
+	info := ResetPasswordInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse password data"})
+	}
+
+	if info.Token == "" || info.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token and password are required"})
+	}
+
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		var token storage.EePasswordToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", GetPasswordHash(info.Token), time.Now()).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errInvalidToken
+		} else if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&storage.EeUser{}).Where("user_id = ?", token.UserID).
+			Update("password_hash", GetPasswordHash(info.Password)).Error
+	})
+
+	if errors.Is(err, errInvalidToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
 func login(c *fiber.Ctx) error {
 	userInfo := User{}
 
@@ -93,7 +157,7 @@ func login(c *fiber.Ctx) error {
 
 	// Проверяем, существует ли уже пользователь с таким же username или email
 	var user storage.EeUser
-	result := storage.DB.Model(&storage.EeUser{}).Where("username = ? AND password_hash = ?", userInfo.Username, getPasswordHash(userInfo.Password)).First(&user)
+	result := storage.DB.Model(&storage.EeUser{}).Where("username = ? AND password_hash = ?", userInfo.Username, GetPasswordHash(userInfo.Password)).First(&user)
 
 	if result.Error != nil {
 		return result.Error
@@ -116,6 +180,7 @@ func RegisterService(app fiber.Router) {
 	g.Post("/register", register)
 	g.Post("/login", login)
 	g.Put("/password", middleware.TokenRequired, changePasswordFromUser)
+	g.Post("/password/reset", resetPassword)
 
 	g.Get("/restricted", middleware.TokenRequired, func(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusOK)
@@ -0,0 +1,76 @@
+package availability
+
+import (
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/database/storage"
+	"time"
+)
+
+// Rules - правила открытия раздела или урока. Пустое значение снимает ограничение.
+type Rules struct {
+	AvailableFrom      *time.Time `json:"available_from"`
+	AvailableAfterDays *int       `json:"available_after_days"`
+}
+
+// Причины, по которым элемент курса закрыт
+const (
+	ReasonSchedule = "schedule"
+	ReasonLesson   = "lesson"
+	ReasonQuiz     = "quiz"
+)
+
+// Reason - невыполненное условие открытия
+type Reason struct {
+	Type     string     `json:"type"`
+	LessonID *uint      `json:"lesson_id,omitempty"`
+	QuizID   *uint      `json:"quiz_id,omitempty"`
+	Title    string     `json:"title,omitempty"`
+	MinScore int        `json:"min_score,omitempty"`
+	Score    *float64   `json:"score,omitempty"` // Текущий результат теста, null - тест не начат
+	Until    *time.Time `json:"until,omitempty"`
+}
+
+// Status - доступность элемента курса для текущего пользователя
+type Status struct {
+	Locked    bool       `json:"locked"`
+	UnlocksAt *time.Time `json:"unlocks_at"` // null у открытых элементов и у закрытых только условиями
+	Reasons   []Reason   `json:"reasons,omitempty"`
+}
+
+type PrerequisiteQuiz struct {
+	QuizID   uint `json:"quiz_id"`
+	MinScore int  `json:"min_score"`
+}
+
+// PrerequisiteInfo - полный набор условий урока или раздела, заменяет существующий
+type PrerequisiteInfo struct {
+	Lessons []uint             `json:"lessons"`
+	Quizzes []PrerequisiteQuiz `json:"quizzes"`
+}
+
+type PrerequisiteWithTitle struct {
+	storage.EePrerequisite
+	RequiredLessonTitle string `json:"required_lesson_title,omitempty"`
+	RequiredQuizTitle   string `json:"required_quiz_title,omitempty"`
+}
+
+type courseLesson struct {
+	LessonID  uint
+	SectionID uint
+}
+
+// Resolver вычисляет доступность элементов одного курса для одного пользователя
+type Resolver struct {
+	bypass   bool
+	userID   uint
+	courseID uint
+	schedule *enrollments.Schedule
+	now      time.Time
+	sections map[uint]*storage.EeCourseSection
+
+	// Загружаются при первой проверке условий
+	loaded        bool
+	prerequisites []PrerequisiteWithTitle
+	completed     map[uint]bool
+	scores        map[uint]float64
+}
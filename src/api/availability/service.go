@@ -0,0 +1,718 @@
+package availability
+
+import (
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/progress"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInvalidPrerequisites = errors.New("invalid prerequisites")
+
+// For создаёт Resolver для текущего пользователя. Персонал курса видит все материалы сразу.
+func For(c *fiber.Ctx, courseID uint) (*Resolver, error) {
+	resolver := Resolver{
+		userID:   middleware.UserID(c),
+		courseID: courseID,
+		now:      time.Now(),
+		sections: make(map[uint]*storage.EeCourseSection),
+	}
+
+	if staff, err := enrollments.CanManage(c, courseID); err != nil {
+		return nil, err
+	} else if staff {
+		resolver.bypass = true
+		return &resolver, nil
+	}
+
+	schedule, err := enrollments.ScheduleFor(resolver.userID, courseID)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Доступ без записи на курс есть только у администратора и преподавателей потоков
+		if resolver.bypass, err = enrollments.CanAccess(c, courseID); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		resolver.schedule = schedule
+	}
+
+	return &resolver, nil
+}
+
+// Момент открытия по правилам одного элемента, nil - ограничений нет
+func (r *Resolver) unlockTime(from *time.Time, afterDays *int) *time.Time {
+	var result *time.Time
+	if from != nil {
+		result = from
+	}
+
+	if afterDays != nil {
+		// Без расписания относительное правило отсчитывается от текущего момента
+		start := r.now
+		if r.schedule != nil {
+			start = r.schedule.StartsAt
+		}
+
+		relative := start.AddDate(0, 0, *afterDays)
+		if result == nil || relative.After(*result) {
+			result = &relative
+		}
+	}
+
+	return result
+}
+
+func (r *Resolver) status(unlocksAt *time.Time, reasons []Reason) Status {
+	if r.bypass {
+		return Status{}
+	}
+
+	status := Status{}
+	if unlocksAt != nil && r.now.Before(*unlocksAt) {
+		status.UnlocksAt = unlocksAt
+		status.Reasons = append(status.Reasons, Reason{Type: ReasonSchedule, Until: unlocksAt})
+	}
+
+	status.Reasons = append(status.Reasons, reasons...)
+	status.Locked = len(status.Reasons) > 0
+
+	return status
+}
+
+func (r *Resolver) section(sectionID uint) (*storage.EeCourseSection, error) {
+	if section, ok := r.sections[sectionID]; ok {
+		return section, nil
+	}
+
+	var section storage.EeCourseSection
+	if err := storage.DB.Where("section_id = ?", sectionID).First(&section).Error; err != nil {
+		return nil, err
+	}
+
+	r.sections[sectionID] = &section
+	return &section, nil
+}
+
+// Загружает условия курса и результаты пользователя при первом обращении
+func (r *Resolver) loadPrerequisites() error {
+	if r.loaded {
+		return nil
+	}
+
+	prerequisites, err := coursePrerequisites(storage.DB, r.courseID)
+	if err != nil {
+		return err
+	}
+
+	if r.completed, err = progress.CompletedLessons(r.userID, r.courseID); err != nil {
+		return err
+	}
+
+	if r.scores, err = progress.QuizScores(r.userID, r.courseID); err != nil {
+		return err
+	}
+
+	r.prerequisites, r.loaded = prerequisites, true
+	return nil
+}
+
+// Невыполненные условия урока или раздела
+func (r *Resolver) unmet(match func(*storage.EePrerequisite) bool) ([]Reason, error) {
+	if r.bypass {
+		return nil, nil
+	}
+
+	if err := r.loadPrerequisites(); err != nil {
+		return nil, err
+	}
+
+	var reasons []Reason
+	for _, prerequisite := range r.prerequisites {
+		if !match(&prerequisite.EePrerequisite) {
+			continue
+		}
+
+		if lessonID := prerequisite.RequiredLessonID; lessonID != nil && !r.completed[*lessonID] {
+			reasons = append(reasons, Reason{Type: ReasonLesson, LessonID: lessonID, Title: prerequisite.RequiredLessonTitle})
+		}
+
+		if quizID := prerequisite.RequiredQuizID; quizID != nil {
+			score, ok := r.scores[*quizID]
+			if ok && score >= float64(prerequisite.MinScore) {
+				continue
+			}
+
+			reason := Reason{Type: ReasonQuiz, QuizID: quizID, Title: prerequisite.RequiredQuizTitle, MinScore: prerequisite.MinScore}
+			if ok {
+				reason.Score = &score
+			}
+			reasons = append(reasons, reason)
+		}
+	}
+
+	return reasons, nil
+}
+
+// Remember сохраняет уже загруженный раздел, чтобы Resolver не запрашивал его повторно
+func (r *Resolver) Remember(section *storage.EeCourseSection) {
+	r.sections[section.SectionID] = section
+}
+
+// Section возвращает доступность раздела
+func (r *Resolver) Section(section *storage.EeCourseSection) (Status, error) {
+	r.Remember(section)
+
+	reasons, err := r.unmet(func(p *storage.EePrerequisite) bool {
+		return p.SectionID != nil && *p.SectionID == section.SectionID
+	})
+	if err != nil {
+		return Status{}, err
+	}
+
+	return r.status(r.unlockTime(section.AvailableFrom, section.AvailableAfterDays), reasons), nil
+}
+
+// Lesson возвращает доступность урока с учётом правил и условий его раздела
+func (r *Resolver) Lesson(lesson *storage.EeLesson) (Status, error) {
+	section, err := r.section(lesson.SectionID)
+	if err != nil {
+		return Status{}, err
+	}
+
+	unlocksAt := r.unlockTime(lesson.AvailableFrom, lesson.AvailableAfterDays)
+	if sectionUnlock := r.unlockTime(section.AvailableFrom, section.AvailableAfterDays); sectionUnlock != nil {
+		if unlocksAt == nil || sectionUnlock.After(*unlocksAt) {
+			unlocksAt = sectionUnlock
+		}
+	}
+
+	reasons, err := r.unmet(func(p *storage.EePrerequisite) bool {
+		return (p.LessonID != nil && *p.LessonID == lesson.LessonID) ||
+			(p.SectionID != nil && *p.SectionID == lesson.SectionID)
+	})
+	if err != nil {
+		return Status{}, err
+	}
+
+	return r.status(unlocksAt, reasons), nil
+}
+
+// ForLesson проверяет доступность урока для текущего пользователя
+func ForLesson(c *fiber.Ctx, lesson *storage.EeLesson) (Status, error) {
+	courseID, err := enrollments.CourseIDBySection(lesson.SectionID)
+	if err != nil {
+		return Status{}, err
+	}
+
+	resolver, err := For(c, courseID)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return resolver.Lesson(lesson)
+}
+
+// ForLessonID - ForLesson по идентификатору урока
+func ForLessonID(c *fiber.Ctx, lessonID uint) (Status, error) {
+	var lesson storage.EeLesson
+	if err := storage.DB.Where("lesson_id = ?", lessonID).First(&lesson).Error; err != nil {
+		return Status{}, err
+	}
+
+	return ForLesson(c, &lesson)
+}
+
+// Deny отвечает 403 с датой открытия урока и невыполненными условиями
+func Deny(c *fiber.Ctx, status Status) error {
+	message := "lesson is locked until prerequisites are met"
+	if status.UnlocksAt != nil && len(status.Reasons) == 1 {
+		message = fmt.Sprintf("lesson is locked until %s", status.UnlocksAt.Format(time.RFC3339))
+	}
+
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error":      message,
+		"unlocks_at": status.UnlocksAt,
+		"reasons":    status.Reasons,
+	})
+}
+
+// RequireUnlocked - обработчик для маршрутов /lessons/:id, пропускающий только к открытым урокам
+func RequireUnlocked(c *fiber.Ctx) error {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	status, err := ForLessonID(c, uint(lessonID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return Deny(c, status)
+	}
+
+	return c.Next()
+}
+
+func parseRules(c *fiber.Ctx) (*Rules, error) {
+	rules := Rules{}
+	if err := c.BodyParser(&rules); err != nil {
+		return nil, err
+	}
+
+	if rules.AvailableAfterDays != nil && *rules.AvailableAfterDays < 0 {
+		return nil, errors.New("available_after_days cannot be negative")
+	}
+
+	return &rules, nil
+}
+
+// Правила задаются целиком, чтобы их можно было снять передав null
+func rulesColumns(rules *Rules) map[string]interface{} {
+	return map[string]interface{}{
+		"available_from":       rules.AvailableFrom,
+		"available_after_days": rules.AvailableAfterDays,
+	}
+}
+
+func SetLessonRules(c *fiber.Ctx) error {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	rules, err := parseRules(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("cannot parse availability rules: %s", err.Error())})
+	}
+
+	var lesson storage.EeLesson
+	err = storage.DB.Model(&storage.EeLesson{}).Where("lesson_id = ?", lessonID).Updates(rulesColumns(rules)).Error
+	if err == nil {
+		err = storage.DB.Where("lesson_id = ?", lessonID).First(&lesson).Error
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&lesson)
+}
+
+func SetSectionRules(c *fiber.Ctx) error {
+	sectionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid section id"})
+	}
+
+	courseID, err := enrollments.CourseIDBySection(uint(sectionID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "section not found"})
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	rules, err := parseRules(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("cannot parse availability rules: %s", err.Error())})
+	}
+
+	var section storage.EeCourseSection
+	err = storage.DB.Model(&storage.EeCourseSection{}).Where("section_id = ?", sectionID).Updates(rulesColumns(rules)).Error
+	if err == nil {
+		err = storage.DB.Where("section_id = ?", sectionID).First(&section).Error
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&section)
+}
+
+// Условия, относящиеся к урокам и разделам курса
+func coursePrerequisites(tx *gorm.DB, courseID uint) ([]PrerequisiteWithTitle, error) {
+	sections := tx.Model(&storage.EeCourseSection{}).Select("section_id").Where("course_id = ?", courseID)
+	lessons := tx.Model(&storage.EeLesson{}).Select("lesson_id").Where("section_id IN (?)", sections)
+
+	var prerequisites []PrerequisiteWithTitle
+	err := tx.Table("ee_prerequisites").
+		Select("ee_prerequisites.*, required_lesson.title AS required_lesson_title, required_quiz.title AS required_quiz_title").
+		Joins("LEFT JOIN ee_lessons AS required_lesson ON required_lesson.lesson_id = ee_prerequisites.required_lesson_id").
+		Joins("LEFT JOIN ee_quizzes AS required_quiz ON required_quiz.quiz_id = ee_prerequisites.required_quiz_id").
+		Where("ee_prerequisites.lesson_id IN (?) OR ee_prerequisites.section_id IN (?)", lessons, sections).
+		Order("ee_prerequisites.prerequisite_id").
+		Scan(&prerequisites).Error
+
+	return prerequisites, err
+}
+
+func isTarget(p *storage.EePrerequisite, target *storage.EePrerequisite) bool {
+	if target.LessonID != nil {
+		return p.LessonID != nil && *p.LessonID == *target.LessonID
+	}
+
+	return p.SectionID != nil && *p.SectionID == *target.SectionID
+}
+
+// Проверяет, что новые условия ссылаются на материалы того же курса, тесты в них не пустые
+// и условия не образуют цикл. Вершины графа - уроки: условие раздела действует на все его уроки,
+// тест относится к своему уроку. Ошибки проверки оборачивают errInvalidPrerequisites.
+func validatePrerequisites(tx *gorm.DB, courseID uint, target *storage.EePrerequisite, replacement []storage.EePrerequisite) error {
+	var lessons []courseLesson
+	err := tx.Table("ee_lessons").
+		Select("ee_lessons.lesson_id, ee_lessons.section_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+		Where("ee_course_sections.course_id = ?", courseID).
+		Scan(&lessons).Error
+	if err != nil {
+		return err
+	}
+
+	lessonSet := make(map[uint]bool, len(lessons))
+	sectionLessons := make(map[uint][]uint)
+	for _, lesson := range lessons {
+		lessonSet[lesson.LessonID] = true
+		sectionLessons[lesson.SectionID] = append(sectionLessons[lesson.SectionID], lesson.LessonID)
+	}
+
+	var quizzes []storage.EeQuiz
+	if len(lessons) > 0 {
+		if err := tx.Select("quiz_id, lesson_id").Where("lesson_id IN ?", keys(lessonSet)).Find(&quizzes).Error; err != nil {
+			return err
+		}
+	}
+
+	// Тест без вопросов нельзя сдать, условие на него закрыло бы урок навсегда
+	var answerable []uint
+	if len(quizzes) > 0 {
+		quizIDs := make([]uint, 0, len(quizzes))
+		for _, quiz := range quizzes {
+			quizIDs = append(quizIDs, quiz.QuizID)
+		}
+
+		err := tx.Model(&storage.EeQuizQuestion{}).Distinct("quiz_id").Where("quiz_id IN ?", quizIDs).Pluck("quiz_id", &answerable).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	hasQuestions := make(map[uint]bool, len(answerable))
+	for _, quizID := range answerable {
+		hasQuestions[quizID] = true
+	}
+
+	quizLesson := make(map[uint]uint, len(quizzes))
+	for _, quiz := range quizzes {
+		quizLesson[quiz.QuizID] = quiz.LessonID
+	}
+
+	for _, p := range replacement {
+		if p.RequiredLessonID != nil && !lessonSet[*p.RequiredLessonID] {
+			return fmt.Errorf("%w: lesson %d does not belong to the course", errInvalidPrerequisites, *p.RequiredLessonID)
+		}
+		if p.RequiredQuizID != nil {
+			if _, ok := quizLesson[*p.RequiredQuizID]; !ok {
+				return fmt.Errorf("%w: quiz %d does not belong to the course", errInvalidPrerequisites, *p.RequiredQuizID)
+			}
+			if !hasQuestions[*p.RequiredQuizID] {
+				return fmt.Errorf("%w: quiz %d has no questions", errInvalidPrerequisites, *p.RequiredQuizID)
+			}
+		}
+	}
+
+	existing, err := coursePrerequisites(tx, courseID)
+	if err != nil {
+		return err
+	}
+
+	all := replacement
+	for _, p := range existing {
+		if !isTarget(&p.EePrerequisite, target) {
+			all = append(all, p.EePrerequisite)
+		}
+	}
+
+	// Ребро "урок -> урок, который нужно пройти раньше"
+	edges := make(map[uint][]uint)
+	for _, p := range all {
+		var required uint
+		if p.RequiredLessonID != nil {
+			required = *p.RequiredLessonID
+		} else {
+			required = quizLesson[*p.RequiredQuizID]
+		}
+
+		targets := sectionLessons[derefOrZero(p.SectionID)]
+		if p.LessonID != nil {
+			targets = []uint{*p.LessonID}
+		}
+
+		for _, lessonID := range targets {
+			edges[lessonID] = append(edges[lessonID], required)
+		}
+	}
+
+	const (
+		unvisited = iota
+		inStack
+		done
+	)
+	state := make(map[uint]int)
+
+	var visit func(lessonID uint) error
+	visit = func(lessonID uint) error {
+		state[lessonID] = inStack
+		for _, next := range edges[lessonID] {
+			switch state[next] {
+			case inStack:
+				return fmt.Errorf("%w: prerequisites form a cycle through lesson %d", errInvalidPrerequisites, next)
+			case unvisited:
+				if err := visit(next); err != nil {
+					return err
+				}
+			}
+		}
+		state[lessonID] = done
+		return nil
+	}
+
+	for lessonID := range edges {
+		if state[lessonID] == unvisited {
+			if err := visit(lessonID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func keys(set map[uint]bool) []uint {
+	result := make([]uint, 0, len(set))
+	for key := range set {
+		result = append(result, key)
+	}
+	return result
+}
+
+func derefOrZero(value *uint) uint {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// Определяет цель условий по маршруту: /lessons/:id или /courses/sections/:id
+func prerequisiteTarget(c *fiber.Ctx, section bool) (*storage.EePrerequisite, uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	targetID := uint(id)
+	if section {
+		courseID, err := enrollments.CourseIDBySection(targetID)
+		return &storage.EePrerequisite{SectionID: &targetID}, courseID, err
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(targetID)
+	return &storage.EePrerequisite{LessonID: &targetID}, courseID, err
+}
+
+func getPrerequisites(c *fiber.Ctx, section bool) error {
+	target, courseID, err := prerequisiteTarget(c, section)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson or section not found"})
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	prerequisites, err := coursePrerequisites(storage.DB, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result := []PrerequisiteWithTitle{}
+	for _, p := range prerequisites {
+		if isTarget(&p.EePrerequisite, target) {
+			result = append(result, p)
+		}
+	}
+
+	return c.JSON(result)
+}
+
+func setPrerequisites(c *fiber.Ctx, section bool) error {
+	target, courseID, err := prerequisiteTarget(c, section)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson or section not found"})
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := PrerequisiteInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse prerequisites"})
+	}
+
+	replacement := []storage.EePrerequisite{}
+	for i := range info.Lessons {
+		replacement = append(replacement, storage.EePrerequisite{
+			LessonID:         target.LessonID,
+			SectionID:        target.SectionID,
+			RequiredLessonID: &info.Lessons[i],
+		})
+	}
+	for i := range info.Quizzes {
+		if info.Quizzes[i].MinScore < 0 || info.Quizzes[i].MinScore > 100 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "min_score must be between 0 and 100"})
+		}
+
+		replacement = append(replacement, storage.EePrerequisite{
+			LessonID:       target.LessonID,
+			SectionID:      target.SectionID,
+			RequiredQuizID: &info.Quizzes[i].QuizID,
+			MinScore:       info.Quizzes[i].MinScore,
+		})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		// Параллельные изменения условий курса могли бы вместе образовать цикл
+		var course storage.EeCourse
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("course_id = ?", courseID).First(&course).Error; err != nil {
+			return err
+		}
+
+		if err := validatePrerequisites(tx, courseID, target, replacement); err != nil {
+			return err
+		}
+
+		var query *gorm.DB
+		if section {
+			query = tx.Where("section_id = ?", *target.SectionID)
+		} else {
+			query = tx.Where("lesson_id = ?", *target.LessonID)
+		}
+
+		if err := query.Delete(&storage.EePrerequisite{}).Error; err != nil {
+			return err
+		}
+
+		if len(replacement) == 0 {
+			return nil
+		}
+
+		return tx.Create(&replacement).Error
+	})
+
+	if errors.Is(err, errInvalidPrerequisites) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return getPrerequisites(c, section)
+}
+
+func GetLessonPrerequisites(c *fiber.Ctx) error {
+	return getPrerequisites(c, false)
+}
+
+func SetLessonPrerequisites(c *fiber.Ctx) error {
+	return setPrerequisites(c, false)
+}
+
+func GetSectionPrerequisites(c *fiber.Ctx) error {
+	return getPrerequisites(c, true)
+}
+
+func SetSectionPrerequisites(c *fiber.Ctx) error {
+	return setPrerequisites(c, true)
+}
+
+// ExplainLesson объясняет, почему урок закрыт для текущего пользователя
+func ExplainLesson(c *fiber.Ctx) error {
+	var lesson storage.EeLesson
+	if err := storage.DB.Where("lesson_id = ?", c.Params("id")).First(&lesson).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	courseID, err := enrollments.CourseIDBySection(lesson.SectionID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := ForLesson(c, &lesson)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(status)
+}
+
+// ExplainSection объясняет, почему раздел закрыт для текущего пользователя
+func ExplainSection(c *fiber.Ctx) error {
+	var section storage.EeCourseSection
+	if err := storage.DB.Where("section_id = ?", c.Params("id")).First(&section).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "section not found"})
+	}
+
+	if ok, err := enrollments.CanAccess(c, section.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	resolver, err := For(c, section.CourseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	status, err := resolver.Section(&section)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(status)
+}
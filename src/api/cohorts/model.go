@@ -0,0 +1,80 @@
+package cohorts
+
+import (
+	"ekb-edu/src/api/patch"
+	"ekb-edu/src/database/storage"
+	"time"
+)
+
+// cohortFields - поля потока, которые можно менять через PATCH. null очищает дату
+var cohortFields = patch.Resource{
+	"title":                {Column: "title", Required: true, Check: patch.NotBlank},
+	"starts_at":            {Column: "starts_at"},
+	"ends_at":              {Column: "ends_at"},
+	"enrollment_opens_at":  {Column: "enrollment_opens_at"},
+	"enrollment_closes_at": {Column: "enrollment_closes_at"},
+}
+
+type CohortInfo struct {
+	Title              *string    `json:"title"`
+	StartsAt           *time.Time `json:"starts_at"`
+	EndsAt             *time.Time `json:"ends_at"`
+	EnrollmentOpensAt  *time.Time `json:"enrollment_opens_at"`
+	EnrollmentClosesAt *time.Time `json:"enrollment_closes_at"`
+}
+
+type CohortWithStaff struct {
+	storage.EeCohort
+	Instructors    []CohortMember `json:"instructors"`
+	StudentCount   int64          `json:"student_count"`
+	EnrollmentOpen bool           `json:"enrollment_open"`
+}
+
+type CohortMember struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"` // Только для персонала курса
+}
+
+type CohortStudent struct {
+	storage.EeEnrollment
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type UserIDs struct {
+	UserIDs []uint `json:"user_ids"`
+}
+
+type GradebookQuiz struct {
+	QuizID        uint    `json:"quiz_id"`
+	Title         string  `json:"title"`
+	ScoringPolicy string  `json:"scoring_policy"`
+	Questions     int64   `json:"questions"`
+	Points        float64 `json:"points"`
+}
+
+// GradebookScore - результат студента по тесту. answered, correct и earned относятся к последней сданной попытке
+type GradebookScore struct {
+	QuizID   uint    `json:"quiz_id"`
+	Attempts int64   `json:"attempts"` // Сданных попыток
+	Answered int64   `json:"answered"`
+	Correct  int64   `json:"correct"`
+	Earned   float64 `json:"earned"`
+	Score    float64 `json:"score"` // Доля набранных баллов по правилу пересдачи теста
+}
+
+type GradebookRow struct {
+	UserID   uint             `json:"user_id"`
+	Username string           `json:"username"`
+	Email    string           `json:"email"`
+	Status   string           `json:"status"`
+	Scores   []GradebookScore `json:"scores"`
+	Average  float64          `json:"average"`
+}
+
+type Gradebook struct {
+	Cohort   storage.EeCohort `json:"cohort"`
+	Quizzes  []GradebookQuiz  `json:"quizzes"`
+	Students []GradebookRow   `json:"students"`
+}
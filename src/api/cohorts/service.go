@@ -0,0 +1,495 @@
+package cohorts
+
+import (
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/patch"
+	"ekb-edu/src/api/progress"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Проверяет согласованность дат потока
+func validateDates(cohort *storage.EeCohort) error {
+	if cohort.StartsAt != nil && cohort.EndsAt != nil && !cohort.EndsAt.After(*cohort.StartsAt) {
+		return errors.New("cohort must end after it starts")
+	}
+
+	if cohort.EnrollmentOpensAt != nil && cohort.EnrollmentClosesAt != nil && !cohort.EnrollmentClosesAt.After(*cohort.EnrollmentOpensAt) {
+		return errors.New("enrollment window must close after it opens")
+	}
+
+	return nil
+}
+
+func applyInfo(cohort *storage.EeCohort, info *CohortInfo) {
+	if info.Title != nil {
+		cohort.Title = *info.Title
+	}
+	if info.StartsAt != nil {
+		cohort.StartsAt = info.StartsAt
+	}
+	if info.EndsAt != nil {
+		cohort.EndsAt = info.EndsAt
+	}
+	if info.EnrollmentOpensAt != nil {
+		cohort.EnrollmentOpensAt = info.EnrollmentOpensAt
+	}
+	if info.EnrollmentClosesAt != nil {
+		cohort.EnrollmentClosesAt = info.EnrollmentClosesAt
+	}
+}
+
+func loadCohort(c *fiber.Ctx) (*storage.EeCohort, error) {
+	cohortID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cohort id"})
+	}
+
+	var cohort storage.EeCohort
+	if err := storage.DB.Where("cohort_id = ?", cohortID).First(&cohort).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "cohort not found"})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return &cohort, nil
+}
+
+// Управлять потоком может персонал курса, просматривать состав - ещё и преподаватель потока
+func canView(c *fiber.Ctx, cohort *storage.EeCohort) (bool, error) {
+	if staff, err := enrollments.CanManage(c, cohort.CourseID); err != nil || staff {
+		return staff, err
+	}
+	return enrollments.IsCohortInstructor(middleware.UserID(c), cohort.CohortID)
+}
+
+func withStaff(cohort storage.EeCohort) (*CohortWithStaff, error) {
+	info := CohortWithStaff{
+		EeCohort:       cohort,
+		Instructors:    []CohortMember{},
+		EnrollmentOpen: enrollments.IsEnrollmentOpen(&cohort, time.Now()),
+	}
+
+	err := storage.DB.Table("ee_cohort_instructors").
+		Select("ee_users.user_id, ee_users.username, ee_users.email").
+		Joins("JOIN ee_users ON ee_users.user_id = ee_cohort_instructors.user_id").
+		Where("ee_cohort_instructors.cohort_id = ?", cohort.CohortID).
+		Scan(&info.Instructors).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.DB.Model(&storage.EeEnrollment{}).
+		Where("cohort_id = ? AND role = ? AND status IN ?", cohort.CohortID, enrollments.RoleStudent, []string{enrollments.StatusActive, enrollments.StatusCompleted}).
+		Count(&info.StudentCount).Error
+
+	return &info, err
+}
+
+func GetCourseCohorts(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	var cohorts []storage.EeCohort
+	if err := storage.DB.Where("course_id = ?", courseID).Order("starts_at NULLS LAST, cohort_id").Find(&cohorts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result := []*CohortWithStaff{}
+	for _, cohort := range cohorts {
+		info, err := withStaff(cohort)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		// Список потоков публичный, почта преподавателей в нём не показывается
+		for i := range info.Instructors {
+			info.Instructors[i].Email = ""
+		}
+		result = append(result, info)
+	}
+
+	return c.JSON(result)
+}
+
+func AddCohort(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	if ok, err := enrollments.CanManage(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := CohortInfo{}
+	if err := c.BodyParser(&info); err != nil || info.Title == nil || *info.Title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse cohort data"})
+	}
+
+	cohort := storage.EeCohort{CourseID: uint(courseID)}
+	applyInfo(&cohort, &info)
+
+	if err := validateDates(&cohort); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := storage.DB.Create(&cohort).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&cohort)
+}
+
+func getCohort(c *fiber.Ctx) error {
+	cohort, err := loadCohort(c)
+	if cohort == nil {
+		return err
+	}
+
+	if ok, err := canView(c, cohort); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not an instructor of the cohort"})
+	}
+
+	info, err := withStaff(*cohort)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(info)
+}
+
+func updateCohort(c *fiber.Ctx) error {
+	cohort, err := loadCohort(c)
+	if cohort == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, cohort.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	update, err := patch.Parse(c, &storage.EeCohort{}, cohortFields)
+	if update == nil {
+		return err
+	}
+
+	// Даты проверяются после применения патча, чтобы учесть и новые, и оставшиеся значения
+	var invalid error
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := update.Apply(tx, &storage.EeCohort{}, "cohort_id", cohort.CohortID); err != nil {
+			return err
+		}
+
+		if err := tx.Where("cohort_id = ?", cohort.CohortID).First(cohort).Error; err != nil {
+			return err
+		}
+
+		invalid = validateDates(cohort)
+		return invalid
+	})
+
+	switch {
+	case invalid != nil:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": invalid.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "cohort not found"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(cohort)
+}
+
+func deleteCohort(c *fiber.Ctx) error {
+	cohort, err := loadCohort(c)
+	if cohort == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, cohort.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	// Участники остаются на курсе без потока
+	if err := storage.DB.Delete(cohort).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func setInstructors(c *fiber.Ctx) error {
+	cohort, err := loadCohort(c)
+	if cohort == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, cohort.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := UserIDs{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse instructors"})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cohort_id = ?", cohort.CohortID).Delete(&storage.EeCohortInstructor{}).Error; err != nil {
+			return err
+		}
+
+		for _, userID := range info.UserIDs {
+			instructor := storage.EeCohortInstructor{CohortID: cohort.CohortID, UserID: userID}
+			if err := tx.FirstOrCreate(&instructor).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result, err := withStaff(*cohort)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(result)
+}
+
+func getStudents(c *fiber.Ctx) error {
+	cohort, err := loadCohort(c)
+	if cohort == nil {
+		return err
+	}
+
+	if ok, err := canView(c, cohort); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not an instructor of the cohort"})
+	}
+
+	students := []CohortStudent{}
+	result := storage.DB.Table("ee_enrollments").
+		Select("ee_enrollments.*, ee_users.username, ee_users.email").
+		Joins("JOIN ee_users ON ee_users.user_id = ee_enrollments.user_id").
+		Where("ee_enrollments.cohort_id = ?", cohort.CohortID).
+		Order("ee_users.username").
+		Scan(&students)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	}
+
+	return c.JSON(students)
+}
+
+// Переводит участников курса в поток. Ответы и прогресс привязаны к пользователю и уроку,
+// поэтому при переводе сохраняются.
+func moveStudents(c *fiber.Ctx) error {
+	cohort, err := loadCohort(c)
+	if cohort == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, cohort.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := UserIDs{}
+	if err := c.BodyParser(&info); err != nil || len(info.UserIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_ids are required"})
+	}
+
+	// Переводятся только студенты, персонал курса к потокам не привязывается
+	var moved []uint
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		students := tx.Model(&storage.EeEnrollment{}).
+			Where("course_id = ? AND role = ? AND user_id IN ?", cohort.CourseID, enrollments.RoleStudent, info.UserIDs)
+
+		if err := students.Session(&gorm.Session{}).Update("cohort_id", cohort.CohortID).Error; err != nil {
+			return err
+		}
+
+		return students.Session(&gorm.Session{}).Pluck("user_id", &moved).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	// Пользователи, не записанные на курс студентами
+	missing := []uint{}
+	for _, userID := range info.UserIDs {
+		found := false
+		for _, id := range moved {
+			found = found || id == userID
+		}
+		if !found {
+			missing = append(missing, userID)
+		}
+	}
+
+	return c.JSON(fiber.Map{"moved": len(moved), "not_enrolled": missing})
+}
+
+func getGradebook(c *fiber.Ctx) error {
+	cohort, err := loadCohort(c)
+	if cohort == nil {
+		return err
+	}
+
+	if ok, err := canView(c, cohort); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not an instructor of the cohort"})
+	}
+
+	gradebook, err := buildGradebook(cohort)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(gradebook)
+}
+
+// Сводная ведомость по тестам курса для студентов потока
+func buildGradebook(cohort *storage.EeCohort) (*Gradebook, error) {
+	gradebook := Gradebook{
+		Cohort:   *cohort,
+		Quizzes:  []GradebookQuiz{},
+		Students: []GradebookRow{},
+	}
+
+	err := storage.DB.Table("ee_quizzes").
+		Select("ee_quizzes.quiz_id, ee_quizzes.title, ee_quizzes.scoring_policy, (SELECT COUNT(*) FROM ee_quiz_questions WHERE ee_quiz_questions.quiz_id = ee_quizzes.quiz_id) AS questions, (SELECT COALESCE(SUM(points), 0) FROM ee_quiz_questions WHERE ee_quiz_questions.quiz_id = ee_quizzes.quiz_id) AS points").
+		Joins("JOIN ee_lessons ON ee_lessons.lesson_id = ee_quizzes.lesson_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+		Where("ee_course_sections.course_id = ?", cohort.CourseID).
+		Order(`ee_course_sections."order", ee_lessons."order", ee_quizzes.quiz_id`).
+		Scan(&gradebook.Quizzes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.DB.Table("ee_enrollments").
+		Select("ee_users.user_id, ee_users.username, ee_users.email, ee_enrollments.status").
+		Joins("JOIN ee_users ON ee_users.user_id = ee_enrollments.user_id").
+		Where("ee_enrollments.cohort_id = ? AND ee_enrollments.role = ?", cohort.CohortID, enrollments.RoleStudent).
+		Order("ee_users.username").
+		Scan(&gradebook.Students).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(gradebook.Quizzes) == 0 || len(gradebook.Students) == 0 {
+		return &gradebook, nil
+	}
+
+	quizIDs := make([]uint, len(gradebook.Quizzes))
+	for i, quiz := range gradebook.Quizzes {
+		quizIDs[i] = quiz.QuizID
+	}
+
+	userIDs := make([]uint, len(gradebook.Students))
+	for i, student := range gradebook.Students {
+		userIDs[i] = student.UserID
+	}
+
+	var attempts []struct {
+		storage.EeQuizAttempt
+		Answered int64
+		Correct  int64
+	}
+
+	err = storage.DB.Table("ee_quiz_attempts").
+		Select("ee_quiz_attempts.*, "+
+			"(SELECT COUNT(*) FROM ee_quiz_answers WHERE ee_quiz_answers.attempt_id = ee_quiz_attempts.attempt_id) AS answered, "+
+			"(SELECT COUNT(*) FROM ee_quiz_answers WHERE ee_quiz_answers.attempt_id = ee_quiz_attempts.attempt_id AND ee_quiz_answers.is_correct) AS correct").
+		Where("quiz_id IN ? AND user_id IN ? AND submitted_at IS NOT NULL", quizIDs, userIDs).
+		Order("number").
+		Scan(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Ответы и баллы берутся из последней сданной попытки, оценка - по правилу теста
+	type key struct{ userID, quizID uint }
+	results := make(map[key]GradebookScore)
+	submitted := make(map[key][]storage.EeQuizAttempt)
+	for _, attempt := range attempts {
+		k := key{attempt.UserID, attempt.QuizID}
+		submitted[k] = append(submitted[k], attempt.EeQuizAttempt)
+		score := GradebookScore{
+			Attempts: int64(len(submitted[k])),
+			Answered: attempt.Answered,
+			Correct:  attempt.Correct,
+		}
+		if attempt.Earned != nil {
+			score.Earned = *attempt.Earned
+		}
+		results[k] = score
+	}
+
+	for i := range gradebook.Students {
+		student := &gradebook.Students[i]
+		student.Scores = make([]GradebookScore, len(gradebook.Quizzes))
+
+		total := 0.0
+		for j, quiz := range gradebook.Quizzes {
+			k := key{student.UserID, quiz.QuizID}
+			score := results[k]
+			score.QuizID = quiz.QuizID
+			score.Score = progress.PolicyScore(quiz.ScoringPolicy, submitted[k])
+
+			student.Scores[j] = score
+			total += score.Score
+		}
+
+		student.Average = total / float64(len(gradebook.Quizzes))
+	}
+
+	return &gradebook, nil
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/cohorts")
+	{
+		staff := g.Group("/", middleware.TokenRequired)
+		{
+			staff.Get("/:id", getCohort)
+			staff.Patch("/:id", updateCohort)
+			staff.Delete("/:id", deleteCohort)
+			staff.Put("/:id/instructors", setInstructors)
+			staff.Get("/:id/students", getStudents)
+			staff.Post("/:id/students", moveStudents)
+			staff.Get("/:id/gradebook", getGradebook)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package comments
+
+import (
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"time"
+)
+
+const (
+	editWindow   = 30 * time.Minute // Автор может исправить текст
+	deleteWindow = 24 * time.Hour   // Автор может удалить комментарий
+	maxDepth     = 4
+	maxBodyRunes = 10000
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+var reactions = map[string]bool{
+	"like":       true,
+	"thanks":     true,
+	"insightful": true,
+	"confused":   true,
+}
+
+var reasons = map[string]bool{
+	"spam":      true,
+	"abuse":     true,
+	"off_topic": true,
+	"other":     true,
+}
+
+type CommentInfo struct {
+	Body     string `json:"body"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+type FlagInfo struct {
+	Value bool `json:"value"`
+}
+
+type ReportInfo struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+type ResolveInfo struct {
+	Hide bool `json:"hide"` // Скрыть комментарий при рассмотрении жалоб
+}
+
+type Author struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// Comment - комментарий с ответами, реакциями и автором для выдачи клиенту.
+// Скрытые и удалённые комментарии остаются в дереве без текста, чтобы не терять ответы
+type Comment struct {
+	storage.EeComment
+	Author      *Author          `json:"author"`
+	BodyHTML    *render.Document `json:"body_html,omitempty"` // Только при ?format=html
+	Reactions   map[string]int   `json:"reactions"`
+	MyReactions []string         `json:"my_reactions"`
+	Reports     int64            `json:"reports,omitempty"` // Открытые жалобы, только для преподавателей
+	Replies     []*Comment       `json:"replies"`
+}
+
+type Page struct {
+	Pinned     []*Comment `json:"pinned"` // Только на первой странице
+	Threads    []*Comment `json:"threads"`
+	NextCursor string     `json:"next_cursor"` // Пусто - страниц больше нет
+}
+
+type ReportWithComment struct {
+	storage.EeCommentReport
+	LessonID uint   `json:"lesson_id"`
+	Body     string `json:"body"`
+	AuthorID *uint  `json:"author_id"`
+	IsHidden bool   `json:"is_hidden"`
+}
@@ -0,0 +1,743 @@
+package comments
+
+import (
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// canRead пускает только участников и преподавателей курса, и только в открытые уроки
+func canRead(c *fiber.Ctx, courseID, lessonID uint) (bool, error) {
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, lessonID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return false, availability.Deny(c, status)
+	}
+
+	return true, nil
+}
+
+func lessonCourse(c *fiber.Ctx) (uint, uint, error) {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	return uint(lessonID), courseID, nil
+}
+
+// find загружает комментарий из :id и проверяет доступ к его уроку. При отказе courseID == 0
+func find(c *fiber.Ctx, comment *storage.EeComment) (uint, error) {
+	err := storage.DB.Where("comment_id = ?", c.Params("id")).First(comment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "comment not found"})
+	} else if err != nil {
+		return 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(comment.LessonID)
+	if err != nil {
+		return 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := canRead(c, courseID, comment.LessonID); !ok {
+		return 0, err
+	}
+
+	return courseID, nil
+}
+
+func isAuthor(c *fiber.Ctx, comment *storage.EeComment) bool {
+	return comment.UserID != nil && *comment.UserID == middleware.UserID(c)
+}
+
+func cleanBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("comment body is required")
+	}
+	if len([]rune(body)) > maxBodyRunes {
+		return "", fmt.Errorf("comment is longer than %d characters", maxBodyRunes)
+	}
+
+	return body, nil
+}
+
+// decorate добавляет авторов, реакции и жалобы и убирает текст, который читателю видеть нельзя
+func decorate(c *fiber.Ctx, records []storage.EeComment, staff bool) ([]*Comment, error) {
+	result := make([]*Comment, len(records))
+	if len(records) == 0 {
+		return result, nil
+	}
+
+	userID := middleware.UserID(c)
+	commentIDs := make([]uint, len(records))
+	var authorIDs []uint
+	for i, record := range records {
+		commentIDs[i] = record.CommentID
+		if record.UserID != nil {
+			authorIDs = append(authorIDs, *record.UserID)
+		}
+	}
+
+	var authors []Author
+	if err := storage.DB.Model(&storage.EeUser{}).Select("user_id, username").Where("user_id IN ?", authorIDs).Scan(&authors).Error; err != nil {
+		return nil, err
+	}
+	authorMap := make(map[uint]*Author, len(authors))
+	for i := range authors {
+		authorMap[authors[i].UserID] = &authors[i]
+	}
+
+	var counts []struct {
+		CommentID uint
+		Reaction  string
+		Count     int
+	}
+	err := storage.DB.Model(&storage.EeCommentReaction{}).
+		Select("comment_id, reaction, COUNT(*) AS count").
+		Where("comment_id IN ?", commentIDs).
+		Group("comment_id, reaction").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var mine []storage.EeCommentReaction
+	if err := storage.DB.Where("comment_id IN ? AND user_id = ?", commentIDs, userID).Find(&mine).Error; err != nil {
+		return nil, err
+	}
+
+	var reports []struct {
+		CommentID uint
+		Count     int64
+	}
+	if staff {
+		err := storage.DB.Model(&storage.EeCommentReport{}).
+			Select("comment_id, COUNT(*) AS count").
+			Where("comment_id IN ? AND resolved_at IS NULL", commentIDs).
+			Group("comment_id").
+			Scan(&reports).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	byID := make(map[uint]*Comment, len(records))
+	asHTML := c.Query("format") == "html"
+	for i, record := range records {
+		if record.DeletedAt != nil || (record.IsHidden && !staff && !isAuthor(c, &record)) {
+			record.Body = ""
+		}
+
+		comment := &Comment{
+			EeComment:   record,
+			Reactions:   map[string]int{},
+			MyReactions: []string{},
+			Replies:     []*Comment{},
+		}
+		if record.UserID != nil {
+			comment.Author = authorMap[*record.UserID]
+		}
+
+		if asHTML && record.Body != "" {
+			if comment.BodyHTML, err = render.Markdown(record.Body); err != nil {
+				return nil, err
+			}
+		}
+
+		result[i] = comment
+		byID[record.CommentID] = comment
+	}
+
+	for _, count := range counts {
+		byID[count.CommentID].Reactions[count.Reaction] = count.Count
+	}
+	for _, reaction := range mine {
+		byID[reaction.CommentID].MyReactions = append(byID[reaction.CommentID].MyReactions, reaction.Reaction)
+	}
+	for _, report := range reports {
+		byID[report.CommentID].Reports = report.Count
+	}
+
+	return result, nil
+}
+
+// prune убирает удалённые комментарии, на которые никто не ответил
+func prune(comments []*Comment) []*Comment {
+	kept := comments[:0]
+	for _, comment := range comments {
+		comment.Replies = prune(comment.Replies)
+		if comment.DeletedAt == nil || len(comment.Replies) > 0 {
+			kept = append(kept, comment)
+		}
+	}
+
+	return kept
+}
+
+// threads собирает ветки: загружает все ответы к корневым комментариям и раскладывает их по родителям
+func threads(c *fiber.Ctx, roots []storage.EeComment, staff bool) ([]*Comment, error) {
+	if len(roots) == 0 {
+		return []*Comment{}, nil
+	}
+
+	rootIDs := make([]uint, len(roots))
+	for i, root := range roots {
+		rootIDs[i] = root.CommentID
+	}
+
+	var replies []storage.EeComment
+	if err := storage.DB.Where("root_id IN ?", rootIDs).Order("comment_id").Find(&replies).Error; err != nil {
+		return nil, err
+	}
+
+	all, err := decorate(c, append(append([]storage.EeComment{}, roots...), replies...), staff)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]*Comment, len(all))
+	for _, comment := range all {
+		byID[comment.CommentID] = comment
+	}
+	for _, comment := range all[len(roots):] {
+		if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+
+	return prune(all[:len(roots)]), nil
+}
+
+// GetComments возвращает ветки обсуждения урока от новых к старым, страницами по курсору
+func GetComments(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, lessonID); !ok {
+		return err
+	}
+
+	limit := c.QueryInt("limit", defaultLimit)
+	if limit < 1 || limit > maxLimit {
+		limit = defaultLimit
+	}
+
+	var cursor uint64
+	if value := c.Query("cursor"); value != "" {
+		if cursor, err = strconv.ParseUint(value, 10, 32); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid cursor"})
+		}
+	}
+
+	// Удалённые и скрытые ветки без ответов читателю не показываются
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	query := storage.DB.Where("lesson_id = ? AND parent_id IS NULL", lessonID)
+	if staff {
+		query = query.Where("NOT (deleted_at IS NOT NULL AND NOT EXISTS (SELECT 1 FROM ee_comments AS replies WHERE replies.root_id = ee_comments.comment_id))")
+	} else {
+		query = query.Where("NOT ((deleted_at IS NOT NULL OR (is_hidden AND user_id IS DISTINCT FROM ?)) AND NOT EXISTS (SELECT 1 FROM ee_comments AS replies WHERE replies.root_id = ee_comments.comment_id))", middleware.UserID(c))
+	}
+
+	page := Page{Pinned: []*Comment{}}
+	if cursor == 0 {
+		var pinned []storage.EeComment
+		if err := query.Session(&gorm.Session{}).Where("is_pinned").Order("comment_id DESC").Find(&pinned).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		if page.Pinned, err = threads(c, pinned, staff); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	query = query.Where("NOT is_pinned")
+	if cursor != 0 {
+		query = query.Where("comment_id < ?", cursor)
+	}
+
+	var roots []storage.EeComment
+	if err := query.Order("comment_id DESC").Limit(limit + 1).Find(&roots).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if len(roots) > limit {
+		roots = roots[:limit]
+		page.NextCursor = strconv.FormatUint(uint64(roots[limit-1].CommentID), 10)
+	}
+
+	if page.Threads, err = threads(c, roots, staff); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&page)
+}
+
+func respond(c *fiber.Ctx, status int, record storage.EeComment, staff bool) error {
+	decorated, err := decorate(c, []storage.EeComment{record}, staff)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.Status(status).JSON(decorated[0])
+}
+
+func CreateComment(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, lessonID); !ok {
+		return err
+	}
+
+	info := CommentInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse comment data"})
+	}
+
+	body, err := cleanBody(info.Body)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID := middleware.UserID(c)
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	comment := storage.EeComment{
+		LessonID: lessonID,
+		UserID:   &userID,
+		Body:     body,
+		IsStaff:  staff,
+	}
+
+	if info.ParentID != nil {
+		var parent storage.EeComment
+		if err := storage.DB.Where("comment_id = ? AND lesson_id = ?", *info.ParentID, lessonID).First(&parent).Error; err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "parent comment not found in this lesson"})
+		}
+
+		if parent.DeletedAt != nil || (parent.IsHidden && !staff) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot reply to a removed comment"})
+		}
+
+		if parent.Depth+1 > maxDepth {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "replies are nested too deep"})
+		}
+
+		root := parent
+		if parent.RootID != nil {
+			if err := storage.DB.Where("comment_id = ?", *parent.RootID).First(&root).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+			}
+		}
+
+		if root.IsLocked && !staff {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "thread is locked"})
+		}
+
+		comment.ParentID = &parent.CommentID
+		comment.RootID = &root.CommentID
+		comment.Depth = parent.Depth + 1
+	}
+
+	if err := storage.DB.Create(&comment).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusCreated, comment, staff)
+}
+
+// updateComment даёт автору исправить текст в течение editWindow, преподавателям - в любое время
+func updateComment(c *fiber.Ctx) error {
+	var comment storage.EeComment
+	courseID, err := find(c, &comment)
+	if courseID == 0 {
+		return err
+	}
+
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if !isAuthor(c, &comment) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only the author can edit a comment"})
+	}
+
+	if comment.DeletedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "comment has been deleted"})
+	}
+
+	if !staff && time.Since(comment.CreatedAt) > editWindow {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": fmt.Sprintf("comments can only be edited within %s", editWindow)})
+	}
+
+	info := CommentInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse comment data"})
+	}
+
+	if comment.Body, err = cleanBody(info.Body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	now := time.Now()
+	comment.EditedAt = &now
+	if err := storage.DB.Model(&comment).Updates(map[string]interface{}{"body": comment.Body, "edited_at": now}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, comment, staff)
+}
+
+// deleteComment стирает текст, но оставляет запись, чтобы ответы не потеряли ветку
+func deleteComment(c *fiber.Ctx) error {
+	var comment storage.EeComment
+	courseID, err := find(c, &comment)
+	if courseID == 0 {
+		return err
+	}
+
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if !staff {
+		if !isAuthor(c, &comment) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only the author or course staff can delete a comment"})
+		}
+
+		if time.Since(comment.CreatedAt) > deleteWindow {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": fmt.Sprintf("comments can only be deleted within %s", deleteWindow)})
+		}
+	}
+
+	if comment.DeletedAt != nil {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&comment).Updates(map[string]interface{}{
+			"body":        "",
+			"deleted_at":  time.Now(),
+			"is_pinned":   false,
+			"is_accepted": false,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("comment_id = ?", comment.CommentID).Delete(&storage.EeCommentReaction{}).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// moderate меняет флаг комментария, который могут менять только преподаватели курса
+func moderate(c *fiber.Ctx, column string, rootOnly bool) error {
+	var comment storage.EeComment
+	courseID, err := find(c, &comment)
+	if courseID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	if rootOnly && comment.ParentID != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "only the first comment of a thread can be changed"})
+	}
+
+	info := FlagInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse flag value"})
+	}
+
+	if comment.DeletedAt != nil && info.Value {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "comment has been deleted"})
+	}
+
+	if err := storage.DB.Model(&comment).Update(column, info.Value).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, comment, true)
+}
+
+func pinComment(c *fiber.Ctx) error {
+	return moderate(c, "is_pinned", true)
+}
+
+func lockComment(c *fiber.Ctx) error {
+	return moderate(c, "is_locked", true)
+}
+
+func hideComment(c *fiber.Ctx) error {
+	return moderate(c, "is_hidden", false)
+}
+
+// acceptComment отмечает ответ решением вопроса. Это может сделать автор вопроса или преподаватель
+func acceptComment(c *fiber.Ctx) error {
+	var comment storage.EeComment
+	courseID, err := find(c, &comment)
+	if courseID == 0 {
+		return err
+	}
+
+	if comment.RootID == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "only replies can be accepted"})
+	}
+
+	var root storage.EeComment
+	if err := storage.DB.Where("comment_id = ?", *comment.RootID).First(&root).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if !staff && !isAuthor(c, &root) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only the author of the question or course staff can accept an answer"})
+	}
+
+	info := FlagInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse flag value"})
+	}
+
+	if info.Value && (comment.DeletedAt != nil || comment.IsHidden) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "removed comments cannot be accepted"})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if info.Value {
+			err := tx.Model(&storage.EeComment{}).
+				Where("root_id = ? AND is_accepted AND comment_id <> ?", root.CommentID, comment.CommentID).
+				Update("is_accepted", false).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&comment).Update("is_accepted", info.Value).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, comment, staff)
+}
+
+func react(c *fiber.Ctx, add bool) error {
+	var comment storage.EeComment
+	courseID, err := find(c, &comment)
+	if courseID == 0 {
+		return err
+	}
+
+	reaction := c.Params("reaction")
+	if !reactions[reaction] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("unknown reaction %q", reaction)})
+	}
+
+	if comment.DeletedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "comment has been deleted"})
+	}
+
+	record := storage.EeCommentReaction{CommentID: comment.CommentID, UserID: middleware.UserID(c), Reaction: reaction}
+	if add {
+		err = storage.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error
+	} else {
+		err = storage.DB.Where(&record).Delete(&storage.EeCommentReaction{}).Error
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, comment, staff)
+}
+
+func addReaction(c *fiber.Ctx) error {
+	return react(c, true)
+}
+
+func removeReaction(c *fiber.Ctx) error {
+	return react(c, false)
+}
+
+func reportComment(c *fiber.Ctx) error {
+	var comment storage.EeComment
+	courseID, err := find(c, &comment)
+	if courseID == 0 {
+		return err
+	}
+
+	if isAuthor(c, &comment) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot report your own comment"})
+	}
+
+	info := ReportInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse report data"})
+	}
+
+	if !reasons[info.Reason] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("unknown report reason %q", info.Reason)})
+	}
+
+	userID := middleware.UserID(c)
+	report := storage.EeCommentReport{
+		CommentID: comment.CommentID,
+		UserID:    &userID,
+		Reason:    info.Reason,
+		Details:   strings.TrimSpace(info.Details),
+	}
+
+	result := storage.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	} else if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "comment has already been reported"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&report)
+}
+
+// resolveReports закрывает открытые жалобы на комментарий и при необходимости скрывает его
+func resolveReports(c *fiber.Ctx) error {
+	var comment storage.EeComment
+	courseID, err := find(c, &comment)
+	if courseID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := ResolveInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse resolution"})
+	}
+
+	userID := middleware.UserID(c)
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&storage.EeCommentReport{}).
+			Where("comment_id = ? AND resolved_at IS NULL", comment.CommentID).
+			Updates(map[string]interface{}{"resolved_at": time.Now(), "resolved_by": userID}).Error
+		if err != nil || !info.Hide {
+			return err
+		}
+
+		comment.IsHidden = true
+		return tx.Model(&comment).Update("is_hidden", true).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return respond(c, fiber.StatusOK, comment, true)
+}
+
+// GetReports возвращает жалобы на комментарии курса, по умолчанию только нерассмотренные
+func GetReports(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	if ok, err := enrollments.CanManage(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	query := storage.DB.Table("ee_comment_reports").
+		Select("ee_comment_reports.*, ee_comments.lesson_id, ee_comments.body, ee_comments.user_id AS author_id, ee_comments.is_hidden").
+		Joins("JOIN ee_comments ON ee_comments.comment_id = ee_comment_reports.comment_id").
+		Joins("JOIN ee_lessons ON ee_lessons.lesson_id = ee_comments.lesson_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+		Where("ee_course_sections.course_id = ?", courseID)
+
+	if !c.QueryBool("resolved") {
+		query = query.Where("ee_comment_reports.resolved_at IS NULL")
+	}
+
+	reports := []ReportWithComment{}
+	if err := query.Order("ee_comment_reports.created_at DESC").Scan(&reports).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(reports)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/comments", middleware.TokenRequired)
+	{
+		g.Patch("/:id", updateComment)
+		g.Delete("/:id", deleteComment)
+		g.Put("/:id/pin", pinComment)
+		g.Put("/:id/lock", lockComment)
+		g.Put("/:id/hide", hideComment)
+		g.Put("/:id/accept", acceptComment)
+		g.Put("/:id/reactions/:reaction", addReaction)
+		g.Delete("/:id/reactions/:reaction", removeReaction)
+		g.Post("/:id/reports", reportComment)
+		g.Put("/:id/reports/resolve", resolveReports)
+	}
+}
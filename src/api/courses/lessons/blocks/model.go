@@ -0,0 +1,93 @@
+package blocks
+
+import (
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"encoding/json"
+)
+
+// Типы блоков содержимого
+const (
+	TypeText    = "text"
+	TypeCode    = "code"
+	TypeImage   = "image"
+	TypeEmbed   = "embed"
+	TypeCallout = "callout"
+	TypeQuiz    = "quiz"
+)
+
+// Форматы текстового блока
+const (
+	FormatMarkdown = render.FormatMarkdown
+	FormatHTML     = render.FormatHTML
+	FormatPlain    = render.FormatPlain
+)
+
+// Схема данных блока. validate приводит данные к каноническому виду и проверяет их.
+type schema interface {
+	validate(lessonID uint) error
+}
+
+type TextData struct {
+	Format string `json:"format"`
+	Text   string `json:"text"`
+}
+
+type CodeData struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+type ImageData struct {
+	URL     string `json:"url"`
+	Alt     string `json:"alt"`
+	Caption string `json:"caption,omitempty"`
+}
+
+type EmbedData struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+type CalloutData struct {
+	Variant string `json:"variant"`
+	Title   string `json:"title,omitempty"`
+	Text    string `json:"text"`
+}
+
+type QuizData struct {
+	QuizID uint `json:"quiz_id"`
+}
+
+// Конструкторы схем по типу блока
+var schemas = map[string]func() schema{
+	TypeText:    func() schema { return &TextData{} },
+	TypeCode:    func() schema { return &CodeData{} },
+	TypeImage:   func() schema { return &ImageData{} },
+	TypeEmbed:   func() schema { return &EmbedData{} },
+	TypeCallout: func() schema { return &CalloutData{} },
+	TypeQuiz:    func() schema { return &QuizData{} },
+}
+
+var calloutVariants = map[string]bool{
+	"info":    true,
+	"tip":     true,
+	"warning": true,
+	"danger":  true,
+}
+
+type BlockInfo struct {
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	Order *int            `json:"order"` // Позиция вставки, по умолчанию в конец урока
+}
+
+type ReorderInfo struct {
+	BlockIDs []uint `json:"block_ids"`
+}
+
+// RenderedBlock - блок с отрисованным HTML для текстовых блоков и выносок при ?format=html
+type RenderedBlock struct {
+	storage.EeLessonBlock
+	HTML *render.Document `json:"html,omitempty"`
+}
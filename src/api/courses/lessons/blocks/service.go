@@ -0,0 +1,530 @@
+package blocks
+
+import (
+	"bytes"
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/editing"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/revisions"
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var errInvalidOrder = errors.New("block_ids must list every block of the lesson exactly once")
+
+func (d *TextData) validate(uint) error {
+	if d.Format == "" {
+		d.Format = FormatMarkdown
+	}
+
+	if d.Format != FormatMarkdown && d.Format != FormatHTML && d.Format != FormatPlain {
+		return fmt.Errorf("unknown text format %q", d.Format)
+	}
+
+	if strings.TrimSpace(d.Text) == "" {
+		return errors.New("text is required")
+	}
+
+	return nil
+}
+
+func (d *CodeData) validate(uint) error {
+	if d.Code == "" {
+		return errors.New("code is required")
+	}
+
+	d.Language = strings.ToLower(strings.TrimSpace(d.Language))
+	return nil
+}
+
+// Разрешены абсолютные http(s) адреса и пути внутри приложения
+func validateURL(value string, allowRelative bool) error {
+	if value == "" {
+		return errors.New("url is required")
+	}
+
+	if allowRelative && strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") {
+		return nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid url %q", value)
+	}
+
+	return nil
+}
+
+func (d *ImageData) validate(uint) error {
+	return validateURL(d.URL, true)
+}
+
+func (d *EmbedData) validate(uint) error {
+	if err := validateURL(d.URL, false); err != nil {
+		return err
+	}
+
+	// Встраиваемое содержимое загружается в iframe, поэтому только https
+	if !strings.HasPrefix(d.URL, "https://") {
+		return errors.New("embed url must use https")
+	}
+
+	return nil
+}
+
+func (d *CalloutData) validate(uint) error {
+	if d.Variant == "" {
+		d.Variant = "info"
+	}
+
+	if !calloutVariants[d.Variant] {
+		return fmt.Errorf("unknown callout variant %q", d.Variant)
+	}
+
+	if strings.TrimSpace(d.Text) == "" {
+		return errors.New("text is required")
+	}
+
+	return nil
+}
+
+func (d *QuizData) validate(lessonID uint) error {
+	if d.QuizID == 0 {
+		return errors.New("quiz_id is required")
+	}
+
+	quizCourse, err := enrollments.CourseIDByQuiz(d.QuizID)
+	if err != nil {
+		return fmt.Errorf("quiz %d not found", d.QuizID)
+	}
+
+	lessonCourse, err := enrollments.CourseIDByLesson(lessonID)
+	if err != nil || quizCourse != lessonCourse {
+		return fmt.Errorf("quiz %d does not belong to the course", d.QuizID)
+	}
+
+	return nil
+}
+
+// Проверяет данные блока по схеме его типа и возвращает их в каноническом виде
+func decode(blockType string, raw json.RawMessage, lessonID uint) (datatypes.JSON, error) {
+	newSchema, ok := schemas[blockType]
+	if !ok {
+		return nil, fmt.Errorf("unknown block type %q", blockType)
+	}
+
+	data := newSchema()
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(data); err != nil {
+		return nil, fmt.Errorf("invalid %s block data: %s", blockType, err.Error())
+	}
+
+	if err := data.validate(lessonID); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(data)
+}
+
+// ForLesson возвращает блоки урока по порядку
+func ForLesson(lessonID uint) ([]storage.EeLessonBlock, error) {
+	blocks := []storage.EeLessonBlock{}
+	err := storage.DB.Where("lesson_id = ?", lessonID).Order(`"order", block_id`).Find(&blocks).Error
+	return blocks, err
+}
+
+// Render добавляет к блокам отрисованный HTML, если asHTML
+func Render(lessonBlocks []storage.EeLessonBlock, asHTML bool) ([]RenderedBlock, error) {
+	result := make([]RenderedBlock, len(lessonBlocks))
+	for i, block := range lessonBlocks {
+		result[i].EeLessonBlock = block
+		if !asHTML {
+			continue
+		}
+
+		var err error
+		switch block.Type {
+		case TypeText:
+			var data TextData
+			if err = json.Unmarshal(block.Data, &data); err == nil {
+				result[i].HTML, err = render.Cached(render.Key("block", block.BlockID), data.Format, data.Text)
+			}
+		case TypeCallout:
+			var data CalloutData
+			if err = json.Unmarshal(block.Data, &data); err == nil {
+				result[i].HTML, err = render.Cached(render.Key("block", block.BlockID), FormatMarkdown, data.Text)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// AddText добавляет текстовый блок в конец урока
+func AddText(tx *gorm.DB, lessonID uint, format, text string) error {
+	data, err := json.Marshal(TextData{Format: format, Text: text})
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := tx.Model(&storage.EeLessonBlock{}).Where("lesson_id = ?", lessonID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	return tx.Create(&storage.EeLessonBlock{LessonID: lessonID, Type: TypeText, Order: int(count), Data: data}).Error
+}
+
+// Проставляет блокам урока порядковые номера по списку
+func renumber(tx *gorm.DB, blockIDs []uint) error {
+	for i, blockID := range blockIDs {
+		if err := tx.Model(&storage.EeLessonBlock{}).Where("block_id = ? AND \"order\" <> ?", blockID, i).Update("order", i).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func lessonBlockIDs(tx *gorm.DB, lessonID uint) ([]uint, error) {
+	var blockIDs []uint
+	err := tx.Model(&storage.EeLessonBlock{}).Where("lesson_id = ?", lessonID).Order(`"order", block_id`).Pluck("block_id", &blockIDs).Error
+	return blockIDs, err
+}
+
+// Ставит блок на позицию position (nil - в конец урока), остальные сдвигаются
+func place(tx *gorm.DB, block *storage.EeLessonBlock, position *int) error {
+	blockIDs, err := lessonBlockIDs(tx, block.LessonID)
+	if err != nil {
+		return err
+	}
+
+	others := make([]uint, 0, len(blockIDs))
+	for _, blockID := range blockIDs {
+		if blockID != block.BlockID {
+			others = append(others, blockID)
+		}
+	}
+
+	index := len(others)
+	if position != nil {
+		index = min(max(*position, 0), len(others))
+	}
+
+	ordered := append(append(append([]uint{}, others[:index]...), block.BlockID), others[index:]...)
+	block.Order = index
+
+	return renumber(tx, ordered)
+}
+
+// edit применяет изменение блоков как правку урока: проверяет If-Match, увеличивает версию урока
+// и записывает правку в журнал. При false ответ уже отправлен
+func edit(c *fiber.Ctx, lessonID uint, change func(tx *gorm.DB) error) (bool, error) {
+	version, ok, err := editing.Expected(c)
+	if !ok {
+		return false, err
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		return revisions.Track(tx, revisions.Lesson, lessonID, middleware.UserID(c), revisions.Summary(c), func(tx *gorm.DB) error {
+			if err := editing.Bump(tx, &storage.EeLesson{}, "lesson_id", lessonID, version); err != nil {
+				return err
+			}
+
+			return change(tx)
+		})
+	})
+
+	switch {
+	case errors.Is(err, errInvalidOrder):
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	case err != nil && !errors.Is(err, editing.ErrConflict):
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var lesson storage.EeLesson
+	if err := storage.DB.Select("lesson_id", "version").Where("lesson_id = ?", lessonID).First(&lesson).Error; err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	// При конфликте клиент получает текущие блоки, чтобы слить правки
+	if errors.Is(err, editing.ErrConflict) {
+		current, err := ForLesson(lessonID)
+		if err != nil {
+			return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+		return false, editing.Conflict(c, lesson.Version, current)
+	}
+
+	editing.SetETag(c, lesson.Version)
+	return true, nil
+}
+
+func lessonCourse(c *fiber.Ctx) (uint, uint, error) {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	return uint(lessonID), courseID, nil
+}
+
+func GetBlocks(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, lessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return availability.Deny(c, status)
+	}
+
+	blocks, err := ForLesson(lessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	// Блоки - содержимое урока, их правки сверяются с версией урока
+	var lesson storage.EeLesson
+	if err := storage.DB.Select("version").Where("lesson_id = ?", lessonID).First(&lesson).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+	editing.SetETag(c, lesson.Version)
+
+	rendered, err := Render(blocks, c.Query("format") == "html")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("cannot render blocks: %s", err.Error())})
+	}
+
+	return c.JSON(rendered)
+}
+
+func CreateBlock(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := BlockInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse block data"})
+	}
+
+	data, err := decode(info.Type, info.Data, lessonID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	block := storage.EeLessonBlock{LessonID: lessonID, Type: info.Type, Data: data}
+	ok, err := edit(c, lessonID, func(tx *gorm.DB) error {
+		if err := tx.Create(&block).Error; err != nil {
+			return err
+		}
+
+		return place(tx, &block, info.Order)
+	})
+	if !ok {
+		return err
+	}
+
+	return c.JSON(&block)
+}
+
+func loadBlock(c *fiber.Ctx) (*storage.EeLessonBlock, error) {
+	blockID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid block id"})
+	}
+
+	var block storage.EeLessonBlock
+	if err := storage.DB.Where("block_id = ?", blockID).First(&block).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "block not found"})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(block.LessonID)
+	if err != nil {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return &block, nil
+}
+
+func updateBlock(c *fiber.Ctx) error {
+	block, err := loadBlock(c)
+	if block == nil {
+		return err
+	}
+
+	info := BlockInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse block data"})
+	}
+
+	// Смена типа требует новых данных, иначе проверяются прежние
+	if info.Type != "" && info.Type != block.Type && info.Data == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "data is required when changing block type"})
+	}
+
+	if info.Type != "" {
+		block.Type = info.Type
+	}
+	if info.Data != nil {
+		data, err := decode(block.Type, info.Data, block.LessonID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		block.Data = data
+	}
+
+	ok, err := edit(c, block.LessonID, func(tx *gorm.DB) error {
+		if err := tx.Model(block).Select("type", "data", "updated_at").Updates(block).Error; err != nil {
+			return err
+		}
+		render.Invalidate(render.Key("block", block.BlockID))
+
+		if info.Order == nil {
+			return nil
+		}
+
+		return place(tx, block, info.Order)
+	})
+	if !ok {
+		return err
+	}
+
+	return c.JSON(block)
+}
+
+func deleteBlock(c *fiber.Ctx) error {
+	block, err := loadBlock(c)
+	if block == nil {
+		return err
+	}
+
+	ok, err := edit(c, block.LessonID, func(tx *gorm.DB) error {
+		if err := tx.Delete(block).Error; err != nil {
+			return err
+		}
+		render.Invalidate(render.Key("block", block.BlockID))
+
+		blockIDs, err := lessonBlockIDs(tx, block.LessonID)
+		if err != nil {
+			return err
+		}
+
+		return renumber(tx, blockIDs)
+	})
+	if !ok {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// ReorderBlocks принимает полный список блоков урока в новом порядке
+func ReorderBlocks(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := ReorderInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse block order"})
+	}
+
+	ok, err := edit(c, lessonID, func(tx *gorm.DB) error {
+		blockIDs, err := lessonBlockIDs(tx, lessonID)
+		if err != nil {
+			return err
+		}
+
+		existing := make(map[uint]bool, len(blockIDs))
+		for _, blockID := range blockIDs {
+			existing[blockID] = true
+		}
+
+		if len(info.BlockIDs) != len(blockIDs) {
+			return errInvalidOrder
+		}
+		for _, blockID := range info.BlockIDs {
+			if !existing[blockID] {
+				return errInvalidOrder
+			}
+			delete(existing, blockID)
+		}
+
+		return renumber(tx, info.BlockIDs)
+	})
+	if !ok {
+		return err
+	}
+
+	blocks, err := ForLesson(lessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(blocks)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/blocks", middleware.TokenRequired)
+	{
+		g.Patch("/:id", updateBlock)
+		g.Delete("/:id", deleteBlock)
+	}
+}
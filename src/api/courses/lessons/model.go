@@ -1 +1,34 @@
 package lessons
+
+import (
+	"ekb-edu/src/api/assignments"
+	"ekb-edu/src/api/attachments"
+	"ekb-edu/src/api/courses/lessons/blocks"
+	"ekb-edu/src/api/courses/lessons/videos"
+	"ekb-edu/src/api/patch"
+	"ekb-edu/src/database/storage"
+	"errors"
+)
+
+// lessonFields - поля урока, которые можно менять через PATCH.
+// Доступность урока настраивается через /lessons/:id/availability, видео - через /lessons/:id/video,
+// содержимое - блоками через /lessons/:id/blocks
+var lessonFields = patch.Resource{
+	"title": {Column: "title", Required: true, Check: patch.NotBlank},
+	"content_text": {Column: "content_text", Required: true, Check: func(interface{}) error {
+		return errors.New("lesson content is stored in blocks, edit it through /lessons/:id/blocks")
+	}},
+	"order": {Column: "order", Required: true},
+	"video_id": {Column: "video_id", Check: func(interface{}) error {
+		return errors.New("only null is allowed, attach videos through /lessons/:id/video")
+	}},
+	"revision_summary": {},
+}
+
+type LessonWithBlocks struct {
+	storage.EeLesson
+	Blocks      []blocks.RenderedBlock   `json:"blocks"` // HTML блоков только при ?format=html
+	Video       *videos.Video            `json:"video"`  // null - у урока нет видео
+	Attachments []attachments.Attachment `json:"attachments"`
+	Assignment  *assignments.Assignment  `json:"assignment"` // null - урок не является заданием
+}
@@ -1 +1,81 @@
 package quizzes
+
+import (
+	"ekb-edu/src/database/storage"
+	"encoding/json"
+	"time"
+)
+
+const (
+	maxPoints          = 1000
+	maxAttemptsLimit   = 100
+	maxCooldownMinutes = 525600 // Год
+)
+
+// QuizSettings - изменяемые настройки теста, nil - оставить как есть
+type QuizSettings struct {
+	Title           *string `json:"title"`
+	MaxAttempts     *int    `json:"max_attempts"` // 0 - без ограничения
+	CooldownMinutes *int    `json:"cooldown_minutes"`
+	ScoringPolicy   *string `json:"scoring_policy"` // highest, latest или average
+}
+
+// QuestionInfo - новый вопрос. Без type и с correct_answer это short_text с одним ответом, как раньше
+type QuestionInfo struct {
+	Type          string          `json:"type"`
+	QuestionText  string          `json:"question_text"`
+	Options       json.RawMessage `json:"options"`
+	Points        float64         `json:"points"` // 0 - 1 балл
+	CorrectAnswer *string         `json:"correct_answer"`
+}
+
+// AnswerInfo - ответ в формате типа вопроса. answer_text - текстовый ответ прежних клиентов
+type AnswerInfo struct {
+	Response   json.RawMessage `json:"response"`
+	AnswerText *string         `json:"answer_text"`
+}
+
+// Question - вопрос теста. Студенту варианты отдаются без правильных ответов
+type Question struct {
+	QuestionID   uint        `json:"question_id"`
+	QuizID       uint        `json:"quiz_id"`
+	Type         string      `json:"type"`
+	QuestionText string      `json:"question_text"`
+	Points       float64     `json:"points"`
+	Options      interface{} `json:"options"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+type EeQuizWithQuestions struct {
+	Quiz      storage.EeQuiz `json:"quiz"`
+	Questions []Question     `json:"questions"`
+}
+
+// Answer - ответ в попытке. Оценка видна только после сдачи, иначе ответы можно подбирать
+type Answer struct {
+	AnswerID   uint            `json:"answer_id"`
+	AttemptID  uint            `json:"attempt_id"`
+	QuestionID uint            `json:"question_id"`
+	UserID     uint            `json:"user_id"`
+	Response   json.RawMessage `json:"response"`
+	Credit     *float64        `json:"credit"`     // null, пока попытка не сдана
+	IsCorrect  *bool           `json:"is_correct"` // null, пока попытка не сдана
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// Attempt - попытка с ответами. score - доля набранных баллов, пока попытка не сдана - null
+type Attempt struct {
+	storage.EeQuizAttempt
+	Score   *float64 `json:"score"`
+	Answers []Answer `json:"answers"`
+}
+
+// AttemptList - попытки пользователя по тесту и когда можно начать следующую
+type AttemptList struct {
+	Attempts     []storage.EeQuizAttempt `json:"attempts"`
+	Score        float64                 `json:"score"`         // Оценка по правилу теста, от 0 до 1
+	AttemptsLeft *int                    `json:"attempts_left"` // null - без ограничения
+	AvailableAt  *time.Time              `json:"available_at"`  // null - можно начать сейчас или попыток не осталось
+}
@@ -0,0 +1,137 @@
+package questions
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Типы вопросов
+const (
+	SingleChoice   = "single_choice"
+	MultipleChoice = "multiple_choice"
+	TrueFalse      = "true_false"
+	Numeric        = "numeric"
+	ShortText      = "short_text"
+	Ordering       = "ordering"
+	Matching       = "matching"
+	FillBlanks     = "fill_blanks"
+)
+
+const (
+	maxItems     = 50
+	maxItemRunes = 1000
+	maxIDRunes   = 64
+	maxPatterns  = 10
+	maxTypos     = 3
+)
+
+// Знаки препинания, которые отбрасываются по краям текстового ответа
+const edgePunctuation = ".,!?;:…\"'«»„“”‘’()[] "
+
+// ErrResponse - ответ студента не подходит к типу вопроса
+var ErrResponse = errors.New("invalid response")
+
+// Grader - варианты вопроса одного типа, которые умеют проверять ответ
+type Grader interface {
+	// Validate проверяет сами варианты, text - текст вопроса
+	Validate(text string) error
+	// Public возвращает варианты без правильных ответов, seed задаёт перемешивание
+	Public(seed uint) interface{}
+	// Grade возвращает долю балла от 0 до 1 или ErrResponse, если ответ не подходит к вопросу
+	Grade(response json.RawMessage) (float64, error)
+}
+
+// Choice - вариант ответа, элемент для упорядочивания или сопоставления
+type Choice struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// Варианты вопросов по типам. Студент получает их без правильных ответов, см. Grader.Public
+
+type SingleChoiceOptions struct {
+	Choices []Choice `json:"choices"`
+	Correct string   `json:"correct"`
+}
+
+type MultipleChoiceOptions struct {
+	Choices []Choice `json:"choices"`
+	Correct []string `json:"correct"`
+	Partial bool     `json:"partial"` // Частичный балл: доля верных отметок за вычетом неверных
+}
+
+type TrueFalseOptions struct {
+	Correct *bool `json:"correct"`
+}
+
+type NumericOptions struct {
+	Value     *float64 `json:"value"`
+	Tolerance float64  `json:"tolerance"` // Допустимое отклонение в обе стороны
+}
+
+// TextMatcher - правило, по которому нормализованный ответ признаётся верным
+type TextMatcher interface {
+	Match(answer string) bool
+}
+
+// TextAnswer - принимаемые текстовые ответы и правила сравнения с ними.
+// Ответ и варианты всегда приводятся к NFC, пробелы по краям отбрасываются, а внутри схлопываются
+type TextAnswer struct {
+	Variants        []string `json:"variants"`
+	Patterns        []string `json:"patterns"` // Регулярные выражения, ответ должен совпасть целиком
+	CaseSensitive   bool     `json:"case_sensitive"`
+	KeepPunctuation bool     `json:"keep_punctuation"` // Не отбрасывать знаки препинания по краям
+	DistinctYo      bool     `json:"distinct_yo"`      // Различать ё и е
+	MaxTypos        int      `json:"max_typos"`        // Допустимое расстояние Левенштейна, не больше четверти длины варианта
+
+	matchers []TextMatcher
+}
+
+type ShortTextOptions struct {
+	TextAnswer
+}
+
+type OrderingOptions struct {
+	Items   []Choice `json:"items"`
+	Correct []string `json:"correct"` // Идентификаторы в правильном порядке
+	Partial bool     `json:"partial"` // Частичный балл: доля элементов на своих местах
+}
+
+type MatchingOptions struct {
+	Prompts []Choice          `json:"prompts"`
+	Matches []Choice          `json:"matches"` // Может быть больше, чем prompts
+	Correct map[string]string `json:"correct"` // prompt id -> match id
+	Partial bool              `json:"partial"`
+}
+
+// Blank - пропуск {{id}} в тексте вопроса
+type Blank struct {
+	ID string `json:"id"`
+	TextAnswer
+}
+
+type FillBlanksOptions struct {
+	Blanks  []Blank `json:"blanks"`
+	Partial bool    `json:"partial"`
+}
+
+// Варианты, которые видит студент
+
+type PublicChoices struct {
+	Choices []Choice `json:"choices"`
+}
+
+type PublicOrdering struct {
+	Items []Choice `json:"items"` // Перемешаны
+}
+
+type PublicMatching struct {
+	Prompts []Choice `json:"prompts"`
+	Matches []Choice `json:"matches"` // Перемешаны
+}
+
+type PublicBlanks struct {
+	Blanks []string `json:"blanks"` // Идентификаторы пропусков, в тексте вопроса они записаны как {{id}}
+}
+
+type Empty struct{}
@@ -0,0 +1,627 @@
+package questions
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+var graders = map[string]func() Grader{
+	SingleChoice:   func() Grader { return &SingleChoiceOptions{} },
+	MultipleChoice: func() Grader { return &MultipleChoiceOptions{} },
+	TrueFalse:      func() Grader { return &TrueFalseOptions{} },
+	Numeric:        func() Grader { return &NumericOptions{} },
+	ShortText:      func() Grader { return &ShortTextOptions{} },
+	Ordering:       func() Grader { return &OrderingOptions{} },
+	Matching:       func() Grader { return &MatchingOptions{} },
+	FillBlanks:     func() Grader { return &FillBlanksOptions{} },
+}
+
+func IsValidType(kind string) bool {
+	_, ok := graders[kind]
+	return ok
+}
+
+// Parse разбирает и проверяет варианты вопроса типа kind. Лишние поля считаются ошибкой,
+// чтобы опечатка в названии поля не превращала вопрос в нерешаемый
+func Parse(kind, text string, options []byte) (Grader, error) {
+	factory, ok := graders[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown question type %q", kind)
+	}
+
+	if len(bytes.TrimSpace(options)) == 0 {
+		options = []byte("{}")
+	}
+
+	grader := factory()
+	decoder := json.NewDecoder(bytes.NewReader(options))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(grader); err != nil {
+		return nil, fmt.Errorf("invalid options for %s question: %s", kind, err.Error())
+	}
+
+	if err := grader.Validate(text); err != nil {
+		return nil, fmt.Errorf("invalid options for %s question: %s", kind, err.Error())
+	}
+
+	return grader, nil
+}
+
+// checkChoices проверяет список вариантов и возвращает множество их идентификаторов
+func checkChoices(name string, items []Choice, least int) (map[string]bool, error) {
+	if len(items) < least || len(items) > maxItems {
+		return nil, fmt.Errorf("%s must have from %d to %d items", name, least, maxItems)
+	}
+
+	ids := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item.ID == "" || len([]rune(item.ID)) > maxIDRunes {
+			return nil, fmt.Errorf("every item in %s needs an id up to %d characters", name, maxIDRunes)
+		} else if ids[item.ID] {
+			return nil, fmt.Errorf("id %q is repeated in %s", item.ID, name)
+		} else if strings.TrimSpace(item.Text) == "" || len([]rune(item.Text)) > maxItemRunes {
+			return nil, fmt.Errorf("item %q in %s needs a text up to %d characters", item.ID, name, maxItemRunes)
+		}
+		ids[item.ID] = true
+	}
+
+	return ids, nil
+}
+
+// check проверяет варианты и правила и готовит правила сравнения для Grade
+func (answer *TextAnswer) check(name string) error {
+	if len(answer.Variants)+len(answer.Patterns) == 0 || len(answer.Variants) > maxItems {
+		return fmt.Errorf("%s must have from 1 to %d accepted answers or a pattern", name, maxItems)
+	} else if len(answer.Patterns) > maxPatterns {
+		return fmt.Errorf("%s must have at most %d patterns", name, maxPatterns)
+	} else if answer.MaxTypos < 0 || answer.MaxTypos > maxTypos {
+		return fmt.Errorf("max_typos in %s must be between 0 and %d", name, maxTypos)
+	}
+
+	exact := exactMatcher{}
+	numbers := numberMatcher{}
+	typos := typoMatcher{max: answer.MaxTypos}
+	for _, variant := range answer.Variants {
+		if strings.TrimSpace(variant) == "" || len([]rune(variant)) > maxItemRunes {
+			return fmt.Errorf("accepted answers in %s must be non-empty and up to %d characters", name, maxItemRunes)
+		}
+
+		variant = answer.normalize(variant)
+		if variant == "" {
+			return fmt.Errorf("accepted answers in %s must not consist of punctuation only", name)
+		}
+
+		exact[variant] = true
+		if value, ok := parseNumber(variant); ok {
+			numbers = append(numbers, value)
+		} else if answer.MaxTypos > 0 {
+			typos.variants = append(typos.variants, []rune(variant))
+		}
+	}
+
+	answer.matchers = []TextMatcher{exact, numbers}
+	if len(typos.variants) > 0 {
+		answer.matchers = append(answer.matchers, typos)
+	}
+
+	for _, pattern := range answer.Patterns {
+		if len([]rune(pattern)) > maxItemRunes {
+			return fmt.Errorf("patterns in %s must be up to %d characters", name, maxItemRunes)
+		}
+
+		// Ответ сравнивается уже нормализованным, поэтому шаблон приводится к тем же правилам
+		if !answer.DistinctYo {
+			pattern = yoReplacer.Replace(pattern)
+		}
+		if !answer.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid pattern in %s: %s", name, err.Error())
+		}
+		answer.matchers = append(answer.matchers, patternMatcher{re})
+	}
+
+	return nil
+}
+
+var yoReplacer = strings.NewReplacer("ё", "е", "Ё", "Е")
+
+// normalize приводит ответ к виду, в котором его сравнивают с вариантами
+func (answer *TextAnswer) normalize(text string) string {
+	text = strings.Join(strings.Fields(norm.NFC.String(text)), " ")
+	// Числа не обрезаются: точка в «.5» значащая
+	if _, ok := parseNumber(text); ok {
+		return text
+	}
+	if !answer.KeepPunctuation {
+		text = strings.Trim(text, edgePunctuation)
+	}
+	if !answer.DistinctYo {
+		text = yoReplacer.Replace(text)
+	}
+	if !answer.CaseSensitive {
+		text = cases.Fold().String(text)
+	}
+	return text
+}
+
+// Match проверяет ответ по всем правилам, достаточно совпадения с одним
+func (answer *TextAnswer) Match(given string) bool {
+	given = answer.normalize(given)
+	if given == "" {
+		return false
+	}
+
+	for _, matcher := range answer.matchers {
+		if matcher.Match(given) {
+			return true
+		}
+	}
+	return false
+}
+
+// exactMatcher - совпадение с одним из нормализованных вариантов
+type exactMatcher map[string]bool
+
+func (variants exactMatcher) Match(answer string) bool {
+	return variants[answer]
+}
+
+var numberText = regexp.MustCompile(`^[+-]?(?:\d+(?:[.,]\d*)?|[.,]\d+)$`)
+
+// parseNumber разбирает десятичное число, в том числе с запятой вместо точки и без нуля в целой части
+func parseNumber(text string) (float64, bool) {
+	if !numberText.MatchString(text) {
+		return 0, false
+	}
+
+	value, err := strconv.ParseFloat(strings.Replace(text, ",", ".", 1), 64)
+	return value, err == nil
+}
+
+// numberMatcher - числовые варианты сравниваются как числа: «3.0» равно «3»
+type numberMatcher []float64
+
+func (values numberMatcher) Match(answer string) bool {
+	value, ok := parseNumber(answer)
+	return ok && slices.ContainsFunc(values, func(variant float64) bool { return math.Abs(value-variant) < 1e-9 })
+}
+
+// patternMatcher - совпадение с регулярным выражением
+type patternMatcher struct {
+	re *regexp.Regexp
+}
+
+func (matcher patternMatcher) Match(answer string) bool {
+	return matcher.re.MatchString(answer)
+}
+
+// typoMatcher - опечатки: не больше max правок и не больше четверти длины варианта,
+// чтобы короткие ответы вроде «да» не совпадали с «на»
+type typoMatcher struct {
+	variants [][]rune
+	max      int
+}
+
+func (matcher typoMatcher) Match(answer string) bool {
+	given := []rune(answer)
+	for _, variant := range matcher.variants {
+		limit := min(matcher.max, len(variant)/4)
+		if limit > 0 && levenshtein(given, variant, limit) <= limit {
+			return true
+		}
+	}
+	return false
+}
+
+// levenshtein считает расстояние редактирования, прекращая счёт, когда оно заведомо больше limit
+func levenshtein(a, b []rune, limit int) int {
+	if abs := len(a) - len(b); abs > limit || -abs > limit {
+		return limit + 1
+	}
+
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		best := current[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			best = min(best, current[j])
+		}
+
+		if best > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// decode разбирает ответ студента, любая ошибка превращается в ErrResponse
+func decode(response json.RawMessage, value interface{}, expected string) error {
+	if err := json.Unmarshal(response, value); err != nil {
+		return fmt.Errorf("%w: expected %s", ErrResponse, expected)
+	}
+	return nil
+}
+
+// shuffle перемешивает элементы одинаково для одного seed, чтобы порядок не менялся
+// от запроса к запросу и не совпадал с правильным
+func shuffle(items []Choice, seed uint) []Choice {
+	keys := make(map[string][32]byte, len(items))
+	for _, item := range items {
+		keys[item.ID] = sha256.Sum256([]byte(fmt.Sprintf("%d:%s", seed, item.ID)))
+	}
+
+	result := slices.Clone(items)
+	sort.Slice(result, func(i, j int) bool {
+		a, b := keys[result[i].ID], keys[result[j].ID]
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+
+	return result
+}
+
+// credit - доля балла: всё или ничего, либо доля верного при частичном зачёте
+func credit(right, total int, partial bool) float64 {
+	switch {
+	case total == 0:
+		return 0
+	case right == total:
+		return 1
+	case partial:
+		return float64(right) / float64(total)
+	default:
+		return 0
+	}
+}
+
+func (options *SingleChoiceOptions) Validate(text string) error {
+	ids, err := checkChoices("choices", options.Choices, 2)
+	if err != nil {
+		return err
+	} else if !ids[options.Correct] {
+		return errors.New("correct must be the id of one of the choices")
+	}
+	return nil
+}
+
+func (options *SingleChoiceOptions) Public(seed uint) interface{} {
+	return PublicChoices{Choices: options.Choices}
+}
+
+func (options *SingleChoiceOptions) Grade(response json.RawMessage) (float64, error) {
+	var choice string
+	if err := decode(response, &choice, "a choice id"); err != nil {
+		return 0, err
+	}
+
+	if !slices.ContainsFunc(options.Choices, func(item Choice) bool { return item.ID == choice }) {
+		return 0, fmt.Errorf("%w: unknown choice %q", ErrResponse, choice)
+	}
+
+	return credit(boolInt(choice == options.Correct), 1, false), nil
+}
+
+func (options *MultipleChoiceOptions) Validate(text string) error {
+	ids, err := checkChoices("choices", options.Choices, 2)
+	if err != nil {
+		return err
+	}
+
+	if len(options.Correct) == 0 {
+		return errors.New("correct must list at least one choice")
+	}
+	seen := make(map[string]bool, len(options.Correct))
+	for _, id := range options.Correct {
+		if !ids[id] || seen[id] {
+			return errors.New("correct must list distinct ids of the choices")
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
+
+func (options *MultipleChoiceOptions) Public(seed uint) interface{} {
+	return PublicChoices{Choices: options.Choices}
+}
+
+// Grade при частичном зачёте вычитает неверные отметки из верных, чтобы отметить всё было невыгодно
+func (options *MultipleChoiceOptions) Grade(response json.RawMessage) (float64, error) {
+	var chosen []string
+	if err := decode(response, &chosen, "a list of choice ids"); err != nil {
+		return 0, err
+	}
+
+	right, wrong := 0, 0
+	seen := make(map[string]bool, len(chosen))
+	for _, id := range chosen {
+		if !slices.ContainsFunc(options.Choices, func(item Choice) bool { return item.ID == id }) {
+			return 0, fmt.Errorf("%w: unknown choice %q", ErrResponse, id)
+		} else if seen[id] {
+			return 0, fmt.Errorf("%w: choice %q is repeated", ErrResponse, id)
+		}
+		seen[id] = true
+
+		if slices.Contains(options.Correct, id) {
+			right++
+		} else {
+			wrong++
+		}
+	}
+
+	if wrong == 0 {
+		return credit(right, len(options.Correct), options.Partial), nil
+	} else if !options.Partial {
+		return 0, nil
+	}
+
+	return credit(max(0, right-wrong), len(options.Correct), true), nil
+}
+
+func (options *TrueFalseOptions) Validate(text string) error {
+	if options.Correct == nil {
+		return errors.New("correct must be true or false")
+	}
+	return nil
+}
+
+func (options *TrueFalseOptions) Public(seed uint) interface{} {
+	return Empty{}
+}
+
+func (options *TrueFalseOptions) Grade(response json.RawMessage) (float64, error) {
+	var value bool
+	if err := decode(response, &value, "true or false"); err != nil {
+		return 0, err
+	}
+
+	return credit(boolInt(value == *options.Correct), 1, false), nil
+}
+
+func (options *NumericOptions) Validate(text string) error {
+	switch {
+	case options.Value == nil || math.IsNaN(*options.Value) || math.IsInf(*options.Value, 0):
+		return errors.New("value must be a number")
+	case options.Tolerance < 0 || math.IsNaN(options.Tolerance) || math.IsInf(options.Tolerance, 0):
+		return errors.New("tolerance must not be negative")
+	}
+	return nil
+}
+
+func (options *NumericOptions) Public(seed uint) interface{} {
+	return Empty{}
+}
+
+// Grade принимает число или строку с числом, в том числе с запятой вместо точки
+func (options *NumericOptions) Grade(response json.RawMessage) (float64, error) {
+	var value float64
+	if err := json.Unmarshal(response, &value); err != nil {
+		var text string
+		if err := decode(response, &text, "a number"); err != nil {
+			return 0, err
+		}
+
+		value, err = strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(text), ",", "."), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, fmt.Errorf("%w: expected a number", ErrResponse)
+		}
+	}
+
+	// Небольшой запас на погрешность представления дробей
+	return credit(boolInt(math.Abs(value-*options.Value) <= options.Tolerance+1e-9), 1, false), nil
+}
+
+func (options *ShortTextOptions) Validate(text string) error {
+	return options.check("variants")
+}
+
+func (options *ShortTextOptions) Public(seed uint) interface{} {
+	return Empty{}
+}
+
+func (options *ShortTextOptions) Grade(response json.RawMessage) (float64, error) {
+	var value string
+	if err := decode(response, &value, "a text"); err != nil {
+		return 0, err
+	}
+
+	return credit(boolInt(options.Match(value)), 1, false), nil
+}
+
+func (options *OrderingOptions) Validate(text string) error {
+	ids, err := checkChoices("items", options.Items, 2)
+	if err != nil {
+		return err
+	}
+
+	if len(options.Correct) != len(options.Items) {
+		return errors.New("correct must list every item exactly once")
+	}
+	seen := make(map[string]bool, len(options.Correct))
+	for _, id := range options.Correct {
+		if !ids[id] || seen[id] {
+			return errors.New("correct must list every item exactly once")
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
+
+func (options *OrderingOptions) Public(seed uint) interface{} {
+	return PublicOrdering{Items: shuffle(options.Items, seed)}
+}
+
+func (options *OrderingOptions) Grade(response json.RawMessage) (float64, error) {
+	var order []string
+	if err := decode(response, &order, "a list of item ids"); err != nil {
+		return 0, err
+	}
+
+	if len(order) != len(options.Correct) {
+		return 0, fmt.Errorf("%w: every item must be placed exactly once", ErrResponse)
+	}
+
+	right := 0
+	seen := make(map[string]bool, len(order))
+	for i, id := range order {
+		if !slices.Contains(options.Correct, id) || seen[id] {
+			return 0, fmt.Errorf("%w: every item must be placed exactly once", ErrResponse)
+		}
+		seen[id] = true
+		right += boolInt(options.Correct[i] == id)
+	}
+
+	return credit(right, len(options.Correct), options.Partial), nil
+}
+
+func (options *MatchingOptions) Validate(text string) error {
+	prompts, err := checkChoices("prompts", options.Prompts, 1)
+	if err != nil {
+		return err
+	}
+
+	matches, err := checkChoices("matches", options.Matches, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(options.Correct) != len(options.Prompts) {
+		return errors.New("correct must map every prompt to a match")
+	}
+	for prompt, match := range options.Correct {
+		if !prompts[prompt] || !matches[match] {
+			return errors.New("correct must map every prompt to a match")
+		}
+	}
+
+	return nil
+}
+
+func (options *MatchingOptions) Public(seed uint) interface{} {
+	return PublicMatching{Prompts: options.Prompts, Matches: shuffle(options.Matches, seed)}
+}
+
+// Grade засчитывает сопоставленные верно пары, несопоставленные считаются неверными
+func (options *MatchingOptions) Grade(response json.RawMessage) (float64, error) {
+	var pairs map[string]string
+	if err := decode(response, &pairs, "an object mapping prompt ids to match ids"); err != nil {
+		return 0, err
+	}
+
+	right := 0
+	for prompt, match := range pairs {
+		correct, ok := options.Correct[prompt]
+		if !ok {
+			return 0, fmt.Errorf("%w: unknown prompt %q", ErrResponse, prompt)
+		} else if !slices.ContainsFunc(options.Matches, func(item Choice) bool { return item.ID == match }) {
+			return 0, fmt.Errorf("%w: unknown match %q", ErrResponse, match)
+		}
+		right += boolInt(correct == match)
+	}
+
+	return credit(right, len(options.Correct), options.Partial), nil
+}
+
+func (options *FillBlanksOptions) Validate(text string) error {
+	if len(options.Blanks) == 0 || len(options.Blanks) > maxItems {
+		return fmt.Errorf("blanks must have from 1 to %d items", maxItems)
+	}
+
+	ids := make(map[string]bool, len(options.Blanks))
+	for i, blank := range options.Blanks {
+		if blank.ID == "" || len([]rune(blank.ID)) > maxIDRunes {
+			return fmt.Errorf("every blank needs an id up to %d characters", maxIDRunes)
+		} else if ids[blank.ID] {
+			return fmt.Errorf("blank %q is repeated", blank.ID)
+		} else if err := options.Blanks[i].check(fmt.Sprintf("blank %q", blank.ID)); err != nil {
+			return err
+		}
+		ids[blank.ID] = true
+	}
+
+	found := make(map[string]bool, len(ids))
+	for _, match := range placeholder.FindAllStringSubmatch(text, -1) {
+		if !ids[match[1]] {
+			return fmt.Errorf("question text has {{%s}} but there is no such blank", match[1])
+		} else if found[match[1]] {
+			return fmt.Errorf("blank {{%s}} appears in the question text twice", match[1])
+		}
+		found[match[1]] = true
+	}
+
+	for _, blank := range options.Blanks {
+		if !found[blank.ID] {
+			return fmt.Errorf("blank %q has no {{%s}} in the question text", blank.ID, blank.ID)
+		}
+	}
+
+	return nil
+}
+
+func (options *FillBlanksOptions) Public(seed uint) interface{} {
+	ids := make([]string, len(options.Blanks))
+	for i, blank := range options.Blanks {
+		ids[i] = blank.ID
+	}
+	return PublicBlanks{Blanks: ids}
+}
+
+// Grade сверяет каждый пропуск с его вариантами, незаполненные пропуски считаются неверными
+func (options *FillBlanksOptions) Grade(response json.RawMessage) (float64, error) {
+	var values map[string]string
+	if err := decode(response, &values, "an object mapping blank ids to texts"); err != nil {
+		return 0, err
+	}
+
+	for id := range values {
+		if !slices.ContainsFunc(options.Blanks, func(blank Blank) bool { return blank.ID == id }) {
+			return 0, fmt.Errorf("%w: unknown blank %q", ErrResponse, id)
+		}
+	}
+
+	right := 0
+	for _, blank := range options.Blanks {
+		if value, ok := values[blank.ID]; ok {
+			right += boolInt(blank.Match(value))
+		}
+	}
+
+	return credit(right, len(options.Blanks), options.Partial), nil
+}
+
+func boolInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
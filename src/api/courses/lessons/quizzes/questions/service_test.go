@@ -0,0 +1,303 @@
+package questions
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		answer TextAnswer
+		text   string
+		want   string
+	}{
+		{"spaces collapse", TextAnswer{}, "  Красная \t  площадь \n", "красная площадь"},
+		{"composed form", TextAnswer{}, "e\u0301", "\u00e9"},
+		{"edge punctuation", TextAnswer{}, "«Война и мир»!", "война и мир"},
+		{"inner punctuation stays", TextAnswer{}, "Ростов-на-Дону, Россия.", "ростов-на-дону, россия"},
+		{"keep punctuation", TextAnswer{KeepPunctuation: true}, "Да!", "да!"},
+		{"yo folds to e", TextAnswer{}, "Ёлка", "елка"},
+		{"distinct yo", TextAnswer{DistinctYo: true}, "Ёлка", "ёлка"},
+		{"case sensitive", TextAnswer{CaseSensitive: true}, "NaCl", "NaCl"},
+		{"leading dot of a number", TextAnswer{}, ".5", ".5"},
+		{"trailing dot of a number", TextAnswer{}, "5.", "5."},
+		{"signed number", TextAnswer{}, " -0,25 ", "-0,25"},
+		{"punctuation only", TextAnswer{}, "?!", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.answer.normalize(tt.text); got != tt.want {
+				t.Errorf("normalize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text string
+		want float64
+		ok   bool
+	}{
+		{"42", 42, true},
+		{"+3.5", 3.5, true},
+		{"-0,25", -0.25, true},
+		{".5", 0.5, true},
+		{"5.", 5, true},
+		{"1.2.3", 0, false},
+		{"1e3", 0, false},
+		{".", 0, false},
+		{"пять", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseNumber(tt.text)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseNumber(%q) = %v, %v, want %v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"кошка", "кошка", 2, 0},
+		{"кошка", "кошки", 2, 1},
+		{"кошка", "окшка", 2, 2},
+		{"", "абв", 3, 3},
+		{"фотосинтез", "фотосинтес", 1, 1},
+		{"фотосинтез", "фатасинтес", 1, 2}, // Больше limit - limit+1
+		{"перпендикуляр", "пер", 3, 4},     // Разница длин сразу больше limit
+		{"abcdef", "badcfe", 2, 3},         // Счёт прерывается, когда строка матрицы больше limit
+		{"параллелограмм", "паралелограм", 2, 2},
+	}
+
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b), tt.limit); got != tt.want {
+			t.Errorf("levenshtein(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestShortTextGrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		answer  string
+		want    float64
+	}{
+		{"exact", `{"variants": ["Москва"]}`, "Москва", 1},
+		{"case and spaces", `{"variants": ["Москва"]}`, "  москва ", 1},
+		{"case sensitive", `{"variants": ["NaCl"], "case_sensitive": true}`, "nacl", 0},
+		{"edge punctuation", `{"variants": ["Пушкин"]}`, "Пушкин.", 1},
+		{"keep punctuation", `{"variants": ["Пушкин"], "keep_punctuation": true}`, "Пушкин.", 0},
+		{"yo", `{"variants": ["ёж"]}`, "еж", 1},
+		{"distinct yo", `{"variants": ["ёж"], "distinct_yo": true}`, "еж", 0},
+		{"another variant", `{"variants": ["СССР", "Советский Союз"]}`, "советский союз", 1},
+		{"wrong", `{"variants": ["Москва"]}`, "Петербург", 0},
+		{"empty answer", `{"variants": ["Москва"]}`, " . ", 0},
+		{"number as number", `{"variants": ["3"]}`, "3,0", 1},
+		{"fraction without zero", `{"variants": ["0.5"]}`, ".5", 1},
+		{"dot is not dropped", `{"variants": ["5"]}`, ".5", 0},
+		{"trailing dot", `{"variants": ["5"]}`, "5.", 1},
+		{"pattern", `{"patterns": ["\\d+ (кг|килограмм)"]}`, "15 КГ", 1},
+		{"pattern must match whole", `{"patterns": ["\\d+ кг"]}`, "около 15 кг", 0},
+		{"pattern with yo", `{"patterns": ["ёлк[аи]"]}`, "Елки", 1},
+		{"typo", `{"variants": ["фотосинтез"], "max_typos": 1}`, "фотосинтес", 1},
+		{"too many typos", `{"variants": ["фотосинтез"], "max_typos": 1}`, "фатасинтес", 0},
+		{"typos limited by length", `{"variants": ["да"], "max_typos": 2}`, "на", 0},
+		{"no typos in numbers", `{"variants": ["1945"], "max_typos": 1}`, "1946", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grader, err := Parse(ShortText, "Вопрос", []byte(tt.options))
+			if err != nil {
+				t.Fatalf("Parse(%s): %v", tt.options, err)
+			}
+
+			response, _ := json.Marshal(tt.answer)
+			got, err := grader.Grade(response)
+			if err != nil {
+				t.Fatalf("Grade(%q): %v", tt.answer, err)
+			}
+			if got != tt.want {
+				t.Errorf("Grade(%q) = %v, want %v", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortTextValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+	}{
+		{"no variants", `{}`},
+		{"blank variant", `{"variants": [" "]}`},
+		{"punctuation only", `{"variants": ["?!"]}`},
+		{"negative typos", `{"variants": ["да"], "max_typos": -1}`},
+		{"too many typos", `{"variants": ["да"], "max_typos": 4}`},
+		{"broken pattern", `{"patterns": ["(кг"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(ShortText, "Вопрос", []byte(tt.options)); err == nil {
+				t.Errorf("Parse(%s) accepted invalid options", tt.options)
+			}
+		})
+	}
+}
+
+const (
+	choices   = `"choices": [{"id": "a", "text": "А"}, {"id": "b", "text": "Б"}, {"id": "c", "text": "В"}, {"id": "d", "text": "Г"}]`
+	items     = `"items": [{"id": "1", "text": "Один"}, {"id": "2", "text": "Два"}, {"id": "3", "text": "Три"}, {"id": "4", "text": "Четыре"}]`
+	pairs     = `"prompts": [{"id": "ru", "text": "Россия"}, {"id": "fr", "text": "Франция"}], "matches": [{"id": "msk", "text": "Москва"}, {"id": "par", "text": "Париж"}, {"id": "ber", "text": "Берлин"}]`
+	blanks    = `"blanks": [{"id": "x", "variants": ["Волга"]}, {"id": "y", "variants": ["Каспийское море"]}]`
+	blankText = "{{x}} впадает в {{ y }}"
+)
+
+func TestGrade(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		text     string
+		options  string
+		response string
+		want     float64
+		invalid  bool // Ожидается ErrResponse
+	}{
+		{"single right", SingleChoice, "", `{` + choices + `, "correct": "b"}`, `"b"`, 1, false},
+		{"single wrong", SingleChoice, "", `{` + choices + `, "correct": "b"}`, `"a"`, 0, false},
+		{"single unknown choice", SingleChoice, "", `{` + choices + `, "correct": "b"}`, `"e"`, 0, true},
+		{"single not a string", SingleChoice, "", `{` + choices + `, "correct": "b"}`, `["b"]`, 0, true},
+
+		{"multiple right", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"]}`, `["c", "a"]`, 1, false},
+		{"multiple missed", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"]}`, `["a"]`, 0, false},
+		{"multiple partial missed", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"], "partial": true}`, `["a"]`, 0.5, false},
+		{"multiple partial wrong mark", MultipleChoice, "", `{` + choices + `, "correct": ["a", "b", "c"], "partial": true}`, `["a", "b", "d"]`, 1.0 / 3, false},
+		{"multiple partial all marked", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"], "partial": true}`, `["a", "b", "c", "d"]`, 0, false},
+		{"multiple wrong mark", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"]}`, `["a", "c", "d"]`, 0, false},
+		{"multiple empty", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"], "partial": true}`, `[]`, 0, false},
+		{"multiple repeated", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"]}`, `["a", "a"]`, 0, true},
+		{"multiple unknown choice", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"]}`, `["a", "e"]`, 0, true},
+		{"multiple not a list", MultipleChoice, "", `{` + choices + `, "correct": ["a", "c"]}`, `"a"`, 0, true},
+
+		{"true right", TrueFalse, "", `{"correct": true}`, `true`, 1, false},
+		{"false right", TrueFalse, "", `{"correct": false}`, `false`, 1, false},
+		{"true wrong", TrueFalse, "", `{"correct": true}`, `false`, 0, false},
+		{"true as string", TrueFalse, "", `{"correct": true}`, `"true"`, 0, true},
+
+		{"numeric exact", Numeric, "", `{"value": 3.14}`, `3.14`, 1, false},
+		{"numeric within tolerance", Numeric, "", `{"value": 3.14, "tolerance": 0.01}`, `3.15`, 1, false},
+		{"numeric outside tolerance", Numeric, "", `{"value": 3.14, "tolerance": 0.01}`, `3.16`, 0, false},
+		{"numeric string with comma", Numeric, "", `{"value": -0.5}`, `" -0,5 "`, 1, false},
+		{"numeric not a number", Numeric, "", `{"value": 1}`, `"один"`, 0, true},
+		{"numeric nan", Numeric, "", `{"value": 1}`, `"NaN"`, 0, true},
+		{"numeric list", Numeric, "", `{"value": 1}`, `[1]`, 0, true},
+
+		{"ordering right", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "4"]}`, `["1", "2", "3", "4"]`, 1, false},
+		{"ordering swapped", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "4"]}`, `["2", "1", "3", "4"]`, 0, false},
+		{"ordering partial swapped", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "4"], "partial": true}`, `["2", "1", "3", "4"]`, 0.5, false},
+		{"ordering missing item", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "4"]}`, `["1", "2", "3"]`, 0, true},
+		{"ordering repeated item", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "4"]}`, `["1", "1", "3", "4"]`, 0, true},
+		{"ordering unknown item", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "4"]}`, `["1", "2", "3", "5"]`, 0, true},
+
+		{"matching right", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "par"}}`, `{"ru": "msk", "fr": "par"}`, 1, false},
+		{"matching one wrong", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "par"}}`, `{"ru": "msk", "fr": "ber"}`, 0, false},
+		{"matching partial one wrong", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "par"}, "partial": true}`, `{"ru": "msk", "fr": "ber"}`, 0.5, false},
+		{"matching partial unanswered", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "par"}, "partial": true}`, `{"fr": "par"}`, 0.5, false},
+		{"matching unknown prompt", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "par"}}`, `{"de": "ber"}`, 0, true},
+		{"matching unknown match", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "par"}}`, `{"ru": "spb"}`, 0, true},
+		{"matching not an object", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "par"}}`, `["msk", "par"]`, 0, true},
+
+		{"blanks right", FillBlanks, blankText, `{` + blanks + `}`, `{"x": "волга", "y": "Каспийское  море."}`, 1, false},
+		{"blanks one wrong", FillBlanks, blankText, `{` + blanks + `}`, `{"x": "Волга", "y": "Чёрное море"}`, 0, false},
+		{"blanks partial one wrong", FillBlanks, blankText, `{` + blanks + `, "partial": true}`, `{"x": "Волга", "y": "Чёрное море"}`, 0.5, false},
+		{"blanks partial unfilled", FillBlanks, blankText, `{` + blanks + `, "partial": true}`, `{"y": "Каспийское море"}`, 0.5, false},
+		{"blanks unknown blank", FillBlanks, blankText, `{` + blanks + `}`, `{"z": "Волга"}`, 0, true},
+		{"blanks not texts", FillBlanks, blankText, `{` + blanks + `}`, `{"x": 1}`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grader, err := Parse(tt.kind, tt.text, []byte(tt.options))
+			if err != nil {
+				t.Fatalf("Parse(%s): %v", tt.options, err)
+			}
+
+			got, err := grader.Grade(json.RawMessage(tt.response))
+			if tt.invalid {
+				if !errors.Is(err, ErrResponse) {
+					t.Errorf("Grade(%s) = %v, %v, want ErrResponse", tt.response, got, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Grade(%s): %v", tt.response, err)
+			}
+			if diff := got - tt.want; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Grade(%s) = %v, want %v", tt.response, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    string
+		text    string
+		options string
+	}{
+		{"unknown type", "essay", "", `{}`},
+		{"unknown field", SingleChoice, "", `{` + choices + `, "corect": "a"}`},
+		{"single one choice", SingleChoice, "", `{"choices": [{"id": "a", "text": "А"}], "correct": "a"}`},
+		{"single unknown correct", SingleChoice, "", `{` + choices + `, "correct": "e"}`},
+		{"single repeated id", SingleChoice, "", `{"choices": [{"id": "a", "text": "А"}, {"id": "a", "text": "Б"}], "correct": "a"}`},
+		{"single blank text", SingleChoice, "", `{"choices": [{"id": "a", "text": "А"}, {"id": "b", "text": " "}], "correct": "a"}`},
+		{"single empty id", SingleChoice, "", `{"choices": [{"id": "", "text": "А"}, {"id": "b", "text": "Б"}], "correct": "b"}`},
+
+		{"multiple no correct", MultipleChoice, "", `{` + choices + `, "correct": []}`},
+		{"multiple unknown correct", MultipleChoice, "", `{` + choices + `, "correct": ["a", "e"]}`},
+		{"multiple repeated correct", MultipleChoice, "", `{` + choices + `, "correct": ["a", "a"]}`},
+
+		{"true_false no correct", TrueFalse, "", `{}`},
+
+		{"numeric no value", Numeric, "", `{"tolerance": 1}`},
+		{"numeric negative tolerance", Numeric, "", `{"value": 1, "tolerance": -0.1}`},
+
+		{"ordering missing item", Ordering, "", `{` + items + `, "correct": ["1", "2", "3"]}`},
+		{"ordering repeated item", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "3"]}`},
+		{"ordering unknown item", Ordering, "", `{` + items + `, "correct": ["1", "2", "3", "5"]}`},
+		{"ordering one item", Ordering, "", `{"items": [{"id": "1", "text": "Один"}], "correct": ["1"]}`},
+
+		{"matching unmapped prompt", Matching, "", `{` + pairs + `, "correct": {"ru": "msk"}}`},
+		{"matching unknown prompt", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "de": "ber"}}`},
+		{"matching unknown match", Matching, "", `{` + pairs + `, "correct": {"ru": "msk", "fr": "spb"}}`},
+		{"matching no matches", Matching, "", `{"prompts": [{"id": "ru", "text": "Россия"}], "matches": [], "correct": {"ru": "msk"}}`},
+
+		{"blanks none", FillBlanks, "Текст", `{"blanks": []}`},
+		{"blanks repeated id", FillBlanks, "{{x}}", `{"blanks": [{"id": "x", "variants": ["а"]}, {"id": "x", "variants": ["б"]}]}`},
+		{"blanks no variants", FillBlanks, "{{x}}", `{"blanks": [{"id": "x"}]}`},
+		{"blanks missing in text", FillBlanks, "{{x}} впадает в море", `{` + blanks + `}`},
+		{"blanks unknown in text", FillBlanks, blankText + " и {{z}}", `{` + blanks + `}`},
+		{"blanks twice in text", FillBlanks, blankText + ", {{x}}", `{` + blanks + `}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.kind, tt.text, []byte(tt.options)); err == nil {
+				t.Errorf("Parse(%s, %s) accepted invalid options", tt.kind, tt.options)
+			}
+		})
+	}
+}
@@ -1,14 +1,25 @@
 package quizzes
 
 import (
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/courses/lessons/quizzes/questions"
+	"ekb-edu/src/api/enrollments"
 	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/progress"
 	"ekb-edu/src/database/storage"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func GetQuizzes(c *fiber.Ctx) error {
@@ -17,6 +28,24 @@ func GetQuizzes(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid Lesson ID"})
 	}
 
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, uint(lessonID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return availability.Deny(c, status)
+	}
+
 	var quizzes []storage.EeQuiz
 	if err := storage.DB.Where("lesson_id = ?", lessonID).Find(&quizzes).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
@@ -34,11 +63,26 @@ func CreateQuiz(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "lesson ID is required"})
 	}
 
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
 	if err := c.BodyParser(&quiz); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse quiz data"})
 	}
 
 	quiz.LessonID = uint(lessonID)
+	if err := validate(&quiz); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	if err := storage.DB.Create(&quiz).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
@@ -46,24 +90,6 @@ func CreateQuiz(c *fiber.Ctx) error {
 	return c.JSON(&quiz)
 }
 
-// QuizQuestion model without the correct answer
-type EeQuizQuestionWithoutAnswer struct {
-	QuestionID   uint      `gorm:"primary_key" json:"question_id"`
-	QuizID       uint      `gorm:"type:integer" json:"quiz_id"`
-	QuestionText string    `gorm:"type:text;not null" json:"question_text"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-}
-
-type EeQuizWithQuestions struct {
-	Quiz      storage.EeQuiz                `json:"quiz"`
-	Questions []EeQuizQuestionWithoutAnswer `json:"questions"`
-}
-
-func (EeQuizQuestionWithoutAnswer) TableName() string {
-	return "ee_quiz_questions"
-}
-
 func getQuiz(c *fiber.Ctx) error {
 	quizID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	// Проверка на наличие ID урока для обновления.
@@ -72,48 +98,677 @@ func getQuiz(c *fiber.Ctx) error {
 	}
 
 	var quizInfo EeQuizWithQuestions
-	if err := storage.DB.Where("quiz_id = ?", quizID).First(&quizInfo.Quiz).Error; err != nil {
+	err = storage.DB.Where("quiz_id = ?", quizID).First(&quizInfo.Quiz).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "quiz not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(quizInfo.Quiz.LessonID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
 	}
 
-	if err := storage.DB.Where("quiz_id = ?", quizID).Find(&quizInfo.Questions).Error; err != nil {
+	status, err := availability.ForLessonID(c, quizInfo.Quiz.LessonID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return availability.Deny(c, status)
+	}
+
+	var list []storage.EeQuizQuestion
+	if err := storage.DB.Where("quiz_id = ?", quizID).Order("question_id").Find(&list).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	// Преподаватели видят варианты целиком, студенты - без правильных ответов
+	staff, err := enrollments.CanManage(c, courseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	quizInfo.Questions = make([]Question, len(list))
+	for i, question := range list {
+		quizInfo.Questions[i] = Question{
+			QuestionID:   question.QuestionID,
+			QuizID:       question.QuizID,
+			Type:         question.Type,
+			QuestionText: question.QuestionText,
+			Points:       question.Points,
+			Options:      question.Options,
+			CreatedAt:    question.CreatedAt,
+			UpdatedAt:    question.UpdatedAt,
+		}
+		if staff {
+			continue
+		}
+
+		grader, err := questions.Parse(question.Type, question.QuestionText, question.Options)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("question %d is broken: %s", question.QuestionID, err.Error())})
+		}
+		quizInfo.Questions[i].Options = grader.Public(question.QuestionID)
 	}
 
 	return c.JSON(&quizInfo)
 }
 
-func addQuestion(c *fiber.Ctx) error {
-	quizID, err := strconv.ParseUint(c.Params("id"), 10, 32)
-	// Проверка на наличие ID урока для обновления.
+// canManageQuiz проверяет, что пользователь ведёт курс теста. При false ответ уже отправлен
+func canManageQuiz(c *fiber.Ctx, quizID uint) (bool, error) {
+	courseID, err := enrollments.CourseIDByQuiz(quizID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "quiz ID is required"})
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
 	}
 
-	var question storage.EeQuizQuestion
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
 
-	if err := c.BodyParser(&question); err != nil {
+	return true, nil
+}
+
+// managedQuiz загружает тест из параметра param и проверяет, что пользователь ведёт его курс.
+// При ошибке возвращает nil и уже отправленный ответ
+func managedQuiz(c *fiber.Ctx, param string) (*storage.EeQuiz, error) {
+	var quiz storage.EeQuiz
+	err := storage.DB.Where("quiz_id = ?", c.Params(param)).First(&quiz).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "quiz not found"})
+	} else if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := canManageQuiz(c, quiz.QuizID); !ok {
+		return nil, err
+	}
+
+	return &quiz, nil
+}
+
+// parseQuestion разбирает и проверяет вопрос из тела запроса, при ошибке возвращает nil и уже отправленный ответ
+func parseQuestion(c *fiber.Ctx) (*storage.EeQuizQuestion, error) {
+	info := QuestionInfo{}
+	if err := c.BodyParser(&info); err != nil {
 		// В случае ошибки разбора возвращаем HTTP статус 400 (Bad Request).
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse quiz data"})
+	}
+
+	// Прежние клиенты присылают только правильный ответ
+	if info.Type == "" && info.CorrectAnswer != nil {
+		info.Type = questions.ShortText
+		info.Options, _ = json.Marshal(questions.ShortTextOptions{TextAnswer: questions.TextAnswer{Variants: []string{*info.CorrectAnswer}, CaseSensitive: true}})
+	}
+
+	question := storage.EeQuizQuestion{
+		Type:         info.Type,
+		QuestionText: strings.TrimSpace(info.QuestionText),
+		Points:       math.Round(info.Points*100) / 100,
+	}
+	if question.Points == 0 {
+		question.Points = 1
+	}
+
+	if question.QuestionText == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "question_text is required"})
+	} else if question.Points < 0 || question.Points > maxPoints {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("points must be between 0 and %d", maxPoints)})
+	}
+
+	grader, err := questions.Parse(info.Type, question.QuestionText, info.Options)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if question.Options, err = json.Marshal(grader); err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return &question, nil
+}
+
+func addQuestion(c *fiber.Ctx) error {
+	quiz, err := managedQuiz(c, "id")
+	if quiz == nil {
+		return err
+	}
+
+	question, err := parseQuestion(c)
+	if question == nil {
+		return err
+	}
+
+	question.QuizID = quiz.QuizID
+	if err := storage.DB.Create(question).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(question)
+}
+
+// managedQuestion загружает вопрос :question_id теста :quiz_id для преподавателя курса.
+// При ошибке возвращает nil и уже отправленный ответ
+func managedQuestion(c *fiber.Ctx) (*storage.EeQuizQuestion, error) {
+	quiz, err := managedQuiz(c, "quiz_id")
+	if quiz == nil {
+		return nil, err
+	}
+
+	var question storage.EeQuizQuestion
+	err = storage.DB.Where("question_id = ? AND quiz_id = ?", c.Params("question_id"), quiz.QuizID).First(&question).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "question not found"})
+	} else if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return &question, nil
+}
+
+// answered проверяет, есть ли уже ответы на вопрос. Их баллы посчитаны по текущим вариантам
+func answered(tx *gorm.DB, questionID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&storage.EeQuizAnswer{}).Where("question_id = ?", questionID).Count(&count).Error
+	return count > 0, err
+}
+
+// sameOptions сравнивает варианты по содержимому: jsonb в базе хранится в своём порядке ключей
+func sameOptions(a, b []byte) bool {
+	var left, right interface{}
+	if json.Unmarshal(a, &left) != nil || json.Unmarshal(b, &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// updateQuestion заменяет вопрос целиком. Когда на вопрос уже отвечали, тип и варианты не меняются,
+// иначе выставленные баллы разойдутся с правильными ответами
+func updateQuestion(c *fiber.Ctx) error {
+	current, err := managedQuestion(c)
+	if current == nil {
+		return err
+	}
+
+	question, err := parseQuestion(c)
+	if question == nil {
+		return err
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("question_id = ?", current.QuestionID).First(current).Error; err != nil {
+			return err
+		}
+
+		if question.Type != current.Type || !sameOptions(question.Options, current.Options) {
+			if has, err := answered(tx, current.QuestionID); err != nil {
+				return err
+			} else if has {
+				return errAnswered
+			}
+		}
+
+		current.Type, current.QuestionText, current.Points, current.Options = question.Type, question.QuestionText, question.Points, question.Options
+		return tx.Model(current).Select("type", "question_text", "points", "options", "updated_at").Updates(current).Error
+	})
+	if errors.Is(err, errAnswered) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "question already has answers, its type and options cannot change"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(current)
+}
+
+// deleteQuestion удаляет вопрос, на который ещё никто не отвечал
+func deleteQuestion(c *fiber.Ctx) error {
+	question, err := managedQuestion(c)
+	if question == nil {
+		return err
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("question_id = ?", question.QuestionID).First(question).Error; err != nil {
+			return err
+		}
+
+		if has, err := answered(tx, question.QuestionID); err != nil {
+			return err
+		} else if has {
+			return errAnswered
+		}
+
+		return tx.Delete(question).Error
+	})
+	if errors.Is(err, errAnswered) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "question already has answers and cannot be deleted"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+var (
+	errNoQuestions = errors.New("quiz has no questions")
+	errNoAttempts  = errors.New("no attempts left")
+	errCooldown    = errors.New("next attempt is not available yet")
+	errSubmitted   = errors.New("attempt is already submitted")
+	errAnswered    = errors.New("question already has answers")
+)
+
+// validate проверяет правила пересдачи теста
+func validate(quiz *storage.EeQuiz) error {
+	if quiz.ScoringPolicy == "" {
+		quiz.ScoringPolicy = progress.ScoreHighest
+	}
+
+	switch {
+	case quiz.MaxAttempts < 0 || quiz.MaxAttempts > maxAttemptsLimit:
+		return fmt.Errorf("max_attempts must be between 0 and %d", maxAttemptsLimit)
+	case quiz.CooldownMinutes < 0 || quiz.CooldownMinutes > maxCooldownMinutes:
+		return fmt.Errorf("cooldown_minutes must be between 0 and %d", maxCooldownMinutes)
+	case quiz.ScoringPolicy != progress.ScoreHighest && quiz.ScoringPolicy != progress.ScoreLatest && quiz.ScoringPolicy != progress.ScoreAverage:
+		return errors.New("scoring_policy must be highest, latest or average")
+	}
+
+	return nil
+}
+
+func updateQuiz(c *fiber.Ctx) error {
+	quiz, err := managedQuiz(c, "id")
+	if quiz == nil {
+		return err
+	}
+
+	settings := QuizSettings{}
+	if err := c.BodyParser(&settings); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse quiz data"})
 	}
 
-	question.QuizID = uint(quizID)
+	if settings.Title != nil {
+		quiz.Title = *settings.Title
+	}
+	if settings.MaxAttempts != nil {
+		quiz.MaxAttempts = *settings.MaxAttempts
+	}
+	if settings.CooldownMinutes != nil {
+		quiz.CooldownMinutes = *settings.CooldownMinutes
+	}
+	if settings.ScoringPolicy != nil {
+		quiz.ScoringPolicy = *settings.ScoringPolicy
+	}
 
-	if err := storage.DB.Create(&question).Error; err != nil {
+	if err := validate(quiz); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	err = storage.DB.Model(quiz).Select("title", "max_attempts", "cooldown_minutes", "scoring_policy", "updated_at").Updates(quiz).Error
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
-	return c.JSON(&question)
+	return c.JSON(quiz)
 }
 
-func answerQuestion(c *fiber.Ctx) error {
-	user := c.Locals("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	userID := uint(claims["id"].(float64))
+// findQuiz загружает тест из :id и проверяет доступ к его уроку, при ошибке возвращает nil и уже отправленный ответ
+func findQuiz(c *fiber.Ctx, param string) (*storage.EeQuiz, uint, error) {
+	var quiz storage.EeQuiz
+	err := storage.DB.Where("quiz_id = ?", c.Params(param)).First(&quiz).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "quiz not found"})
+	} else if err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(quiz.LessonID)
+	if err != nil {
+		return nil, 0, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return nil, 0, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
 
-	quizID, err := c.ParamsInt("quiz_id")
+	status, err := availability.ForLessonID(c, quiz.LessonID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid quiz ID"})
+		return nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return nil, 0, availability.Deny(c, status)
+	}
+
+	return &quiz, courseID, nil
+}
+
+// findAttempt загружает попытку из :id вместе с тестом. Чужие попытки видят только преподаватели
+func findAttempt(c *fiber.Ctx) (*storage.EeQuizAttempt, *storage.EeQuiz, uint, error) {
+	var attempt storage.EeQuizAttempt
+	err := storage.DB.Where("attempt_id = ?", c.Params("id")).First(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "attempt not found"})
+	} else if err != nil {
+		return nil, nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var quiz storage.EeQuiz
+	if err := storage.DB.Where("quiz_id = ?", attempt.QuizID).First(&quiz).Error; err != nil {
+		return nil, nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(quiz.LessonID)
+	if err != nil {
+		return nil, nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if attempt.UserID != middleware.UserID(c) {
+		if staff, err := enrollments.CanManage(c, courseID); err != nil {
+			return nil, nil, 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if !staff {
+			return nil, nil, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "attempt not found"})
+		}
+	}
+
+	return &attempt, &quiz, courseID, nil
+}
+
+// nextAttempt возвращает время, с которого можно начать новую попытку после сданной last
+func nextAttempt(quiz *storage.EeQuiz, last *storage.EeQuizAttempt) time.Time {
+	if last == nil || last.SubmittedAt == nil {
+		return time.Time{}
+	}
+	return last.SubmittedAt.Add(time.Duration(quiz.CooldownMinutes) * time.Minute)
+}
+
+// openAttempt возвращает незавершённую попытку пользователя или начинает новую, если правила теста позволяют.
+// При errCooldown второе значение - когда можно начать следующую попытку
+func openAttempt(quiz *storage.EeQuiz, userID uint) (*storage.EeQuizAttempt, time.Time, error) {
+	var attempt storage.EeQuizAttempt
+	var availableAt time.Time
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		// Блокировка теста не даёт двум одновременным запросам начать две попытки
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("quiz_id = ?", quiz.QuizID).First(&storage.EeQuiz{}).Error; err != nil {
+			return err
+		}
+
+		var list []storage.EeQuizAttempt
+		if err := tx.Where("quiz_id = ? AND user_id = ?", quiz.QuizID, userID).Order("number").Find(&list).Error; err != nil {
+			return err
+		}
+
+		for _, existing := range list {
+			if existing.SubmittedAt == nil {
+				attempt = existing
+				return nil
+			}
+		}
+
+		var questions int64
+		if err := tx.Model(&storage.EeQuizQuestion{}).Where("quiz_id = ?", quiz.QuizID).Count(&questions).Error; err != nil {
+			return err
+		} else if questions == 0 {
+			return errNoQuestions
+		}
+
+		if quiz.MaxAttempts > 0 && len(list) >= quiz.MaxAttempts {
+			return errNoAttempts
+		}
+
+		now := time.Now()
+		if len(list) > 0 {
+			if availableAt = nextAttempt(quiz, &list[len(list)-1]); availableAt.After(now) {
+				return errCooldown
+			}
+		}
+
+		attempt = storage.EeQuizAttempt{QuizID: quiz.QuizID, UserID: userID, Number: len(list) + 1, StartedAt: now}
+		return tx.Create(&attempt).Error
+	})
+	if err != nil {
+		return nil, availableAt, err
+	}
+
+	return &attempt, availableAt, nil
+}
+
+// deny отвечает на ошибку openAttempt
+func deny(c *fiber.Ctx, quiz *storage.EeQuiz, availableAt time.Time, err error) error {
+	switch {
+	case errors.Is(err, errNoQuestions):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errNoAttempts):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("quiz allows at most %d attempts", quiz.MaxAttempts)})
+	case errors.Is(err, errCooldown):
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(time.Until(availableAt).Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": err.Error(), "available_at": availableAt})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+}
+
+// lockAttempt блокирует попытку до конца транзакции и проверяет, что она ещё не сдана.
+// Запись ответа и сдача берут одну блокировку, поэтому ответ не попадает в уже посчитанную попытку
+func lockAttempt(tx *gorm.DB, attemptID uint) error {
+	var attempt storage.EeQuizAttempt
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("attempt_id = ?", attemptID).First(&attempt).Error; err != nil {
+		return err
+	} else if attempt.SubmittedAt != nil {
+		return errSubmitted
+	}
+	return nil
+}
+
+// finish сдаёт попытку: баллы считаются по всем вопросам теста, неотвеченные дают 0
+func finish(attempt *storage.EeQuizAttempt) error {
+	var totals struct {
+		Points float64
+		Earned float64
+	}
+
+	now := time.Now()
+	var points, earned float64
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockAttempt(tx, attempt.AttemptID); err != nil {
+			return err
+		}
+
+		err := tx.Table("ee_quiz_questions").
+			Select("COALESCE(SUM(ee_quiz_questions.points), 0) AS points, COALESCE(SUM(ee_quiz_answers.credit * ee_quiz_questions.points), 0) AS earned").
+			Joins("LEFT JOIN ee_quiz_answers ON ee_quiz_answers.question_id = ee_quiz_questions.question_id AND ee_quiz_answers.attempt_id = ?", attempt.AttemptID).
+			Where("ee_quiz_questions.quiz_id = ?", attempt.QuizID).
+			Scan(&totals).Error
+		if err != nil {
+			return err
+		}
+
+		points, earned = math.Round(totals.Points*100)/100, math.Round(totals.Earned*100)/100
+		return tx.Model(attempt).Updates(map[string]interface{}{"points": points, "earned": earned, "submitted_at": now}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	attempt.Points, attempt.Earned, attempt.SubmittedAt = &points, &earned, &now
+	return nil
+}
+
+// parseResponse разбирает ответ на вопрос, при ошибке возвращает nil и уже отправленный ответ
+func parseResponse(c *fiber.Ctx) (json.RawMessage, error) {
+	var info AnswerInfo
+	if err := c.BodyParser(&info); err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse the answer"})
+	}
+
+	response := info.Response
+	if len(response) == 0 && info.AnswerText != nil {
+		response, _ = json.Marshal(*info.AnswerText)
+	}
+	if len(response) == 0 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "response is required"})
+	}
+
+	return response, nil
+}
+
+// saveAnswer проверяет ответ и записывает его в незавершённую попытку, заменяя прежний ответ на тот же вопрос.
+// При ошибке возвращает nil и уже отправленный ответ
+func saveAnswer(c *fiber.Ctx, attempt *storage.EeQuizAttempt, questionID int, response json.RawMessage) (*storage.EeQuizAnswer, error) {
+	if attempt.SubmittedAt != nil {
+		return nil, c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": errSubmitted.Error()})
+	}
+
+	var question storage.EeQuizQuestion
+	err := storage.DB.Where("question_id = ? AND quiz_id = ?", questionID, attempt.QuizID).First(&question).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "question not found"})
+	} else if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	grader, err := questions.Parse(question.Type, question.QuestionText, question.Options)
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("question %d is broken: %s", question.QuestionID, err.Error())})
+	}
+
+	credit, err := grader.Grade(response)
+	if errors.Is(err, questions.ErrResponse) {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	answer := storage.EeQuizAnswer{
+		AttemptID:  attempt.AttemptID,
+		QuestionID: question.QuestionID,
+		UserID:     attempt.UserID,
+		Response:   datatypes.JSON(response),
+		Credit:     math.Round(credit*10000) / 10000,
+		IsCorrect:  credit == 1,
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		// Попытку могли сдать, пока проверялся ответ
+		if err := lockAttempt(tx, attempt.AttemptID); err != nil {
+			return err
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "attempt_id"}, {Name: "question_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"response", "credit", "is_correct", "updated_at"}),
+		}).Create(&answer).Error
+	})
+	if errors.Is(err, errSubmitted) {
+		return nil, c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return &answer, nil
+}
+
+// answerView готовит ответ к отправке, оценка открывается только в сданной попытке
+func answerView(answer *storage.EeQuizAnswer, submitted bool) Answer {
+	view := Answer{
+		AnswerID:   answer.AnswerID,
+		AttemptID:  answer.AttemptID,
+		QuestionID: answer.QuestionID,
+		UserID:     answer.UserID,
+		Response:   json.RawMessage(answer.Response),
+		CreatedAt:  answer.CreatedAt,
+		UpdatedAt:  answer.UpdatedAt,
+	}
+	if submitted {
+		view.Credit, view.IsCorrect = &answer.Credit, &answer.IsCorrect
+	}
+	return view
+}
+
+// respondAttempt отправляет попытку с ответами
+func respondAttempt(c *fiber.Ctx, status int, attempt *storage.EeQuizAttempt) error {
+	view := Attempt{EeQuizAttempt: *attempt, Answers: []Answer{}}
+	if score, ok := progress.AttemptScore(attempt); ok {
+		view.Score = &score
+	}
+
+	var answers []storage.EeQuizAnswer
+	if err := storage.DB.Where("attempt_id = ?", attempt.AttemptID).Order("question_id").Find(&answers).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	for i := range answers {
+		view.Answers = append(view.Answers, answerView(&answers[i], attempt.SubmittedAt != nil))
+	}
+
+	return c.Status(status).JSON(&view)
+}
+
+// startAttempt начинает попытку или возвращает уже начатую
+func startAttempt(c *fiber.Ctx) error {
+	quiz, _, err := findQuiz(c, "id")
+	if quiz == nil {
+		return err
+	}
+
+	attempt, availableAt, err := openAttempt(quiz, middleware.UserID(c))
+	if err != nil {
+		return deny(c, quiz, availableAt, err)
+	}
+
+	return respondAttempt(c, fiber.StatusOK, attempt)
+}
+
+// listAttempts - попытки текущего пользователя по тесту и оценка по правилу теста
+func listAttempts(c *fiber.Ctx) error {
+	quiz, _, err := findQuiz(c, "id")
+	if quiz == nil {
+		return err
+	}
+
+	list := AttemptList{Attempts: []storage.EeQuizAttempt{}}
+	err = storage.DB.Where("quiz_id = ? AND user_id = ?", quiz.QuizID, middleware.UserID(c)).Order("number").Find(&list.Attempts).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	list.Score = progress.PolicyScore(quiz.ScoringPolicy, list.Attempts)
+	if quiz.MaxAttempts > 0 {
+		left := max(quiz.MaxAttempts-len(list.Attempts), 0)
+		list.AttemptsLeft = &left
+	}
+
+	if count := len(list.Attempts); count > 0 && (list.AttemptsLeft == nil || *list.AttemptsLeft > 0) {
+		if availableAt := nextAttempt(quiz, &list.Attempts[count-1]); availableAt.After(time.Now()) {
+			list.AvailableAt = &availableAt
+		}
+	}
+
+	return c.JSON(&list)
+}
+
+func getAttempt(c *fiber.Ctx) error {
+	attempt, _, _, err := findAttempt(c)
+	if attempt == nil {
+		return err
+	}
+
+	return respondAttempt(c, fiber.StatusOK, attempt)
+}
+
+// answerAttempt записывает ответ на вопрос в попытку, до сдачи ответ можно менять
+func answerAttempt(c *fiber.Ctx) error {
+	attempt, quiz, _, err := findAttempt(c)
+	if attempt == nil {
+		return err
+	} else if attempt.UserID != middleware.UserID(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "attempt belongs to another user"})
 	}
 
 	questionID, err := c.ParamsInt("question_id")
@@ -121,53 +776,128 @@ func answerQuestion(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid question ID"})
 	}
 
-	// Парсим тело запроса для получения ответа
-	var answer storage.EeQuizAnswer
-	if err := c.BodyParser(&answer); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse the answer"})
+	status, err := availability.ForLessonID(c, quiz.LessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return availability.Deny(c, status)
+	}
+
+	response, err := parseResponse(c)
+	if response == nil {
+		return err
 	}
 
-	answer.QuestionID = uint(questionID)
-	answer.UserID = userID
+	answer, err := saveAnswer(c, attempt, questionID, response)
+	if answer == nil {
+		return err
+	}
 
-	// Проверяем, является ли пользователь владельцем курса
-	var courseOwnerCount int64
-	storage.DB.Table("ee_course_owners").
-		Joins("JOIN ee_courses ON ee_course_owners.course_id = ee_courses.course_id").
-		Joins("JOIN ee_course_sections ON ee_courses.course_id = ee_course_sections.course_id").
-		Joins("JOIN ee_lessons ON ee_course_sections.section_id = ee_lessons.section_id").
-		Joins("JOIN ee_quizzes ON ee_lessons.lesson_id = ee_quizzes.lesson_id").
-		Where("ee_course_owners.user_id = ? AND ee_quizzes.quiz_id = ?", userID, quizID).
-		Count(&courseOwnerCount)
+	return c.JSON(answerView(answer, false))
+}
 
-	if courseOwnerCount == 0 {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not the owner of the course"})
+// submitAttempt сдаёт попытку, после этого ответы не меняются
+func submitAttempt(c *fiber.Ctx) error {
+	attempt, quiz, courseID, err := findAttempt(c)
+	if attempt == nil {
+		return err
+	} else if attempt.UserID != middleware.UserID(c) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "attempt belongs to another user"})
 	}
 
-	var question storage.EeQuizQuestion
-	if err := storage.DB.Where("question_id = ?", questionID).First(&question).Error; err != nil {
+	// Урок мог закрыться после начала попытки
+	status, err := availability.ForLessonID(c, quiz.LessonID)
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return availability.Deny(c, status)
 	}
 
-	answer.IsCorrect = answer.AnswerText == question.CorrectAnswer
+	if err := finish(attempt); errors.Is(err, errSubmitted) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
 
-	// Если пользователь является владельцем, добавляем ответ
-	if err := storage.DB.Create(&answer).Error; err != nil {
+	// Сданный тест может завершить курс
+	if err := progress.Evaluate(attempt.UserID, courseID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(&answer)
+	return respondAttempt(c, fiber.StatusOK, attempt)
+}
+
+// answerQuestion - ответ без явной попытки для прежних клиентов: ответ попадает в незавершённую попытку
+// (она начинается сама), а когда отвечены все вопросы, попытка сдаётся
+func answerQuestion(c *fiber.Ctx) error {
+	userID := middleware.UserID(c)
+
+	questionID, err := c.ParamsInt("question_id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid question ID"})
+	}
+
+	response, err := parseResponse(c)
+	if response == nil {
+		return err
+	}
+
+	quiz, courseID, err := findQuiz(c, "quiz_id")
+	if quiz == nil {
+		return err
+	}
+
+	attempt, availableAt, err := openAttempt(quiz, userID)
+	if err != nil {
+		return deny(c, quiz, availableAt, err)
+	}
+
+	answer, err := saveAnswer(c, attempt, questionID, response)
+	if answer == nil {
+		return err
+	}
+
+	var unanswered int64
+	err = storage.DB.Model(&storage.EeQuizQuestion{}).
+		Where("quiz_id = ? AND question_id NOT IN (?)", quiz.QuizID, storage.DB.Model(&storage.EeQuizAnswer{}).Select("question_id").Where("attempt_id = ?", attempt.AttemptID)).
+		Count(&unanswered).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if unanswered == 0 {
+		if err := finish(attempt); err != nil && !errors.Is(err, errSubmitted) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		// Сданный тест может завершить курс
+		if err := progress.Evaluate(userID, courseID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(answerView(answer, attempt.SubmittedAt != nil))
 }
 
 func RegisterService(app fiber.Router) {
 	g := app.Group("/quizzes", middleware.TokenRequired)
 	{
 		g.Get("/:id", getQuiz)
+		g.Get("/:id/attempts", listAttempts)
+		g.Post("/:id/attempts", startAttempt)
 		g.Post("/:quiz_id/:question_id", answerQuestion)
 
-		admin := g.Group("/", middleware.AdminRequired)
-		{
-			admin.Post("/:id", addQuestion)
-		}
+		// Вопросы и настройки теста меняют преподаватели курса
+		g.Post("/:id", addQuestion)
+		g.Put("/:id", updateQuiz)
+		g.Put("/:quiz_id/:question_id", updateQuestion)
+		g.Delete("/:quiz_id/:question_id", deleteQuestion)
+	}
+
+	a := app.Group("/quiz_attempts", middleware.TokenRequired)
+	{
+		a.Get("/:id", getAttempt)
+		a.Put("/:id/answers/:question_id", answerAttempt)
+		a.Post("/:id/submit", submitAttempt)
 	}
 }
@@ -1,14 +1,27 @@
 package lessons
 
 import (
+	"ekb-edu/src/api/assignments"
+	"ekb-edu/src/api/attachments"
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/comments"
+	"ekb-edu/src/api/courses/lessons/blocks"
 	"ekb-edu/src/api/courses/lessons/quizzes"
+	"ekb-edu/src/api/courses/lessons/videos"
+	"ekb-edu/src/api/editing"
+	"ekb-edu/src/api/enrollments"
 	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/notes"
+	"ekb-edu/src/api/patch"
+	"ekb-edu/src/api/progress"
+	"ekb-edu/src/api/revisions"
 	"ekb-edu/src/database/storage"
+	"errors"
 	"fmt"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // Struct to aggregate lesson with course and section info
@@ -18,19 +31,16 @@ type LessonWithCourseAndSection struct {
 	CourseID         uint   `json:"course_id"`
 	SectionTitle     string `json:"section_title"`
 	SectionID        uint   `json:"section_id"`
+
+	Progress *storage.EeLessonProgress `json:"progress"` // null - урок ещё не открывался
+	availability.Status
 }
 
 func getLessons(c *fiber.Ctx) error {
-	user := c.Locals("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	userID := uint(claims["id"].(float64))
-
-	// Сначала находим все курсы, принадлежащие пользователю
-	var ownedCourses []storage.EeCourseOwner
-	storage.DB.Where("user_id = ?", userID).Find(&ownedCourses)
-	var courseIDs []uint
-	for _, co := range ownedCourses {
-		courseIDs = append(courseIDs, co.CourseID)
+	// Сначала находим все курсы, доступные пользователю
+	courseIDs, err := enrollments.AccessibleCourseIDs(middleware.UserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
 	// Теперь находим все секции этих курсов
@@ -45,36 +55,81 @@ func getLessons(c *fiber.Ctx) error {
 	var lessons []storage.EeLesson
 	storage.DB.Where("section_id IN ?", sectionIDs).Find(&lessons)
 
+	lessonIDs := make([]uint, len(lessons))
+	for i, lesson := range lessons {
+		lessonIDs[i] = lesson.LessonID
+	}
+
+	progressMap, err := progress.ForLessons(middleware.UserID(c), lessonIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
 	// Создаем словарь для курсов и секций для удобства доступа
 	courseMap := make(map[uint]storage.EeCourse)
 	sectionMap := make(map[uint]storage.EeCourseSection)
-	for _, course := range ownedCourses {
+	for _, courseID := range courseIDs {
 		var c storage.EeCourse
-		storage.DB.First(&c, course.CourseID)
+		storage.DB.First(&c, courseID)
 		courseMap[c.CourseID] = c
 	}
 	for _, section := range sections {
 		sectionMap[section.SectionID] = section
 	}
 
+	// Закрытые уроки показываем без содержимого, с датой открытия
+	resolvers := make(map[uint]*availability.Resolver)
+	for _, courseID := range courseIDs {
+		if resolvers[courseID], err = availability.For(c, courseID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
 	// Агрегируем уроки с информацией о курсе и секции
 	var result []LessonWithCourseAndSection
 	for _, lesson := range lessons {
 		section := sectionMap[lesson.SectionID]
 		course := courseMap[section.CourseID]
-		result = append(result, LessonWithCourseAndSection{
+		resolver := resolvers[section.CourseID]
+		resolver.Remember(&section)
+		status, err := resolver.Lesson(&lesson)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+		item := LessonWithCourseAndSection{
 			EeLesson:     lesson,
 			CourseTitle:  course.Title,
 			CourseID:     course.CourseID,
 			SectionTitle: section.Title,
 			SectionID:    section.SectionID,
-		})
+			Status:       status,
+		}
+		if record, ok := progressMap[lesson.LessonID]; ok {
+			item.Progress = &record
+		}
+		result = append(result, item)
 	}
 
 	// Возвращаем агрегированные уроки как JSON
 	return c.JSON(result)
 }
 
+// canManageLesson проверяет, что пользователь ведёт курс урока. При false ответ уже отправлен
+func canManageLesson(c *fiber.Ctx, lessonID uint) (bool, error) {
+	courseID, err := enrollments.CourseIDByLesson(lessonID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	} else if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return true, nil
+}
+
 func addLesson(c *fiber.Ctx) error {
 	lesson := storage.EeLesson{}
 
@@ -83,12 +138,73 @@ func addLesson(c *fiber.Ctx) error {
 		// В случае ошибки разбора возвращаем HTTP статус 400 (Bad Request).
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse lesson data"})
 	}
+	lesson.VideoID = nil // видео привязывается через /lessons/:id/video
+	lesson.Version = 0
 
-	if err := storage.DB.Create(&lesson).Error; err != nil {
+	courseID, err := enrollments.CourseIDBySection(lesson.SectionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "section not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if ok, err := enrollments.CanManage(c, courseID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
 	}
 
-	return c.JSON(&lesson)
+	// Текст урока становится первым блоком содержимого, сам урок хранит только заголовок
+	text := lesson.ContentText
+	lesson.ContentText = ""
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&lesson).Error; err != nil {
+			return err
+		}
+
+		if text != "" {
+			if err := blocks.AddText(tx, lesson.LessonID, blocks.FormatMarkdown, text); err != nil {
+				return err
+			}
+		}
+
+		// Первая правка урока сохраняет и его блоки
+		userID := middleware.UserID(c)
+		return revisions.Record(tx, revisions.Lesson, lesson.LessonID, &userID, revisions.Summary(c))
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return sendLesson(c, lesson)
+}
+
+// sendLesson отдаёт урок вместе с блоками, видео и вложениями, при ?format=html - с HTML
+func sendLesson(c *fiber.Ctx, lesson storage.EeLesson) error {
+	lessonBlocks, err := blocks.ForLesson(lesson.LessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	editing.SetETag(c, lesson.Version)
+	asHTML := c.Query("format") == "html"
+	result := LessonWithBlocks{EeLesson: lesson}
+	if result.Blocks, err = blocks.Render(lessonBlocks, asHTML); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("cannot render lesson: %s", err.Error())})
+	}
+
+	if result.Video, err = videos.Load(lesson.LessonID, middleware.UserID(c)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if result.Attachments, err = attachments.ForLesson(c, lesson.LessonID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if result.Assignment, err = assignments.Load(lesson.LessonID, asHTML); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&result)
 }
 
 func getLesson(c *fiber.Ctx) error {
@@ -102,18 +218,33 @@ func getLesson(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
 	}
 
-	return c.JSON(&lesson)
-}
+	courseID, err := enrollments.CourseIDBySection(lesson.SectionID)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
 
-func updateLesson(c *fiber.Ctx) error {
-	lessonInfo := storage.EeLesson{}
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
 
-	// Разбор JSON тела запроса в структуру EeLesson.
-	if err := c.BodyParser(&lessonInfo); err != nil {
-		// В случае ошибки разбора возвращаем HTTP статус 400 (Bad Request).
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse lesson data"})
+	status, err := availability.ForLesson(c, &lesson)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return availability.Deny(c, status)
 	}
 
+	// Открытие урока отмечает его как начатый
+	if err := progress.Touch(middleware.UserID(c), lesson.LessonID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return sendLesson(c, lesson)
+}
+
+func updateLesson(c *fiber.Ctx) error {
 	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 
 	// Проверка на наличие ID урока для обновления.
@@ -121,13 +252,54 @@ func updateLesson(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "lesson ID is required"})
 	}
 
-	// Обновление урока в базе данных.
-	result := storage.DB.Model(&storage.EeLesson{}).Where("lesson_id = ?", lessonID).Updates(lessonInfo)
-	if result.Error != nil {
+	if ok, err := canManageLesson(c, uint(lessonID)); !ok {
+		return err
+	}
+
+	// Разбор тела запроса как JSON Merge Patch, менять можно только поля из lessonFields.
+	update, err := patch.Parse(c, &storage.EeLesson{}, lessonFields)
+	if update == nil {
+		return err
+	}
+
+	// Правка применяется только к той версии, которую видел клиент.
+	version, ok, err := editing.Expected(c)
+	if !ok {
+		return err
+	}
+
+	// Обновление урока в базе данных с записью в журнал правок.
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		return revisions.Track(tx, revisions.Lesson, uint(lessonID), middleware.UserID(c), revisions.Summary(c), func(tx *gorm.DB) error {
+			if err := editing.Bump(tx, &storage.EeLesson{}, "lesson_id", uint(lessonID), version); err != nil {
+				return err
+			}
+
+			if err := update.Apply(tx, &storage.EeLesson{}, "lesson_id", uint(lessonID)); err != nil || !update.Has("video_id") {
+				return err
+			}
+
+			// "video_id": null отвязывает видео так же, как DELETE /lessons/:id/video
+			return tx.Where("lesson_id = ?", lessonID).Delete(&storage.EeVideo{}).Error
+		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	} else if err != nil && !errors.Is(err, editing.ErrConflict) {
 		// В случае ошибки обновления возвращаем HTTP статус 500 (Internal Server Error).
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to update lesson"})
 	}
 
+	var lesson storage.EeLesson
+	if err := storage.DB.Where("lesson_id = ?", lessonID).First(&lesson).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if errors.Is(err, editing.ErrConflict) {
+		return editing.Conflict(c, lesson.Version, &lesson)
+	}
+	editing.SetETag(c, lesson.Version)
+
 	// Возвращение HTTP статуса 200 (OK), если обновление прошло успешно.
 	return c.SendStatus(fiber.StatusOK)
 }
@@ -138,6 +310,10 @@ func deleteLesson(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid Lesson ID"})
 	}
 
+	if ok, err := canManageLesson(c, uint(lessonID)); !ok {
+		return err
+	}
+
 	lesson := storage.EeLesson{
 		LessonID: uint(lessonID),
 	}
@@ -155,14 +331,42 @@ func RegisterService(app fiber.Router) {
 		g.Get("/", getLessons)
 		g.Get("/:id", getLesson)
 		g.Get("/:id/quizzes", quizzes.GetQuizzes)
+		g.Post("/:id/progress", availability.RequireUnlocked, progress.MarkLesson)
+		g.Get("/:id/availability", availability.ExplainLesson)
+		g.Put("/:id/availability", availability.SetLessonRules)
+		g.Get("/:id/blocks", blocks.GetBlocks)
+		g.Post("/:id/blocks", blocks.CreateBlock)
+		g.Put("/:id/blocks/order", blocks.ReorderBlocks)
+		g.Get("/:id/prerequisites", availability.GetLessonPrerequisites)
+		g.Put("/:id/prerequisites", availability.SetLessonPrerequisites)
+		g.Get("/:id/video", videos.GetVideo)
+		g.Put("/:id/video", videos.PutVideo)
+		g.Delete("/:id/video", videos.DeleteVideo)
+		g.Get("/:id/attachments", attachments.GetLessonAttachments)
+		g.Post("/:id/attachments", attachments.CreateLessonAttachment)
+		g.Put("/:id/attachments/order", attachments.ReorderLessonAttachments)
+		g.Get("/:id/attachments/zip", attachments.LessonArchive)
+		g.Get("/:id/assignment", assignments.GetAssignment)
+		g.Put("/:id/assignment", assignments.PutAssignment)
+		g.Delete("/:id/assignment", assignments.DeleteAssignment)
+		g.Get("/:id/comments", comments.GetComments)
+		g.Post("/:id/comments", comments.CreateComment)
+		g.Get("/:id/notes", notes.GetLessonNotes)
+		g.Post("/:id/notes", notes.CreateLessonNote)
+		g.Put("/:id/bookmark", notes.AddBookmark)
+		g.Delete("/:id/bookmark", notes.RemoveBookmark)
+		g.Get("/:id/revisions", revisions.List(revisions.Lesson))
+		g.Get("/:id/revisions/diff", revisions.Compare(revisions.Lesson))
+		g.Get("/:id/revisions/:number", revisions.Get(revisions.Lesson))
+		g.Post("/:id/revisions/:number/restore", revisions.Restore(revisions.Lesson))
+		g.Get("/:id/edit_lock", editing.GetLock(revisions.Lesson))
+		g.Put("/:id/edit_lock", editing.AcquireLock(revisions.Lesson))
+		g.Delete("/:id/edit_lock", editing.ReleaseLock(revisions.Lesson))
 
-		admin := g.Group("/", middleware.AdminRequired)
-		{
-			admin.Post("/", addLesson)
-			admin.Patch("/:id", updateLesson)
-			admin.Delete("/:id", deleteLesson)
-
-			admin.Post("/:id/quizzes", quizzes.CreateQuiz)
-		}
+		// Уроки и тесты пишут преподаватели курса, права проверяются в обработчиках
+		g.Post("/", addLesson)
+		g.Patch("/:id", updateLesson)
+		g.Delete("/:id", deleteLesson)
+		g.Post("/:id/quizzes", quizzes.CreateQuiz)
 	}
 }
@@ -0,0 +1,35 @@
+package videos
+
+import "ekb-edu/src/database/storage"
+
+// Видеохостинги
+const (
+	ProviderSelfHosted = "self_hosted"
+	ProviderYouTube    = "youtube"
+	ProviderRuTube     = "rutube"
+	ProviderVK         = "vk"
+)
+
+type CaptionInfo struct {
+	Language  string `json:"language"`
+	Label     string `json:"label"`
+	URL       string `json:"url"`
+	IsDefault bool   `json:"is_default"`
+}
+
+// VideoInfo - видео урока целиком, субтитры заменяют существующие
+type VideoInfo struct {
+	URL       string        `json:"url"`
+	Provider  string        `json:"provider"` // Определяется по URL, если не указан
+	Title     string        `json:"title"`
+	Duration  *int          `json:"duration"`
+	PosterURL string        `json:"poster_url"`
+	Captions  []CaptionInfo `json:"captions"`
+}
+
+// Video - видео с адресом для встраивания и субтитрами
+type Video struct {
+	storage.EeVideo
+	EmbedURL string                   `json:"embed_url"`
+	Captions []storage.EeVideoCaption `json:"captions"`
+}
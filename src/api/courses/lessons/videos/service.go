@@ -0,0 +1,352 @@
+package videos
+
+import (
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/media"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	youtubeID = regexp.MustCompile(`^[\w-]{6,20}$`)
+	rutubeID  = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	vkVideo   = regexp.MustCompile(`video(-?\d+)_(\d+)`)
+	language  = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+)
+
+// Разрешены абсолютные http(s) адреса и пути внутри приложения
+func validURL(value string) bool {
+	if strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") {
+		return true
+	}
+
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Detect определяет видеохостинг и идентификатор видео по ссылке
+func Detect(rawURL string) (string, string, error) {
+	if !validURL(rawURL) {
+		return "", "", fmt.Errorf("invalid video url %q", rawURL)
+	}
+
+	u, _ := url.Parse(rawURL)
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."), "m.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch host {
+	case "youtube.com", "youtube-nocookie.com", "youtu.be":
+		id := ""
+		switch {
+		case host == "youtu.be":
+			id = segments[0]
+		case segments[0] == "watch":
+			id = u.Query().Get("v")
+		case len(segments) > 1 && (segments[0] == "embed" || segments[0] == "shorts" || segments[0] == "live"):
+			id = segments[1]
+		}
+
+		if !youtubeID.MatchString(id) {
+			return "", "", errors.New("cannot find YouTube video id in url")
+		}
+		return ProviderYouTube, id, nil
+
+	case "rutube.ru":
+		for _, segment := range segments {
+			if rutubeID.MatchString(segment) {
+				return ProviderRuTube, segment, nil
+			}
+		}
+		return "", "", errors.New("cannot find RuTube video id in url")
+
+	case "vk.com", "vk.ru", "vkvideo.ru":
+		if strings.HasSuffix(u.Path, "/video_ext.php") {
+			oid, id := u.Query().Get("oid"), u.Query().Get("id")
+			if _, err := strconv.ParseInt(oid, 10, 64); err == nil && id != "" {
+				return ProviderVK, oid + "_" + id, nil
+			}
+		}
+
+		// Ссылки вида /video-123_456 и ?z=video-123_456
+		for _, candidate := range []string{u.Path, u.Query().Get("z")} {
+			if match := vkVideo.FindStringSubmatch(candidate); match != nil {
+				return ProviderVK, match[1] + "_" + match[2], nil
+			}
+		}
+		return "", "", errors.New("cannot find VK Video id in url")
+	}
+
+	return ProviderSelfHosted, "", nil
+}
+
+// EmbedURL возвращает адрес плеера для iframe, для своих файлов - сам файл
+func EmbedURL(video *storage.EeVideo) string {
+	switch video.Provider {
+	case ProviderYouTube:
+		return "https://www.youtube.com/embed/" + video.ExternalID
+	case ProviderRuTube:
+		return "https://rutube.ru/play/embed/" + video.ExternalID
+	case ProviderVK:
+		oid, id, _ := strings.Cut(video.ExternalID, "_")
+		return fmt.Sprintf("https://vk.com/video_ext.php?oid=%s&id=%s", oid, id)
+	}
+
+	return video.URL
+}
+
+// Load возвращает видео урока или nil, если его нет.
+// Для загруженных файлов в embed_url выдаётся подписанная ссылка для пользователя
+func Load(lessonID, userID uint) (*Video, error) {
+	var video Video
+	err := storage.DB.Where("lesson_id = ?", lessonID).First(&video.EeVideo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	video.EmbedURL = EmbedURL(&video.EeVideo)
+	if video.UploadID != nil {
+		video.EmbedURL = media.Sign(*video.UploadID, userID, false).URL
+	}
+	video.Captions = []storage.EeVideoCaption{}
+	if err := storage.DB.Where("video_id = ?", video.VideoID).Order("language").Find(&video.Captions).Error; err != nil {
+		return nil, err
+	}
+
+	return &video, nil
+}
+
+// validate проверяет данные видео и возвращает идентификатор на видеохостинге
+func validate(info *VideoInfo) (string, error) {
+	provider, externalID, err := Detect(info.URL)
+	if err != nil {
+		return "", err
+	}
+
+	if info.Provider != "" && info.Provider != provider {
+		return "", fmt.Errorf("url points to %s, not %s", provider, info.Provider)
+	}
+	info.Provider = provider
+
+	if info.Duration != nil && *info.Duration < 0 {
+		return "", errors.New("duration cannot be negative")
+	}
+
+	if info.PosterURL != "" && !validURL(info.PosterURL) {
+		return "", fmt.Errorf("invalid poster url %q", info.PosterURL)
+	}
+
+	languages := make(map[string]bool)
+	defaults := 0
+	for _, caption := range info.Captions {
+		if !language.MatchString(caption.Language) {
+			return "", fmt.Errorf("invalid caption language %q", caption.Language)
+		}
+		if languages[strings.ToLower(caption.Language)] {
+			return "", fmt.Errorf("duplicate caption language %q", caption.Language)
+		}
+		languages[strings.ToLower(caption.Language)] = true
+
+		if !validURL(caption.URL) {
+			return "", fmt.Errorf("invalid caption url %q", caption.URL)
+		}
+		if caption.IsDefault {
+			defaults++
+		}
+	}
+
+	if defaults > 1 {
+		return "", errors.New("only one caption track can be default")
+	}
+
+	return externalID, nil
+}
+
+func lessonCourse(c *fiber.Ctx) (uint, uint, error) {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	return uint(lessonID), courseID, nil
+}
+
+func GetVideo(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, lessonID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return availability.Deny(c, status)
+	}
+
+	video, err := Load(lessonID, middleware.UserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if video == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson has no video"})
+	}
+
+	return c.JSON(video)
+}
+
+// PutVideo создаёт или заменяет видео урока и обновляет ee_lessons.video_id
+func PutVideo(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := VideoInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse video data"})
+	}
+
+	externalID, err := validate(&info)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		var video storage.EeVideo
+		err := tx.Where("lesson_id = ?", lessonID).First(&video).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// Ссылка на другой файл отвязывает ранее загруженное видео
+		if video.URL != info.URL {
+			video.UploadID = nil
+		}
+
+		video.LessonID = lessonID
+		video.URL = info.URL
+		video.Provider = info.Provider
+		video.ExternalID = externalID
+		video.Title = info.Title
+		video.Duration = info.Duration
+		video.PosterURL = info.PosterURL
+
+		if err := tx.Save(&video).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("video_id = ?", video.VideoID).Delete(&storage.EeVideoCaption{}).Error; err != nil {
+			return err
+		}
+
+		for _, caption := range info.Captions {
+			record := storage.EeVideoCaption{
+				VideoID:   video.VideoID,
+				Language:  caption.Language,
+				Label:     caption.Label,
+				URL:       caption.URL,
+				IsDefault: caption.IsDefault,
+			}
+			if record.Label == "" {
+				record.Label = caption.Language
+			}
+
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(&storage.EeLesson{}).Where("lesson_id = ?", lessonID).Update("video_id", video.VideoID).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	video, err := Load(lessonID, middleware.UserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(video)
+}
+
+// AttachUpload делает загруженный файл видео урока, сохраняя название и субтитры
+func AttachUpload(tx *gorm.DB, lessonID uint, uploadID, url, title string) error {
+	var video storage.EeVideo
+	err := tx.Where("lesson_id = ?", lessonID).First(&video).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if video.Title == "" {
+		video.Title = title
+	}
+
+	video.LessonID = lessonID
+	video.URL = url
+	video.Provider = ProviderSelfHosted
+	video.ExternalID = ""
+	video.UploadID = &uploadID
+
+	if err := tx.Save(&video).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&storage.EeLesson{}).Where("lesson_id = ?", lessonID).Update("video_id", video.VideoID).Error
+}
+
+func DeleteVideo(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&storage.EeLesson{}).Where("lesson_id = ?", lessonID).Update("video_id", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("lesson_id = ?", lessonID).Delete(&storage.EeVideo{}).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -1 +1,69 @@
 package courses
+
+import (
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/media"
+	"ekb-edu/src/api/patch"
+	"ekb-edu/src/api/progress"
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+)
+
+// courseFields - поля курса, которые можно менять через PATCH.
+// Правила завершения и доступ к урокам меняются своими ручками
+var courseFields = patch.Resource{
+	"title":                 {Column: "title", Required: true, Check: patch.NotBlank},
+	"description":           {Column: "description"},
+	"meta":                  {Column: "meta", Merge: true},
+	"enrollment_policy":     {Column: "enrollment_policy", Required: true, Check: patch.OneOf(enrollments.IsValidPolicy)},
+	"capacity":              {Column: "capacity", Required: true, Check: patch.NotNegative},
+	"media_download_policy": {Column: "media_download_policy", Required: true, Check: patch.OneOf(media.IsValidPolicy)},
+	"revision_summary":      {},
+}
+
+var sectionFields = patch.Resource{
+	"title":            {Column: "title", Required: true, Check: patch.NotBlank},
+	"order":            {Column: "order", Required: true},
+	"revision_summary": {},
+}
+
+type CourseWithSeats struct {
+	storage.EeCourse
+	SeatsRemaining *int64 `json:"seats_remaining"` // null - количество мест не ограничено
+
+	DescriptionHTML *render.Document `json:"description_html,omitempty"` // Только при ?format=html
+}
+
+type TreeQuiz struct {
+	QuizID uint   `json:"quiz_id"`
+	Title  string `json:"title"`
+}
+
+type TreeLesson struct {
+	LessonID uint                      `json:"lesson_id"`
+	Title    string                    `json:"title"`
+	Order    int                       `json:"order"`
+	Quizzes  []TreeQuiz                `json:"quizzes"`
+	Progress *storage.EeLessonProgress `json:"progress"`
+	availability.Status
+}
+
+type TreeSection struct {
+	storage.EeCourseSection
+	availability.Status
+	Lessons []TreeLesson `json:"lessons"`
+}
+
+// LessonWithStatus - урок в списке раздела, у закрытых уроков содержимое не передаётся
+type LessonWithStatus struct {
+	storage.EeLesson
+	availability.Status
+}
+
+// CourseTree - структура курса с прогрессом текущего пользователя
+type CourseTree struct {
+	Course   storage.EeCourse         `json:"course"`
+	Sections []TreeSection            `json:"sections"`
+	Progress *progress.CourseProgress `json:"progress"`
+}
@@ -1,19 +1,46 @@
 package courses
 
 import (
+	"ekb-edu/src/api/assignments"
+	"ekb-edu/src/api/attachments"
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/cohorts"
+	"ekb-edu/src/api/comments"
+	"ekb-edu/src/api/editing"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/enrollments/roster"
+	"ekb-edu/src/api/media"
 	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/notes"
+	"ekb-edu/src/api/patch"
+	"ekb-edu/src/api/progress"
+	"ekb-edu/src/api/revisions"
+	"ekb-edu/src/api/taxonomy"
 	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 func getCourses(c *fiber.Ctx) error {
 	var courses []storage.EeCourse
 
-	if err := storage.DB.Find(&courses).Error; err != nil {
+	var tags []string
+	if tagParam := c.Query("tag"); tagParam != "" {
+		tags = strings.Split(tagParam, ",")
+	}
+
+	query, err := taxonomy.CourseFilter(storage.DB, c.Query("category"), tags)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if err := query.Find(&courses).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
@@ -31,7 +58,20 @@ func getCourse(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
 	}
 
-	return c.JSON(&course)
+	seats, err := enrollments.SeatsRemaining(&course)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	info := CourseWithSeats{EeCourse: course, SeatsRemaining: seats}
+	editing.SetETag(c, course.Version)
+	if c.Query("format") == "html" && course.Description != "" {
+		if info.DescriptionHTML, err = render.Cached(render.Key("course", course.CourseID), render.FormatMarkdown, course.Description); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("cannot render description: %s", err.Error())})
+		}
+	}
+
+	return c.JSON(&info)
 }
 
 func addCourse(c *fiber.Ctx) error {
@@ -41,13 +81,31 @@ func addCourse(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "failed to parse course data"})
 	}
 
-	userLocals := c.Locals("user").(*jwt.Token)
-	userClaims := userLocals.Claims.(jwt.MapClaims)
-	courseInfo.InstructorID = userClaims["id"].(uint)
+	if courseInfo.EnrollmentPolicy != "" && !enrollments.IsValidPolicy(courseInfo.EnrollmentPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown enrollment policy"})
+	}
 
-	result := storage.DB.Create(&courseInfo)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	if courseInfo.MediaPolicy != "" && !media.IsValidPolicy(courseInfo.MediaPolicy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown media download policy"})
+	}
+
+	userID := middleware.UserID(c)
+	courseInfo.InstructorID = userID
+	courseInfo.Version = 0
+
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&courseInfo).Error; err != nil {
+			return err
+		}
+
+		if err := enrollments.EnrollAuthor(tx, userID, courseInfo.CourseID); err != nil {
+			return err
+		}
+
+		return revisions.Record(tx, revisions.Course, courseInfo.CourseID, &userID, revisions.Summary(c))
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
 	return c.JSON(&courseInfo)
@@ -60,10 +118,18 @@ func getSection(c *fiber.Ctx) error {
 		Where("section_id = ?", c.Params("id")).
 		First(&section)
 
-	if result.Error != nil {
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "section not found"})
+	} else if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
 	}
 
+	if ok, err := enrollments.CanAccess(c, section.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
 	return c.JSON(&section)
 }
 
@@ -81,9 +147,16 @@ func addSection(c *fiber.Ctx) error {
 
 	courseSection.CourseID = uint(id)
 
-	result := storage.DB.Create(&courseSection)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	userID := middleware.UserID(c)
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&courseSection).Error; err != nil {
+			return err
+		}
+
+		return revisions.Record(tx, revisions.Section, courseSection.SectionID, &userID, revisions.Summary(c))
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
 	return c.JSON(&courseSection)
@@ -105,62 +178,63 @@ func addSections(c *fiber.Ctx) error {
 		course.CourseID = uint(id)
 	}
 
-	result := storage.DB.Create(&courseSection)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
-	}
-
-	return c.SendStatus(fiber.StatusOK)
-}
-
-func getCourseSections(c *fiber.Ctx) error {
-	var sections []storage.EeCourseSection
+	userID := middleware.UserID(c)
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&courseSection).Error; err != nil {
+			return err
+		}
 
-	result := storage.DB.
-		Where("course_id = ?", c.Params("id")).
-		Find(&sections)
+		for _, section := range courseSection {
+			if err := revisions.Record(tx, revisions.Section, section.SectionID, &userID, ""); err != nil {
+				return err
+			}
+		}
 
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
-	return c.JSON(sections)
+	return c.SendStatus(fiber.StatusOK)
 }
 
-func linkUser(c *fiber.Ctx) error {
-	userID, err := strconv.ParseUint(c.Params("user_id"), 10, 32)
+func getCourseSections(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid User ID",
-		})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course ID"})
 	}
 
-	courseID, err := strconv.ParseUint(c.Params("course_id"), 10, 32)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	if ok, err := enrollments.CanAccess(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
 	}
 
-	courseOwner := storage.EeCourseOwner{
-		UserID:   uint(userID),
-		CourseID: uint(courseID),
-	}
+	var sections []storage.EeCourseSection
+
+	result := storage.DB.
+		Where("course_id = ?", courseID).
+		Find(&sections)
 
-	result := storage.DB.Create(&courseOwner)
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return c.JSON(sections)
 }
 
 func getMyCourses(c *fiber.Ctx) error {
-	user := c.Locals("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
-	userID := uint(claims["id"].(float64))
+	userID := middleware.UserID(c)
 
 	var courses []storage.EeCourse
 
-	if err := storage.DB.Where("instructor_id = ?", userID).Find(&courses).Error; err != nil {
+	// Курсы, где пользователь автор, соавтор или ассистент
+	staffCourses := storage.DB.Model(&storage.EeEnrollment{}).
+		Select("course_id").
+		Where("user_id = ? AND role IN ? AND status = ?", userID, []string{enrollments.RoleInstructor, enrollments.RoleCoInstructor, enrollments.RoleTA}, enrollments.StatusActive)
+
+	if err := storage.DB.Where("course_id IN (?)", staffCourses).Find(&courses).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
@@ -181,48 +255,84 @@ func deleteCourse(c *fiber.Ctx) error {
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
 	}
+	render.Invalidate(render.Key("course", course.CourseID))
 
 	return c.SendStatus(fiber.StatusOK)
 }
 
 func updateCourse(c *fiber.Ctx) error {
-	courseInfo := storage.EeCourse{}
-
-	if err := c.BodyParser(&courseInfo); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "failed to parse course data"})
-	}
-
 	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
 	}
 
-	result := storage.DB.Model(&storage.EeCourse{}).Where("course_id = ?", courseID).Updates(&courseInfo)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	update, err := patch.Parse(c, &storage.EeCourse{}, courseFields)
+	if update == nil {
+		return err
 	}
 
-	return c.SendStatus(fiber.StatusOK)
-}
+	version, ok, err := editing.Expected(c)
+	if !ok {
+		return err
+	}
 
-func updateSection(c *fiber.Ctx) error {
-	sectionInfo := storage.EeCourseSection{}
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		return revisions.Track(tx, revisions.Course, uint(courseID), middleware.UserID(c), revisions.Summary(c), func(tx *gorm.DB) error {
+			if err := editing.Bump(tx, &storage.EeCourse{}, "course_id", uint(courseID), version); err != nil {
+				return err
+			}
 
-	if err := c.BodyParser(&sectionInfo); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Cannot parse section data",
+			return update.Apply(tx, &storage.EeCourse{}, "course_id", uint(courseID))
 		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	} else if err != nil && !errors.Is(err, editing.ErrConflict) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
+	var course storage.EeCourse
+	if err := storage.DB.Where("course_id = ?", courseID).First(&course).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if errors.Is(err, editing.ErrConflict) {
+		return editing.Conflict(c, course.Version, &course)
+	}
+	render.Invalidate(render.Key("course", uint(courseID)))
+	editing.SetETag(c, course.Version)
+
+	// Вместимость могла увеличиться
+	if update.Has("capacity") {
+		if err := enrollments.PromoteWaitlist(uint(courseID)); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func updateSection(c *fiber.Ctx) error {
 	sectionID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid section id"})
 	}
 
-	result := storage.DB.Model(&storage.EeCourseSection{}).Where("section_id = ?", sectionID).Updates(sectionInfo)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	update, err := patch.Parse(c, &storage.EeCourseSection{}, sectionFields)
+	if update == nil {
+		return err
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		return revisions.Track(tx, revisions.Section, uint(sectionID), middleware.UserID(c), revisions.Summary(c), func(tx *gorm.DB) error {
+			return update.Apply(tx, &storage.EeCourseSection{}, "section_id", uint(sectionID))
+		})
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "section not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
 	}
 
 	return c.SendStatus(fiber.StatusOK)
@@ -255,13 +365,147 @@ func getLessonsBySection(c *fiber.Ctx) error {
 		})
 	}
 
+	var section storage.EeCourseSection
+	if err := storage.DB.Where("section_id = ?", sectionID).First(&section).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := enrollments.CanAccess(c, section.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
 	var lessons []storage.EeLesson
-	result := storage.DB.Where("section_id = ?", sectionID).Find(&lessons)
+	result := storage.DB.Where("section_id = ?", sectionID).Order(`"order", lesson_id`).Find(&lessons)
 	if result.Error != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
 	}
 
-	return c.JSON(lessons)
+	resolver, err := availability.For(c, section.CourseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+	resolver.Remember(&section)
+
+	items := make([]LessonWithStatus, len(lessons))
+	for i, lesson := range lessons {
+		status, err := resolver.Lesson(&lesson)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		items[i] = LessonWithStatus{EeLesson: lesson, Status: status}
+	}
+
+	return c.JSON(items)
+}
+
+func getCourseTree(c *fiber.Ctx) error {
+	var tree CourseTree
+
+	if err := storage.DB.Where("course_id = ?", c.Params("id")).First(&tree.Course).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := enrollments.CanAccess(c, tree.Course.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	var sections []storage.EeCourseSection
+	if err := storage.DB.Where("course_id = ?", tree.Course.CourseID).Order(`"order", section_id`).Find(&sections).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	sectionIDs := make([]uint, len(sections))
+	for i, section := range sections {
+		sectionIDs[i] = section.SectionID
+	}
+
+	var lessons []storage.EeLesson
+	if len(sectionIDs) > 0 {
+		if err := storage.DB.Where("section_id IN ?", sectionIDs).Order(`"order", lesson_id`).Find(&lessons).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	lessonIDs := make([]uint, len(lessons))
+	for i, lesson := range lessons {
+		lessonIDs[i] = lesson.LessonID
+	}
+
+	var quizzes []storage.EeQuiz
+	if len(lessonIDs) > 0 {
+		if err := storage.DB.Where("lesson_id IN ?", lessonIDs).Order("quiz_id").Find(&quizzes).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	userID := middleware.UserID(c)
+	progressMap, err := progress.ForLessons(userID, lessonIDs)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if tree.Progress, err = progress.Compute(userID, &tree.Course); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	resolver, err := availability.For(c, tree.Course.CourseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	sectionStatus := make(map[uint]availability.Status)
+	for i := range sections {
+		if sectionStatus[sections[i].SectionID], err = resolver.Section(&sections[i]); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	quizMap := make(map[uint][]TreeQuiz)
+	for _, quiz := range quizzes {
+		quizMap[quiz.LessonID] = append(quizMap[quiz.LessonID], TreeQuiz{QuizID: quiz.QuizID, Title: quiz.Title})
+	}
+
+	lessonMap := make(map[uint][]TreeLesson)
+	for _, lesson := range lessons {
+		status, err := resolver.Lesson(&lesson)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		item := TreeLesson{
+			LessonID: lesson.LessonID,
+			Title:    lesson.Title,
+			Order:    lesson.Order,
+			Quizzes:  quizMap[lesson.LessonID],
+			Status:   status,
+		}
+		if item.Quizzes == nil {
+			item.Quizzes = []TreeQuiz{}
+		}
+		if record, ok := progressMap[lesson.LessonID]; ok {
+			item.Progress = &record
+		}
+		lessonMap[lesson.SectionID] = append(lessonMap[lesson.SectionID], item)
+	}
+
+	tree.Sections = make([]TreeSection, len(sections))
+	for i, section := range sections {
+		tree.Sections[i] = TreeSection{
+			EeCourseSection: section,
+			Status:          sectionStatus[section.SectionID],
+			Lessons:         lessonMap[section.SectionID],
+		}
+		if tree.Sections[i].Lessons == nil {
+			tree.Sections[i].Lessons = []TreeLesson{}
+		}
+	}
+
+	return c.JSON(&tree)
 }
 
 func RegisterService(app fiber.Router) {
@@ -270,9 +514,45 @@ func RegisterService(app fiber.Router) {
 		courses.Get("/", getCourses)
 		courses.Get("/:id", getCourse)
 
-		courses.Get("/:id/sections", getCourseSections)
-		courses.Get("/sections/:id", getSection)
-		courses.Get("/sections/:id/lessons", getLessonsBySection)
+		courses.Get("/:id/sections", middleware.TokenRequired, getCourseSections)
+		courses.Get("/:id/taxonomy", taxonomy.GetCourseTaxonomy)
+		courses.Get("/:id/enrollments", middleware.TokenRequired, enrollments.GetCourseEnrollments)
+		courses.Post("/:id/enroll", middleware.TokenRequired, enrollments.EnrollSelf)
+		courses.Delete("/:id/enroll", middleware.TokenRequired, enrollments.DropSelf)
+		courses.Put("/:id/enrollment_policy", middleware.TokenRequired, enrollments.SetPolicy)
+		courses.Get("/:id/cohorts", cohorts.GetCourseCohorts)
+		courses.Post("/:id/cohorts", middleware.TokenRequired, cohorts.AddCohort)
+		courses.Get("/:id/tree", middleware.TokenRequired, getCourseTree)
+		courses.Get("/:id/progress", middleware.TokenRequired, progress.GetCourseProgress)
+		courses.Get("/:id/submissions", middleware.TokenRequired, assignments.GetCourseInbox)
+		courses.Get("/:id/progress/students", middleware.TokenRequired, progress.GetStudentsProgress)
+		courses.Put("/:id/completion_rules", middleware.TokenRequired, progress.SetCompletionRules)
+		courses.Put("/:id/media_policy", middleware.TokenRequired, media.SetPolicy)
+		courses.Get("/:id/media/log", middleware.TokenRequired, media.GetAccessLog)
+		courses.Get("/:id/attachments", middleware.TokenRequired, attachments.GetCourseAttachments)
+		courses.Post("/:id/attachments", middleware.TokenRequired, attachments.CreateCourseAttachment)
+		courses.Put("/:id/attachments/order", middleware.TokenRequired, attachments.ReorderCourseAttachments)
+		courses.Get("/:id/comment_reports", middleware.TokenRequired, comments.GetReports)
+		courses.Get("/:id/notes", middleware.TokenRequired, notes.GetCourseNotes)
+		courses.Get("/:id/notes/export", middleware.TokenRequired, notes.ExportCourseNotes)
+		courses.Get("/:id/revisions", middleware.TokenRequired, revisions.List(revisions.Course))
+		courses.Get("/:id/revisions/diff", middleware.TokenRequired, revisions.Compare(revisions.Course))
+		courses.Get("/:id/revisions/:number", middleware.TokenRequired, revisions.Get(revisions.Course))
+		courses.Post("/:id/revisions/:number/restore", middleware.TokenRequired, revisions.Restore(revisions.Course))
+		courses.Get("/:id/edit_lock", middleware.TokenRequired, editing.GetLock(revisions.Course))
+		courses.Put("/:id/edit_lock", middleware.TokenRequired, editing.AcquireLock(revisions.Course))
+		courses.Delete("/:id/edit_lock", middleware.TokenRequired, editing.ReleaseLock(revisions.Course))
+		courses.Get("/sections/:id", middleware.TokenRequired, getSection)
+		courses.Get("/sections/:id/lessons", middleware.TokenRequired, getLessonsBySection)
+		courses.Get("/sections/:id/availability", middleware.TokenRequired, availability.ExplainSection)
+		courses.Put("/sections/:id/availability", middleware.TokenRequired, availability.SetSectionRules)
+		courses.Get("/sections/:id/prerequisites", middleware.TokenRequired, availability.GetSectionPrerequisites)
+		courses.Put("/sections/:id/prerequisites", middleware.TokenRequired, availability.SetSectionPrerequisites)
+		courses.Get("/sections/:id/attachments/zip", middleware.TokenRequired, attachments.SectionArchive)
+		courses.Get("/sections/:id/revisions", middleware.TokenRequired, revisions.List(revisions.Section))
+		courses.Get("/sections/:id/revisions/diff", middleware.TokenRequired, revisions.Compare(revisions.Section))
+		courses.Get("/sections/:id/revisions/:number", middleware.TokenRequired, revisions.Get(revisions.Section))
+		courses.Post("/sections/:id/revisions/:number/restore", middleware.TokenRequired, revisions.Restore(revisions.Section))
 
 		admin := courses.Group("/", middleware.TokenRequired, middleware.AdminRequired)
 		{
@@ -282,7 +562,11 @@ func RegisterService(app fiber.Router) {
 			admin.Post("/:id/section", addSection)
 			admin.Post("/:id/sections", addSections)
 
-			admin.Post("/link/:course_id/:user_id", linkUser)
+			admin.Put("/:id/categories", taxonomy.SetCourseCategories)
+			admin.Put("/:id/tags", taxonomy.SetCourseTags)
+
+			admin.Post("/link/:course_id/:user_id", enrollments.LinkUser)
+			admin.Post("/:id/enrollments/import", roster.ImportRoster)
 
 			admin.Delete("/:id", deleteCourse)
 
@@ -0,0 +1,27 @@
+package editing
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	lockTTL = 90 * time.Second // Редактор присылает сигнал раз в 30 секунд, пропуск двух сигналов освобождает объект
+)
+
+// ErrConflict - объект изменили после того, как клиент получил его версию
+var ErrConflict = errors.New("object was modified by someone else")
+
+// Editor - кто сейчас редактирует объект
+type Editor struct {
+	UserID      uint      `json:"user_id"`
+	Username    string    `json:"username"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Mine        bool      `json:"mine"` // Блокировка принадлежит текущему пользователю
+}
+
+type LockState struct {
+	Editor *Editor `json:"editor"` // null - объект никто не редактирует
+}
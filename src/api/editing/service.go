@@ -0,0 +1,201 @@
+package editing
+
+import (
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/revisions"
+	"ekb-edu/src/database/storage"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ETag формирует значение заголовка ETag по версии объекта
+func ETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func SetETag(c *fiber.Ctx, version int) {
+	c.Set(fiber.HeaderETag, ETag(version))
+}
+
+// Expected разбирает If-Match и возвращает версию, от которой клиент делал правку, 0 - для "*".
+// Без заголовка правка отклоняется с 428
+func Expected(c *fiber.Ctx) (int, bool, error) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return 0, false, c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{"error": "If-Match header with the current ETag is required"})
+	} else if header == "*" {
+		return 0, true, nil
+	}
+
+	value, err := strconv.Unquote(header)
+	if err != nil {
+		return 0, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid If-Match header"})
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid If-Match header"})
+	}
+
+	return version, true, nil
+}
+
+// Bump увеличивает версию объекта, если она всё ещё равна ожидаемой, иначе возвращает ErrConflict
+func Bump(tx *gorm.DB, model interface{}, key string, id uint, version int) error {
+	query := tx.Model(model).Where(key+" = ?", id)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+
+	result := query.UpdateColumn("version", gorm.Expr("version + 1"))
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 && version == 0 {
+		return gorm.ErrRecordNotFound
+	} else if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Conflict отвечает 412 с текущим состоянием объекта, чтобы клиент мог слить правки
+func Conflict(c *fiber.Ctx, version int, current interface{}) error {
+	SetETag(c, version)
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": ErrConflict.Error(), "current": current})
+}
+
+// scope проверяет, что пользователь ведёт курс объекта. При отказе возвращает 0
+func scope(c *fiber.Ctx, entity string) (uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid %s id", entity)})
+	}
+
+	courseID := uint(id)
+	if entity == revisions.Lesson {
+		if courseID, err = enrollments.CourseIDByLesson(uint(id)); err != nil {
+			return 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+		}
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return 0, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return uint(id), nil
+}
+
+// current возвращает действующую блокировку объекта или nil
+func current(entity string, id, userID uint) (*Editor, error) {
+	var editors []Editor
+	err := storage.DB.Table("ee_edit_locks").
+		Select("ee_edit_locks.*, ee_users.username").
+		Joins("JOIN ee_users ON ee_users.user_id = ee_edit_locks.user_id").
+		Where("ee_edit_locks.entity = ? AND ee_edit_locks.entity_id = ? AND ee_edit_locks.expires_at > ?", entity, id, time.Now()).
+		Scan(&editors).Error
+	if err != nil || len(editors) == 0 {
+		return nil, err
+	}
+
+	editors[0].Mine = editors[0].UserID == userID
+	return &editors[0], nil
+}
+
+func sendState(c *fiber.Ctx, status int, entity string, id uint) error {
+	editor, err := current(entity, id, middleware.UserID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if status == fiber.StatusConflict {
+		return c.Status(status).JSON(fiber.Map{"error": "object is being edited by another user", "editor": editor})
+	}
+
+	return c.Status(status).JSON(&LockState{Editor: editor})
+}
+
+// GetLock возвращает обработчик, показывающий, кто сейчас редактирует объект
+func GetLock(entity string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := scope(c, entity)
+		if id == 0 {
+			return err
+		}
+
+		return sendState(c, fiber.StatusOK, entity, id)
+	}
+}
+
+// AcquireLock возвращает обработчик, который занимает объект или продлевает свою блокировку.
+// Повторный вызов служит сигналом, что редактор ещё работает. ?force=true забирает чужую блокировку
+func AcquireLock(entity string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := scope(c, entity)
+		if id == 0 {
+			return err
+		}
+
+		now := time.Now()
+		result := storage.DB.Exec(`
+			INSERT INTO ee_edit_locks (entity, entity_id, user_id, acquired_at, heartbeat_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (entity, entity_id) DO UPDATE SET
+				user_id = EXCLUDED.user_id,
+				acquired_at = CASE
+					WHEN ee_edit_locks.user_id = EXCLUDED.user_id AND ee_edit_locks.expires_at > EXCLUDED.heartbeat_at
+					THEN ee_edit_locks.acquired_at
+					ELSE EXCLUDED.acquired_at
+				END,
+				heartbeat_at = EXCLUDED.heartbeat_at,
+				expires_at = EXCLUDED.expires_at
+			WHERE ee_edit_locks.user_id = EXCLUDED.user_id OR ee_edit_locks.expires_at <= EXCLUDED.heartbeat_at OR ?`,
+			entity, id, middleware.UserID(c), now, now, now.Add(lockTTL), c.QueryBool("force"),
+		)
+
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+		} else if result.RowsAffected == 0 {
+			return sendState(c, fiber.StatusConflict, entity, id)
+		}
+
+		return sendState(c, fiber.StatusOK, entity, id)
+	}
+}
+
+// ReleaseLock возвращает обработчик, снимающий свою блокировку, а с ?force=true - любую
+func ReleaseLock(entity string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := scope(c, entity)
+		if id == 0 {
+			return err
+		}
+
+		query := storage.DB.Where("entity = ? AND entity_id = ?", entity, id)
+		if !c.QueryBool("force") {
+			query = query.Where("(user_id = ? OR expires_at <= ?)", middleware.UserID(c), time.Now())
+		}
+
+		result := query.Delete(&storage.EeEditLock{})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+		}
+
+		var left int64
+		if err := storage.DB.Model(&storage.EeEditLock{}).Where("entity = ? AND entity_id = ?", entity, id).Count(&left).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if left > 0 {
+			return sendState(c, fiber.StatusConflict, entity, id)
+		}
+
+		return c.SendStatus(fiber.StatusOK)
+	}
+}
@@ -0,0 +1,100 @@
+package enrollments
+
+import (
+	"ekb-edu/src/database/storage"
+	"time"
+)
+
+// Роли участников курса
+const (
+	RoleInstructor   = "instructor" // Автор курса, запись появляется при создании курса
+	RoleStudent      = "student"
+	RoleTA           = "ta"
+	RoleCoInstructor = "co_instructor"
+	RoleObserver     = "observer"
+)
+
+// Состояния записи на курс
+const (
+	StatusActive    = "active"
+	StatusCompleted = "completed"
+	StatusDropped   = "dropped"
+	StatusExpired   = "expired"
+	StatusPending   = "pending"    // Ожидает одобрения преподавателем
+	StatusWaitlist  = "waitlisted" // В очереди на освободившееся место
+)
+
+// Политики записи на курс
+const (
+	PolicyOpen     = "open"
+	PolicyApproval = "approval"
+	PolicyKey      = "key"
+)
+
+var policies = map[string]bool{
+	PolicyOpen:     true,
+	PolicyApproval: true,
+	PolicyKey:      true,
+}
+
+var roles = map[string]bool{
+	RoleStudent:      true,
+	RoleTA:           true,
+	RoleCoInstructor: true,
+	RoleObserver:     true,
+}
+
+var statuses = map[string]bool{
+	StatusActive:    true,
+	StatusCompleted: true,
+	StatusDropped:   true,
+	StatusExpired:   true,
+	StatusPending:   true,
+	StatusWaitlist:  true,
+}
+
+// Роли, которые могут управлять курсом
+var staffRoles = []string{RoleInstructor, RoleTA, RoleCoInstructor}
+
+// Состояния, в которых у участника остаётся доступ к материалам
+var accessStatuses = []string{StatusActive, StatusCompleted}
+
+type EnrollmentInfo struct {
+	Role     string `json:"role"`
+	Status   string `json:"status"`
+	CohortID *uint  `json:"cohort_id"` // 0 убирает участника из потока
+}
+
+type EnrollmentWithUser struct {
+	storage.EeEnrollment
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+type EnrollmentWithCourse struct {
+	storage.EeEnrollment
+	CourseTitle string `json:"course_title"`
+}
+
+type EnrollRequest struct {
+	Key      string `json:"key"`
+	CohortID *uint  `json:"cohort_id"`
+}
+
+type EnrollResult struct {
+	storage.EeEnrollment
+	WaitlistPosition int64 `json:"waitlist_position,omitempty"`
+}
+
+type PolicyInfo struct {
+	Policy   *string `json:"enrollment_policy"`
+	Key      *string `json:"enrollment_key"`
+	Capacity *int    `json:"capacity"`
+}
+
+// Schedule - даты обучения участника: по его потоку или от даты записи на курс
+type Schedule struct {
+	CohortID *uint      `json:"cohort_id"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
@@ -0,0 +1,38 @@
+package roster
+
+// Результат обработки строки списка
+const (
+	ActionEnrolled = "enrolled" // Существующий пользователь записан на курс
+	ActionCreated  = "created"  // Создан аккаунт, пользователь записан на курс и приглашён
+	ActionSkipped  = "skipped"
+	ActionError    = "error"
+)
+
+type Row struct {
+	Line     int    `json:"line"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+type RowResult struct {
+	Row
+	UserID  uint   `json:"user_id,omitempty"`
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+}
+
+type Report struct {
+	CourseID uint        `json:"course_id"`
+	DryRun   bool        `json:"dry_run"`
+	Enrolled int         `json:"enrolled"`
+	Created  int         `json:"created"`
+	Skipped  int         `json:"skipped"`
+	Errors   int         `json:"errors"`
+	Rows     []RowResult `json:"rows"`
+}
+
+// Приглашение для созданного аккаунта, отправляется после фиксации транзакции
+type invite struct {
+	index int    // Номер строки в Report.Rows
+	token string // Одноразовый токен для установки пароля
+}
@@ -0,0 +1,361 @@
+package roster
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"ekb-edu/src/api/auth"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/mail"
+	"encoding/base32"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	netmail "net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCourseNotFound = errors.New("course not found")
+	errDryRun         = errors.New("dry run")
+)
+
+var usernameCleaner = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// Parse читает CSV со столбцами email и/или username. Заголовок необязателен,
+// разделителем может быть запятая или точка с запятой (выгрузка из Excel).
+func Parse(r io.Reader) ([]Row, error) {
+	br := bufio.NewReader(r)
+
+	// Пропускаем BOM
+	if bom, err := br.Peek(3); err == nil && bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	first, _ := br.Peek(4096)
+	line, _, _ := bytes.Cut(first, []byte("\n"))
+	if bytes.Contains(line, []byte(";")) && !bytes.Contains(line, []byte(",")) {
+		reader.Comma = ';'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	emailColumn, usernameColumn := -1, -1
+	start := 0
+	if len(records) > 0 {
+		for i, field := range records[0] {
+			switch strings.ToLower(strings.TrimSpace(field)) {
+			case "email", "e-mail", "почта":
+				emailColumn = i
+			case "username", "login", "логин":
+				usernameColumn = i
+			}
+		}
+
+		if emailColumn >= 0 || usernameColumn >= 0 {
+			start = 1
+		}
+	}
+
+	rows := []Row{}
+	for i := start; i < len(records); i++ {
+		row := Row{Line: i + 1}
+		record := records[i]
+
+		if start == 0 {
+			// Без заголовка: значение с @ считаем почтой, остальное логином
+			for _, field := range record {
+				field = strings.TrimSpace(field)
+				if strings.Contains(field, "@") {
+					row.Email = field
+				} else if field != "" {
+					row.Username = field
+				}
+			}
+		} else {
+			if emailColumn >= 0 && emailColumn < len(record) {
+				row.Email = strings.TrimSpace(record[emailColumn])
+			}
+			if usernameColumn >= 0 && usernameColumn < len(record) {
+				row.Username = strings.TrimSpace(record[usernameColumn])
+			}
+		}
+
+		row.Email = strings.ToLower(row.Email)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Случайный пароль нового аккаунта. Он никому не сообщается: пользователь задаёт свой пароль по ссылке из приглашения.
+func generatePassword() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return strings.ToLower(base32.StdEncoding.EncodeToString(buf)), nil
+}
+
+// Подбирает свободный логин на основе почты
+func freeUsername(tx *gorm.DB, email string) (string, error) {
+	local, _, _ := strings.Cut(email, "@")
+	base := usernameCleaner.ReplaceAllString(strings.ToLower(local), "")
+	if base == "" {
+		base = "student"
+	}
+
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = base + strconv.Itoa(i)
+		}
+
+		var count int64
+		if err := tx.Model(&storage.EeUser{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot find a free username for %s", email)
+}
+
+// Обрабатывает одну строку внутри транзакции. Возвращает токен приглашения, если аккаунт был создан.
+func importRow(tx *gorm.DB, courseID uint, result *RowResult) (string, error) {
+	var user storage.EeUser
+	query := tx.Model(&storage.EeUser{})
+	if result.Email != "" {
+		query = query.Where("email = ?", result.Email)
+	} else {
+		query = query.Where("username = ?", result.Username)
+	}
+
+	token := ""
+	err := query.First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound) && result.Email == "":
+		result.Action, result.Message = ActionError, "user not found"
+		return "", nil
+
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		username := result.Username
+		if username == "" {
+			if username, err = freeUsername(tx, result.Email); err != nil {
+				return "", err
+			}
+		} else {
+			var count int64
+			tx.Model(&storage.EeUser{}).Where("username = ?", username).Count(&count)
+			if count > 0 {
+				result.Action, result.Message = ActionError, "username is taken by another user"
+				return "", nil
+			}
+		}
+
+		password, err := generatePassword()
+		if err != nil {
+			return "", err
+		}
+
+		user = storage.EeUser{
+			Username:     username,
+			Email:        result.Email,
+			PasswordHash: auth.GetPasswordHash(password),
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return "", err
+		}
+
+		if token, err = auth.IssuePasswordToken(tx, user.UserID); err != nil {
+			return "", err
+		}
+
+		result.Username = username
+		result.Action = ActionCreated
+
+	case err != nil:
+		return "", err
+
+	default:
+		var enrollment storage.EeEnrollment
+		err := tx.Where("user_id = ? AND course_id = ?", user.UserID, courseID).First(&enrollment).Error
+		if err == nil && enrollment.Status != enrollments.StatusDropped && enrollment.Status != enrollments.StatusExpired {
+			result.UserID = user.UserID
+			result.Action, result.Message = ActionSkipped, fmt.Sprintf("already enrolled (%s)", enrollment.Status)
+			return "", nil
+		} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+
+		result.Action = ActionEnrolled
+		result.Email, result.Username = user.Email, user.Username
+	}
+
+	result.UserID = user.UserID
+
+	// При заполненном курсе студенты из списка встают в лист ожидания
+	status, err := enrollments.Admit(tx, courseID)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := enrollments.Enroll(tx, user.UserID, courseID, enrollments.RoleStudent, status); err != nil {
+		return "", err
+	}
+
+	if status == enrollments.StatusWaitlist {
+		result.Message = "added to the waitlist"
+	}
+
+	return token, nil
+}
+
+// Import записывает пользователей из списка на курс. В режиме dryRun изменения откатываются,
+// а письма не отправляются, отчёт при этом совпадает с реальным запуском.
+func Import(courseID uint, rows []Row, dryRun bool) (*Report, error) {
+	var course storage.EeCourse
+	if err := storage.DB.Where("course_id = ?", courseID).First(&course).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCourseNotFound
+		}
+		return nil, err
+	}
+
+	report := Report{CourseID: courseID, DryRun: dryRun, Rows: make([]RowResult, 0, len(rows))}
+	var invites []invite
+	seen := make(map[string]bool)
+
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			result := RowResult{Row: row}
+			key := row.Email
+			if key == "" {
+				key = strings.ToLower(row.Username)
+			}
+
+			switch {
+			case row.Email == "" && row.Username == "":
+				result.Action, result.Message = ActionSkipped, "empty row"
+			case row.Email != "" && !isEmail(row.Email):
+				result.Action, result.Message = ActionError, "invalid email"
+			case seen[key]:
+				result.Action, result.Message = ActionSkipped, "duplicate row"
+			default:
+				seen[key] = true
+
+				// Ошибка в одной строке не должна откатывать остальные
+				tx.SavePoint("roster_row")
+				token, err := importRow(tx, courseID, &result)
+				if err != nil {
+					tx.RollbackTo("roster_row")
+					result.Action, result.Message = ActionError, err.Error()
+				} else if token != "" {
+					invites = append(invites, invite{index: len(report.Rows), token: token})
+				}
+			}
+
+			report.Rows = append(report.Rows, result)
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	if !dryRun {
+		for _, inv := range invites {
+			result := &report.Rows[inv.index]
+			if err := sendInvite(&course, result, inv.token); err != nil {
+				result.Message = fmt.Sprintf("invite not sent: %s", err.Error())
+			}
+		}
+	}
+
+	for _, result := range report.Rows {
+		switch result.Action {
+		case ActionEnrolled:
+			report.Enrolled++
+		case ActionCreated:
+			report.Created++
+		case ActionSkipped:
+			report.Skipped++
+		case ActionError:
+			report.Errors++
+		}
+	}
+
+	return &report, nil
+}
+
+func isEmail(value string) bool {
+	address, err := netmail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+func sendInvite(course *storage.EeCourse, result *RowResult, token string) error {
+	return mail.Send(mail.Message{
+		To:      result.Email,
+		Subject: fmt.Sprintf("Приглашение на курс «%s»", course.Title),
+		Body: fmt.Sprintf("Здравствуйте!\n\n"+
+			"Вас записали на курс «%s».\n\n"+
+			"Логин: %s\n\n"+
+			"Чтобы задать пароль и войти, перейдите по ссылке (действует 7 дней):\n"+
+			"%s/reset-password?token=%s\n",
+			course.Title, result.Username, mail.AppURL(), token),
+	})
+}
+
+// ImportRoster принимает CSV файл (поле file) или CSV в теле запроса, ?dry_run=true для предпросмотра
+func ImportRoster(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	var body io.Reader = bytes.NewReader(c.Body())
+	if header, err := c.FormFile("file"); err == nil {
+		file, err := header.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot read roster file"})
+		}
+		defer file.Close()
+		body = file
+	}
+
+	rows, err := Parse(body)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid CSV: %s", err.Error())})
+	}
+
+	report, err := Import(uint(courseID), rows, c.QueryBool("dry_run"))
+	if errors.Is(err, ErrCourseNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,994 @@
+package enrollments
+
+import (
+	"crypto/subtle"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errAlreadyEnrolled  = errors.New("user is already enrolled in the course")
+	errInvalidKey       = errors.New("invalid enrollment key")
+	errCohortNotFound   = errors.New("cohort not found in this course")
+	errEnrollmentClosed = errors.New("enrollment is closed")
+	errCourseFull       = errors.New("course has no free seats")
+	errAuthorEnrollment = errors.New("enrollment of the course author cannot be changed")
+	errNotPending       = errors.New("enrollment is not pending approval")
+)
+
+// CourseIDBySection возвращает курс, к которому относится раздел
+func CourseIDBySection(sectionID uint) (uint, error) {
+	var section storage.EeCourseSection
+	err := storage.DB.Select("course_id").Where("section_id = ?", sectionID).First(&section).Error
+	return section.CourseID, err
+}
+
+// CourseIDByLesson возвращает курс, к которому относится урок
+func CourseIDByLesson(lessonID uint) (uint, error) {
+	var courseID uint
+	err := storage.DB.Table("ee_lessons").
+		Select("ee_course_sections.course_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+		Where("ee_lessons.lesson_id = ?", lessonID).
+		Row().Scan(&courseID)
+	return courseID, err
+}
+
+// CourseIDByQuiz возвращает курс, к которому относится тест
+func CourseIDByQuiz(quizID uint) (uint, error) {
+	var courseID uint
+	err := storage.DB.Table("ee_quizzes").
+		Select("ee_course_sections.course_id").
+		Joins("JOIN ee_lessons ON ee_lessons.lesson_id = ee_quizzes.lesson_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+		Where("ee_quizzes.quiz_id = ?", quizID).
+		Row().Scan(&courseID)
+	return courseID, err
+}
+
+// Find возвращает запись пользователя на курс или gorm.ErrRecordNotFound
+func Find(userID, courseID uint) (*storage.EeEnrollment, error) {
+	var enrollment storage.EeEnrollment
+	err := storage.DB.Where("user_id = ? AND course_id = ?", userID, courseID).First(&enrollment).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &enrollment, nil
+}
+
+// hasEnrollment проверяет, есть ли у пользователя запись на курс с одной из ролей и состояний
+func hasEnrollment(userID, courseID uint, anyRole, anyStatus []string) (bool, error) {
+	var count int64
+	err := storage.DB.Model(&storage.EeEnrollment{}).
+		Where("user_id = ? AND course_id = ? AND role IN ? AND status IN ?", userID, courseID, anyRole, anyStatus).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsInstructor проверяет, является ли пользователь автором курса
+func IsInstructor(userID, courseID uint) (bool, error) {
+	return hasEnrollment(userID, courseID, []string{RoleInstructor}, []string{StatusActive})
+}
+
+// IsStaff проверяет, может ли пользователь управлять курсом: автор, соавтор или ассистент
+func IsStaff(userID, courseID uint) (bool, error) {
+	return hasEnrollment(userID, courseID, staffRoles, []string{StatusActive})
+}
+
+// IsStudent проверяет, что пользователь учится на курсе
+func IsStudent(userID, courseID uint) (bool, error) {
+	return hasEnrollment(userID, courseID, []string{RoleStudent}, []string{StatusActive})
+}
+
+// HasAccess проверяет, может ли пользователь просматривать материалы курса
+func HasAccess(userID, courseID uint) (bool, error) {
+	var count int64
+	err := storage.DB.Model(&storage.EeEnrollment{}).
+		Where("user_id = ? AND course_id = ? AND status IN ?", userID, courseID, accessStatuses).
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	// Преподаватели потоков видят материалы всего курса
+	err = storage.DB.Table("ee_cohort_instructors").
+		Joins("JOIN ee_cohorts ON ee_cohorts.cohort_id = ee_cohort_instructors.cohort_id").
+		Where("ee_cohort_instructors.user_id = ? AND ee_cohorts.course_id = ?", userID, courseID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// IsCohortInstructor проверяет, ведёт ли пользователь поток
+func IsCohortInstructor(userID, cohortID uint) (bool, error) {
+	var count int64
+	err := storage.DB.Model(&storage.EeCohortInstructor{}).Where("cohort_id = ? AND user_id = ?", cohortID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// ScheduleFor возвращает даты обучения участника курса
+func ScheduleFor(userID, courseID uint) (*Schedule, error) {
+	enrollment, err := Find(userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := Schedule{CohortID: enrollment.CohortID, StartsAt: enrollment.CreatedAt}
+	if enrollment.CohortID == nil {
+		return &schedule, nil
+	}
+
+	var cohort storage.EeCohort
+	if err := storage.DB.Where("cohort_id = ?", *enrollment.CohortID).First(&cohort).Error; err != nil {
+		return nil, err
+	}
+
+	if cohort.StartsAt != nil {
+		schedule.StartsAt = *cohort.StartsAt
+	}
+	schedule.EndsAt = cohort.EndsAt
+
+	return &schedule, nil
+}
+
+// IsEnrollmentOpen проверяет, принимает ли поток заявки в данный момент
+func IsEnrollmentOpen(cohort *storage.EeCohort, now time.Time) bool {
+	if cohort.EnrollmentOpensAt != nil && now.Before(*cohort.EnrollmentOpensAt) {
+		return false
+	}
+
+	if cohort.EnrollmentClosesAt != nil && !now.Before(*cohort.EnrollmentClosesAt) {
+		return false
+	}
+
+	return true
+}
+
+// Выбирает поток для самостоятельной записи: запрошенный или ближайший с открытым приёмом
+func pickCohort(tx *gorm.DB, courseID uint, requested *uint) (*uint, error) {
+	var cohorts []storage.EeCohort
+	if err := tx.Where("course_id = ?", courseID).Order("starts_at NULLS LAST, cohort_id").Find(&cohorts).Error; err != nil {
+		return nil, err
+	}
+
+	if len(cohorts) == 0 {
+		if requested != nil {
+			return nil, errCohortNotFound
+		}
+		return nil, nil
+	}
+
+	now := time.Now()
+	for _, cohort := range cohorts {
+		if requested != nil && cohort.CohortID != *requested {
+			continue
+		}
+
+		if IsEnrollmentOpen(&cohort, now) {
+			return &cohort.CohortID, nil
+		}
+
+		if requested != nil {
+			return nil, errEnrollmentClosed
+		}
+	}
+
+	if requested != nil {
+		return nil, errCohortNotFound
+	}
+
+	return nil, errEnrollmentClosed
+}
+
+// Проверяет, что поток относится к курсу
+func validateCohort(courseID uint, cohortID *uint) error {
+	if cohortID == nil || *cohortID == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := storage.DB.Model(&storage.EeCohort{}).Where("cohort_id = ? AND course_id = ?", *cohortID, courseID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return errCohortNotFound
+	}
+
+	return nil
+}
+
+// Значение для столбца cohort_id: 0 означает "без потока"
+func cohortColumn(cohortID *uint) interface{} {
+	if *cohortID == 0 {
+		return nil
+	}
+
+	return *cohortID
+}
+
+// CanAccess - HasAccess для текущего пользователя запроса, администратор имеет доступ ко всему
+func CanAccess(c *fiber.Ctx, courseID uint) (bool, error) {
+	if middleware.IsAdmin(c) {
+		return true, nil
+	}
+	return HasAccess(middleware.UserID(c), courseID)
+}
+
+// CanManage - IsStaff для текущего пользователя запроса, администратор управляет всеми курсами
+func CanManage(c *fiber.Ctx, courseID uint) (bool, error) {
+	if middleware.IsAdmin(c) {
+		return true, nil
+	}
+	return IsStaff(middleware.UserID(c), courseID)
+}
+
+// AccessibleCourseIDs возвращает курсы, к материалам которых у пользователя есть доступ
+func AccessibleCourseIDs(userID uint) ([]uint, error) {
+	var courseIDs []uint
+	err := storage.DB.Model(&storage.EeEnrollment{}).
+		Where("user_id = ? AND status IN ?", userID, accessStatuses).
+		Pluck("course_id", &courseIDs).Error
+	return courseIDs, err
+}
+
+// EnrollAuthor записывает автора в только что созданный курс
+func EnrollAuthor(tx *gorm.DB, userID, courseID uint) error {
+	return tx.Create(&storage.EeEnrollment{UserID: userID, CourseID: courseID, Role: RoleInstructor, Status: StatusActive}).Error
+}
+
+// isAuthor проверяет внутри транзакции, что запись принадлежит автору курса
+func isAuthor(tx *gorm.DB, userID, courseID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&storage.EeEnrollment{}).
+		Where("user_id = ? AND course_id = ? AND role = ?", userID, courseID, RoleInstructor).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Enroll записывает пользователя на курс или возобновляет существующую запись.
+// Запись автора курса не перезаписывается, см. errAuthorEnrollment
+func Enroll(tx *gorm.DB, userID, courseID uint, role, status string) (*storage.EeEnrollment, error) {
+	if author, err := isAuthor(tx, userID, courseID); err != nil {
+		return nil, err
+	} else if author {
+		return nil, errAuthorEnrollment
+	}
+
+	enrollment := storage.EeEnrollment{
+		UserID:   userID,
+		CourseID: courseID,
+		Role:     role,
+		Status:   status,
+	}
+
+	if status == StatusWaitlist {
+		now := time.Now()
+		enrollment.WaitlistedAt = &now
+	}
+
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "course_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "status", "waitlisted_at", "updated_at"}),
+	}).Create(&enrollment).Error
+
+	return &enrollment, err
+}
+
+// IsValidPolicy проверяет название политики записи
+func IsValidPolicy(policy string) bool {
+	return policies[policy]
+}
+
+// Блокирует строку курса до конца транзакции, чтобы параллельные записи не заняли одно место
+func lockCourse(tx *gorm.DB, courseID uint) (*storage.EeCourse, error) {
+	var course storage.EeCourse
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("course_id = ?", courseID).First(&course).Error
+	return &course, err
+}
+
+// SeatsTaken возвращает количество мест, занятых активными студентами
+func SeatsTaken(tx *gorm.DB, courseID uint) (int64, error) {
+	var count int64
+	err := tx.Model(&storage.EeEnrollment{}).
+		Where("course_id = ? AND role = ? AND status = ?", courseID, RoleStudent, StatusActive).
+		Count(&count).Error
+	return count, err
+}
+
+// SeatsRemaining возвращает количество свободных мест или nil для курса без ограничений
+func SeatsRemaining(course *storage.EeCourse) (*int64, error) {
+	if course.Capacity == 0 {
+		return nil, nil
+	}
+
+	taken, err := SeatsTaken(storage.DB, course.CourseID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := max(int64(course.Capacity)-taken, 0)
+	return &remaining, nil
+}
+
+// Статус новой записи студента с учётом свободных мест и очереди
+func admissionStatus(tx *gorm.DB, course *storage.EeCourse) (string, error) {
+	if course.Capacity == 0 {
+		return StatusActive, nil
+	}
+
+	taken, err := SeatsTaken(tx, course.CourseID)
+	if err != nil {
+		return "", err
+	}
+
+	var waiting int64
+	if err := tx.Model(&storage.EeEnrollment{}).Where("course_id = ? AND status = ?", course.CourseID, StatusWaitlist).Count(&waiting).Error; err != nil {
+		return "", err
+	}
+
+	// Свободное место сначала достаётся тем, кто уже стоит в очереди
+	if taken >= int64(course.Capacity) || waiting > 0 {
+		return StatusWaitlist, nil
+	}
+
+	return StatusActive, nil
+}
+
+// Admit блокирует курс и возвращает статус новой записи студента с учётом вместимости
+func Admit(tx *gorm.DB, courseID uint) (string, error) {
+	course, err := lockCourse(tx, courseID)
+	if err != nil {
+		return "", err
+	}
+
+	return admissionStatus(tx, course)
+}
+
+// Проверяет, что у курса есть место для ещё одного активного студента
+func checkSeat(tx *gorm.DB, course *storage.EeCourse) error {
+	if course.Capacity == 0 {
+		return nil
+	}
+
+	taken, err := SeatsTaken(tx, course.CourseID)
+	if err != nil {
+		return err
+	}
+
+	if taken >= int64(course.Capacity) {
+		return errCourseFull
+	}
+
+	return nil
+}
+
+func waitlistPosition(tx *gorm.DB, enrollment *storage.EeEnrollment) (int64, error) {
+	var ahead int64
+	err := tx.Model(&storage.EeEnrollment{}).
+		Where("course_id = ? AND status = ? AND (waitlisted_at, enrollment_id) < (?, ?)",
+			enrollment.CourseID, StatusWaitlist, enrollment.WaitlistedAt, enrollment.EnrollmentID).
+		Count(&ahead).Error
+	return ahead + 1, err
+}
+
+// Переводит студентов из листа ожидания на свободные места в порядке очереди.
+// Строка курса должна быть заблокирована вызывающим кодом.
+func promoteWaitlist(tx *gorm.DB, course *storage.EeCourse) error {
+	query := tx.Model(&storage.EeEnrollment{}).
+		Where("course_id = ? AND status = ?", course.CourseID, StatusWaitlist).
+		Order("waitlisted_at, enrollment_id")
+
+	if course.Capacity > 0 {
+		taken, err := SeatsTaken(tx, course.CourseID)
+		if err != nil {
+			return err
+		}
+
+		free := int64(course.Capacity) - taken
+		if free <= 0 {
+			return nil
+		}
+		query = query.Limit(int(free))
+	}
+
+	var ids []uint
+	if err := query.Pluck("enrollment_id", &ids).Error; err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return tx.Model(&storage.EeEnrollment{}).
+		Where("enrollment_id IN ?", ids).
+		Updates(map[string]interface{}{"status": StatusActive, "waitlisted_at": nil}).Error
+}
+
+// PromoteWaitlist занимает освободившиеся места курса студентами из листа ожидания
+func PromoteWaitlist(courseID uint) error {
+	return storage.DB.Transaction(func(tx *gorm.DB) error {
+		course, err := lockCourse(tx, courseID)
+		if err != nil {
+			return err
+		}
+
+		return promoteWaitlist(tx, course)
+	})
+}
+
+func parseEnrollmentInfo(c *fiber.Ctx) (*EnrollmentInfo, error) {
+	info := EnrollmentInfo{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&info); err != nil {
+			return nil, errors.New("cannot parse enrollment data")
+		}
+	}
+
+	if info.Role != "" && !roles[info.Role] {
+		return nil, fmt.Errorf("unknown role %q", info.Role)
+	}
+
+	if info.Status != "" && !statuses[info.Status] {
+		return nil, fmt.Errorf("unknown status %q", info.Status)
+	}
+
+	return &info, nil
+}
+
+// LinkUser записывает пользователя на курс, роль передаётся в теле запроса (по умолчанию student)
+func LinkUser(c *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(c.Params("user_id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid User ID",
+		})
+	}
+
+	courseID, err := strconv.ParseUint(c.Params("course_id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	info, err := parseEnrollmentInfo(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if info.Role == "" {
+		info.Role = RoleStudent
+	}
+
+	if err := validateCohort(uint(courseID), info.CohortID); errors.Is(err, errCohortNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var enrollment *storage.EeEnrollment
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		course, err := lockCourse(tx, uint(courseID))
+		if err != nil {
+			return err
+		}
+
+		// Новый студент занимает место, только если оно свободно, иначе встаёт в очередь
+		status := StatusActive
+		if info.Role == RoleStudent {
+			var existing storage.EeEnrollment
+			err := tx.Where("user_id = ? AND course_id = ?", userID, courseID).First(&existing).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && (existing.Role != RoleStudent || existing.Status != StatusActive)) {
+				if status, err = admissionStatus(tx, course); err != nil {
+					return err
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if enrollment, err = Enroll(tx, uint(userID), uint(courseID), info.Role, status); err != nil {
+			return err
+		}
+
+		if info.CohortID != nil {
+			enrollment.CohortID = info.CohortID
+			if *info.CohortID == 0 {
+				enrollment.CohortID = nil
+			}
+
+			if err := tx.Model(enrollment).Update("cohort_id", cohortColumn(info.CohortID)).Error; err != nil {
+				return err
+			}
+		}
+
+		// Студент мог стать сотрудником курса и освободить место
+		return promoteWaitlist(tx, course)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	} else if errors.Is(err, errAuthorEnrollment) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(enrollment)
+}
+
+func GetCourseEnrollments(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	if ok, err := CanManage(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	query := storage.DB.Table("ee_enrollments").
+		Select("ee_enrollments.*, ee_users.username, ee_users.email").
+		Joins("JOIN ee_users ON ee_users.user_id = ee_enrollments.user_id").
+		Where("ee_enrollments.course_id = ?", courseID)
+
+	if role := c.Query("role"); role != "" {
+		query = query.Where("ee_enrollments.role = ?", role)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("ee_enrollments.status = ?", status)
+	}
+
+	enrollments := []EnrollmentWithUser{}
+	if err := query.Order("ee_enrollments.created_at").Scan(&enrollments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(enrollments)
+}
+
+func getMyEnrollments(c *fiber.Ctx) error {
+	enrollments := []EnrollmentWithCourse{}
+
+	result := storage.DB.Table("ee_enrollments").
+		Select("ee_enrollments.*, ee_courses.title AS course_title").
+		Joins("JOIN ee_courses ON ee_courses.course_id = ee_enrollments.course_id").
+		Where("ee_enrollments.user_id = ?", middleware.UserID(c)).
+		Order("ee_enrollments.created_at DESC").
+		Scan(&enrollments)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	}
+
+	return c.JSON(enrollments)
+}
+
+func findEnrollment(c *fiber.Ctx) (*storage.EeEnrollment, error) {
+	enrollmentID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid enrollment id"})
+	}
+
+	var enrollment storage.EeEnrollment
+	if err := storage.DB.Where("enrollment_id = ?", enrollmentID).First(&enrollment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "enrollment not found"})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if ok, err := CanManage(c, enrollment.CourseID); err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return nil, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return &enrollment, nil
+}
+
+func updateEnrollment(c *fiber.Ctx) error {
+	enrollment, err := findEnrollment(c)
+	if enrollment == nil {
+		return err
+	}
+
+	info, err := parseEnrollmentInfo(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Назначать соавторов и ассистентов может только автор курса или администратор
+	if info.Role != "" && info.Role != enrollment.Role && !middleware.IsAdmin(c) {
+		if author, err := IsInstructor(middleware.UserID(c), enrollment.CourseID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if !author {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only the course instructor can change roles"})
+		}
+	}
+
+	if err := validateCohort(enrollment.CourseID, info.CohortID); errors.Is(err, errCohortNotFound) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		course, err := lockCourse(tx, enrollment.CourseID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("enrollment_id = ?", enrollment.EnrollmentID).First(enrollment).Error; err != nil {
+			return err
+		}
+
+		// Автор курса остаётся автором, иначе у курса не останется владельца
+		if enrollment.Role == RoleInstructor && (info.Role != "" && info.Role != RoleInstructor || info.Status != "" && info.Status != StatusActive) {
+			return errAuthorEnrollment
+		}
+
+		updates := map[string]interface{}{}
+		if info.Role != "" {
+			updates["role"] = info.Role
+		}
+		// Перевод в другой поток не затрагивает ответы и прогресс, они привязаны к пользователю
+		if info.CohortID != nil {
+			updates["cohort_id"] = cohortColumn(info.CohortID)
+		}
+		if info.Status != "" {
+			updates["status"] = info.Status
+			if info.Status == StatusWaitlist && enrollment.WaitlistedAt == nil {
+				updates["waitlisted_at"] = time.Now()
+			} else if info.Status != StatusWaitlist {
+				updates["waitlisted_at"] = nil
+			}
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+
+		// Запись, которая становится активным студентом, должна занять свободное место
+		role, status := enrollment.Role, enrollment.Status
+		if info.Role != "" {
+			role = info.Role
+		}
+		if info.Status != "" {
+			status = info.Status
+		}
+		if role == RoleStudent && status == StatusActive && (enrollment.Role != RoleStudent || enrollment.Status != StatusActive) {
+			if err := checkSeat(tx, course); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(enrollment).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Студент мог освободить место
+		return promoteWaitlist(tx, course)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "enrollment not found"})
+	case errors.Is(err, errCourseFull), errors.Is(err, errAuthorEnrollment):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(enrollment)
+}
+
+func deleteEnrollment(c *fiber.Ctx) error {
+	enrollment, err := findEnrollment(c)
+	if enrollment == nil {
+		return err
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		course, err := lockCourse(tx, enrollment.CourseID)
+		if err != nil {
+			return err
+		}
+
+		if author, err := isAuthor(tx, enrollment.UserID, enrollment.CourseID); err != nil {
+			return err
+		} else if author {
+			return errAuthorEnrollment
+		}
+
+		if err := tx.Delete(enrollment).Error; err != nil {
+			return err
+		}
+
+		return promoteWaitlist(tx, course)
+	})
+
+	if errors.Is(err, errAuthorEnrollment) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// EnrollSelf записывает текущего пользователя на курс согласно политике курса
+func EnrollSelf(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	request := EnrollRequest{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse enrollment data"})
+		}
+	}
+
+	userID := middleware.UserID(c)
+	result := EnrollResult{}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		course, err := lockCourse(tx, uint(courseID))
+		if err != nil {
+			return err
+		}
+
+		var existing storage.EeEnrollment
+		err = tx.Where("user_id = ? AND course_id = ?", userID, courseID).First(&existing).Error
+		if err == nil && existing.Status != StatusDropped && existing.Status != StatusExpired {
+			return errAlreadyEnrolled
+		} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		cohortID, err := pickCohort(tx, course.CourseID, request.CohortID)
+		if err != nil {
+			return err
+		}
+
+		status := StatusPending
+		switch course.EnrollmentPolicy {
+		case PolicyKey:
+			if course.EnrollmentKey == "" || subtle.ConstantTimeCompare([]byte(course.EnrollmentKey), []byte(request.Key)) != 1 {
+				return errInvalidKey
+			}
+			fallthrough
+		case PolicyOpen:
+			if status, err = admissionStatus(tx, course); err != nil {
+				return err
+			}
+		}
+
+		enrollment, err := Enroll(tx, userID, course.CourseID, RoleStudent, status)
+		if err != nil {
+			return err
+		}
+
+		enrollment.CohortID = cohortID
+		if err := tx.Model(enrollment).Update("cohort_id", cohortID).Error; err != nil {
+			return err
+		}
+		result.EeEnrollment = *enrollment
+
+		if status == StatusWaitlist {
+			result.WaitlistPosition, err = waitlistPosition(tx, enrollment)
+		}
+
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	case errors.Is(err, errAlreadyEnrolled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errInvalidKey), errors.Is(err, errEnrollmentClosed):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, errCohortNotFound):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&result)
+}
+
+// DropSelf отчисляет текущего пользователя с курса и отдаёт место следующему в очереди
+func DropSelf(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	userID := middleware.UserID(c)
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		course, err := lockCourse(tx, uint(courseID))
+		if err != nil {
+			return err
+		}
+
+		if author, err := isAuthor(tx, userID, course.CourseID); err != nil {
+			return err
+		} else if author {
+			return errAuthorEnrollment
+		}
+
+		result := tx.Model(&storage.EeEnrollment{}).
+			Where("user_id = ? AND course_id = ? AND status <> ?", userID, courseID, StatusDropped).
+			Updates(map[string]interface{}{"status": StatusDropped, "waitlisted_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return promoteWaitlist(tx, course)
+	})
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "enrollment not found"})
+	} else if errors.Is(err, errAuthorEnrollment) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// Одобряет заявку: студент получает место или встаёт в лист ожидания
+func approveEnrollment(c *fiber.Ctx) error {
+	enrollment, err := findEnrollment(c)
+	if enrollment == nil {
+		return err
+	}
+
+	result := EnrollResult{}
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		course, err := lockCourse(tx, enrollment.CourseID)
+		if err != nil {
+			return err
+		}
+
+		// Заявку могли одобрить или отозвать, пока курс не был заблокирован
+		if err := tx.Where("enrollment_id = ?", enrollment.EnrollmentID).First(enrollment).Error; err != nil {
+			return err
+		} else if enrollment.Status != StatusPending {
+			return errNotPending
+		}
+
+		status, err := admissionStatus(tx, course)
+		if err != nil {
+			return err
+		}
+
+		updated, err := Enroll(tx, enrollment.UserID, enrollment.CourseID, enrollment.Role, status)
+		if err != nil {
+			return err
+		}
+		result.EeEnrollment = *updated
+
+		if status == StatusWaitlist {
+			result.WaitlistPosition, err = waitlistPosition(tx, updated)
+		}
+
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "enrollment not found"})
+	case errors.Is(err, errNotPending):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&result)
+}
+
+// SetPolicy меняет политику записи, кодовое слово и вместимость курса
+func SetPolicy(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	if ok, err := CanManage(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := PolicyInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse enrollment policy"})
+	}
+
+	updates := map[string]interface{}{}
+	if info.Policy != nil {
+		if !IsValidPolicy(*info.Policy) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("unknown enrollment policy %q", *info.Policy)})
+		}
+		updates["enrollment_policy"] = *info.Policy
+	}
+	if info.Key != nil {
+		updates["enrollment_key"] = *info.Key
+	}
+	if info.Capacity != nil {
+		if *info.Capacity < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "capacity cannot be negative"})
+		}
+		updates["capacity"] = *info.Capacity
+	}
+
+	var course *storage.EeCourse
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if course, err = lockCourse(tx, uint(courseID)); err != nil {
+			return err
+		}
+
+		if info.Policy != nil {
+			course.EnrollmentPolicy = *info.Policy
+		}
+		if info.Key != nil {
+			course.EnrollmentKey = *info.Key
+		}
+		if info.Capacity != nil {
+			course.Capacity = *info.Capacity
+		}
+
+		if course.EnrollmentPolicy == PolicyKey && course.EnrollmentKey == "" {
+			return errInvalidKey
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&storage.EeCourse{}).Where("course_id = ?", course.CourseID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		// Увеличение вместимости освобождает места для очереди
+		return promoteWaitlist(tx, course)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	case errors.Is(err, errInvalidKey):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "enrollment key is required for key policy"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(course)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/enrollments", middleware.TokenRequired)
+	{
+		g.Get("/my", getMyEnrollments)
+		g.Patch("/:id", updateEnrollment)
+		g.Post("/:id/approve", approveEnrollment)
+		g.Delete("/:id", deleteEnrollment)
+	}
+}
@@ -0,0 +1,183 @@
+package imports
+
+import "encoding/xml"
+
+// Поддерживаемые форматы пакетов
+const (
+	FormatCommonCartridge = "imscc"
+	FormatScorm12         = "scorm12"
+	FormatScorm2004       = "scorm2004"
+	FormatUnknown         = "unknown"
+)
+
+// Уровни записей в отчёте об импорте
+const (
+	IssueSkipped = "skipped"
+	IssueWarning = "warning"
+)
+
+// Ограничения на распакованный размер: сжатый пакет ограничен только телом запроса
+const (
+	maxFileSize     = 256 << 20 // Один файл пакета, 256 МиБ
+	maxUnpackedSize = 1 << 30   // Все файлы пакета вместе, 1 ГиБ
+)
+
+// Файл пакета, сохранённый в хранилище
+type asset struct {
+	key      string
+	size     int64
+	sha256   string
+	mimeType string
+}
+
+// Manifest описывает imsmanifest.xml (общая часть IMS CC и SCORM)
+type Manifest struct {
+	XMLName       xml.Name              `xml:"manifest"`
+	Identifier    string                `xml:"identifier,attr"`
+	Base          string                `xml:"base,attr"`
+	Metadata      ManifestMetadata      `xml:"metadata"`
+	Organizations ManifestOrganizations `xml:"organizations"`
+	Resources     ManifestResources     `xml:"resources"`
+}
+
+type ManifestMetadata struct {
+	Schema        string `xml:"schema"`
+	SchemaVersion string `xml:"schemaversion"`
+	Title         string `xml:"lom>general>title>string"`
+}
+
+type ManifestOrganizations struct {
+	Default       string                 `xml:"default,attr"`
+	Organizations []ManifestOrganization `xml:"organization"`
+}
+
+type ManifestOrganization struct {
+	Identifier string         `xml:"identifier,attr"`
+	Title      string         `xml:"title"`
+	Items      []ManifestItem `xml:"item"`
+}
+
+type ManifestItem struct {
+	Identifier    string         `xml:"identifier,attr"`
+	IdentifierRef string         `xml:"identifierref,attr"`
+	Title         string         `xml:"title"`
+	Items         []ManifestItem `xml:"item"`
+}
+
+type ManifestResources struct {
+	Base      string             `xml:"base,attr"`
+	Resources []ManifestResource `xml:"resource"`
+}
+
+type ManifestResource struct {
+	Identifier   string               `xml:"identifier,attr"`
+	Type         string               `xml:"type,attr"`
+	Href         string               `xml:"href,attr"`
+	Base         string               `xml:"base,attr"`
+	ScormType12  string               `xml:"scormtype,attr"`
+	ScormType    string               `xml:"scormType,attr"`
+	Files        []ManifestFile       `xml:"file"`
+	Dependencies []ManifestDependency `xml:"dependency"`
+}
+
+type ManifestFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type ManifestDependency struct {
+	IdentifierRef string `xml:"identifierref,attr"`
+}
+
+// WebLink описывает ресурс-ссылку IMS CC (imswl_xmlv1p*)
+type WebLink struct {
+	Title string `xml:"title"`
+	URL   struct {
+		Href string `xml:"href,attr"`
+	} `xml:"url"`
+}
+
+// QTI 1.2 (профиль IMS CC)
+type QtiInterop struct {
+	XMLName    xml.Name      `xml:"questestinterop"`
+	Assessment QtiAssessment `xml:"assessment"`
+	Items      []QtiItem     `xml:"objectbank>item"`
+}
+
+type QtiAssessment struct {
+	Title    string       `xml:"title,attr"`
+	Sections []QtiSection `xml:"section"`
+}
+
+type QtiSection struct {
+	Items    []QtiItem    `xml:"item"`
+	Sections []QtiSection `xml:"section"`
+}
+
+type QtiItem struct {
+	Ident         string             `xml:"ident,attr"`
+	Title         string             `xml:"title,attr"`
+	ProfileFields []QtiMetadataField `xml:"itemmetadata>qtimetadata>qtimetadatafield"`
+	Presentation  QtiPresentation    `xml:"presentation"`
+	Conditions    []QtiRespCondition `xml:"resprocessing>respcondition"`
+}
+
+type QtiMetadataField struct {
+	Label string `xml:"fieldlabel"`
+	Entry string `xml:"fieldentry"`
+}
+
+type QtiPresentation struct {
+	Texts     []string      `xml:"material>mattext"`
+	Responses []QtiResponse `xml:",any"`
+}
+
+// QtiResponse покрывает response_lid и response_str
+type QtiResponse struct {
+	XMLName xml.Name
+	Ident   string         `xml:"ident,attr"`
+	Texts   []string       `xml:"material>mattext"`
+	Labels  []QtiRespLabel `xml:"render_choice>response_label"`
+	Fib     []QtiRespLabel `xml:"render_fib>response_label"`
+}
+
+type QtiRespLabel struct {
+	Ident string   `xml:"ident,attr"`
+	Texts []string `xml:"material>mattext"`
+}
+
+type QtiRespCondition struct {
+	Equals  []QtiVarEqual `xml:"conditionvar>varequal"`
+	Ors     []QtiVarEqual `xml:"conditionvar>or>varequal"`
+	SetVars []QtiSetVar   `xml:"setvar"`
+}
+
+type QtiVarEqual struct {
+	RespIdent string `xml:"respident,attr"`
+	Value     string `xml:",chardata"`
+}
+
+type QtiSetVar struct {
+	Action string `xml:"action,attr"`
+	Value  string `xml:",chardata"`
+}
+
+// ImportIssue описывает элемент пакета, который не удалось импортировать полностью
+type ImportIssue struct {
+	Identifier string `json:"identifier"`
+	Title      string `json:"title,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Severity   string `json:"severity"`
+	Reason     string `json:"reason"`
+}
+
+// ImportReport - итог импорта пакета
+type ImportReport struct {
+	Format    string        `json:"format"`
+	CourseID  uint          `json:"course_id"`
+	Sections  int           `json:"sections"`
+	Lessons   int           `json:"lessons"`
+	Quizzes   int           `json:"quizzes"`
+	Questions int           `json:"questions"`
+	Assets    int           `json:"assets"`
+	Issues    []ImportIssue `json:"issues"`
+}
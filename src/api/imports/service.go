@@ -0,0 +1,795 @@
+package imports
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"ekb-edu/src/api/courses/lessons/blocks"
+	"ekb-edu/src/api/courses/lessons/quizzes/questions"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/uploads"
+	"ekb-edu/src/database/files"
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const manifestName = "imsmanifest.xml"
+
+var (
+	errNoManifest = errors.New("imsmanifest.xml not found in package")
+	errTooLarge   = errors.New("package is too large when unpacked")
+)
+
+// Состояние одного импорта пакета
+type importer struct {
+	tx        *gorm.DB
+	files     map[string]*zip.File
+	manifest  Manifest
+	resources map[string]ManifestResource
+	keyPrefix string
+	userID    uint
+	stored    map[string]string // путь в архиве -> ключ в хранилище
+	assets    map[string]asset  // путь в архиве -> сохранённый файл
+	rejected  map[string]string // путь в архиве -> почему файл не сохранён
+	unpacked  int64             // Сколько байт уже распаковано из пакета
+	report    *ImportReport
+}
+
+func openPackage(r io.ReaderAt, size int64) (*importer, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	im := importer{
+		files:     make(map[string]*zip.File),
+		resources: make(map[string]ManifestResource),
+		stored:    make(map[string]string),
+		assets:    make(map[string]asset),
+		rejected:  make(map[string]string),
+		report:    &ImportReport{Issues: []ImportIssue{}},
+	}
+
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		im.files[path.Clean(f.Name)] = f
+	}
+
+	data, err := im.read(manifestName)
+	if errors.Is(err, errTooLarge) {
+		return nil, err
+	} else if err != nil {
+		return nil, errNoManifest
+	}
+
+	if err := xml.Unmarshal(data, &im.manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	for _, res := range im.manifest.Resources.Resources {
+		im.resources[res.Identifier] = res
+	}
+
+	im.report.Format = detectFormat(&im.manifest)
+
+	return &im, nil
+}
+
+func detectFormat(m *Manifest) string {
+	schema := strings.ToLower(m.Metadata.Schema)
+	version := strings.ToLower(m.Metadata.SchemaVersion)
+
+	switch {
+	case strings.Contains(schema, "common cartridge"):
+		return FormatCommonCartridge
+	case strings.Contains(schema, "scorm") && version == "1.2":
+		return FormatScorm12
+	case strings.Contains(schema, "scorm") && (strings.Contains(version, "2004") || strings.Contains(version, "1.3")):
+		return FormatScorm2004
+	}
+
+	// Манифест без метаданных: определяем по атрибутам ресурсов
+	for _, res := range m.Resources.Resources {
+		if res.ScormType != "" {
+			return FormatScorm2004
+		}
+		if res.ScormType12 != "" {
+			return FormatScorm12
+		}
+	}
+
+	return FormatUnknown
+}
+
+// unpackReader считает распакованные байты и возвращает errTooLarge, когда файл или весь пакет
+// превышают лимит. Размеры в заголовках zip не проверяются: их легко подделать
+type unpackReader struct {
+	im   *importer
+	r    io.Reader
+	read int64
+}
+
+func (u *unpackReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.read += int64(n)
+	u.im.unpacked += int64(n)
+	if u.read > maxFileSize || u.im.unpacked > maxUnpackedSize {
+		return n, errTooLarge
+	}
+	return n, err
+}
+
+// open открывает файл архива для чтения с ограничением распакованного размера
+func (im *importer) open(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	// Лишний байт сверх лимита нужен, чтобы отличить файл ровно в лимит от большего
+	reader := &unpackReader{im: im, r: io.LimitReader(rc, maxFileSize+1)}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, rc}, nil
+}
+
+func (im *importer) read(name string) ([]byte, error) {
+	f, ok := im.files[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found in package", name)
+	}
+
+	rc, err := im.open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+func (im *importer) issue(identifier, title, kind, severity, reason string) {
+	im.report.Issues = append(im.report.Issues, ImportIssue{
+		Identifier: identifier,
+		Title:      title,
+		Type:       kind,
+		Severity:   severity,
+		Reason:     reason,
+	})
+}
+
+// Путь файла ресурса внутри архива с учётом xml:base
+func (im *importer) resourcePath(res *ManifestResource, href string) string {
+	return path.Clean(path.Join(im.manifest.Base, im.manifest.Resources.Base, res.Base, href))
+}
+
+// storeResource сохраняет файлы ресурса и его зависимостей в файловое хранилище.
+// В added попадают пути файлов, сохранённых этим вызовом, в порядке манифеста
+func (im *importer) storeResource(res *ManifestResource, visited map[string]bool, added *[]string) error {
+	if visited[res.Identifier] {
+		return nil
+	}
+	visited[res.Identifier] = true
+
+	for _, file := range res.Files {
+		name := im.resourcePath(res, file.Href)
+		if _, ok := im.stored[name]; ok {
+			continue
+		} else if _, ok := im.rejected[name]; ok {
+			continue
+		}
+
+		f, ok := im.files[name]
+		if !ok {
+			im.issue(res.Identifier, "", res.Type, IssueWarning, fmt.Sprintf("file %s is listed in the manifest but missing from the package", name))
+			continue
+		}
+
+		key, err := files.CleanKey(im.keyPrefix + "/" + name)
+		if err != nil {
+			im.issue(res.Identifier, "", res.Type, IssueWarning, fmt.Sprintf("file %s has an invalid path", name))
+			continue
+		}
+
+		rc, err := im.open(f)
+		if err != nil {
+			return err
+		}
+
+		// Файлы пакета проходят те же проверки типа, что и загрузки вложений
+		mimeType, err := im.sniff(name, rc)
+		if err != nil {
+			rc.Close()
+			if errors.Is(err, errTooLarge) {
+				return err
+			}
+			im.rejected[name] = err.Error()
+			*added = append(*added, name)
+			continue
+		}
+
+		// Начало файла уже прочитано при проверке, поэтому файл открывается заново
+		rc.Close()
+		if rc, err = im.open(f); err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		size, err := files.Store.Put(key, io.TeeReader(rc, hash))
+		rc.Close()
+		if err != nil {
+			return err
+		}
+
+		im.stored[name] = key
+		im.assets[name] = asset{key: key, size: size, sha256: hex.EncodeToString(hash.Sum(nil)), mimeType: mimeType}
+		*added = append(*added, name)
+		im.report.Assets++
+	}
+
+	for _, dep := range res.Dependencies {
+		if depRes, ok := im.resources[dep.IdentifierRef]; ok {
+			if err := im.storeResource(&depRes, visited, added); err != nil {
+				return err
+			}
+		} else {
+			im.issue(dep.IdentifierRef, "", "", IssueWarning, fmt.Sprintf("dependency of %s not found in manifest", res.Identifier))
+		}
+	}
+
+	return nil
+}
+
+// sniff определяет тип файла по расширению и проверяет его по списку типов вложений и по содержимому
+func (im *importer) sniff(name string, r io.Reader) (string, error) {
+	mimeType, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+	if err != nil || !uploads.IsAllowedType(uploads.PurposeAttachment, mimeType) {
+		return "", fmt.Errorf("file %s has a type that is not allowed for attachments", name)
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if err := uploads.VerifyType(mimeType, head[:n]); err != nil {
+		return "", fmt.Errorf("file %s: %s", name, err.Error())
+	}
+
+	return mimeType, nil
+}
+
+// attach делает сохранённые файлы вложениями урока, чтобы они были доступны студентам и не терялись.
+// Файлы, не прошедшие проверку типа, попадают в отчёт как пропущенные
+func (im *importer) attach(courseID, lessonID uint, names []string) error {
+	order := 0
+	for _, name := range names {
+		if reason, ok := im.rejected[name]; ok {
+			im.issue(name, path.Base(name), "", IssueSkipped, reason)
+			continue
+		}
+
+		stored := im.assets[name]
+		filename := path.Base(name)
+
+		now := time.Now()
+		upload := storage.EeUpload{
+			UploadID:    uuid.NewString(),
+			UserID:      im.userID,
+			CourseID:    courseID,
+			LessonID:    &lessonID,
+			Purpose:     uploads.PurposeAttachment,
+			Filename:    filename,
+			MimeType:    stored.mimeType,
+			Size:        stored.size,
+			Received:    stored.size,
+			SHA256:      stored.sha256,
+			BlobKey:     stored.key,
+			Status:      uploads.StatusComplete,
+			CompletedAt: &now,
+		}
+		if err := im.tx.Create(&upload).Error; err != nil {
+			return err
+		}
+
+		attachment := storage.EeAttachment{
+			CourseID: courseID,
+			LessonID: &lessonID,
+			UploadID: upload.UploadID,
+			Title:    filename,
+			Order:    order,
+		}
+		if err := im.tx.Create(&attachment).Error; err != nil {
+			return err
+		}
+		order++
+	}
+
+	return nil
+}
+
+// Удаляет сохранённые файлы, если импорт не удался
+func (im *importer) rollbackFiles() {
+	for _, key := range im.stored {
+		files.Store.Delete(key)
+	}
+}
+
+func (im *importer) organization() (*ManifestOrganization, error) {
+	orgs := im.manifest.Organizations.Organizations
+	if len(orgs) == 0 {
+		return nil, errors.New("package has no organizations")
+	}
+
+	for i := range orgs {
+		if orgs[i].Identifier == im.manifest.Organizations.Default {
+			return &orgs[i], nil
+		}
+	}
+
+	return &orgs[0], nil
+}
+
+// В IMS CC организация содержит один корневой элемент без ресурса, разделы лежат внутри него
+func topLevelItems(org *ManifestOrganization) []ManifestItem {
+	if len(org.Items) == 1 && org.Items[0].IdentifierRef == "" && len(org.Items[0].Items) > 0 {
+		return org.Items[0].Items
+	}
+
+	return org.Items
+}
+
+// Разворачивает вложенные элементы раздела в плоский список уроков
+func flattenItems(items []ManifestItem, prefix string) []ManifestItem {
+	var result []ManifestItem
+	for _, item := range items {
+		title := item.Title
+		if prefix != "" {
+			title = prefix + " / " + title
+		}
+
+		if item.IdentifierRef != "" {
+			leaf := item
+			leaf.Title = title
+			result = append(result, leaf)
+		}
+
+		result = append(result, flattenItems(item.Items, title)...)
+	}
+
+	return result
+}
+
+func (im *importer) importCourse(org *ManifestOrganization, courseID uint) error {
+	im.report.CourseID = courseID
+
+	var sectionCount int64
+	if err := im.tx.Model(&storage.EeCourseSection{}).Where("course_id = ?", courseID).Count(&sectionCount).Error; err != nil {
+		return err
+	}
+
+	for i, item := range topLevelItems(org) {
+		section := storage.EeCourseSection{
+			CourseID: courseID,
+			Title:    item.Title,
+			Order:    int(sectionCount) + i + 1,
+		}
+
+		if err := im.tx.Create(&section).Error; err != nil {
+			return err
+		}
+		im.report.Sections++
+
+		// Элемент верхнего уровня без вложенных - раздел из одного урока
+		lessons := flattenItems(item.Items, "")
+		if item.IdentifierRef != "" {
+			lessons = append([]ManifestItem{item}, lessons...)
+		}
+
+		if len(lessons) == 0 {
+			im.issue(item.Identifier, item.Title, "", IssueWarning, "section has no lessons")
+		}
+
+		for order, lesson := range lessons {
+			if err := im.importLesson(section.SectionID, order+1, &lesson); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func isQti(kind string) bool {
+	return strings.HasPrefix(kind, "imsqti_")
+}
+
+func (im *importer) importLesson(sectionID uint, order int, item *ManifestItem) error {
+	res, ok := im.resources[item.IdentifierRef]
+	if !ok {
+		im.issue(item.Identifier, item.Title, "", IssueSkipped, fmt.Sprintf("resource %s not found in manifest", item.IdentifierRef))
+		return nil
+	}
+
+	lesson := storage.EeLesson{
+		SectionID: sectionID,
+		Title:     item.Title,
+		Order:     order,
+	}
+
+	var questions []storage.EeQuizQuestion
+	var assets []string
+	var text string // HTML урока, становится его первым блоком
+	quizTitle := item.Title
+
+	switch {
+	case isQti(res.Type) && strings.HasSuffix(res.Type, "/assessment"):
+		interop, err := im.readQti(&res)
+		if errors.Is(err, errTooLarge) {
+			return err
+		} else if err != nil {
+			im.issue(item.Identifier, item.Title, res.Type, IssueSkipped, err.Error())
+			return nil
+		}
+
+		if interop.Assessment.Title != "" {
+			quizTitle = interop.Assessment.Title
+		}
+		questions = im.convertQti(interop, &res)
+
+	case strings.HasPrefix(res.Type, "imswl_"):
+		link, err := im.readWebLink(&res)
+		if errors.Is(err, errTooLarge) {
+			return err
+		} else if err != nil {
+			im.issue(item.Identifier, item.Title, res.Type, IssueSkipped, err.Error())
+			return nil
+		}
+		text = fmt.Sprintf("<p><a href=\"%s\">%s</a></p>", html.EscapeString(link.URL.Href), html.EscapeString(link.Title))
+
+	case res.Type == "webcontent" || strings.HasPrefix(res.Type, "associatedcontent/"):
+		if err := im.storeResource(&res, make(map[string]bool), &assets); err != nil {
+			return err
+		}
+
+		entry := res.Href
+		if entry == "" && len(res.Files) > 0 {
+			entry = res.Files[0].Href
+		}
+		entry = im.resourcePath(&res, entry)
+
+		switch strings.ToLower(path.Ext(entry)) {
+		case ".html", ".htm":
+			data, err := im.read(entry)
+			if errors.Is(err, errTooLarge) {
+				return err
+			} else if err != nil {
+				im.issue(item.Identifier, item.Title, res.Type, IssueSkipped, err.Error())
+				return nil
+			}
+
+			// Текст урока из пакета не доверенный: скрипты и обработчики событий вырезаются
+			document, err := render.Render(render.FormatHTML, string(data))
+			if err != nil {
+				return err
+			}
+			text = document.HTML
+
+			// Страница стала текстом урока, вложением остаются только её файлы
+			assets = slices.DeleteFunc(assets, func(name string) bool { return name == entry })
+		default:
+			im.issue(item.Identifier, item.Title, res.Type, IssueWarning, fmt.Sprintf("entry %s is not HTML, attached to the lesson without lesson text", entry))
+		}
+
+		if strings.EqualFold(res.ScormType12, "sco") || strings.EqualFold(res.ScormType, "sco") {
+			im.issue(item.Identifier, item.Title, res.Type, IssueWarning, "SCORM runtime API is not supported, SCO imported as static content")
+		}
+
+	default:
+		im.issue(item.Identifier, item.Title, res.Type, IssueSkipped, "unsupported resource type")
+		return nil
+	}
+
+	if err := im.tx.Create(&lesson).Error; err != nil {
+		return err
+	}
+	im.report.Lessons++
+
+	if text != "" {
+		if err := blocks.AddText(im.tx, lesson.LessonID, blocks.FormatHTML, text); err != nil {
+			return err
+		}
+	}
+
+	if err := im.attach(im.report.CourseID, lesson.LessonID, assets); err != nil {
+		return err
+	}
+
+	if questions == nil {
+		return nil
+	}
+
+	if len(questions) == 0 {
+		im.issue(item.Identifier, item.Title, res.Type, IssueWarning, "assessment has no supported questions, quiz not created")
+		return nil
+	}
+
+	quiz := storage.EeQuiz{
+		LessonID: lesson.LessonID,
+		Title:    quizTitle,
+	}
+
+	if err := im.tx.Create(&quiz).Error; err != nil {
+		return err
+	}
+	im.report.Quizzes++
+
+	for i := range questions {
+		questions[i].QuizID = quiz.QuizID
+	}
+
+	if err := im.tx.Create(&questions).Error; err != nil {
+		return err
+	}
+	im.report.Questions += len(questions)
+
+	return nil
+}
+
+// Первый XML файл ресурса
+func (im *importer) resourceXML(res *ManifestResource) ([]byte, error) {
+	for _, file := range res.Files {
+		if strings.EqualFold(path.Ext(file.Href), ".xml") {
+			return im.read(im.resourcePath(res, file.Href))
+		}
+	}
+
+	if res.Href != "" {
+		return im.read(im.resourcePath(res, res.Href))
+	}
+
+	return nil, errors.New("resource has no XML file")
+}
+
+func (im *importer) readWebLink(res *ManifestResource) (*WebLink, error) {
+	data, err := im.resourceXML(res)
+	if err != nil {
+		return nil, err
+	}
+
+	var link WebLink
+	if err := xml.Unmarshal(data, &link); err != nil {
+		return nil, fmt.Errorf("invalid web link: %w", err)
+	}
+
+	if link.URL.Href == "" {
+		return nil, errors.New("web link has no url")
+	}
+
+	return &link, nil
+}
+
+func (im *importer) readQti(res *ManifestResource) (*QtiInterop, error) {
+	data, err := im.resourceXML(res)
+	if err != nil {
+		return nil, err
+	}
+
+	var interop QtiInterop
+	if err := xml.Unmarshal(data, &interop); err != nil {
+		return nil, fmt.Errorf("invalid QTI document: %w", err)
+	}
+
+	return &interop, nil
+}
+
+func collectQtiItems(sections []QtiSection) []QtiItem {
+	var items []QtiItem
+	for _, section := range sections {
+		items = append(items, section.Items...)
+		items = append(items, collectQtiItems(section.Sections)...)
+	}
+
+	return items
+}
+
+func (item *QtiItem) profile() string {
+	for _, field := range item.ProfileFields {
+		if field.Label == "cc_profile" {
+			return strings.TrimSpace(field.Entry)
+		}
+	}
+
+	return ""
+}
+
+// Значения ответа, за которые начисляются баллы
+func (item *QtiItem) correctValues() []string {
+	var values []string
+	for _, cond := range item.Conditions {
+		scored := false
+		for _, setvar := range cond.SetVars {
+			score, err := strconv.ParseFloat(strings.TrimSpace(setvar.Value), 64)
+			if err == nil && score > 0 && !strings.EqualFold(setvar.Action, "Subtract") {
+				scored = true
+			}
+		}
+
+		if !scored {
+			continue
+		}
+
+		for _, eq := range append(cond.Equals, cond.Ors...) {
+			values = append(values, strings.TrimSpace(eq.Value))
+		}
+	}
+
+	return values
+}
+
+// convertQti переносит вопросы QTI 1.2: вопросы с вариантами становятся single_choice или multiple_choice,
+// остальные - short_text со всеми принимаемыми ответами
+func (im *importer) convertQti(interop *QtiInterop, res *ManifestResource) []storage.EeQuizQuestion {
+	items := append(collectQtiItems(interop.Assessment.Sections), interop.Items...)
+	list := []storage.EeQuizQuestion{}
+
+	for _, item := range items {
+		text := strings.TrimSpace(strings.Join(item.Presentation.Texts, "\n"))
+		if text == "" {
+			im.issue(item.Ident, item.Title, item.profile(), IssueSkipped, "question has no text")
+			continue
+		}
+
+		values := item.correctValues()
+		if len(values) == 0 {
+			im.issue(item.Ident, item.Title, item.profile(), IssueSkipped, "question has no automatically gradable answer")
+			continue
+		}
+
+		// Варианты ответа в порядке пакета
+		var choices []questions.Choice
+		for _, response := range item.Presentation.Responses {
+			for _, label := range response.Labels {
+				choices = append(choices, questions.Choice{ID: label.Ident, Text: strings.TrimSpace(strings.Join(label.Texts, " "))})
+			}
+		}
+
+		var kind string
+		var options interface{}
+		switch {
+		case len(choices) == 0:
+			kind, options = questions.ShortText, questions.ShortTextOptions{TextAnswer: questions.TextAnswer{Variants: values}}
+		case len(values) == 1:
+			kind, options = questions.SingleChoice, questions.SingleChoiceOptions{Choices: choices, Correct: values[0]}
+		default:
+			kind, options = questions.MultipleChoice, questions.MultipleChoiceOptions{Choices: choices, Correct: values}
+		}
+
+		raw, err := json.Marshal(options)
+		if err == nil {
+			_, err = questions.Parse(kind, text, raw)
+		}
+		if err != nil {
+			im.issue(item.Ident, item.Title, item.profile(), IssueSkipped, err.Error())
+			continue
+		}
+
+		list = append(list, storage.EeQuizQuestion{
+			Type:         kind,
+			QuestionText: text,
+			Options:      raw,
+			Points:       1,
+		})
+	}
+
+	return list
+}
+
+func importPackage(c *fiber.Ctx) error {
+	header, err := c.FormFile("package")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "package file is required"})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot read package"})
+	}
+	defer file.Close()
+
+	im, err := openPackage(file, header.Size)
+	if errors.Is(err, errTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid package: %s", err.Error())})
+	}
+
+	var course storage.EeCourse
+	if courseParam := c.FormValue("course_id"); courseParam != "" {
+		// Импорт в существующий курс
+		courseID, err := strconv.ParseUint(courseParam, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+		}
+
+		if err := storage.DB.Where("course_id = ?", courseID).First(&course).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	// Пакет без организаций нечего импортировать, это ошибка пакета, а не сервера
+	org, err := im.organization()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid package: %s", err.Error())})
+	}
+
+	userID := middleware.UserID(c)
+	im.userID = userID
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		im.tx = tx
+
+		if course.CourseID == 0 {
+			course.Title = org.Title
+			if course.Title == "" {
+				course.Title = im.manifest.Metadata.Title
+			}
+			if course.Title == "" {
+				course.Title = strings.TrimSuffix(header.Filename, path.Ext(header.Filename))
+			}
+			course.InstructorID = userID
+
+			if err := tx.Create(&course).Error; err != nil {
+				return err
+			}
+
+			if err := enrollments.EnrollAuthor(tx, userID, course.CourseID); err != nil {
+				return err
+			}
+		}
+
+		im.keyPrefix = fmt.Sprintf("courses/%d/imports/%s", course.CourseID, time.Now().Format("20060102150405"))
+
+		return im.importCourse(org, course.CourseID)
+	})
+
+	if err != nil {
+		im.rollbackFiles()
+		if errors.Is(err, errTooLarge) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("import failed: %s", err.Error())})
+	}
+
+	return c.JSON(im.report)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/imports", middleware.TokenRequired, middleware.AdminRequired)
+	{
+		g.Post("/", importPackage)
+	}
+}
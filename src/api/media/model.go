@@ -0,0 +1,37 @@
+package media
+
+import "time"
+
+// Политики скачивания медиафайлов курса, персонал курса может скачивать всегда
+const (
+	PolicyAllow      = "allow"       // Любые файлы можно скачать
+	PolicyStreamOnly = "stream_only" // Видео только просматривается, остальные файлы скачиваются
+	PolicyNone       = "none"        // Все файлы только просматриваются в браузере
+)
+
+var policies = map[string]bool{
+	PolicyAllow:      true,
+	PolicyStreamOnly: true,
+	PolicyNone:       true,
+}
+
+const (
+	ActionIssue   = "issue"
+	ActionStream  = "stream"
+	ActionArchive = "archive"
+)
+
+var (
+	secret []byte
+	ttl    time.Duration
+)
+
+type SignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Download  bool      `json:"download"`
+}
+
+type PolicyInfo struct {
+	Policy string `json:"media_download_policy"`
+}
@@ -0,0 +1,336 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/config"
+	"ekb-edu/src/database/files"
+	"ekb-edu/src/database/storage"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func Initialize(cfg *config.Media, jwtSecret string) {
+	secret = []byte(cfg.Secret)
+	if cfg.Secret == "" {
+		mac := hmac.New(sha256.New, []byte(jwtSecret))
+		mac.Write([]byte("ekb-edu media urls"))
+		secret = mac.Sum(nil)
+	}
+
+	ttl = cfg.URLTTL
+}
+
+func IsValidPolicy(policy string) bool {
+	return policies[policy]
+}
+
+func signature(uploadID string, userID uint, expires int64, download bool) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%d\n%d\n%t", uploadID, userID, expires, download)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Sign выдаёт ссылку на файл, которая действует ограниченное время и только для этого пользователя
+func Sign(uploadID string, userID uint, download bool) SignedURL {
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("user", strconv.FormatUint(uint64(userID), 10))
+	if download {
+		query.Set("download", "1")
+	}
+	query.Set("sig", signature(uploadID, userID, expiresAt.Unix(), download))
+
+	return SignedURL{
+		URL:       "/v1/media/" + url.PathEscape(uploadID) + "?" + query.Encode(),
+		ExpiresAt: expiresAt,
+		Download:  download,
+	}
+}
+
+// CanDownload проверяет политику скачивания курса, просмотр разрешён всегда
+func CanDownload(c *fiber.Ctx, upload *storage.EeUpload) (bool, error) {
+	if upload.Purpose == "submission" {
+		return true, nil
+	} else if staff, err := enrollments.CanManage(c, upload.CourseID); err != nil || staff {
+		return staff, err
+	}
+
+	var course storage.EeCourse
+	if err := storage.DB.Select("media_download_policy").Where("course_id = ?", upload.CourseID).First(&course).Error; err != nil {
+		return false, err
+	}
+
+	switch course.MediaPolicy {
+	case PolicyAllow:
+		return true, nil
+	case PolicyStreamOnly:
+		return upload.Purpose != "video", nil
+	}
+
+	return false, nil
+}
+
+// Record пишет обращение к файлу в журнал доступа
+func Record(c *fiber.Ctx, entry storage.EeMediaAccessLog) {
+	entry.IP = c.IP()
+	entry.UserAgent = c.Get(fiber.HeaderUserAgent)
+	if len(entry.UserAgent) > 512 {
+		entry.UserAgent = entry.UserAgent[:512]
+	}
+
+	// Журнал не должен задерживать отдачу файла
+	go func() {
+		if err := storage.DB.Create(&entry).Error; err != nil {
+			log.Printf("cannot write media access log: %s", err)
+		}
+	}()
+}
+
+// Issue проверяет доступ пользователя к файлу и выдаёт подписанную ссылку.
+// Если доступа нет, ответ уже отправлен и возвращается false
+func Issue(c *fiber.Ctx, upload *storage.EeUpload, download bool) (SignedURL, bool, error) {
+	if ok, err := enrollments.CanAccess(c, upload.CourseID); err != nil {
+		return SignedURL{}, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return SignedURL{}, false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	// Ответ на задание видят только его автор и преподаватели
+	if upload.Purpose == "submission" && upload.UserID != middleware.UserID(c) {
+		if staff, err := enrollments.CanManage(c, upload.CourseID); err != nil {
+			return SignedURL{}, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if !staff {
+			return SignedURL{}, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+		}
+	}
+
+	if upload.LessonID != nil {
+		status, err := availability.ForLessonID(c, *upload.LessonID)
+		if err != nil {
+			return SignedURL{}, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if status.Locked {
+			return SignedURL{}, false, availability.Deny(c, status)
+		}
+	}
+
+	if download {
+		allowed, err := CanDownload(c, upload)
+		if err != nil {
+			return SignedURL{}, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		} else if !allowed {
+			return SignedURL{}, false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "downloading this file is not allowed by the course policy"})
+		}
+	}
+
+	userID := middleware.UserID(c)
+	signed := Sign(upload.UploadID, userID, download)
+	Record(c, storage.EeMediaAccessLog{
+		UploadID: &upload.UploadID,
+		CourseID: upload.CourseID,
+		UserID:   &userID,
+		Action:   ActionIssue,
+		Download: download,
+		Status:   fiber.StatusOK,
+	})
+
+	return signed, true, nil
+}
+
+func completedUpload(c *fiber.Ctx, upload *storage.EeUpload) (bool, error) {
+	err := storage.DB.Where("upload_id = ? AND status = ?", c.Params("id"), "complete").First(upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+	} else if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return true, nil
+}
+
+func issueURL(c *fiber.Ctx) error {
+	var upload storage.EeUpload
+	if ok, err := completedUpload(c, &upload); !ok {
+		return err
+	}
+
+	signed, ok, err := Issue(c, &upload, c.QueryBool("download"))
+	if !ok {
+		return err
+	}
+
+	return c.JSON(&signed)
+}
+
+// stream отдаёт файл по подписанной ссылке с поддержкой Range, чтобы в видео работала перемотка
+func stream(c *fiber.Ctx) error {
+	uploadID := c.Params("id")
+	expires, expiresErr := strconv.ParseInt(c.Query("expires"), 10, 64)
+	userID, userErr := strconv.ParseUint(c.Query("user"), 10, 32)
+	download := c.Query("download") == "1"
+
+	expected := signature(uploadID, uint(userID), expires, download)
+	if expiresErr != nil || userErr != nil || !hmac.Equal([]byte(expected), []byte(c.Query("sig"))) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "invalid media link"})
+	}
+
+	remaining := time.Until(time.Unix(expires, 0))
+	if remaining <= 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "media link has expired"})
+	}
+
+	var upload storage.EeUpload
+	if ok, err := completedUpload(c, &upload); !ok {
+		return err
+	}
+
+	etag := `"` + upload.SHA256 + `"`
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+
+	c.Set(fiber.HeaderContentType, upload.MimeType)
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType(disposition, map[string]string{"filename": upload.Filename}))
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", int(remaining.Seconds())))
+
+	entry := storage.EeMediaAccessLog{
+		UploadID: &upload.UploadID,
+		CourseID: upload.CourseID,
+		Action:   ActionStream,
+		Download: download,
+	}
+	uid := uint(userID)
+	entry.UserID = &uid
+
+	// Range игнорируется, если файл изменился (If-Range) или запрошено несколько диапазонов
+	start, length := int64(0), upload.Size
+	if c.Get(fiber.HeaderRange) != "" && (c.Get(fiber.HeaderIfRange) == "" || c.Get(fiber.HeaderIfRange) == etag) {
+		ranges, err := c.Range(int(upload.Size))
+		if errors.Is(err, fiber.ErrRangeUnsatisfiable) {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", upload.Size))
+			entry.Status = fiber.StatusRequestedRangeNotSatisfiable
+			Record(c, entry)
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+		}
+
+		if err == nil && ranges.Type == "bytes" && len(ranges.Ranges) == 1 {
+			start = int64(ranges.Ranges[0].Start)
+			length = int64(ranges.Ranges[0].End) - start + 1
+
+			c.Status(fiber.StatusPartialContent)
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, upload.Size))
+		}
+	}
+
+	if c.Method() == fiber.MethodHead {
+		c.Response().Header.SetContentLength(int(length))
+		return nil
+	}
+
+	reader, err := files.Store.OpenRange(upload.BlobKey, start, length)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("cannot open file: %s", err.Error())})
+	}
+
+	rangeEnd := start + length - 1
+	entry.RangeStart = &start
+	entry.RangeEnd = &rangeEnd
+	entry.Status = c.Response().StatusCode()
+	Record(c, entry)
+
+	return c.SendStream(reader, int(length))
+}
+
+func GetAccessLog(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	if ok, err := enrollments.CanManage(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	query := storage.DB.Where("course_id = ?", courseID)
+	if uploadID := c.Query("upload_id"); uploadID != "" {
+		query = query.Where("upload_id = ?", uploadID)
+	}
+	if userID := c.QueryInt("user_id"); userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	entries := []storage.EeMediaAccessLog{}
+	if err := query.Order("created_at DESC, log_id DESC").Limit(limit).Offset(c.QueryInt("offset")).Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(entries)
+}
+
+func SetPolicy(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	if ok, err := enrollments.CanManage(c, uint(courseID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	info := PolicyInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse media policy"})
+	}
+
+	if !IsValidPolicy(info.Policy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("unknown media download policy %q", info.Policy)})
+	}
+
+	result := storage.DB.Model(&storage.EeCourse{}).Where("course_id = ?", courseID).Update("media_download_policy", info.Policy)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	} else if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	}
+
+	return c.JSON(&info)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/media")
+	{
+		// Ссылка сама является пропуском, поэтому её можно вставить в <video src>
+		g.Get("/:id", stream)
+		g.Get("/:id/url", middleware.TokenRequired, issueURL)
+	}
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"ekb-edu/src/database/config"
+	"strings"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
@@ -18,6 +19,13 @@ func hasClaim(c *fiber.Ctx, claim string) bool {
 	return claims[claim].(bool)
 }
 
+// UserID возвращает идентификатор пользователя из токена
+func UserID(c *fiber.Ctx) uint {
+	user := c.Locals("user").(*jwt.Token)
+	claims := user.Claims.(jwt.MapClaims)
+	return uint(claims["id"].(float64))
+}
+
 func IsAdmin(c *fiber.Ctx) bool {
 	return hasClaim(c, "admin")
 }
@@ -30,6 +38,24 @@ func AdminRequired(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// BodyLimit отклоняет запросы с телом больше limit. Маршрутам с префиксами из large
+// разрешено тело до общего лимита сервера
+func BodyLimit(limit int, large ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, prefix := range large {
+			if c.Path() == prefix || strings.HasPrefix(c.Path(), prefix+"/") {
+				return c.Next()
+			}
+		}
+
+		if c.Request().Header.ContentLength() > limit || len(c.Request().Body()) > limit {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "request body is too large"})
+		}
+
+		return c.Next()
+	}
+}
+
 func InitializeJWT(cfg *config.Jwt) {
 	JwtSecret = cfg.Secret
 
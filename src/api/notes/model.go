@@ -0,0 +1,54 @@
+package notes
+
+import (
+	"ekb-edu/src/database/storage"
+	"time"
+)
+
+const (
+	AnchorNone  = "none"
+	AnchorText  = "text"
+	AnchorVideo = "video"
+)
+
+const (
+	maxBodyRunes  = 20000
+	maxQuoteRunes = 1000
+	searchLimit   = 50
+)
+
+type NoteInfo struct {
+	Body        string   `json:"body"`
+	AnchorType  string   `json:"anchor_type"` // Пусто - none
+	BlockID     *uint    `json:"block_id"`
+	AnchorStart *int     `json:"anchor_start"`
+	AnchorEnd   *int     `json:"anchor_end"`
+	AnchorQuote string   `json:"anchor_quote"`
+	VideoTime   *float64 `json:"video_time"`
+}
+
+// NoteWithLesson - заметка в списке по курсу или в результатах поиска
+type NoteWithLesson struct {
+	storage.EeNote
+	LessonTitle  string  `json:"lesson_title"`
+	SectionID    uint    `json:"section_id"`
+	SectionTitle string  `json:"section_title"`
+	CourseID     uint    `json:"course_id"`
+	Headline     string  `json:"headline,omitempty"` // Фрагмент с подсвеченными словами, только в поиске
+	Rank         float64 `json:"rank,omitempty"`
+}
+
+type BookmarkWithLesson struct {
+	LessonID     uint      `json:"lesson_id"`
+	LessonTitle  string    `json:"lesson_title"`
+	SectionID    uint      `json:"section_id"`
+	SectionTitle string    `json:"section_title"`
+	CourseID     uint      `json:"course_id"`
+	CourseTitle  string    `json:"course_title"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type CourseNotes struct {
+	Notes     []NoteWithLesson     `json:"notes"`
+	Bookmarks []BookmarkWithLesson `json:"bookmarks"`
+}
@@ -0,0 +1,403 @@
+package notes
+
+import (
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func lessonCourse(c *fiber.Ctx) (uint, uint, error) {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return 0, 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+	}
+
+	return uint(lessonID), courseID, nil
+}
+
+// canRead пускает к заметкам урока только тех, кому открыт сам урок
+func canRead(c *fiber.Ctx, courseID, lessonID uint) (bool, error) {
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, lessonID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return false, availability.Deny(c, status)
+	}
+
+	return true, nil
+}
+
+// apply проверяет данные заметки и переносит их в запись
+func apply(info *NoteInfo, note *storage.EeNote) error {
+	note.Body = strings.TrimSpace(info.Body)
+	if note.Body == "" {
+		return errors.New("note body is required")
+	} else if len([]rune(note.Body)) > maxBodyRunes {
+		return fmt.Errorf("note is longer than %d characters", maxBodyRunes)
+	}
+
+	note.AnchorType = info.AnchorType
+	note.BlockID, note.AnchorStart, note.AnchorEnd, note.AnchorQuote, note.VideoTime = nil, nil, nil, "", nil
+
+	switch info.AnchorType {
+	case "", AnchorNone:
+		note.AnchorType = AnchorNone
+
+	case AnchorText:
+		if info.AnchorStart == nil || info.AnchorEnd == nil || *info.AnchorStart < 0 || *info.AnchorEnd < *info.AnchorStart {
+			return errors.New("text anchor needs anchor_start and anchor_end with 0 <= anchor_start <= anchor_end")
+		}
+		if len([]rune(info.AnchorQuote)) > maxQuoteRunes {
+			return fmt.Errorf("anchor_quote is longer than %d characters", maxQuoteRunes)
+		}
+
+		if info.BlockID != nil {
+			var count int64
+			if err := storage.DB.Model(&storage.EeLessonBlock{}).Where("block_id = ? AND lesson_id = ?", *info.BlockID, note.LessonID).Count(&count).Error; err != nil {
+				return err
+			} else if count == 0 {
+				return fmt.Errorf("block %d does not belong to the lesson", *info.BlockID)
+			}
+		}
+
+		note.BlockID, note.AnchorStart, note.AnchorEnd, note.AnchorQuote = info.BlockID, info.AnchorStart, info.AnchorEnd, info.AnchorQuote
+
+	case AnchorVideo:
+		if info.VideoTime == nil || *info.VideoTime < 0 || math.IsNaN(*info.VideoTime) || math.IsInf(*info.VideoTime, 0) {
+			return errors.New("video anchor needs a non-negative video_time")
+		}
+
+		var video storage.EeVideo
+		if err := storage.DB.Where("lesson_id = ?", note.LessonID).First(&video).Error; err != nil {
+			return errors.New("lesson has no video")
+		}
+		if video.Duration != nil && *info.VideoTime > float64(*video.Duration) {
+			return fmt.Errorf("video_time is past the end of the video (%d seconds)", *video.Duration)
+		}
+
+		note.VideoTime = info.VideoTime
+
+	default:
+		return fmt.Errorf("unknown anchor type %q", info.AnchorType)
+	}
+
+	return nil
+}
+
+// find загружает заметку текущего пользователя. Чужие заметки для него не существуют
+func find(c *fiber.Ctx, note *storage.EeNote) (bool, error) {
+	err := storage.DB.Where("note_id = ? AND user_id = ?", c.Params("id"), middleware.UserID(c)).First(note).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "note not found"})
+	} else if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return true, nil
+}
+
+// anchorOrder - порядок заметок внутри урока: по месту в тексте, затем по времени видео
+const anchorOrder = "ee_notes.block_id NULLS FIRST, ee_notes.anchor_start NULLS LAST, ee_notes.video_time NULLS LAST, ee_notes.note_id"
+
+func GetLessonNotes(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, lessonID); !ok {
+		return err
+	}
+
+	notes := []storage.EeNote{}
+	if err := storage.DB.Where("lesson_id = ? AND user_id = ?", lessonID, middleware.UserID(c)).Order(anchorOrder).Find(&notes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(notes)
+}
+
+func CreateLessonNote(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := canRead(c, courseID, lessonID); !ok {
+		return err
+	}
+
+	info := NoteInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse note data"})
+	}
+
+	note := storage.EeNote{UserID: middleware.UserID(c), LessonID: lessonID}
+	if err := apply(&info, &note); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := storage.DB.Create(&note).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(&note)
+}
+
+// updateNote заменяет текст и привязку заметки целиком
+func updateNote(c *fiber.Ctx) error {
+	var note storage.EeNote
+	if ok, err := find(c, &note); !ok {
+		return err
+	}
+
+	info := NoteInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse note data"})
+	}
+
+	if err := apply(&info, &note); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := storage.DB.Save(&note).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&note)
+}
+
+func deleteNote(c *fiber.Ctx) error {
+	var note storage.EeNote
+	if ok, err := find(c, &note); !ok {
+		return err
+	}
+
+	if err := storage.DB.Delete(&note).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func withLesson(query *gorm.DB) *gorm.DB {
+	return query.
+		Joins("JOIN ee_lessons ON ee_lessons.lesson_id = ee_notes.lesson_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id")
+}
+
+// searchNotes ищет по заметкам текущего пользователя, при ?course_id - только в одном курсе
+func searchNotes(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "search query is required"})
+	}
+
+	query := withLesson(storage.DB.Table("ee_notes")).
+		Joins("CROSS JOIN websearch_to_tsquery('russian', ?) AS query", q).
+		Select(`ee_notes.*, ee_lessons.title AS lesson_title, ee_course_sections.section_id, ee_course_sections.title AS section_title, ee_course_sections.course_id,
+			ts_headline('russian', ee_notes.body, query, 'StartSel=**, StopSel=**, MaxFragments=2') AS headline,
+			ts_rank(ee_notes.search, query) AS rank`).
+		Where("ee_notes.user_id = ? AND ee_notes.search @@ query", middleware.UserID(c))
+
+	if courseID := c.QueryInt("course_id"); courseID != 0 {
+		query = query.Where("ee_course_sections.course_id = ?", courseID)
+	}
+
+	found := []NoteWithLesson{}
+	if err := query.Order("rank DESC, ee_notes.note_id DESC").Limit(searchLimit).Scan(&found).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(found)
+}
+
+// courseNotes возвращает заметки и закладки пользователя в курсе в порядке уроков
+func courseNotes(userID, courseID uint) (*CourseNotes, error) {
+	result := &CourseNotes{Notes: []NoteWithLesson{}, Bookmarks: []BookmarkWithLesson{}}
+
+	err := withLesson(storage.DB.Table("ee_notes")).
+		Select("ee_notes.*, ee_lessons.title AS lesson_title, ee_course_sections.section_id, ee_course_sections.title AS section_title, ee_course_sections.course_id").
+		Where("ee_notes.user_id = ? AND ee_course_sections.course_id = ?", userID, courseID).
+		Order(`ee_course_sections."order", ee_lessons."order", ` + anchorOrder).
+		Scan(&result.Notes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = bookmarks(userID).
+		Where("ee_course_sections.course_id = ?", courseID).
+		Order(`ee_course_sections."order", ee_lessons."order"`).
+		Scan(&result.Bookmarks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func GetCourseNotes(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	result, err := courseNotes(middleware.UserID(c), uint(courseID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(result)
+}
+
+// timestamp форматирует момент видео как 1:02:03 или 2:03
+func timestamp(seconds float64) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+// markdown собирает заметки курса в один документ с разделами и уроками в качестве заголовков
+func markdown(course *storage.EeCourse, notes *CourseNotes) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# %s\n\n", course.Title)
+	fmt.Fprintf(&out, "Exported %s\n", time.Now().Format("2006-01-02 15:04"))
+
+	if len(notes.Bookmarks) > 0 {
+		out.WriteString("\n## Bookmarks\n\n")
+		for _, bookmark := range notes.Bookmarks {
+			fmt.Fprintf(&out, "- %s / %s\n", bookmark.SectionTitle, bookmark.LessonTitle)
+		}
+	}
+
+	var section, lesson uint
+	for _, note := range notes.Notes {
+		if note.SectionID != section {
+			section = note.SectionID
+			fmt.Fprintf(&out, "\n## %s\n", note.SectionTitle)
+		}
+		if note.LessonID != lesson {
+			lesson = note.LessonID
+			fmt.Fprintf(&out, "\n### %s\n", note.LessonTitle)
+		}
+
+		out.WriteString("\n")
+		switch note.AnchorType {
+		case AnchorText:
+			if note.AnchorQuote != "" {
+				out.WriteString("> " + strings.ReplaceAll(note.AnchorQuote, "\n", "\n> ") + "\n\n")
+			}
+		case AnchorVideo:
+			fmt.Fprintf(&out, "**[%s]** ", timestamp(*note.VideoTime))
+		}
+		out.WriteString(note.Body + "\n")
+	}
+
+	return out.String()
+}
+
+// ExportCourseNotes отдаёт заметки и закладки пользователя в курсе файлом Markdown
+func ExportCourseNotes(c *fiber.Ctx) error {
+	var course storage.EeCourse
+	if err := storage.DB.Where("course_id = ?", c.Params("id")).First(&course).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	}
+
+	notes, err := courseNotes(middleware.UserID(c), course.CourseID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/markdown; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": fmt.Sprintf("course-%d-notes.md", course.CourseID)}))
+	return c.SendString(markdown(&course, notes))
+}
+
+func bookmarks(userID uint) *gorm.DB {
+	return storage.DB.Table("ee_bookmarks").
+		Select("ee_bookmarks.lesson_id, ee_bookmarks.created_at, ee_lessons.title AS lesson_title, ee_course_sections.section_id, ee_course_sections.title AS section_title, ee_courses.course_id, ee_courses.title AS course_title").
+		Joins("JOIN ee_lessons ON ee_lessons.lesson_id = ee_bookmarks.lesson_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+		Joins("JOIN ee_courses ON ee_courses.course_id = ee_course_sections.course_id").
+		Where("ee_bookmarks.user_id = ?", userID)
+}
+
+func getBookmarks(c *fiber.Ctx) error {
+	result := []BookmarkWithLesson{}
+	if err := bookmarks(middleware.UserID(c)).Order("ee_bookmarks.created_at DESC").Scan(&result).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(result)
+}
+
+// AddBookmark добавляет урок в закладки, повторный вызов ничего не меняет
+func AddBookmark(c *fiber.Ctx) error {
+	lessonID, courseID, err := lessonCourse(c)
+	if lessonID == 0 {
+		return err
+	}
+
+	if ok, err := enrollments.CanAccess(c, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	bookmark := storage.EeBookmark{UserID: middleware.UserID(c), LessonID: lessonID}
+	if err := storage.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&bookmark).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func RemoveBookmark(c *fiber.Ctx) error {
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	if err := storage.DB.Where("user_id = ? AND lesson_id = ?", middleware.UserID(c), lessonID).Delete(&storage.EeBookmark{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/notes", middleware.TokenRequired)
+	{
+		g.Get("/search", searchNotes)
+		g.Put("/:id", updateNote)
+		g.Delete("/:id", deleteNote)
+	}
+
+	app.Get("/bookmarks", middleware.TokenRequired, getBookmarks)
+}
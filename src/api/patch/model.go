@@ -0,0 +1,22 @@
+package patch
+
+import (
+	"encoding/json"
+)
+
+// Field - правило для поля, которое можно менять через PATCH
+type Field struct {
+	Column   string                  // Пусто - служебное поле запроса, в базу не пишется
+	Required bool                    // null недопустим
+	Merge    bool                    // JSON-объект, объединяется с текущим значением по RFC 7396
+	Check    func(interface{}) error // Проверка нового значения, null не проверяется
+}
+
+// Resource - разрешённые поля ресурса по имени в JSON. Остальные поля менять нельзя
+type Resource map[string]Field
+
+// Patch - разобранный JSON Merge Patch
+type Patch struct {
+	values map[string]interface{}
+	merges map[string]json.RawMessage
+}
@@ -0,0 +1,212 @@
+package patch
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"reflect"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// jsonField находит тип поля модели по его имени в JSON
+func jsonField(model interface{}, name string) (reflect.Type, bool) {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == name {
+			return field.Type, true
+		}
+	}
+
+	return nil, false
+}
+
+// decode проверяет и преобразует одно значение патча
+func decode(model interface{}, name string, field Field, raw json.RawMessage) (interface{}, error) {
+	fieldType, ok := jsonField(model, name)
+	if !ok {
+		return nil, fmt.Errorf("field %q cannot be changed", name)
+	}
+
+	if string(raw) == "null" {
+		if field.Required {
+			return nil, fmt.Errorf("field %q cannot be null", name)
+		} else if fieldType.Kind() == reflect.Pointer || field.Merge {
+			return nil, nil
+		}
+		return reflect.Zero(fieldType).Interface(), nil
+	}
+
+	value := reflect.New(fieldType)
+	if err := json.Unmarshal(raw, value.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid value for %q", name)
+	}
+
+	result := value.Elem().Interface()
+	if field.Check != nil {
+		if err := field.Check(result); err != nil {
+			return nil, fmt.Errorf("invalid value for %q: %w", name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// Parse разбирает тело запроса как JSON Merge Patch (RFC 7396) и проверяет его по списку разрешённых полей.
+// При ошибке отвечает клиенту и возвращает nil
+func Parse(c *fiber.Ctx, model interface{}, resource Resource) (*Patch, error) {
+	contentType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if contentType != "application/merge-patch+json" && contentType != fiber.MIMEApplicationJSON {
+		return nil, c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "expected application/merge-patch+json body"})
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil || body == nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "patch must be a JSON object"})
+	}
+
+	result := &Patch{values: map[string]interface{}{}, merges: map[string]json.RawMessage{}}
+	for name, raw := range body {
+		field, ok := resource[name]
+		if !ok {
+			return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("field %q cannot be changed", name)})
+		} else if field.Column == "" {
+			continue
+		}
+
+		if field.Merge && strings.HasPrefix(strings.TrimSpace(string(raw)), "{") {
+			result.merges[field.Column] = raw
+			continue
+		}
+
+		value, err := decode(model, name, field, raw)
+		if err != nil {
+			return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		result.values[field.Column] = value
+	}
+
+	return result, nil
+}
+
+// Has сообщает, меняет ли патч колонку
+func (p *Patch) Has(column string) bool {
+	_, value := p.values[column]
+	_, merge := p.merges[column]
+	return value || merge
+}
+
+// Apply записывает патч в строку key = id. Если строки нет, возвращает gorm.ErrRecordNotFound
+func (p *Patch) Apply(tx *gorm.DB, model interface{}, key string, id uint) error {
+	values := maps.Clone(p.values)
+	for column, raw := range p.merges {
+		var current sql.NullString
+		err := tx.Model(model).Select(column).Where(key+" = ?", id).Row().Scan(&current)
+		if errors.Is(err, sql.ErrNoRows) {
+			return gorm.ErrRecordNotFound
+		} else if err != nil {
+			return err
+		}
+
+		merged, err := Merge([]byte(current.String), raw)
+		if err != nil {
+			return err
+		}
+		values[column] = string(merged)
+	}
+
+	if len(values) == 0 {
+		var count int64
+		if err := tx.Model(model).Where(key+" = ?", id).Count(&count).Error; err != nil {
+			return err
+		} else if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	}
+
+	result := tx.Model(model).Where(key+" = ?", id).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Merge применяет JSON Merge Patch к документу. Некорректный или пустой документ считается пустым
+func Merge(target, patch []byte) ([]byte, error) {
+	var patchValue, targetValue interface{}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	if len(target) > 0 {
+		_ = json.Unmarshal(target, &targetValue)
+	}
+
+	return json.Marshal(mergeValue(targetValue, patchValue))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergeValue(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
+
+// NotBlank запрещает пустые строки
+func NotBlank(value interface{}) error {
+	if s, ok := value.(string); ok && strings.TrimSpace(s) == "" {
+		return errors.New("value cannot be empty")
+	}
+
+	return nil
+}
+
+// NotNegative запрещает отрицательные числа
+func NotNegative(value interface{}) error {
+	if n, ok := value.(int); ok && n < 0 {
+		return errors.New("value cannot be negative")
+	}
+
+	return nil
+}
+
+// OneOf пропускает только строки, которые принимает valid
+func OneOf(valid func(string) bool) func(interface{}) error {
+	return func(value interface{}) error {
+		if s, ok := value.(string); ok && !valid(s) {
+			return fmt.Errorf("unknown value %q", s)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,47 @@
+package progress
+
+import "time"
+
+// Какая попытка теста идёт в оценку
+const (
+	ScoreHighest = "highest"
+	ScoreLatest  = "latest"
+	ScoreAverage = "average"
+)
+
+type MarkRequest struct {
+	Completed *bool `json:"completed"` // Без поля урок только отмечается как просмотренный
+}
+
+type CompletionRules struct {
+	RequiresLessons *bool `json:"completion_requires_lessons"`
+	RequiresQuizzes *bool `json:"completion_requires_quizzes"`
+	QuizPassPercent *int  `json:"quiz_pass_percent"`
+}
+
+// CourseProgress - сводный прогресс пользователя по курсу
+type CourseProgress struct {
+	CourseID         uint       `json:"course_id"`
+	CourseTitle      string     `json:"course_title,omitempty"`
+	Lessons          int64      `json:"lessons"`
+	LessonsStarted   int64      `json:"lessons_started"`
+	LessonsCompleted int64      `json:"lessons_completed"`
+	Quizzes          int64      `json:"quizzes"`
+	QuizzesPassed    int64      `json:"quizzes_passed"`
+	Percent          float64    `json:"percent"` // Доля выполненных требований правил завершения, 0-100
+	Completed        bool       `json:"completed"`
+	CompletedAt      *time.Time `json:"completed_at"`
+}
+
+type UserProgress struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	CourseProgress
+}
+
+type quizResult struct {
+	QuizID    uint
+	Score     float64 // Доля набранных баллов по правилу теста, от 0 до 1
+	Attempted bool    // Есть сданная попытка, без неё тест не пройден даже при пороге 0
+}
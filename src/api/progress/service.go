@@ -0,0 +1,456 @@
+package progress
+
+import (
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Touch отмечает просмотр урока: при первом открытии фиксирует начало, далее обновляет last_seen_at
+func Touch(userID, lessonID uint) error {
+	now := time.Now()
+	record := storage.EeLessonProgress{UserID: userID, LessonID: lessonID, StartedAt: now, LastSeenAt: now}
+
+	return storage.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "lesson_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"last_seen_at": now}),
+	}).Create(&record).Error
+}
+
+// ForLessons возвращает прогресс пользователя по указанным урокам
+func ForLessons(userID uint, lessonIDs []uint) (map[uint]storage.EeLessonProgress, error) {
+	result := make(map[uint]storage.EeLessonProgress)
+	if len(lessonIDs) == 0 {
+		return result, nil
+	}
+
+	var records []storage.EeLessonProgress
+	if err := storage.DB.Where("user_id = ? AND lesson_id IN ?", userID, lessonIDs).Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		result[record.LessonID] = record
+	}
+
+	return result, nil
+}
+
+func courseLessons(courseID uint) *gorm.DB {
+	return storage.DB.Model(&storage.EeLesson{}).
+		Select("ee_lessons.lesson_id").
+		Joins("JOIN ee_course_sections ON ee_course_sections.section_id = ee_lessons.section_id").
+		Where("ee_course_sections.course_id = ?", courseID)
+}
+
+// Результаты пользователя по тестам курса. Тесты без вопросов не учитываются.
+func quizResults(userID, courseID uint) ([]quizResult, error) {
+	var quizzes []storage.EeQuiz
+	err := storage.DB.
+		Where("lesson_id IN (?) AND EXISTS (SELECT 1 FROM ee_quiz_questions WHERE ee_quiz_questions.quiz_id = ee_quizzes.quiz_id)", courseLessons(courseID)).
+		Find(&quizzes).Error
+	if err != nil || len(quizzes) == 0 {
+		return nil, err
+	}
+
+	quizIDs := make([]uint, len(quizzes))
+	for i, quiz := range quizzes {
+		quizIDs[i] = quiz.QuizID
+	}
+
+	var attempts []storage.EeQuizAttempt
+	err = storage.DB.Where("user_id = ? AND quiz_id IN ? AND submitted_at IS NOT NULL", userID, quizIDs).
+		Order("number").
+		Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byQuiz := make(map[uint][]storage.EeQuizAttempt)
+	for _, attempt := range attempts {
+		byQuiz[attempt.QuizID] = append(byQuiz[attempt.QuizID], attempt)
+	}
+
+	results := make([]quizResult, len(quizzes))
+	for i, quiz := range quizzes {
+		results[i] = quizResult{QuizID: quiz.QuizID, Score: PolicyScore(quiz.ScoringPolicy, byQuiz[quiz.QuizID]), Attempted: len(byQuiz[quiz.QuizID]) > 0}
+	}
+
+	return results, nil
+}
+
+// AttemptScore возвращает долю набранных в сданной попытке баллов
+func AttemptScore(attempt *storage.EeQuizAttempt) (float64, bool) {
+	if attempt.SubmittedAt == nil || attempt.Points == nil || attempt.Earned == nil || *attempt.Points <= 0 {
+		return 0, false
+	}
+	return *attempt.Earned / *attempt.Points, true
+}
+
+// PolicyScore сводит сданные попытки теста, упорядоченные по номеру, в одну оценку от 0 до 1
+func PolicyScore(policy string, attempts []storage.EeQuizAttempt) float64 {
+	var scores []float64
+	for i := range attempts {
+		if score, ok := AttemptScore(&attempts[i]); ok {
+			scores = append(scores, score)
+		}
+	}
+
+	if len(scores) == 0 {
+		return 0
+	}
+
+	switch policy {
+	case ScoreLatest:
+		return scores[len(scores)-1]
+	case ScoreAverage:
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		return total / float64(len(scores))
+	default:
+		return slices.Max(scores)
+	}
+}
+
+// CompletedLessons возвращает завершённые пользователем уроки курса
+func CompletedLessons(userID, courseID uint) (map[uint]bool, error) {
+	var lessonIDs []uint
+	err := storage.DB.Model(&storage.EeLessonProgress{}).
+		Where("user_id = ? AND completed_at IS NOT NULL AND lesson_id IN (?)", userID, courseLessons(courseID)).
+		Pluck("lesson_id", &lessonIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint]bool, len(lessonIDs))
+	for _, lessonID := range lessonIDs {
+		result[lessonID] = true
+	}
+
+	return result, nil
+}
+
+// QuizScores возвращает процент набранных пользователем баллов с учётом правила пересдачи по тестам курса.
+// Тестов без сданных попыток в результате нет
+func QuizScores(userID, courseID uint) (map[uint]float64, error) {
+	quizzes, err := quizResults(userID, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint]float64, len(quizzes))
+	for _, quiz := range quizzes {
+		if quiz.Attempted {
+			result[quiz.QuizID] = quiz.Score * 100
+		}
+	}
+
+	return result, nil
+}
+
+// Compute считает прогресс пользователя по курсу с учётом правил завершения
+func Compute(userID uint, course *storage.EeCourse) (*CourseProgress, error) {
+	result := CourseProgress{CourseID: course.CourseID}
+
+	if err := courseLessons(course.CourseID).Count(&result.Lessons).Error; err != nil {
+		return nil, err
+	}
+
+	err := storage.DB.Model(&storage.EeLessonProgress{}).
+		Select("COUNT(*) AS lessons_started, COUNT(completed_at) AS lessons_completed").
+		Where("user_id = ? AND lesson_id IN (?)", userID, courseLessons(course.CourseID)).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+
+	quizzes, err := quizResults(userID, course.CourseID)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Quizzes = int64(len(quizzes))
+	for _, quiz := range quizzes {
+		if quiz.Attempted && quiz.Score*100+1e-9 >= float64(course.QuizPassPercent) {
+			result.QuizzesPassed++
+		}
+	}
+
+	var done, required int64
+	if course.RequiresLessons {
+		done, required = done+result.LessonsCompleted, required+result.Lessons
+	}
+	if course.RequiresQuizzes {
+		done, required = done+result.QuizzesPassed, required+result.Quizzes
+	}
+
+	// Без правил завершения процент считается по урокам, но курс автоматически не завершается
+	if !course.RequiresLessons && !course.RequiresQuizzes {
+		done, required = result.LessonsCompleted, result.Lessons
+	}
+
+	if required > 0 {
+		result.Percent = float64(done) * 100 / float64(required)
+	}
+
+	enrollment, err := enrollments.Find(userID, course.CourseID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if enrollment != nil && enrollment.Status == enrollments.StatusCompleted {
+		result.Completed, result.CompletedAt = true, enrollment.CompletedAt
+	} else {
+		result.Completed = (course.RequiresLessons || course.RequiresQuizzes) && required > 0 && done >= required
+	}
+
+	return &result, nil
+}
+
+// Evaluate переводит запись студента в состояние completed, когда выполнены правила завершения курса.
+// Завершённый курс не возвращается в active, даже если прогресс по уроку потом сбросили.
+func Evaluate(userID, courseID uint) error {
+	enrollment, err := enrollments.Find(userID, courseID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if enrollment.Role != enrollments.RoleStudent || enrollment.Status != enrollments.StatusActive {
+		return nil
+	}
+
+	var course storage.EeCourse
+	if err := storage.DB.Where("course_id = ?", courseID).First(&course).Error; err != nil {
+		return err
+	}
+
+	progress, err := Compute(userID, &course)
+	if err != nil || !progress.Completed {
+		return err
+	}
+
+	return storage.DB.Model(enrollment).Updates(map[string]interface{}{
+		"status":       enrollments.StatusCompleted,
+		"completed_at": time.Now(),
+	}).Error
+}
+
+func MarkLesson(c *fiber.Ctx) error {
+	userID := middleware.UserID(c)
+
+	lessonID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid lesson id"})
+	}
+
+	courseID, err := enrollments.CourseIDByLesson(uint(lessonID))
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	if ok, err := enrollments.HasAccess(userID, courseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	request := MarkRequest{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse progress data"})
+		}
+	}
+
+	if err := Touch(userID, uint(lessonID)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	query := storage.DB.Model(&storage.EeLessonProgress{}).Where("user_id = ? AND lesson_id = ?", userID, lessonID)
+	if request.Completed != nil && *request.Completed {
+		err = query.Where("completed_at IS NULL").Update("completed_at", time.Now()).Error
+	} else if request.Completed != nil {
+		err = query.Update("completed_at", nil).Error
+	}
+
+	if err == nil {
+		err = Evaluate(userID, courseID)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	var record storage.EeLessonProgress
+	if err := storage.DB.Where("user_id = ? AND lesson_id = ?", userID, lessonID).First(&record).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&record)
+}
+
+func loadCourse(c *fiber.Ctx) (*storage.EeCourse, error) {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	var course storage.EeCourse
+	if err := storage.DB.Where("course_id = ?", courseID).First(&course).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return &course, nil
+}
+
+func GetCourseProgress(c *fiber.Ctx) error {
+	course, err := loadCourse(c)
+	if course == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanAccess(c, course.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	progress, err := Compute(middleware.UserID(c), course)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(progress)
+}
+
+// GetStudentsProgress - прогресс всех студентов курса для персонала
+func GetStudentsProgress(c *fiber.Ctx) error {
+	course, err := loadCourse(c)
+	if course == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, course.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	var students []UserProgress
+	err = storage.DB.Table("ee_enrollments").
+		Select("ee_users.user_id, ee_users.username, ee_users.email").
+		Joins("JOIN ee_users ON ee_users.user_id = ee_enrollments.user_id").
+		Where("ee_enrollments.course_id = ? AND ee_enrollments.role = ? AND ee_enrollments.status IN ?", course.CourseID, enrollments.RoleStudent, []string{enrollments.StatusActive, enrollments.StatusCompleted}).
+		Order("ee_users.username").
+		Scan(&students).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result := make([]UserProgress, 0, len(students))
+	for _, student := range students {
+		progress, err := Compute(student.UserID, course)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		student.CourseProgress = *progress
+		result = append(result, student)
+	}
+
+	return c.JSON(result)
+}
+
+func getMyProgress(c *fiber.Ctx) error {
+	userID := middleware.UserID(c)
+
+	var courses []storage.EeCourse
+	err := storage.DB.
+		Where("course_id IN (?)", storage.DB.Model(&storage.EeEnrollment{}).
+			Select("course_id").
+			Where("user_id = ? AND role = ? AND status IN ?", userID, enrollments.RoleStudent, []string{enrollments.StatusActive, enrollments.StatusCompleted})).
+		Order("course_id").
+		Find(&courses).Error
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	result := make([]*CourseProgress, 0, len(courses))
+	for i := range courses {
+		progress, err := Compute(userID, &courses[i])
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		progress.CourseTitle = courses[i].Title
+		result = append(result, progress)
+	}
+
+	return c.JSON(result)
+}
+
+// SetCompletionRules меняет правила завершения курса. Уже завершённые записи не пересматриваются.
+func SetCompletionRules(c *fiber.Ctx) error {
+	course, err := loadCourse(c)
+	if course == nil {
+		return err
+	}
+
+	if ok, err := enrollments.CanManage(c, course.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	rules := CompletionRules{}
+	if err := c.BodyParser(&rules); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse completion rules"})
+	}
+
+	updates := map[string]interface{}{}
+	if rules.RequiresLessons != nil {
+		updates["completion_requires_lessons"] = *rules.RequiresLessons
+		course.RequiresLessons = *rules.RequiresLessons
+	}
+	if rules.RequiresQuizzes != nil {
+		updates["completion_requires_quizzes"] = *rules.RequiresQuizzes
+		course.RequiresQuizzes = *rules.RequiresQuizzes
+	}
+	if rules.QuizPassPercent != nil {
+		if *rules.QuizPassPercent < 0 || *rules.QuizPassPercent > 100 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "quiz_pass_percent must be between 0 and 100"})
+		}
+		updates["quiz_pass_percent"] = *rules.QuizPassPercent
+		course.QuizPassPercent = *rules.QuizPassPercent
+	}
+
+	if len(updates) > 0 {
+		if err := storage.DB.Model(&storage.EeCourse{}).Where("course_id = ?", course.CourseID).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	return c.JSON(course)
+}
+
+func RegisterService(app fiber.Router) {
+	g := app.Group("/progress", middleware.TokenRequired)
+	{
+		g.Get("/my", getMyProgress)
+	}
+}
@@ -0,0 +1,88 @@
+package revisions
+
+import (
+	"ekb-edu/src/database/storage"
+	"encoding/json"
+	"time"
+)
+
+const (
+	Course  = "course"
+	Section = "section"
+	Lesson  = "lesson"
+)
+
+const (
+	contextLines = 3    // Строк контекста вокруг изменений в unified diff
+	maxEdits     = 2000 // Дальше сравнение не ищет минимальный diff и заменяет текст целиком
+)
+
+// blocksField - поле снимка с блоками содержимого урока
+const blocksField = "blocks"
+
+const (
+	opEqual  = "equal"
+	opInsert = "insert"
+	opDelete = "delete"
+)
+
+// kind описывает, где лежит объект и какие его поля попадают в журнал
+type kind struct {
+	model     interface{}
+	key       string
+	fields    []string
+	versioned bool // Откат увеличивает версию объекта, см. ETag
+	blocks    bool // Содержимое хранится в ee_lesson_blocks и попадает в снимок полем blocks
+}
+
+var kinds = map[string]kind{
+	Course:  {model: &storage.EeCourse{}, key: "course_id", fields: []string{"title", "description", "meta"}, versioned: true},
+	Section: {model: &storage.EeCourseSection{}, key: "section_id", fields: []string{"title"}},
+	Lesson:  {model: &storage.EeLesson{}, key: "lesson_id", fields: []string{"title"}, versioned: true, blocks: true},
+}
+
+// Snapshot - значения отслеживаемых полей объекта
+type Snapshot map[string]string
+
+// snapshotBlock - блок урока в снимке, без идентификаторов и порядковых номеров
+type snapshotBlock struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type SummaryInfo struct {
+	Summary string `json:"revision_summary"`
+}
+
+// RevisionInfo - правка в списке, без содержимого
+type RevisionInfo struct {
+	RevisionID uint      `json:"revision_id"`
+	Number     int       `json:"number"`
+	UserID     *uint     `json:"user_id"`
+	Username   *string   `json:"username"`
+	Summary    string    `json:"summary"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type Revision struct {
+	RevisionInfo
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+type Change struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type FieldDiff struct {
+	Field   string   `json:"field"`
+	Unified string   `json:"unified,omitempty"` // При ?mode=unified
+	Words   []Change `json:"words,omitempty"`   // При ?mode=words
+}
+
+type Diff struct {
+	From   int         `json:"from"`
+	To     int         `json:"to"`
+	Mode   string      `json:"mode"`
+	Fields []FieldDiff `json:"fields"` // Только изменившиеся поля
+}
@@ -0,0 +1,647 @@
+package revisions
+
+import (
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"ekb-edu/src/render"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var wordToken = regexp.MustCompile(`\s+|[\p{L}\p{N}_]+|.`)
+
+// tracked перечисляет поля снимка объекта
+func (k kind) tracked() []string {
+	if k.blocks {
+		return append(append([]string{}, k.fields...), blocksField)
+	}
+
+	return k.fields
+}
+
+// Блоки урока по порядку, по одному полю JSON на строку, чтобы построчный diff был читаемым
+func snapshotBlocks(tx *gorm.DB, lessonID uint) (string, error) {
+	var rows []storage.EeLessonBlock
+	if err := tx.Where("lesson_id = ?", lessonID).Order(`"order", block_id`).Find(&rows).Error; err != nil {
+		return "", err
+	} else if len(rows) == 0 {
+		return "", nil
+	}
+
+	list := make([]snapshotBlock, len(rows))
+	for i, row := range rows {
+		list[i] = snapshotBlock{Type: row.Type, Data: json.RawMessage(row.Data)}
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	return string(data), err
+}
+
+// restoreBlocks заменяет блоки урока блоками из снимка и возвращает идентификаторы удалённых блоков.
+// Правки, записанные до перехода на блоки, хранят текст урока в content_text
+func restoreBlocks(tx *gorm.DB, lessonID uint, snapshot Snapshot) ([]uint, error) {
+	list := []snapshotBlock{}
+	if data, ok := snapshot[blocksField]; ok && data != "" {
+		if err := json.Unmarshal([]byte(data), &list); err != nil {
+			return nil, fmt.Errorf("corrupted blocks snapshot: %w", err)
+		}
+	} else if text := snapshot["content_text"]; !ok && text != "" {
+		data, err := json.Marshal(map[string]string{"format": render.FormatMarkdown, "text": text})
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, snapshotBlock{Type: "text", Data: data})
+	}
+
+	var removed []uint
+	if err := tx.Model(&storage.EeLessonBlock{}).Where("lesson_id = ?", lessonID).Pluck("block_id", &removed).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("lesson_id = ?", lessonID).Delete(&storage.EeLessonBlock{}).Error; err != nil {
+		return nil, err
+	}
+
+	for i, block := range list {
+		row := storage.EeLessonBlock{LessonID: lessonID, Type: block.Type, Order: i, Data: []byte(block.Data)}
+		if err := tx.Create(&row).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, nil
+}
+
+// snapshot читает отслеживаемые поля объекта, блокируя строку до конца транзакции
+func snapshot(tx *gorm.DB, entity string, id uint) (Snapshot, error) {
+	k := kinds[entity]
+	row := map[string]interface{}{}
+	err := tx.Model(k.model).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select(k.fields).
+		Where(k.key+" = ?", id).
+		Take(&row).Error
+	if err != nil {
+		return nil, err
+	} else if len(row) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	result := make(Snapshot, len(k.fields)+1)
+	for _, field := range k.fields {
+		switch value := row[field].(type) {
+		case nil:
+			result[field] = ""
+		case []byte:
+			result[field] = string(value)
+		default:
+			result[field] = fmt.Sprint(value)
+		}
+	}
+
+	if k.blocks {
+		if result[blocksField], err = snapshotBlocks(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func decode(revision *storage.EeRevision) (Snapshot, error) {
+	result := Snapshot{}
+	if err := json.Unmarshal(revision.Snapshot, &result); err != nil {
+		return nil, fmt.Errorf("corrupted revision %d: %w", revision.RevisionID, err)
+	}
+
+	return result, nil
+}
+
+// latest возвращает последнюю правку объекта или nil, если журнал пуст
+func latest(tx *gorm.DB, entity string, id uint) (*storage.EeRevision, error) {
+	var revision storage.EeRevision
+	err := tx.Where("entity = ? AND entity_id = ?", entity, id).Order("number DESC").Take(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// changed перечисляет различающиеся поля в порядке их описания
+func changed(entity string, from, to Snapshot) []string {
+	var fields []string
+	for _, field := range kinds[entity].tracked() {
+		if from[field] != to[field] {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// Record добавляет правку с текущим состоянием объекта, если оно отличается от последней правки.
+// Пустое описание заполняется списком изменившихся полей
+func Record(tx *gorm.DB, entity string, id uint, userID *uint, summary string) error {
+	current, err := snapshot(tx, entity, id)
+	if err != nil {
+		return err
+	}
+
+	last, err := latest(tx, entity, id)
+	if err != nil {
+		return err
+	}
+
+	revision := storage.EeRevision{Entity: entity, EntityID: id, Number: 1, UserID: userID, Summary: summary}
+	if last != nil {
+		previous, err := decode(last)
+		if err != nil {
+			return err
+		}
+
+		fields := changed(entity, previous, current)
+		if len(fields) == 0 {
+			return nil
+		}
+
+		revision.Number = last.Number + 1
+		if revision.Summary == "" {
+			revision.Summary = "updated " + strings.Join(fields, ", ")
+		}
+	} else if revision.Summary == "" {
+		revision.Summary = "created"
+	}
+
+	if revision.Snapshot, err = json.Marshal(current); err != nil {
+		return err
+	}
+
+	return tx.Create(&revision).Error
+}
+
+// Track выполняет изменение объекта и записывает его в журнал.
+// Для объектов, созданных до появления журнала, сначала сохраняется исходное состояние
+func Track(tx *gorm.DB, entity string, id, userID uint, summary string, change func(tx *gorm.DB) error) error {
+	last, err := latest(tx, entity, id)
+	if err != nil {
+		return err
+	}
+
+	if last == nil {
+		if err := Record(tx, entity, id, nil, "initial version"); err != nil {
+			return err
+		}
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+
+	return Record(tx, entity, id, &userID, summary)
+}
+
+// Summary достаёт из тела запроса описание правки revision_summary
+func Summary(c *fiber.Ctx) string {
+	info := SummaryInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(info.Summary)
+}
+
+// scope проверяет, что пользователь ведёт курс объекта. При отказе возвращает 0
+func scope(c *fiber.Ctx, entity string) (uint, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return 0, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid %s id", entity)})
+	}
+
+	courseID := uint(id)
+	switch entity {
+	case Section:
+		courseID, err = enrollments.CourseIDBySection(uint(id))
+	case Lesson:
+		courseID, err = enrollments.CourseIDByLesson(uint(id))
+	}
+	if err != nil {
+		return 0, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("%s not found", entity)})
+	}
+
+	if ok, err := enrollments.CanManage(c, courseID); err != nil {
+		return 0, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return 0, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	return uint(id), nil
+}
+
+func infos(entity string, id uint, number int) ([]Revision, error) {
+	query := storage.DB.Table("ee_revisions").
+		Select("ee_revisions.*, ee_users.username").
+		Joins("LEFT JOIN ee_users ON ee_users.user_id = ee_revisions.user_id").
+		Where("ee_revisions.entity = ? AND ee_revisions.entity_id = ?", entity, id)
+	if number != 0 {
+		query = query.Where("ee_revisions.number = ?", number)
+	}
+
+	var rows []struct {
+		storage.EeRevision
+		Username *string
+	}
+	if err := query.Order("ee_revisions.number DESC").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Revision, len(rows))
+	for i, row := range rows {
+		result[i].RevisionInfo = RevisionInfo{
+			RevisionID: row.RevisionID,
+			Number:     row.Number,
+			UserID:     row.UserID,
+			Username:   row.Username,
+			Summary:    row.Summary,
+			CreatedAt:  row.CreatedAt,
+		}
+		if number != 0 {
+			snapshot, err := decode(&row.EeRevision)
+			if err != nil {
+				return nil, err
+			}
+			result[i].Snapshot = snapshot
+		}
+	}
+
+	return result, nil
+}
+
+// load находит правку по номеру. При отказе возвращает nil
+func load(c *fiber.Ctx, entity string, id uint, number int) (*Revision, error) {
+	if number < 1 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid revision number"})
+	}
+
+	found, err := infos(entity, id, number)
+	if err != nil {
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if len(found) == 0 {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("revision %d not found", number)})
+	}
+
+	return &found[0], nil
+}
+
+// List возвращает обработчик со списком правок объекта, от новых к старым
+func List(entity string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := scope(c, entity)
+		if id == 0 {
+			return err
+		}
+
+		result, err := infos(entity, id, 0)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		list := make([]RevisionInfo, len(result))
+		for i := range result {
+			list[i] = result[i].RevisionInfo
+		}
+
+		return c.JSON(list)
+	}
+}
+
+// Get возвращает обработчик, отдающий правку :number с содержимым
+func Get(entity string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := scope(c, entity)
+		if id == 0 {
+			return err
+		}
+
+		number, _ := strconv.Atoi(c.Params("number"))
+		revision, err := load(c, entity, id, number)
+		if revision == nil {
+			return err
+		}
+
+		return c.JSON(revision)
+	}
+}
+
+// Compare возвращает обработчик, сравнивающий правки ?from и ?to.
+// По умолчанию to - последняя правка, from - предыдущая перед to
+func Compare(entity string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := scope(c, entity)
+		if id == 0 {
+			return err
+		}
+
+		mode := c.Query("mode", "unified")
+		if mode != "unified" && mode != "words" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mode must be unified or words"})
+		}
+
+		result := Diff{To: c.QueryInt("to"), Mode: mode, Fields: []FieldDiff{}}
+		if result.To == 0 {
+			last, err := latest(storage.DB, entity, id)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+			} else if last == nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no revisions recorded yet"})
+			}
+			result.To = last.Number
+		}
+		result.From = c.QueryInt("from", result.To-1)
+
+		to, err := load(c, entity, id, result.To)
+		if to == nil {
+			return err
+		}
+
+		// Первая правка сравнивается с пустым объектом
+		from := &Revision{Snapshot: Snapshot{}}
+		if result.From != 0 {
+			if from, err = load(c, entity, id, result.From); from == nil {
+				return err
+			}
+		}
+
+		for _, field := range changed(entity, from.Snapshot, to.Snapshot) {
+			fieldDiff := FieldDiff{Field: field}
+			if mode == "words" {
+				fieldDiff.Words = words(from.Snapshot[field], to.Snapshot[field])
+			} else {
+				fieldDiff.Unified = unified(
+					fmt.Sprintf("%s@%d", field, result.From), fmt.Sprintf("%s@%d", field, result.To),
+					from.Snapshot[field], to.Snapshot[field],
+				)
+			}
+			result.Fields = append(result.Fields, fieldDiff)
+		}
+
+		return c.JSON(&result)
+	}
+}
+
+// Restore возвращает обработчик, который возвращает объект к правке :number.
+// Откат записывается новой правкой, журнал не переписывается
+func Restore(entity string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := scope(c, entity)
+		if id == 0 {
+			return err
+		}
+
+		number, _ := strconv.Atoi(c.Params("number"))
+		revision, err := load(c, entity, id, number)
+		if revision == nil {
+			return err
+		}
+
+		summary := Summary(c)
+		if summary == "" {
+			summary = fmt.Sprintf("restored revision %d", number)
+		}
+
+		k := kinds[entity]
+		values := make(map[string]interface{}, len(k.fields))
+		for _, field := range k.fields {
+			values[field] = revision.Snapshot[field]
+		}
+		if k.versioned {
+			values["version"] = gorm.Expr("version + 1")
+		}
+
+		var removed []uint
+		err = storage.DB.Transaction(func(tx *gorm.DB) error {
+			return Track(tx, entity, id, middleware.UserID(c), summary, func(tx *gorm.DB) error {
+				err := tx.Model(k.model).Where(k.key+" = ?", id).Updates(values).Error
+				if err == nil && k.blocks {
+					removed, err = restoreBlocks(tx, id, revision.Snapshot)
+				}
+				return err
+			})
+		})
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("%s not found", entity)})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		if entity == Course {
+			render.Invalidate(render.Key(entity, id))
+		}
+		for _, blockID := range removed {
+			render.Invalidate(render.Key("block", blockID))
+		}
+
+		list, err := infos(entity, id, 0)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+
+		return c.JSON(list[0].RevisionInfo)
+	}
+}
+
+type edit struct {
+	op   string
+	text string
+}
+
+// compare находит кратчайший список правок алгоритмом Майерса.
+// Если правок больше maxEdits, текст считается заменённым целиком
+func compare(a, b []string) []edit {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		// В trace[d] хранятся диагонали -d..d до шага d
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		result := make([]edit, 0, n+m)
+		for _, text := range a {
+			result = append(result, edit{opDelete, text})
+		}
+		for _, text := range b {
+			result = append(result, edit{opInsert, text})
+		}
+		return result
+	}
+
+	var reversed []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && trace[d][k-1+d] < trace[d][k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := trace[d][prevK+d]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, edit{opEqual, a[x]})
+		}
+
+		if x == prevX {
+			reversed = append(reversed, edit{opInsert, b[prevY]})
+		} else {
+			reversed = append(reversed, edit{opDelete, a[prevX]})
+		}
+		x, y = prevX, prevY
+	}
+
+	for x > 0 {
+		x--
+		reversed = append(reversed, edit{opEqual, a[x]})
+	}
+
+	result := make([]edit, len(reversed))
+	for i, e := range reversed {
+		result[len(reversed)-1-i] = e
+	}
+
+	return result
+}
+
+func lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
+}
+
+// hunkRange форматирует диапазон строк для заголовка @@
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	} else if count == 1 {
+		return strconv.Itoa(start + 1)
+	}
+
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// unified строит построчный diff в формате diff -u
+func unified(fromName, toName, from, to string) string {
+	edits := compare(lines(from), lines(to))
+
+	// Номера строк в старом и новом тексте перед каждой правкой
+	aPos := make([]int, len(edits)+1)
+	bPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if e.op != opInsert {
+			aPos[i+1]++
+		}
+		if e.op != opDelete {
+			bPos[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i, done := 0, 0; i < len(edits); {
+		for i < len(edits) && edits[i].op == opEqual {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// Изменения, между которыми меньше 2*contextLines общих строк, попадают в один блок
+		start := max(i-contextLines, done)
+		end := i + 1
+		for j := i; j < len(edits); j++ {
+			if edits[j].op != opEqual {
+				end = j + 1
+			} else if j-end >= 2*contextLines {
+				break
+			}
+		}
+		stop := min(end+contextLines, len(edits))
+
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aPos[start], aPos[stop]-aPos[start]),
+			hunkRange(bPos[start], bPos[stop]-bPos[start]))
+		for _, e := range edits[start:stop] {
+			prefix := " "
+			if e.op == opDelete {
+				prefix = "-"
+			} else if e.op == opInsert {
+				prefix = "+"
+			}
+			out.WriteString(prefix + e.text + "\n")
+		}
+
+		i, done = stop, stop
+	}
+
+	return out.String()
+}
+
+// words строит пословный diff, соседние правки одного вида склеиваются
+func words(from, to string) []Change {
+	result := []Change{}
+	for _, e := range compare(wordToken.FindAllString(from, -1), wordToken.FindAllString(to, -1)) {
+		if last := len(result) - 1; last >= 0 && result[last].Op == e.op {
+			result[last].Text += e.text
+			continue
+		}
+		result = append(result, Change{Op: e.op, Text: e.text})
+	}
+
+	return result
+}
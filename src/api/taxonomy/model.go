@@ -0,0 +1,47 @@
+package taxonomy
+
+import "ekb-edu/src/database/storage"
+
+// Категория в дереве каталога вместе с количеством курсов
+type CategoryNode struct {
+	storage.EeCategory
+	CourseCount int64           `json:"course_count"` // Курсы, привязанные непосредственно к категории
+	TotalCount  int64           `json:"total_count"`  // Курсы категории вместе с подкатегориями
+	Children    []*CategoryNode `json:"children"`
+}
+
+type CategoryWithCourses struct {
+	Category    *CategoryNode        `json:"category"`
+	Breadcrumbs []storage.EeCategory `json:"breadcrumbs"`
+	Courses     []storage.EeCourse   `json:"courses"`
+}
+
+type CategoryInfo struct {
+	Title    *string `json:"title"`
+	Slug     *string `json:"slug"`
+	ParentID *uint   `json:"parent_id"` // 0 переносит категорию в корень каталога
+	Order    *int    `json:"order"`
+}
+
+type TagWithCount struct {
+	storage.EeTag
+	CourseCount int64 `json:"course_count"`
+}
+
+type TagWithCourses struct {
+	Tag     storage.EeTag      `json:"tag"`
+	Courses []storage.EeCourse `json:"courses"`
+}
+
+type CourseTaxonomy struct {
+	Categories []storage.EeCategory `json:"categories"`
+	Tags       []storage.EeTag      `json:"tags"`
+}
+
+type CourseCategoriesInfo struct {
+	Categories []string `json:"categories"` // Слаги категорий
+}
+
+type CourseTagsInfo struct {
+	Tags []string `json:"tags"` // Названия тегов, отсутствующие теги будут созданы
+}
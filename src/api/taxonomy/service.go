@@ -0,0 +1,638 @@
+package taxonomy
+
+import (
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/storage"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "sch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// Slugify строит слаг из названия с транслитерацией кириллицы
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(r)
+			dash = false
+		case translit[r] != "":
+			b.WriteString(translit[r])
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func loadCategories(db *gorm.DB) ([]storage.EeCategory, error) {
+	var categories []storage.EeCategory
+	err := db.Order(`"order", title`).Find(&categories).Error
+	return categories, err
+}
+
+// Идентификаторы категории и всех её подкатегорий
+func subtreeIDs(categories []storage.EeCategory, rootID uint) []uint {
+	children := make(map[uint][]uint)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.CategoryID)
+		}
+	}
+
+	ids := []uint{rootID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+
+	return ids
+}
+
+func findBySlug(categories []storage.EeCategory, slug string) *storage.EeCategory {
+	for i := range categories {
+		if categories[i].Slug == slug {
+			return &categories[i]
+		}
+	}
+
+	return nil
+}
+
+// Строит дерево категорий и считает курсы по каждой ветке
+func buildTree(db *gorm.DB, categories []storage.EeCategory) ([]*CategoryNode, map[uint]*CategoryNode, error) {
+	var links []storage.EeCourseCategory
+	if err := db.Find(&links).Error; err != nil {
+		return nil, nil, err
+	}
+
+	courses := make(map[uint][]uint)
+	for _, link := range links {
+		courses[link.CategoryID] = append(courses[link.CategoryID], link.CourseID)
+	}
+
+	nodes := make(map[uint]*CategoryNode)
+	for _, category := range categories {
+		nodes[category.CategoryID] = &CategoryNode{
+			EeCategory:  category,
+			CourseCount: int64(len(courses[category.CategoryID])),
+			Children:    []*CategoryNode{},
+		}
+	}
+
+	roots := []*CategoryNode{}
+	for _, category := range categories {
+		node := nodes[category.CategoryID]
+		if parent, ok := nodes[derefParent(category.ParentID)]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	// Один курс может лежать в нескольких подкатегориях, поэтому считаем уникальные
+	for _, category := range categories {
+		unique := make(map[uint]bool)
+		for _, id := range subtreeIDs(categories, category.CategoryID) {
+			for _, courseID := range courses[id] {
+				unique[courseID] = true
+			}
+		}
+		nodes[category.CategoryID].TotalCount = int64(len(unique))
+	}
+
+	return roots, nodes, nil
+}
+
+func derefParent(parentID *uint) uint {
+	if parentID == nil {
+		return 0
+	}
+
+	return *parentID
+}
+
+// CourseFilter ограничивает выборку курсов категорией (вместе с подкатегориями) и тегами
+func CourseFilter(db *gorm.DB, categorySlug string, tagSlugs []string) (*gorm.DB, error) {
+	if categorySlug != "" {
+		categories, err := loadCategories(storage.DB)
+		if err != nil {
+			return nil, err
+		}
+
+		category := findBySlug(categories, categorySlug)
+		if category == nil {
+			return db.Where("1 = 0"), nil
+		}
+
+		db = db.Where("course_id IN (?)", storage.DB.Model(&storage.EeCourseCategory{}).
+			Select("course_id").
+			Where("category_id IN ?", subtreeIDs(categories, category.CategoryID)))
+	}
+
+	// Курс должен содержать все перечисленные теги
+	for _, slug := range tagSlugs {
+		db = db.Where("course_id IN (?)", storage.DB.Table("ee_course_tags").
+			Select("ee_course_tags.course_id").
+			Joins("JOIN ee_tags ON ee_tags.tag_id = ee_course_tags.tag_id").
+			Where("ee_tags.slug = ?", slug))
+	}
+
+	return db, nil
+}
+
+func getCategories(c *fiber.Ctx) error {
+	categories, err := loadCategories(storage.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	roots, _, err := buildTree(storage.DB, categories)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(roots)
+}
+
+func getCategory(c *fiber.Ctx) error {
+	categories, err := loadCategories(storage.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	category := findBySlug(categories, c.Params("slug"))
+	if category == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "category not found"})
+	}
+
+	_, nodes, err := buildTree(storage.DB, categories)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	info := CategoryWithCourses{
+		Category:    nodes[category.CategoryID],
+		Breadcrumbs: []storage.EeCategory{},
+		Courses:     []storage.EeCourse{},
+	}
+
+	// Цепочка родителей от корня каталога
+	for parent := nodes[derefParent(category.ParentID)]; parent != nil; parent = nodes[derefParent(parent.ParentID)] {
+		info.Breadcrumbs = append([]storage.EeCategory{parent.EeCategory}, info.Breadcrumbs...)
+	}
+
+	query, err := CourseFilter(storage.DB, category.Slug, nil)
+	if err == nil {
+		err = query.Find(&info.Courses).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&info)
+}
+
+func addCategory(c *fiber.Ctx) error {
+	info := CategoryInfo{}
+	if err := c.BodyParser(&info); err != nil || info.Title == nil || *info.Title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse category data"})
+	}
+
+	category := storage.EeCategory{Title: *info.Title, Slug: Slugify(*info.Title)}
+	if info.Slug != nil {
+		category.Slug = *info.Slug
+	}
+	if info.Order != nil {
+		category.Order = *info.Order
+	}
+	if info.ParentID != nil && *info.ParentID != 0 {
+		category.ParentID = info.ParentID
+	}
+
+	if !slugPattern.MatchString(category.Slug) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid slug"})
+	}
+
+	if category.ParentID != nil {
+		var count int64
+		storage.DB.Model(&storage.EeCategory{}).Where("category_id = ?", *category.ParentID).Count(&count)
+		if count == 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "parent category not found"})
+		}
+	}
+
+	var count int64
+	storage.DB.Model(&storage.EeCategory{}).Where("slug = ?", category.Slug).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "category with this slug already exists"})
+	}
+
+	if err := storage.DB.Create(&category).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&category)
+}
+
+func updateCategory(c *fiber.Ctx) error {
+	info := CategoryInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse category data"})
+	}
+
+	categories, err := loadCategories(storage.DB)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	category := findBySlug(categories, c.Params("slug"))
+	if category == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "category not found"})
+	}
+
+	updates := map[string]interface{}{}
+	if info.Title != nil {
+		if *info.Title == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "title cannot be empty"})
+		}
+		updates["title"] = *info.Title
+	}
+
+	if info.Slug != nil && *info.Slug != category.Slug {
+		if !slugPattern.MatchString(*info.Slug) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid slug"})
+		}
+		if findBySlug(categories, *info.Slug) != nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "category with this slug already exists"})
+		}
+		updates["slug"] = *info.Slug
+	}
+
+	if info.Order != nil {
+		updates["order"] = *info.Order
+	}
+
+	if info.ParentID != nil {
+		if *info.ParentID == 0 {
+			updates["parent_id"] = nil
+		} else {
+			// Нельзя перенести категорию внутрь самой себя
+			for _, id := range subtreeIDs(categories, category.CategoryID) {
+				if id == *info.ParentID {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "category cannot be moved into its own subtree"})
+				}
+			}
+
+			found := false
+			for _, other := range categories {
+				found = found || other.CategoryID == *info.ParentID
+			}
+			if !found {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "parent category not found"})
+			}
+
+			updates["parent_id"] = *info.ParentID
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := storage.DB.Model(category).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func deleteCategory(c *fiber.Ctx) error {
+	var category storage.EeCategory
+	if err := storage.DB.Where("slug = ?", c.Params("slug")).First(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "category not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	// Подкатегории переходят к родителю удаляемой категории
+	err := storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&storage.EeCategory{}).Where("parent_id = ?", category.CategoryID).Update("parent_id", category.ParentID).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&category).Error
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func getTags(c *fiber.Ctx) error {
+	var tags []TagWithCount
+
+	result := storage.DB.Table("ee_tags").
+		Select("ee_tags.*, COUNT(ee_course_tags.course_id) AS course_count").
+		Joins("LEFT JOIN ee_course_tags ON ee_course_tags.tag_id = ee_tags.tag_id").
+		Group("ee_tags.tag_id").
+		Order("course_count DESC, ee_tags.title").
+		Scan(&tags)
+
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	}
+
+	return c.JSON(tags)
+}
+
+func getTag(c *fiber.Ctx) error {
+	info := TagWithCourses{Courses: []storage.EeCourse{}}
+
+	if err := storage.DB.Where("slug = ?", c.Params("slug")).First(&info.Tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "tag not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	query, _ := CourseFilter(storage.DB, "", []string{info.Tag.Slug})
+	if err := query.Find(&info.Courses).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&info)
+}
+
+// Находит тег по названию или создаёт новый
+func findOrCreateTag(tx *gorm.DB, title string) (*storage.EeTag, error) {
+	tag := storage.EeTag{Title: strings.TrimSpace(title), Slug: Slugify(title)}
+	if !slugPattern.MatchString(tag.Slug) {
+		return nil, fmt.Errorf("invalid tag %q", title)
+	}
+
+	err := tx.Where(storage.EeTag{Slug: tag.Slug}).FirstOrCreate(&tag).Error
+	return &tag, err
+}
+
+func addTag(c *fiber.Ctx) error {
+	info := storage.EeTag{}
+	if err := c.BodyParser(&info); err != nil || info.Title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse tag data"})
+	}
+
+	tag, err := findOrCreateTag(storage.DB, info.Title)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(tag)
+}
+
+func updateTag(c *fiber.Ctx) error {
+	info := storage.EeTag{}
+	if err := c.BodyParser(&info); err != nil || info.Title == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse tag data"})
+	}
+
+	var tag storage.EeTag
+	if err := storage.DB.Where("slug = ?", c.Params("slug")).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "tag not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	slug := Slugify(info.Title)
+	if !slugPattern.MatchString(slug) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid tag title"})
+	}
+
+	var count int64
+	storage.DB.Model(&storage.EeTag{}).Where("slug = ? AND tag_id <> ?", slug, tag.TagID).Count(&count)
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "tag with this slug already exists"})
+	}
+
+	if err := storage.DB.Model(&tag).Updates(storage.EeTag{Title: info.Title, Slug: slug}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(&tag)
+}
+
+func deleteTag(c *fiber.Ctx) error {
+	result := storage.DB.Where("slug = ?", c.Params("slug")).Delete(&storage.EeTag{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", result.Error.Error())})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "tag not found"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// LoadCourseTaxonomy возвращает категории и теги курса
+func LoadCourseTaxonomy(courseID uint) (*CourseTaxonomy, error) {
+	info := CourseTaxonomy{
+		Categories: []storage.EeCategory{},
+		Tags:       []storage.EeTag{},
+	}
+
+	err := storage.DB.
+		Where("category_id IN (?)", storage.DB.Model(&storage.EeCourseCategory{}).Select("category_id").Where("course_id = ?", courseID)).
+		Order("title").
+		Find(&info.Categories).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.DB.
+		Where("tag_id IN (?)", storage.DB.Model(&storage.EeCourseTag{}).Select("tag_id").Where("course_id = ?", courseID)).
+		Order("title").
+		Find(&info.Tags).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func GetCourseTaxonomy(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	info, err := LoadCourseTaxonomy(uint(courseID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(info)
+}
+
+func courseExists(courseID uint64) bool {
+	var count int64
+	storage.DB.Model(&storage.EeCourse{}).Where("course_id = ?", courseID).Count(&count)
+	return count > 0
+}
+
+func SetCourseCategories(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	info := CourseCategoriesInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse categories"})
+	}
+
+	if !courseExists(courseID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	}
+
+	var categories []storage.EeCategory
+	if len(info.Categories) > 0 {
+		if err := storage.DB.Where("slug IN ?", info.Categories).Find(&categories).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	for _, slug := range info.Categories {
+		if findBySlug(categories, slug) == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("unknown category %q", slug)})
+		}
+	}
+
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("course_id = ?", courseID).Delete(&storage.EeCourseCategory{}).Error; err != nil {
+			return err
+		}
+
+		for _, category := range categories {
+			link := storage.EeCourseCategory{CourseID: uint(courseID), CategoryID: category.CategoryID}
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func SetCourseTags(c *fiber.Ctx) error {
+	courseID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid course id"})
+	}
+
+	info := CourseTagsInfo{}
+	if err := c.BodyParser(&info); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot parse tags"})
+	}
+
+	if !courseExists(courseID) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "course not found"})
+	}
+
+	for _, title := range info.Tags {
+		if !slugPattern.MatchString(Slugify(title)) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("invalid tag %q", title)})
+		}
+	}
+
+	var tags []storage.EeTag
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("course_id = ?", courseID).Delete(&storage.EeCourseTag{}).Error; err != nil {
+			return err
+		}
+
+		linked := make(map[uint]bool)
+		for _, title := range info.Tags {
+			tag, err := findOrCreateTag(tx, title)
+			if err != nil {
+				return err
+			}
+
+			if linked[tag.TagID] {
+				continue
+			}
+			linked[tag.TagID] = true
+
+			if err := tx.Create(&storage.EeCourseTag{CourseID: uint(courseID), TagID: tag.TagID}).Error; err != nil {
+				return err
+			}
+			tags = append(tags, *tag)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Title < tags[j].Title })
+
+	return c.JSON(tags)
+}
+
+func RegisterService(app fiber.Router) {
+	categories := app.Group("/categories")
+	{
+		categories.Get("/", getCategories)
+		categories.Get("/:slug", getCategory)
+
+		admin := categories.Group("/", middleware.TokenRequired, middleware.AdminRequired)
+		{
+			admin.Post("/", addCategory)
+			admin.Patch("/:slug", updateCategory)
+			admin.Delete("/:slug", deleteCategory)
+		}
+	}
+
+	tags := app.Group("/tags")
+	{
+		tags.Get("/", getTags)
+		tags.Get("/:slug", getTag)
+
+		admin := tags.Group("/", middleware.TokenRequired, middleware.AdminRequired)
+		{
+			admin.Post("/", addTag)
+			admin.Patch("/:slug", updateTag)
+			admin.Delete("/:slug", deleteTag)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package uploads
+
+import "ekb-edu/src/database/config"
+
+// Поддерживается ядро протокола tus 1.0.0 и расширения creation, checksum, termination, expiration
+const (
+	TusVersion    = "1.0.0"
+	TusExtensions = "creation,checksum,termination,expiration"
+	TusChecksums  = "sha1,sha256,md5"
+
+	// Нестандартный статус tus для несовпадения контрольной суммы
+	StatusChecksumMismatch = 460
+)
+
+const (
+	StatusUploading = "uploading"
+	StatusComplete  = "complete"
+)
+
+const (
+	PurposeVideo      = "video"
+	PurposeAttachment = "attachment"
+	PurposeSubmission = "submission" // Файлы ответов студентов на задания
+)
+
+// Допустимые MIME-типы для каждого назначения файла
+var allowedTypes = map[string][]string{
+	PurposeVideo: {
+		"video/mp4",
+		"video/webm",
+		"video/ogg",
+		"video/quicktime",
+	},
+	PurposeAttachment: {
+		"application/pdf",
+		"application/zip",
+		"application/json",
+		"application/msword",
+		"application/vnd.ms-excel",
+		"application/vnd.ms-powerpoint",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.oasis.opendocument.text",
+		"application/vnd.oasis.opendocument.spreadsheet",
+		"application/vnd.oasis.opendocument.presentation",
+		"text/plain",
+		"text/csv",
+		"image/png",
+		"image/jpeg",
+		"image/gif",
+		"image/webp",
+	},
+	// Задание может сузить список через allowed_types
+	PurposeSubmission: {
+		"application/pdf",
+		"application/zip",
+		"application/json",
+		"application/x-ipynb+json",
+		"application/msword",
+		"application/vnd.ms-excel",
+		"application/vnd.ms-powerpoint",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		"application/vnd.oasis.opendocument.text",
+		"application/vnd.oasis.opendocument.spreadsheet",
+		"application/vnd.oasis.opendocument.presentation",
+		"text/plain",
+		"text/csv",
+		"text/markdown",
+		"text/x-python",
+		"image/png",
+		"image/jpeg",
+		"image/gif",
+		"image/webp",
+		"video/mp4",
+		"video/webm",
+	},
+}
+
+var cfg *config.Uploads
+
+// Метаданные из заголовка Upload-Metadata
+type metadata struct {
+	Filename string
+	MimeType string
+	Purpose  string
+	CourseID uint
+	LessonID *uint
+	SHA256   string
+}
+
+type Usage struct {
+	Used    int64 `json:"used"`
+	Quota   int64 `json:"quota"`
+	MaxSize int64 `json:"max_size"`
+}
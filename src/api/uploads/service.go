@@ -0,0 +1,727 @@
+package uploads
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"ekb-edu/src/api/availability"
+	"ekb-edu/src/api/courses/lessons/videos"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/media"
+	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/database/config"
+	"ekb-edu/src/database/files"
+	"ekb-edu/src/database/storage"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+	// Одновременно дописывать одну загрузку может только один запрос
+	locks sync.Map
+
+	errChecksum = errors.New("checksum mismatch")
+	errType     = errors.New("file content does not match its type")
+	errQuota    = errors.New("upload quota exceeded")
+)
+
+func Initialize(c *config.Uploads) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		panic(err)
+	}
+
+	cfg = c
+}
+
+// Незавершённые загрузки хранятся локально и переносятся в хранилище целиком
+func stagingPath(uploadID string) string {
+	return filepath.Join(cfg.Dir, uploadID+".part")
+}
+
+// ContentURL возвращает адрес для скачивания завершённой загрузки
+func ContentURL(uploadID string) string {
+	return "/v1/uploads/" + uploadID + "/content"
+}
+
+// IsAllowedType сообщает, можно ли загрузить файл такого типа с этим назначением
+func IsAllowedType(purpose, mimeType string) bool {
+	return slices.Contains(allowedTypes[purpose], mimeType)
+}
+
+func expired(upload *storage.EeUpload) bool {
+	return upload.Status == StatusUploading && time.Since(upload.CreatedAt) > cfg.Expiration
+}
+
+func parseMetadata(header string) (metadata, error) {
+	meta := metadata{Purpose: PurposeAttachment}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return meta, fmt.Errorf("invalid base64 in Upload-Metadata key %q", key)
+		}
+		value := string(raw)
+
+		switch key {
+		case "filename", "name":
+			meta.Filename = value
+		case "filetype", "type":
+			meta.MimeType = value
+		case "purpose":
+			meta.Purpose = value
+		case "course_id":
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return meta, errors.New("invalid course_id in Upload-Metadata")
+			}
+			meta.CourseID = uint(id)
+		case "lesson_id":
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return meta, errors.New("invalid lesson_id in Upload-Metadata")
+			}
+			lessonID := uint(id)
+			meta.LessonID = &lessonID
+		case "checksum", "sha256":
+			meta.SHA256 = strings.ToLower(value)
+		}
+	}
+
+	return meta, nil
+}
+
+// cleanFilename проверяет имя файла. Пустая строка - имя недопустимо: содержит путь,
+// управляющие символы или ссылается на каталог
+func cleanFilename(name string) string {
+	if strings.ContainsAny(name, "/\\") || strings.ContainsFunc(name, unicode.IsControl) {
+		return ""
+	}
+
+	name = strings.TrimSpace(strings.ReplaceAll(name, `"`, ""))
+	if name == "." || name == ".." {
+		return ""
+	}
+
+	if runes := []rune(name); len(runes) > 255 {
+		ext := []rune(path.Ext(name))
+		if len(ext) > 16 {
+			ext = nil
+		}
+		name = string(runes[:255-len(ext)]) + string(ext)
+	}
+
+	return name
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	case "md5":
+		return md5.New()
+	}
+
+	return nil
+}
+
+// verifyChunk проверяет заголовок Upload-Checksum вида "sha256 <base64>"
+func verifyChunk(header string, body []byte) error {
+	if header == "" {
+		return nil
+	}
+
+	algorithm, encoded, _ := strings.Cut(header, " ")
+	h := newHash(algorithm)
+	if h == nil {
+		return fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return errors.New("invalid base64 in Upload-Checksum")
+	}
+
+	h.Write(body)
+	if !slices.Equal(h.Sum(nil), expected) {
+		return errChecksum
+	}
+
+	return nil
+}
+
+// VerifyType проверяет, что объявленный тип совпадает с содержимым хотя бы по основному типу
+func VerifyType(declared string, head []byte) error {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if sniffed == "text/html" || sniffed == "text/xml" {
+		return errType
+	}
+
+	if sniffed == "application/octet-stream" || sniffed == "text/plain" || sniffed == declared {
+		return nil
+	}
+
+	declaredMajor, _, _ := strings.Cut(declared, "/")
+	sniffedMajor, _, _ := strings.Cut(sniffed, "/")
+	if declaredMajor != sniffedMajor {
+		return errType
+	}
+
+	return nil
+}
+
+func setTusHeaders(c *fiber.Ctx, upload *storage.EeUpload) {
+	c.Set("Tus-Resumable", TusVersion)
+	c.Set("Upload-Offset", strconv.FormatInt(upload.Received, 10))
+	c.Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	c.Set("Cache-Control", "no-store")
+
+	if upload.Status == StatusUploading {
+		c.Set("Upload-Expires", upload.CreatedAt.Add(cfg.Expiration).UTC().Format(http.TimeFormat))
+	}
+}
+
+// requireTus отклоняет запросы клиентов другой версии протокола
+func requireTus(c *fiber.Ctx) error {
+	if c.Get("Tus-Resumable") != TusVersion {
+		c.Set("Tus-Version", TusVersion)
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": "unsupported tus version"})
+	}
+
+	return c.Next()
+}
+
+func options(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+	c.Set("Tus-Version", TusVersion)
+	c.Set("Tus-Extension", TusExtensions)
+	c.Set("Tus-Checksum-Algorithm", TusChecksums)
+	c.Set("Tus-Max-Size", strconv.FormatInt(cfg.MaxSize, 10))
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Used возвращает объём, занятый загрузками пользователя, включая незавершённые
+func Used(userID uint) (int64, error) {
+	return usedBy(storage.DB, userID)
+}
+
+func usedBy(tx *gorm.DB, userID uint) (int64, error) {
+	var used int64
+	err := tx.Model(&storage.EeUpload{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("user_id = ?", userID).
+		Row().Scan(&used)
+	return used, err
+}
+
+func getUploads(c *fiber.Ctx) error {
+	userID := middleware.UserID(c)
+
+	uploads := []storage.EeUpload{}
+	if err := storage.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&uploads).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	used, err := Used(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.JSON(fiber.Map{
+		"usage":   Usage{Used: used, Quota: cfg.UserQuota, MaxSize: cfg.MaxSize},
+		"uploads": uploads,
+	})
+}
+
+func createUpload(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+
+	if c.Get("Upload-Defer-Length") != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "deferred upload length is not supported"})
+	}
+
+	size, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Upload-Length header is required"})
+	}
+
+	if size > cfg.MaxSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": fmt.Sprintf("file is larger than %d bytes", cfg.MaxSize)})
+	}
+
+	meta, err := parseMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if meta.Filename == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "filename is required in Upload-Metadata"})
+	}
+
+	if meta.Filename = cleanFilename(meta.Filename); meta.Filename == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid filename in Upload-Metadata"})
+	}
+
+	types, ok := allowedTypes[meta.Purpose]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("unknown upload purpose %q", meta.Purpose)})
+	}
+
+	meta.MimeType, _, _ = mime.ParseMediaType(strings.ToLower(meta.MimeType))
+	if meta.MimeType == "" {
+		meta.MimeType = mime.TypeByExtension(strings.ToLower(path.Ext(meta.Filename)))
+		meta.MimeType, _, _ = mime.ParseMediaType(meta.MimeType)
+	}
+
+	if !slices.Contains(types, meta.MimeType) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": fmt.Sprintf("file type %q is not allowed for %s", meta.MimeType, meta.Purpose)})
+	}
+
+	if meta.SHA256 != "" && !sha256Hex.MatchString(meta.SHA256) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "checksum must be a hex encoded SHA-256"})
+	}
+
+	// Файл всегда относится к курсу, урок задаёт его точнее
+	if meta.LessonID != nil {
+		courseID, err := enrollments.CourseIDByLesson(*meta.LessonID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "lesson not found"})
+		}
+
+		if meta.CourseID != 0 && meta.CourseID != courseID {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "lesson does not belong to the course"})
+		}
+		meta.CourseID = courseID
+	} else if meta.Purpose == PurposeVideo || meta.Purpose == PurposeSubmission {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("lesson_id is required for %s uploads", meta.Purpose)})
+	}
+
+	if meta.CourseID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "course_id or lesson_id is required in Upload-Metadata"})
+	}
+
+	// Ответы на задания загружают участники курса, остальные файлы - преподаватели
+	if meta.Purpose == PurposeSubmission {
+		if ok, err := checkSubmission(c, &meta); !ok {
+			return err
+		}
+	} else if ok, err := enrollments.CanManage(c, meta.CourseID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not a staff member of the course"})
+	}
+
+	userID := middleware.UserID(c)
+	upload := storage.EeUpload{
+		UploadID: uuid.NewString(),
+		UserID:   userID,
+		CourseID: meta.CourseID,
+		LessonID: meta.LessonID,
+		Purpose:  meta.Purpose,
+		Filename: meta.Filename,
+		MimeType: meta.MimeType,
+		Size:     size,
+		SHA256:   meta.SHA256,
+		Status:   StatusUploading,
+	}
+
+	file, err := os.Create(stagingPath(upload.UploadID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("cannot create upload: %s", err.Error())})
+	}
+	file.Close()
+
+	// Квота проверяется под блокировкой пользователя, чтобы параллельные загрузки не превысили её вместе
+	var used int64
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		if !middleware.IsAdmin(c) {
+			var user storage.EeUser
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&user).Error; err != nil {
+				return err
+			}
+
+			if used, err = usedBy(tx, userID); err != nil {
+				return err
+			}
+
+			if used+size > cfg.UserQuota {
+				return errQuota
+			}
+		}
+
+		return tx.Create(&upload).Error
+	})
+
+	if err != nil {
+		os.Remove(stagingPath(upload.UploadID))
+		if errors.Is(err, errQuota) {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": fmt.Sprintf("%s: %d of %d bytes used", err.Error(), used, cfg.UserQuota)})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	// Пустой файл завершается сразу, без PATCH
+	if size == 0 {
+		if err := finish(&upload); err != nil {
+			return rejectUpload(c, &upload, err)
+		}
+	}
+
+	setTusHeaders(c, &upload)
+	c.Location(strings.TrimSuffix(c.Path(), "/") + "/" + upload.UploadID)
+
+	return c.Status(fiber.StatusCreated).JSON(&upload)
+}
+
+// ownUpload находит загрузку текущего пользователя, чужие загрузки не видны
+func ownUpload(c *fiber.Ctx, upload *storage.EeUpload) (bool, error) {
+	err := storage.DB.Where("upload_id = ? AND user_id = ?", c.Params("id"), middleware.UserID(c)).First(upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && expired(upload)) {
+		return false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "upload not found"})
+	} else if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return true, nil
+}
+
+func headUpload(c *fiber.Ctx) error {
+	var upload storage.EeUpload
+	if ok, err := ownUpload(c, &upload); !ok {
+		return err
+	}
+
+	setTusHeaders(c, &upload)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func patchUpload(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+
+	if c.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "Content-Type must be application/offset+octet-stream"})
+	}
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Upload-Offset header is required"})
+	}
+
+	// Блокировка заводится только для своей загрузки, иначе любой запрос добавлял бы запись в locks
+	var upload storage.EeUpload
+	if ok, err := ownUpload(c, &upload); !ok {
+		return err
+	}
+
+	lock, _ := locks.LoadOrStore(upload.UploadID, &sync.Mutex{})
+	if !lock.(*sync.Mutex).TryLock() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "upload is being written by another request"})
+	}
+	defer lock.(*sync.Mutex).Unlock()
+
+	// Перечитываем под блокировкой: загрузку мог дописать запрос, который держал её до нас
+	if ok, err := ownUpload(c, &upload); !ok {
+		return err
+	}
+
+	if upload.Status == StatusComplete || offset != upload.Received {
+		setTusHeaders(c, &upload)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": fmt.Sprintf("upload offset is %d", upload.Received)})
+	}
+
+	body := c.Body()
+	if offset+int64(len(body)) > upload.Size {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "chunk exceeds the declared upload length"})
+	}
+
+	if err := verifyChunk(c.Get("Upload-Checksum"), body); errors.Is(err, errChecksum) {
+		return c.Status(StatusChecksumMismatch).JSON(fiber.Map{"error": "chunk checksum mismatch"})
+	} else if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Обрезаем хвост от прерванной записи, которая не попала в базу
+	file, err := os.OpenFile(stagingPath(upload.UploadID), os.O_WRONLY, 0)
+	if err == nil {
+		if err = file.Truncate(offset); err == nil {
+			_, err = file.WriteAt(body, offset)
+		}
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("cannot write upload: %s", err.Error())})
+	}
+
+	upload.Received = offset + int64(len(body))
+	if err := storage.DB.Model(&upload).Update("received", upload.Received).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	if upload.Received == upload.Size {
+		if err := finish(&upload); err != nil {
+			return rejectUpload(c, &upload, err)
+		}
+	}
+
+	setTusHeaders(c, &upload)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// rejectUpload отвечает на ошибку завершения, повреждённую загрузку нужно начинать заново
+func rejectUpload(c *fiber.Ctx, upload *storage.EeUpload, err error) error {
+	switch {
+	case errors.Is(err, errChecksum):
+		Remove(upload)
+		return c.Status(StatusChecksumMismatch).JSON(fiber.Map{"error": "file checksum mismatch, upload has been discarded"})
+	case errors.Is(err, errType):
+		Remove(upload)
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": fmt.Sprintf("file content is not %s, upload has been discarded", upload.MimeType)})
+	}
+
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("cannot complete upload: %s", err.Error())})
+}
+
+// finish проверяет собранный файл, переносит его в хранилище и привязывает к видео урока
+func finish(upload *storage.EeUpload) error {
+	file, err := os.Open(stagingPath(upload.UploadID))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if err := VerifyType(upload.MimeType, head[:n]); err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if upload.SHA256 != "" && upload.SHA256 != sum {
+		return errChecksum
+	}
+
+	key, err := files.CleanKey(fmt.Sprintf("courses/%d/uploads/%s/%s", upload.CourseID, upload.UploadID, upload.Filename))
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := files.Store.Put(key, file); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = storage.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(upload).Updates(map[string]interface{}{
+			"status":       StatusComplete,
+			"sha256":       sum,
+			"blob_key":     key,
+			"completed_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if upload.Purpose == PurposeVideo && upload.LessonID != nil {
+			return videos.AttachUpload(tx, *upload.LessonID, upload.UploadID, ContentURL(upload.UploadID), upload.Filename)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		files.Store.Delete(key)
+		return err
+	}
+
+	upload.Status = StatusComplete
+	upload.SHA256 = sum
+	upload.BlobKey = key
+	upload.CompletedAt = &now
+
+	os.Remove(stagingPath(upload.UploadID))
+	locks.Delete(upload.UploadID)
+
+	return nil
+}
+
+// checkSubmission пускает загрузку ответа, только если урок - открытое участнику задание,
+// принимающее файлы этого типа
+func checkSubmission(c *fiber.Ctx, meta *metadata) (bool, error) {
+	if ok, err := enrollments.CanAccess(c, meta.CourseID); err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if !ok {
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is not enrolled in the course"})
+	}
+
+	status, err := availability.ForLessonID(c, *meta.LessonID)
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	} else if status.Locked {
+		return false, availability.Deny(c, status)
+	}
+
+	var assignment storage.EeAssignment
+	if err := storage.DB.Where("lesson_id = ?", *meta.LessonID).First(&assignment).Error; err != nil {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "lesson has no assignment"})
+	}
+
+	if !assignment.AllowFiles {
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "assignment does not accept files"})
+	}
+
+	var types []string
+	if err := json.Unmarshal(assignment.AllowedTypes, &types); err == nil && len(types) > 0 && !slices.Contains(types, meta.MimeType) {
+		return false, c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": fmt.Sprintf("file type %q is not accepted by the assignment", meta.MimeType)})
+	}
+
+	return true, nil
+}
+
+// Remove удаляет загрузку вместе с временным и сохранённым файлом
+func Remove(upload *storage.EeUpload) error {
+	if err := storage.DB.Delete(upload).Error; err != nil {
+		return err
+	}
+
+	os.Remove(stagingPath(upload.UploadID))
+	if upload.BlobKey != "" {
+		files.Store.Delete(upload.BlobKey)
+	}
+	locks.Delete(upload.UploadID)
+
+	return nil
+}
+
+func deleteUpload(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", TusVersion)
+
+	var upload storage.EeUpload
+	if ok, err := ownUpload(c, &upload); !ok {
+		return err
+	}
+
+	if upload.Status == StatusComplete {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "completed uploads are removed together with the video or attachment"})
+	}
+
+	if err := Remove(&upload); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// getContent перенаправляет на подписанную ссылку, скачивание - если позволяет политика курса
+func getContent(c *fiber.Ctx) error {
+	var upload storage.EeUpload
+	err := storage.DB.Where("upload_id = ? AND status = ?", c.Params("id"), StatusComplete).First(&upload).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "file not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+	}
+
+	download := false
+	if upload.Purpose != PurposeVideo {
+		if download, err = media.CanDownload(c, &upload); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": fmt.Sprintf("database error: %s", err.Error())})
+		}
+	}
+
+	signed, ok, err := media.Issue(c, &upload, download)
+	if !ok {
+		return err
+	}
+
+	return c.Redirect(signed.URL, fiber.StatusFound)
+}
+
+// Cleanup удаляет просроченные незавершённые загрузки и файлы, которые больше не привязаны
+// к видео, вложениям или ответам. Неприкреплённым файлам даётся тот же срок, что и загрузке
+func Cleanup() (int, error) {
+	deadline := time.Now().Add(-cfg.Expiration)
+
+	var stale []storage.EeUpload
+	err := storage.DB.
+		Where("status = ? AND created_at < ?", StatusUploading, deadline).
+		Or("status = ? AND purpose = ? AND upload_id NOT IN (?)", StatusComplete, PurposeVideo,
+			storage.DB.Model(&storage.EeVideo{}).Select("upload_id").Where("upload_id IS NOT NULL")).
+		Or("status = ? AND purpose = ? AND completed_at < ? AND upload_id NOT IN (?)", StatusComplete, PurposeAttachment, deadline,
+			storage.DB.Model(&storage.EeAttachment{}).Select("upload_id")).
+		Or("status = ? AND purpose = ? AND completed_at < ? AND upload_id NOT IN (?)", StatusComplete, PurposeSubmission, deadline,
+			storage.DB.Model(&storage.EeSubmissionFile{}).Select("upload_id")).
+		Find(&stale).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range stale {
+		if err := Remove(&stale[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(stale), nil
+}
+
+func RegisterService(app fiber.Router) {
+	app.Options("/uploads", options)
+	app.Options("/uploads/:id", options)
+
+	g := app.Group("/uploads", middleware.TokenRequired)
+	{
+		g.Get("/", getUploads)
+		g.Get("/:id/content", getContent)
+		g.Post("/", requireTus, createUpload)
+		g.Head("/:id", requireTus, headUpload)
+		g.Patch("/:id", requireTus, patchUpload)
+		g.Delete("/:id", requireTus, deleteUpload)
+	}
+}
@@ -0,0 +1,7 @@
+package cli
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"ekb-edu/src/api/assignments/peer"
+	"ekb-edu/src/api/enrollments/roster"
+	"ekb-edu/src/api/uploads"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var commands = []command{
+	{
+		name:  "import-roster",
+		usage: "import-roster -course <id> -file <roster.csv> [-dry-run]",
+		run:   importRoster,
+	},
+	{
+		name:  "cleanup-uploads",
+		usage: "cleanup-uploads",
+		run:   cleanupUploads,
+	},
+	{
+		name:  "peer-reviews",
+		usage: "peer-reviews",
+		run:   processPeerReviews,
+	},
+}
+
+// Run выполняет консольную команду вместо запуска веб-сервера
+func Run(args []string) error {
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
+		}
+	}
+
+	var usage strings.Builder
+	for _, cmd := range commands {
+		fmt.Fprintf(&usage, "\n  %s", cmd.usage)
+	}
+
+	return fmt.Errorf("unknown command %q, available commands:%s", args[0], usage.String())
+}
+
+func importRoster(args []string) error {
+	flags := flag.NewFlagSet("import-roster", flag.ContinueOnError)
+	courseID := flags.Uint("course", 0, "course id")
+	path := flags.String("file", "", "CSV file with email and/or username columns")
+	dryRun := flags.Bool("dry-run", false, "show the report without enrolling anyone")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *courseID == 0 || *path == "" {
+		return errors.New("both -course and -file are required")
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rows, err := roster.Parse(file)
+	if err != nil {
+		return fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	report, err := roster.Import(*courseID, rows, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LINE\tEMAIL\tUSERNAME\tACTION\tMESSAGE")
+	for _, row := range report.Rows {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", row.Line, row.Email, row.Username, row.Action, row.Message)
+	}
+	w.Flush()
+
+	mode := ""
+	if report.DryRun {
+		mode = " (dry run, nothing was saved)"
+	}
+	fmt.Printf("\nenrolled: %d, created: %d, skipped: %d, errors: %d%s\n",
+		report.Enrolled, report.Created, report.Skipped, report.Errors, mode)
+
+	return nil
+}
+
+func cleanupUploads(args []string) error {
+	removed, err := uploads.Cleanup()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("removed %d uploads\n", removed)
+	return nil
+}
+
+func processPeerReviews(args []string) error {
+	allocated, graded, err := peer.Process()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("allocated reviewers for %d assignments, graded %d submissions\n", allocated, graded)
+	return nil
+}
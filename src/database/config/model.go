@@ -1,19 +1,41 @@
 package config
 
 import (
+	"time"
+
+	"ekb-edu/src/database/files"
 	"ekb-edu/src/database/repository"
+	"ekb-edu/src/mail"
 )
 
 type Config struct {
 	Web      Web
 	Jwt      Jwt
+	Uploads  Uploads
+	Media    Media
 	Postgres repository.Config
+	Files    files.Config
+	Mail     mail.Config
 }
 
 type Web struct {
-	Port uint16 `env:"WEB_PORT" env-default:"8000"`
+	Port           uint16 `env:"WEB_PORT" env-default:"8000"`
+	BodyLimit      int    `env:"WEB_BODY_LIMIT" env-default:"4194304"`         // 4 МиБ, как по умолчанию в fiber
+	LargeBodyLimit int    `env:"WEB_LARGE_BODY_LIMIT" env-default:"268435456"` // Импорт пакетов и части загрузок, 256 МиБ
 }
 
 type Jwt struct {
 	Secret string `env:"JWT_SECRET"`
 }
+
+type Uploads struct {
+	Dir        string        `env:"UPLOADS_DIR" env-default:"./data/uploads"`
+	MaxSize    int64         `env:"UPLOADS_MAX_SIZE" env-default:"4294967296"`    // 4 ГиБ
+	UserQuota  int64         `env:"UPLOADS_USER_QUOTA" env-default:"21474836480"` // 20 ГиБ
+	Expiration time.Duration `env:"UPLOADS_EXPIRATION" env-default:"24h"`         // Срок жизни незавершённой загрузки
+}
+
+type Media struct {
+	Secret string        `env:"MEDIA_SECRET"` // Если не задан, выводится из JWT_SECRET
+	URLTTL time.Duration `env:"MEDIA_URL_TTL" env-default:"15m"`
+}
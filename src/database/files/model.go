@@ -0,0 +1,63 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// BlobStore хранит бинарные файлы (ассеты курсов, медиа) по строковому ключу
+type BlobStore interface {
+	Put(key string, r io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	OpenRange(key string, offset, length int64) (io.ReadCloser, error) // Часть файла для HTTP Range запросов
+	Delete(key string) error
+}
+
+var Store BlobStore
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+type Config struct {
+	Backend string `env:"FILES_BACKEND" env-default:"local"`
+	Root    string `env:"FILES_ROOT" env-default:"./data/files"`
+	S3      S3Config
+}
+
+// S3Config подходит и для AWS, и для совместимых хранилищ (MinIO, Yandex Object Storage)
+type S3Config struct {
+	Endpoint  string `env:"S3_ENDPOINT" env-default:"http://localhost:9000"`
+	Region    string `env:"S3_REGION" env-default:"us-east-1"`
+	Bucket    string `env:"S3_BUCKET"`
+	AccessKey string `env:"S3_ACCESS_KEY"`
+	SecretKey string `env:"S3_SECRET_KEY"`
+	PathStyle bool   `env:"S3_PATH_STYLE" env-default:"true"` // MinIO не поддерживает адресацию через поддомены
+	PartSize  int64  `env:"S3_PART_SIZE" env-default:"67108864"`
+
+	// Ожидание подключения и заголовков ответа. Сама передача не ограничена: видео отдаются потоком
+	Timeout time.Duration `env:"S3_TIMEOUT" env-default:"30s"`
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteRequest struct {
+	XMLName struct{} `xml:"CompleteMultipartUpload"`
+	Parts   []s3Part `xml:"Part"`
+}
@@ -0,0 +1,450 @@
+package files
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Хранилище файлов в локальной файловой системе
+type localStore struct {
+	root string
+}
+
+func Connect(cfg *Config) {
+	switch cfg.Backend {
+	case BackendLocal:
+		if err := os.MkdirAll(cfg.Root, 0o755); err != nil {
+			panic(err)
+		}
+
+		Store = &localStore{root: cfg.Root}
+
+	case BackendS3:
+		store, err := newS3Store(cfg.S3)
+		if err != nil {
+			panic(err)
+		}
+
+		Store = store
+
+	default:
+		panic(fmt.Errorf("unknown FILES_BACKEND %q", cfg.Backend))
+	}
+}
+
+// CleanKey нормализует ключ и запрещает выход за пределы хранилища
+func CleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "", ErrInvalidKey
+	}
+
+	return cleaned, nil
+}
+
+func (s *localStore) path(key string) (string, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (s *localStore) Put(key string, r io.Reader) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, err
+	}
+
+	// Пишем во временный файл, чтобы читатели не увидели недописанный объект
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	return n, os.Rename(tmp.Name(), p)
+}
+
+func (s *localStore) Open(key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(p)
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
+
+func (s *localStore) OpenRange(key string, offset, length int64) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return limitedFile{Reader: io.NewSectionReader(file, offset, length), Closer: file}, nil
+}
+
+func (s *localStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Хранилище файлов в S3-совместимом объектном хранилище, запросы подписываются AWS Signature V4
+type s3Store struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+const (
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+)
+
+func newS3Store(cfg S3Config) (*s3Store, error) {
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required for the s3 backend")
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", cfg.Endpoint)
+	}
+
+	// S3 не принимает части меньше 5 МиБ, кроме последней
+	if cfg.PartSize < 5<<20 {
+		cfg.PartSize = 5 << 20
+	}
+
+	// Общий http.Client.Timeout оборвал бы долгую отдачу файла, поэтому ограничены только этапы до ответа
+	dialer := &net.Dialer{Timeout: cfg.Timeout, KeepAlive: 30 * time.Second}
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Timeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	}}
+
+	return &s3Store{cfg: cfg, endpoint: endpoint, client: client}, nil
+}
+
+// uriEncode кодирует строку по правилам SigV4: всё, кроме unreserved символов RFC 3986
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (s *s3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	scope := now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		"host;x-amz-content-sha256;x-amz-date",
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), now.Format("20060102"))
+	signingKey = hmacSHA256(signingKey, s.cfg.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=%s",
+		s.cfg.AccessKey, scope, hex.EncodeToString(hmacSHA256(signingKey, stringToSign)),
+	))
+}
+
+func (s *s3Store) request(method, key string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	u := *s.endpoint
+	objectPath := "/" + cleaned
+	if s.cfg.PathStyle {
+		objectPath = "/" + s.cfg.Bucket + objectPath
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+
+	objectPath = strings.TrimSuffix(s.endpoint.Path, "/") + objectPath
+	u.Path = objectPath
+	u.RawPath = uriEncode(objectPath, false)
+
+	// Канонический запрос требует отсортированных параметров с кодированием SigV4
+	keys := make([]string, 0, len(query))
+	for name := range query {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, name := range keys {
+		params = append(params, uriEncode(name, true)+"="+uriEncode(query.Get(name), true))
+	}
+	u.RawQuery = strings.Join(params, "&")
+
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = size
+	if body == nil {
+		req.ContentLength = 0
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, &fs.PathError{Op: strings.ToLower(method), Path: cleaned, Err: fs.ErrNotExist}
+		}
+
+		var e s3Error
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if xml.Unmarshal(data, &e) != nil || e.Code == "" {
+			e.Code = resp.Status
+		}
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, cleaned, e.Code, e.Message)
+	}
+
+	return resp, nil
+}
+
+// spool возвращает данные в виде io.ReaderAt известного размера, при необходимости через временный файл
+func spool(r io.Reader) (io.ReaderAt, int64, func(), error) {
+	if file, ok := r.(*os.File); ok {
+		info, err := file.Stat()
+		offset, seekErr := file.Seek(0, io.SeekCurrent)
+		if err == nil && seekErr == nil && info.Mode().IsRegular() {
+			size := info.Size() - offset
+			return io.NewSectionReader(file, offset, size), size, func() {}, nil
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "ekb-edu-s3-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+
+	return tmp, size, cleanup, nil
+}
+
+func (s *s3Store) Put(key string, r io.Reader) (int64, error) {
+	data, size, cleanup, err := spool(r)
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+
+	if size <= s.cfg.PartSize {
+		resp, err := s.request(http.MethodPut, key, nil, nil, io.NewSectionReader(data, 0, size), size, unsignedPayload)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+
+		return size, nil
+	}
+
+	return size, s.putMultipart(key, data, size)
+}
+
+// Большие файлы загружаются частями, при ошибке загрузка отменяется
+func (s *s3Store) putMultipart(key string, data io.ReaderAt, size int64) error {
+	resp, err := s.request(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	var initiated s3InitiateResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("s3 multipart upload: %w", err)
+	}
+
+	err = func() error {
+		var complete s3CompleteRequest
+		for offset, number := int64(0), 1; offset < size; offset, number = offset+s.cfg.PartSize, number+1 {
+			partSize := min(s.cfg.PartSize, size-offset)
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadID}}
+
+			resp, err := s.request(http.MethodPut, key, query, nil, io.NewSectionReader(data, offset, partSize), partSize, unsignedPayload)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+
+			complete.Parts = append(complete.Parts, s3Part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+		}
+
+		body, err := xml.Marshal(complete)
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(body)
+
+		resp, err := s.request(http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, nil, bytes.NewReader(body), int64(len(body)), hex.EncodeToString(hash[:]))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		// Ошибка сборки может прийти в теле ответа со статусом 200
+		var e s3Error
+		if data, _ := io.ReadAll(resp.Body); xml.Unmarshal(data, &e) == nil && e.Code != "" {
+			return fmt.Errorf("s3 complete multipart upload %s: %s %s", key, e.Code, e.Message)
+		}
+
+		return nil
+	}()
+
+	if err != nil {
+		if resp, abortErr := s.request(http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil, 0, emptyPayloadHash); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *s3Store) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.request(http.MethodGet, key, nil, nil, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *s3Store) OpenRange(key string, offset, length int64) (io.ReadCloser, error) {
+	// Диапазон bytes=N-(N-1) некорректен, пустая часть файла не запрашивается
+	if length <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+	resp, err := s.request(http.MethodGet, key, nil, header, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (s *s3Store) Delete(key string) error {
+	resp, err := s.request(http.MethodDelete, key, nil, nil, nil, 0, emptyPayloadHash)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
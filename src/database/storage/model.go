@@ -19,83 +19,477 @@ type EeUser struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// PasswordToken model
+type EePasswordToken struct {
+	TokenID   uint       `gorm:"primary_key" json:"token_id"`
+	UserID    uint       `gorm:"type:integer;not null" json:"user_id"`
+	TokenHash string     `gorm:"type:char(64);unique;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
 // Course model
 type EeCourse struct {
-	CourseID     uint           `gorm:"primary_key" json:"course_id"`
-	Title        string         `gorm:"type:varchar(255);not null" json:"title"`
-	Description  string         `gorm:"type:text" json:"description"`
-	Meta         datatypes.JSON `gorm:"type:text" json:"meta"`
-	InstructorID uint           `gorm:"type:integer" json:"instructor_id"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
+	CourseID         uint           `gorm:"primary_key" json:"course_id"`
+	Title            string         `gorm:"type:varchar(255);not null" json:"title"`
+	Description      string         `gorm:"type:text" json:"description"`
+	Meta             datatypes.JSON `gorm:"type:text" json:"meta"`
+	InstructorID     uint           `gorm:"type:integer" json:"instructor_id"` // Автор курса, права дают записи ee_enrollments с ролью instructor
+	EnrollmentPolicy string         `gorm:"type:varchar(32);not null;default:approval" json:"enrollment_policy"`
+	EnrollmentKey    string         `gorm:"type:varchar(255)" json:"-"`
+	Capacity         int            `gorm:"type:integer;not null;default:0" json:"capacity"` // 0 - без ограничений
+	RequiresLessons  bool           `gorm:"column:completion_requires_lessons;not null;default:true" json:"completion_requires_lessons"`
+	RequiresQuizzes  bool           `gorm:"column:completion_requires_quizzes;not null;default:false" json:"completion_requires_quizzes"`
+	QuizPassPercent  int            `gorm:"type:integer;not null;default:60" json:"quiz_pass_percent"`
+	MediaPolicy      string         `gorm:"column:media_download_policy;type:varchar(16);not null;default:stream_only" json:"media_download_policy"`
+	Version          int            `gorm:"type:integer;not null;default:1" json:"version"` // Меняется только правкой через API, см. ETag
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
 }
 
-// Course owner model
-type EeCourseOwner struct {
-	ID        uint      `gorm:"primary_key" json:"id"`
-	UserID    uint      `gorm:"type:integer" json:"user_id"`
-	CourseID  uint      `gorm:"type:integer" json:"course_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+// Enrollment model
+type EeEnrollment struct {
+	EnrollmentID uint       `gorm:"primary_key" json:"enrollment_id"`
+	UserID       uint       `gorm:"type:integer;not null;index:idx_user_course,unique" json:"user_id"`
+	CourseID     uint       `gorm:"type:integer;not null;index:idx_user_course,unique" json:"course_id"`
+	Role         string     `gorm:"type:varchar(32);not null" json:"role"`
+	Status       string     `gorm:"type:varchar(32);not null" json:"status"`
+	CohortID     *uint      `gorm:"type:integer" json:"cohort_id"`
+	WaitlistedAt *time.Time `json:"waitlisted_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Cohort model
+type EeCohort struct {
+	CohortID           uint       `gorm:"primary_key" json:"cohort_id"`
+	CourseID           uint       `gorm:"type:integer;not null" json:"course_id"`
+	Title              string     `gorm:"type:varchar(255);not null" json:"title"`
+	StartsAt           *time.Time `json:"starts_at"`
+	EndsAt             *time.Time `json:"ends_at"`
+	EnrollmentOpensAt  *time.Time `json:"enrollment_opens_at"`
+	EnrollmentClosesAt *time.Time `json:"enrollment_closes_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// CohortInstructor model
+type EeCohortInstructor struct {
+	CohortID uint `gorm:"primaryKey;autoIncrement:false" json:"cohort_id"`
+	UserID   uint `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
 }
 
 // CourseSection model
 type EeCourseSection struct {
-	SectionID uint      `gorm:"primary_key" json:"section_id"`
-	CourseID  uint      `gorm:"type:integer" json:"course_id"`
-	Title     string    `gorm:"type:varchar(255);not null" json:"title"`
-	Order     int       `gorm:"type:integer;not null" json:"order"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	SectionID          uint       `gorm:"primary_key" json:"section_id"`
+	CourseID           uint       `gorm:"type:integer" json:"course_id"`
+	Title              string     `gorm:"type:varchar(255);not null" json:"title"`
+	Order              int        `gorm:"type:integer;not null" json:"order"`
+	AvailableFrom      *time.Time `json:"available_from"`
+	AvailableAfterDays *int       `gorm:"type:integer" json:"available_after_days"` // Дней от начала обучения участника
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
 }
 
 // Lesson model
 type EeLesson struct {
-	LessonID    uint      `gorm:"primary_key" json:"lesson_id"`
-	SectionID   uint      `gorm:"type:integer" json:"section_id"`
-	Title       string    `gorm:"type:varchar(255);not null" json:"title"`
-	ContentText string    `gorm:"type:text" json:"content_text"`
-	VideoID     uint      `gorm:"type:integer" json:"video_id"` // Optional, relation will be established separately
-	Order       int       `gorm:"type:integer;not null" json:"order"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	LessonID           uint       `gorm:"primary_key" json:"lesson_id"`
+	SectionID          uint       `gorm:"type:integer" json:"section_id"`
+	Title              string     `gorm:"type:varchar(255);not null" json:"title"`
+	ContentText        string     `gorm:"type:text" json:"content_text"` // Не используется, содержимое урока хранится в блоках
+	VideoID            *uint      `gorm:"type:integer" json:"video_id"`  // Меняется через API видео, повторяет ee_videos.lesson_id
+	Order              int        `gorm:"type:integer;not null" json:"order"`
+	AvailableFrom      *time.Time `json:"available_from"`
+	AvailableAfterDays *int       `gorm:"type:integer" json:"available_after_days"`       // Дней от начала обучения участника
+	Version            int        `gorm:"type:integer;not null;default:1" json:"version"` // Меняется только правкой через API, см. ETag
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// LessonProgress model
+type EeLessonProgress struct {
+	UserID      uint       `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	LessonID    uint       `gorm:"primaryKey;autoIncrement:false" json:"lesson_id"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at"`
+}
+
+func (EeLessonProgress) TableName() string {
+	return "ee_lesson_progress"
+}
+
+// LessonBlock model
+type EeLessonBlock struct {
+	BlockID   uint           `gorm:"primary_key" json:"block_id"`
+	LessonID  uint           `gorm:"type:integer;not null" json:"lesson_id"`
+	Type      string         `gorm:"type:varchar(32);not null" json:"type"`
+	Order     int            `gorm:"type:integer;not null" json:"order"`
+	Data      datatypes.JSON `gorm:"type:jsonb;not null" json:"data"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Prerequisite model
+type EePrerequisite struct {
+	PrerequisiteID   uint      `gorm:"primary_key" json:"prerequisite_id"`
+	LessonID         *uint     `gorm:"type:integer" json:"lesson_id"`
+	SectionID        *uint     `gorm:"type:integer" json:"section_id"`
+	RequiredLessonID *uint     `gorm:"type:integer" json:"required_lesson_id"`
+	RequiredQuizID   *uint     `gorm:"type:integer" json:"required_quiz_id"`
+	MinScore         int       `gorm:"type:integer;not null;default:0" json:"min_score"` // Процент верных ответов
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 // Video model
 type EeVideo struct {
-	VideoID   uint      `gorm:"primary_key" json:"video_id"`
-	LessonID  uint      `gorm:"type:integer;unique" json:"lesson_id"`
-	URL       string    `gorm:"type:varchar(255);not null" json:"url"`
+	VideoID    uint      `gorm:"primary_key" json:"video_id"`
+	LessonID   uint      `gorm:"type:integer;unique" json:"lesson_id"`
+	URL        string    `gorm:"type:varchar(1024);not null" json:"url"`
+	Provider   string    `gorm:"type:varchar(32);not null;default:self_hosted" json:"provider"`
+	ExternalID string    `gorm:"type:varchar(255)" json:"external_id"`
+	Title      string    `gorm:"type:varchar(255)" json:"title"`
+	Duration   *int      `gorm:"type:integer" json:"duration"` // Секунды
+	PosterURL  string    `gorm:"type:varchar(1024)" json:"poster_url"`
+	UploadID   *string   `gorm:"type:varchar(36)" json:"upload_id"` // Файл, загруженный через /uploads
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// VideoCaption model
+type EeVideoCaption struct {
+	CaptionID uint      `gorm:"primary_key" json:"caption_id"`
+	VideoID   uint      `gorm:"type:integer;not null" json:"video_id"`
+	Language  string    `gorm:"type:varchar(16);not null" json:"language"`
+	Label     string    `gorm:"type:varchar(255);not null" json:"label"`
+	URL       string    `gorm:"type:varchar(1024);not null" json:"url"`
+	IsDefault bool      `gorm:"not null" json:"is_default"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// Upload model
+type EeUpload struct {
+	UploadID    string     `gorm:"primaryKey;type:varchar(36)" json:"upload_id"`
+	UserID      uint       `gorm:"type:integer;not null" json:"user_id"`
+	CourseID    uint       `gorm:"type:integer;not null" json:"course_id"`
+	LessonID    *uint      `gorm:"type:integer" json:"lesson_id"`
+	Purpose     string     `gorm:"type:varchar(32);not null" json:"purpose"`
+	Filename    string     `gorm:"type:varchar(255);not null" json:"filename"`
+	MimeType    string     `gorm:"type:varchar(255);not null" json:"mime_type"`
+	Size        int64      `gorm:"type:bigint;not null" json:"size"`
+	Received    int64      `gorm:"type:bigint;not null;default:0" json:"received"`
+	SHA256      string     `gorm:"column:sha256;type:char(64)" json:"sha256"`
+	BlobKey     string     `gorm:"type:varchar(1024)" json:"-"`
+	Status      string     `gorm:"type:varchar(16);not null;default:uploading" json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// Attachment model
+type EeAttachment struct {
+	AttachmentID uint      `gorm:"primary_key" json:"attachment_id"`
+	CourseID     uint      `gorm:"type:integer;not null" json:"course_id"`
+	LessonID     *uint     `gorm:"type:integer" json:"lesson_id"` // null - вложение курса
+	UploadID     string    `gorm:"type:varchar(36);not null;unique" json:"upload_id"`
+	Title        string    `gorm:"type:varchar(255);not null" json:"title"`
+	Description  string    `gorm:"type:text" json:"description"`
+	Order        int       `gorm:"type:integer;not null" json:"order"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Revision model
+type EeRevision struct {
+	RevisionID uint           `gorm:"primary_key" json:"revision_id"`
+	Entity     string         `gorm:"type:varchar(16);not null" json:"entity"`
+	EntityID   uint           `gorm:"type:integer;not null" json:"entity_id"`
+	Number     int            `gorm:"type:integer;not null" json:"number"`
+	UserID     *uint          `gorm:"type:integer" json:"user_id"`
+	Summary    string         `gorm:"type:text;not null" json:"summary"`
+	Snapshot   datatypes.JSON `gorm:"type:jsonb;not null" json:"snapshot"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// EditLock model
+type EeEditLock struct {
+	Entity      string    `gorm:"primaryKey;type:varchar(16)" json:"entity"`
+	EntityID    uint      `gorm:"primaryKey;autoIncrement:false" json:"entity_id"`
+	UserID      uint      `gorm:"type:integer;not null" json:"user_id"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Bookmark model
+type EeBookmark struct {
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	LessonID  uint      `gorm:"primaryKey;autoIncrement:false" json:"lesson_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Note model
+type EeNote struct {
+	NoteID      uint      `gorm:"primary_key" json:"note_id"`
+	UserID      uint      `gorm:"type:integer;not null" json:"user_id"`
+	LessonID    uint      `gorm:"type:integer;not null" json:"lesson_id"`
+	Body        string    `gorm:"type:text;not null" json:"body"`
+	AnchorType  string    `gorm:"type:varchar(16);not null;default:none" json:"anchor_type"`
+	BlockID     *uint     `gorm:"type:integer" json:"block_id"`
+	AnchorStart *int      `gorm:"type:integer" json:"anchor_start"`
+	AnchorEnd   *int      `gorm:"type:integer" json:"anchor_end"`
+	AnchorQuote string    `gorm:"type:text;not null" json:"anchor_quote"`
+	VideoTime   *float64  `gorm:"type:double precision" json:"video_time"` // Секунды от начала видео
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Assignment model
+type EeAssignment struct {
+	AssignmentID uint           `gorm:"primary_key" json:"assignment_id"`
+	LessonID     uint           `gorm:"type:integer;not null;unique" json:"lesson_id"`
+	Instructions string         `gorm:"type:text;not null" json:"instructions"`
+	DueAt        *time.Time     `json:"due_at"`
+	LatePolicy   string         `gorm:"type:varchar(16);not null;default:accept" json:"late_policy"`
+	LatePenalty  int            `gorm:"type:integer;not null;default:0" json:"late_penalty"` // Процентов за день опоздания
+	LateUntil    *time.Time     `json:"late_until"`
+	AllowText    bool           `gorm:"not null;default:true" json:"allow_text"`
+	AllowFiles   bool           `gorm:"not null;default:true" json:"allow_files"`
+	AllowedTypes datatypes.JSON `gorm:"type:jsonb;not null" json:"allowed_types"` // Список MIME-типов
+	MaxFiles     int            `gorm:"type:integer;not null;default:5" json:"max_files"`
+	MaxAttempts  int            `gorm:"type:integer;not null;default:0" json:"max_attempts"` // 0 - без ограничений
+	MaxScore     float64        `gorm:"type:numeric(7,2);not null;default:100" json:"max_score"`
+	// Взаимное оценивание, 0 рецензентов - выключено
+	PeerReviewers   int        `gorm:"type:integer;not null;default:0" json:"peer_reviewers"`
+	PeerDueAt       *time.Time `json:"peer_due_at"`
+	PeerAllocatedAt *time.Time `json:"peer_allocated_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// AssignmentCriterion model
+type EeAssignmentCriterion struct {
+	CriterionID  uint    `gorm:"primary_key" json:"criterion_id"`
+	AssignmentID uint    `gorm:"type:integer;not null" json:"assignment_id"`
+	Title        string  `gorm:"type:varchar(255);not null" json:"title"`
+	Description  string  `gorm:"type:text;not null" json:"description"`
+	MaxPoints    float64 `gorm:"type:numeric(7,2);not null" json:"max_points"`
+	Order        int     `gorm:"type:integer;not null" json:"order"`
+}
+
+func (EeAssignmentCriterion) TableName() string {
+	return "ee_assignment_criteria"
+}
+
+// Submission model
+type EeSubmission struct {
+	SubmissionID uint       `gorm:"primary_key" json:"submission_id"`
+	AssignmentID uint       `gorm:"type:integer;not null" json:"assignment_id"`
+	UserID       uint       `gorm:"type:integer;not null" json:"user_id"`
+	Attempt      int        `gorm:"type:integer;not null" json:"attempt"`
+	TextBody     string     `gorm:"type:text;not null" json:"text_body"`
+	LateDays     int        `gorm:"type:integer;not null;default:0" json:"late_days"`
+	RawScore     *float64   `gorm:"type:numeric(7,2)" json:"raw_score"`
+	Penalty      float64    `gorm:"type:numeric(5,2);not null;default:0" json:"penalty"` // Процентов
+	Score        *float64   `gorm:"type:numeric(7,2)" json:"score"`
+	Feedback     string     `gorm:"type:text;not null" json:"feedback"`
+	GradedBy     *uint      `gorm:"type:integer" json:"graded_by"`
+	GradedAt     *time.Time `json:"graded_at"`
+	ReleasedAt   *time.Time `json:"released_at"`
+	SubmittedAt  time.Time  `json:"submitted_at"`
+	PeerScore    *float64   `gorm:"type:numeric(7,2)" json:"peer_score"`
+	GradeSource  *string    `gorm:"type:varchar(16)" json:"grade_source"` // instructor или peer
+}
+
+// SubmissionFile model
+type EeSubmissionFile struct {
+	SubmissionID uint   `gorm:"primaryKey;autoIncrement:false" json:"submission_id"`
+	UploadID     string `gorm:"primaryKey;type:varchar(36)" json:"upload_id"`
+	Order        int    `gorm:"type:integer;not null" json:"order"`
+}
+
+// SubmissionScore model
+type EeSubmissionScore struct {
+	SubmissionID uint    `gorm:"primaryKey;autoIncrement:false" json:"submission_id"`
+	CriterionID  uint    `gorm:"primaryKey;autoIncrement:false" json:"criterion_id"`
+	Points       float64 `gorm:"type:numeric(7,2);not null" json:"points"`
+	Comment      string  `gorm:"type:text;not null" json:"comment"`
+}
+
+// SubmissionComment model
+type EeSubmissionComment struct {
+	CommentID    uint      `gorm:"primary_key" json:"comment_id"`
+	SubmissionID uint      `gorm:"type:integer;not null" json:"submission_id"`
+	UserID       *uint     `gorm:"type:integer" json:"user_id"`
+	UploadID     *string   `gorm:"type:varchar(36)" json:"upload_id"`
+	AnchorStart  *int      `gorm:"type:integer" json:"anchor_start"`
+	AnchorEnd    *int      `gorm:"type:integer" json:"anchor_end"`
+	Location     string    `gorm:"type:varchar(255);not null" json:"location"`
+	Body         string    `gorm:"type:text;not null" json:"body"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PeerReview model
+type EePeerReview struct {
+	ReviewID     uint       `gorm:"primary_key" json:"review_id"`
+	AssignmentID uint       `gorm:"type:integer;not null" json:"assignment_id"`
+	SubmissionID uint       `gorm:"type:integer;not null" json:"submission_id"`
+	ReviewerID   uint       `gorm:"type:integer;not null" json:"reviewer_id"`
+	RawScore     *float64   `gorm:"type:numeric(7,2)" json:"raw_score"`
+	Feedback     string     `gorm:"type:text;not null" json:"feedback"`
+	Excluded     bool       `gorm:"not null;default:false" json:"excluded"`
+	CreatedAt    time.Time  `json:"created_at"`
+	SubmittedAt  *time.Time `json:"submitted_at"`
+}
+
+// PeerReviewScore model
+type EePeerReviewScore struct {
+	ReviewID    uint    `gorm:"primaryKey;autoIncrement:false" json:"review_id"`
+	CriterionID uint    `gorm:"primaryKey;autoIncrement:false" json:"criterion_id"`
+	Points      float64 `gorm:"type:numeric(7,2);not null" json:"points"`
+	Comment     string  `gorm:"type:text;not null" json:"comment"`
+}
+
+// Comment model
+type EeComment struct {
+	CommentID  uint       `gorm:"primary_key" json:"comment_id"`
+	LessonID   uint       `gorm:"type:integer;not null" json:"lesson_id"`
+	UserID     *uint      `gorm:"type:integer" json:"user_id"`
+	ParentID   *uint      `gorm:"type:integer" json:"parent_id"`
+	RootID     *uint      `gorm:"type:integer" json:"root_id"`
+	Depth      int        `gorm:"type:integer;not null;default:0" json:"depth"`
+	Body       string     `gorm:"type:text;not null" json:"body"`
+	IsStaff    bool       `gorm:"not null;default:false" json:"is_staff"`
+	IsPinned   bool       `gorm:"not null;default:false" json:"is_pinned"`
+	IsAccepted bool       `gorm:"not null;default:false" json:"is_accepted"`
+	IsHidden   bool       `gorm:"not null;default:false" json:"is_hidden"`
+	IsLocked   bool       `gorm:"not null;default:false" json:"is_locked"`
+	EditedAt   *time.Time `json:"edited_at"`
+	DeletedAt  *time.Time `json:"deleted_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// CommentReaction model
+type EeCommentReaction struct {
+	CommentID uint      `gorm:"primaryKey;autoIncrement:false" json:"comment_id"`
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Reaction  string    `gorm:"primaryKey;type:varchar(16)" json:"reaction"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentReport model
+type EeCommentReport struct {
+	ReportID   uint       `gorm:"primary_key" json:"report_id"`
+	CommentID  uint       `gorm:"type:integer;not null" json:"comment_id"`
+	UserID     *uint      `gorm:"type:integer" json:"user_id"`
+	Reason     string     `gorm:"type:varchar(32);not null" json:"reason"`
+	Details    string     `gorm:"type:text" json:"details"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolvedBy *uint      `gorm:"type:integer" json:"resolved_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// MediaAccessLog model
+type EeMediaAccessLog struct {
+	LogID      uint      `gorm:"primary_key" json:"log_id"`
+	UploadID   *string   `gorm:"type:varchar(36)" json:"upload_id"`
+	CourseID   uint      `gorm:"type:integer;not null" json:"course_id"`
+	UserID     *uint     `gorm:"type:integer" json:"user_id"`
+	Action     string    `gorm:"type:varchar(16);not null" json:"action"`
+	Download   bool      `gorm:"not null;default:false" json:"download"`
+	RangeStart *int64    `gorm:"type:bigint" json:"range_start"`
+	RangeEnd   *int64    `gorm:"type:bigint" json:"range_end"`
+	Status     int       `gorm:"type:integer;not null" json:"status"`
+	IP         string    `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string    `gorm:"type:varchar(512)" json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (EeMediaAccessLog) TableName() string {
+	return "ee_media_access_log"
+}
+
 // Quiz model
 type EeQuiz struct {
-	QuizID    uint      `gorm:"primary_key" json:"quiz_id"`
-	LessonID  uint      `gorm:"type:integer" json:"lesson_id"`
-	Title     string    `gorm:"type:varchar(255);not null" json:"title"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	QuizID          uint      `gorm:"primary_key" json:"quiz_id"`
+	LessonID        uint      `gorm:"type:integer" json:"lesson_id"`
+	Title           string    `gorm:"type:varchar(255);not null" json:"title"`
+	MaxAttempts     int       `gorm:"type:integer;not null;default:0" json:"max_attempts"` // 0 - без ограничения
+	CooldownMinutes int       `gorm:"type:integer;not null;default:0" json:"cooldown_minutes"`
+	ScoringPolicy   string    `gorm:"type:varchar(16);not null;default:highest" json:"scoring_policy"` // highest, latest или average
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // QuizQuestion model
 type EeQuizQuestion struct {
-	QuestionID    uint      `gorm:"primary_key" json:"question_id"`
-	QuizID        uint      `gorm:"type:integer" json:"quiz_id"`
-	QuestionText  string    `gorm:"type:text;not null" json:"question_text"`
-	CorrectAnswer string    `gorm:"type:text;not null" json:"correct_answer"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	QuestionID   uint           `gorm:"primary_key" json:"question_id"`
+	QuizID       uint           `gorm:"type:integer" json:"quiz_id"`
+	Type         string         `gorm:"type:varchar(32);not null" json:"type"`
+	QuestionText string         `gorm:"type:text;not null" json:"question_text"`
+	Options      datatypes.JSON `gorm:"type:jsonb;not null" json:"options"` // Варианты и правильные ответы, схема зависит от типа
+	Points       float64        `gorm:"type:numeric(7,2);not null;default:1" json:"points"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+// QuizAttempt model
+type EeQuizAttempt struct {
+	AttemptID   uint       `gorm:"primary_key" json:"attempt_id"`
+	QuizID      uint       `gorm:"type:integer;not null" json:"quiz_id"`
+	UserID      uint       `gorm:"type:integer;not null" json:"user_id"`
+	Number      int        `gorm:"type:integer;not null" json:"number"`
+	Points      *float64   `gorm:"type:numeric(9,2)" json:"points"`
+	Earned      *float64   `gorm:"type:numeric(9,2)" json:"earned"` // nil - попытка не сдана
+	StartedAt   time.Time  `json:"started_at"`
+	SubmittedAt *time.Time `json:"submitted_at"`
 }
 
 // QuizAnswer model
 type EeQuizAnswer struct {
-	AnswerID   uint      `gorm:"primary_key" json:"answer_id"`
-	QuestionID uint      `gorm:"not null;index:idx_user_question,unique" json:"question_id"`
-	UserID     uint      `gorm:"not null;index:idx_user_question,unique" json:"user_id"`
-	AnswerText string    `gorm:"type:text;not null" json:"answer_text"`
-	IsCorrect  bool      `gorm:"not null" json:"is_correct"`
+	AnswerID   uint           `gorm:"primary_key" json:"answer_id"`
+	AttemptID  uint           `gorm:"not null;index:idx_attempt_question,unique" json:"attempt_id"`
+	QuestionID uint           `gorm:"not null;index:idx_attempt_question,unique" json:"question_id"`
+	UserID     uint           `gorm:"not null" json:"user_id"`
+	Response   datatypes.JSON `gorm:"type:jsonb;not null" json:"response"`
+	Credit     float64        `gorm:"type:numeric(5,4);not null;default:0" json:"credit"` // Доля баллов вопроса
+	IsCorrect  bool           `gorm:"not null" json:"is_correct"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// Category model
+type EeCategory struct {
+	CategoryID uint      `gorm:"primary_key" json:"category_id"`
+	ParentID   *uint     `gorm:"type:integer" json:"parent_id"`
+	Title      string    `gorm:"type:varchar(255);not null" json:"title"`
+	Slug       string    `gorm:"type:varchar(255);unique;not null" json:"slug"`
+	Order      int       `gorm:"type:integer;not null" json:"order"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
+
+// Tag model
+type EeTag struct {
+	TagID     uint      `gorm:"primary_key" json:"tag_id"`
+	Title     string    `gorm:"type:varchar(255);not null" json:"title"`
+	Slug      string    `gorm:"type:varchar(255);unique;not null" json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CourseCategory model
+type EeCourseCategory struct {
+	CourseID   uint `gorm:"primaryKey;autoIncrement:false" json:"course_id"`
+	CategoryID uint `gorm:"primaryKey;autoIncrement:false" json:"category_id"`
+}
+
+// CourseTag model
+type EeCourseTag struct {
+	CourseID uint `gorm:"primaryKey;autoIncrement:false" json:"course_id"`
+	TagID    uint `gorm:"primaryKey;autoIncrement:false" json:"tag_id"`
+}
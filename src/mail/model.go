@@ -0,0 +1,16 @@
+package mail
+
+type Config struct {
+	Host     string `env:"SMTP_HOST"`
+	Port     uint16 `env:"SMTP_PORT" env-default:"587"`
+	User     string `env:"SMTP_USER"`
+	Password string `env:"SMTP_PASSWORD"`
+	From     string `env:"SMTP_FROM" env-default:"no-reply@ekb-edu.ru"`
+	AppURL   string `env:"APP_URL" env-default:"http://localhost:3000"`
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
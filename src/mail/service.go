@@ -0,0 +1,49 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"strings"
+)
+
+var cfg *Config
+
+func Connect(config *Config) {
+	cfg = config
+}
+
+// AppURL возвращает адрес фронтенда для ссылок в письмах
+func AppURL() string {
+	if cfg == nil {
+		return ""
+	}
+
+	return strings.TrimSuffix(cfg.AppURL, "/")
+}
+
+// Send отправляет письмо через SMTP. Без настроенного SMTP в лог пишутся только адресат и тема,
+// тело письма может содержать ссылки для входа.
+func Send(msg Message) error {
+	if cfg == nil || cfg.Host == "" {
+		log.Printf("mail to %s: %s (SMTP is not configured, not sent)", msg.To, msg.Subject)
+		return nil
+	}
+
+	var auth smtp.Auth
+	if cfg.User != "" {
+		auth = smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), auth, cfg.From, []string{msg.To}, []byte(b.String()))
+}
@@ -1,15 +1,32 @@
 package main
 
 import (
+	"ekb-edu/src/api/assignments"
+	"ekb-edu/src/api/assignments/peer"
+	"ekb-edu/src/api/attachments"
 	"ekb-edu/src/api/auth"
+	"ekb-edu/src/api/cohorts"
+	"ekb-edu/src/api/comments"
 	"ekb-edu/src/api/courses"
 	"ekb-edu/src/api/courses/lessons"
+	"ekb-edu/src/api/courses/lessons/blocks"
 	"ekb-edu/src/api/courses/lessons/quizzes"
+	"ekb-edu/src/api/enrollments"
+	"ekb-edu/src/api/imports"
+	"ekb-edu/src/api/media"
 	"ekb-edu/src/api/middleware"
+	"ekb-edu/src/api/notes"
+	"ekb-edu/src/api/progress"
+	"ekb-edu/src/api/taxonomy"
+	"ekb-edu/src/api/uploads"
+	"ekb-edu/src/cli"
 	"ekb-edu/src/database/config"
+	"ekb-edu/src/database/files"
 	"ekb-edu/src/database/storage"
+	"ekb-edu/src/mail"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -23,12 +40,27 @@ func main() {
 	}
 
 	storage.Connect(&cfg.Postgres)
+	files.Connect(&cfg.Files)
+	mail.Connect(&cfg.Mail)
 	middleware.InitializeJWT(&cfg.Jwt)
+	uploads.Initialize(&cfg.Uploads)
+	media.Initialize(&cfg.Media, cfg.Jwt.Secret)
 
-	app := fiber.New()
+	if len(os.Args) > 1 {
+		if err := cli.Run(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Сервер принимает тело до большого лимита, остальным маршрутам его сужает BodyLimit
+	app := fiber.New(fiber.Config{
+		BodyLimit: max(cfg.Web.BodyLimit, cfg.Web.LargeBodyLimit),
+	})
 	{
 		config := cors.ConfigDefault
 		config.AllowCredentials = true
+		config.ExposeHeaders = "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Offset, Upload-Length, Upload-Expires, Content-Range, Accept-Ranges, ETag"
 		app.Use(cors.New(config))
 	}
 
@@ -37,12 +69,27 @@ func main() {
 		TimeFormat: "2006-01-02 15:04:05",
 	}))
 
+	app.Use(middleware.BodyLimit(cfg.Web.BodyLimit, "/v1/imports", "/v1/uploads"))
+
 	v1 := app.Group("/v1")
 	{
 		auth.RegisterService(v1)
 		courses.RegisterService(v1)
 		lessons.RegisterService(v1)
 		quizzes.RegisterService(v1)
+		enrollments.RegisterService(v1)
+		imports.RegisterService(v1)
+		taxonomy.RegisterService(v1)
+		cohorts.RegisterService(v1)
+		progress.RegisterService(v1)
+		blocks.RegisterService(v1)
+		uploads.RegisterService(v1)
+		media.RegisterService(v1)
+		attachments.RegisterService(v1)
+		comments.RegisterService(v1)
+		notes.RegisterService(v1)
+		assignments.RegisterService(v1)
+		peer.RegisterService(v1)
 	}
 
 	app.Listen(fmt.Sprintf(":%d", cfg.Web.Port))
@@ -0,0 +1,47 @@
+package render
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Форматы исходного текста
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatPlain    = "plain"
+)
+
+// Размер кэша отрисованных документов
+const cacheSize = 1024
+
+// Heading - пункт оглавления
+type Heading struct {
+	Level int    `json:"level"`
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+}
+
+// Document - очищенный HTML с оглавлением
+type Document struct {
+	HTML string    `json:"html"`
+	TOC  []Heading `json:"toc"`
+}
+
+type cacheEntry struct {
+	key      string
+	hash     [32]byte
+	document *Document
+}
+
+// LRU кэш документов по ключу сущности, например lesson:42
+type cache struct {
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// Генератор id заголовков, сохраняющий кириллицу
+type headingIDs struct {
+	used map[string]bool
+}
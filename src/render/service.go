@@ -0,0 +1,199 @@
+package render
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Встроенный HTML пропускается рендерером и затем очищается политикой
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+var policy = newPolicy()
+
+var documents = &cache{order: list.New(), entries: make(map[string]*list.Element)}
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// Классы подсветки кода вида language-go, как у highlight.js и Prism
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+
+	return p
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	id := strings.TrimSuffix(b.String(), "-")
+	if id == "" {
+		id = "section"
+	}
+
+	// Одинаковые заголовки получают суффиксы -1, -2...
+	result := id
+	for i := 1; ids.used[result]; i++ {
+		result = id + "-" + strconv.Itoa(i)
+	}
+	ids.used[result] = true
+
+	return []byte(result)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.used[string(value)] = true
+}
+
+// Markdown преобразует Markdown в очищенный HTML с якорями заголовков и оглавлением
+func Markdown(source string) (*Document, error) {
+	src := []byte(source)
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{used: make(map[string]bool)}))
+	root := markdown.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+
+	toc := []Heading{}
+	err := ast.Walk(root, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		id, _ := heading.AttributeString("id")
+		idBytes, _ := id.([]byte)
+		toc = append(toc, Heading{
+			Level: heading.Level,
+			ID:    string(idBytes),
+			Text:  string(heading.Text(src)),
+		})
+
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, src, root); err != nil {
+		return nil, err
+	}
+
+	return &Document{HTML: policy.Sanitize(buf.String()), TOC: toc}, nil
+}
+
+// Render отрисовывает текст в указанном формате. HTML только очищается, обычный текст экранируется.
+func Render(format, source string) (*Document, error) {
+	switch format {
+	case FormatHTML:
+		return &Document{HTML: policy.Sanitize(source), TOC: []Heading{}}, nil
+	case FormatPlain:
+		paragraphs := []string{}
+		for _, paragraph := range strings.Split(strings.ReplaceAll(source, "\r\n", "\n"), "\n\n") {
+			if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+				paragraphs = append(paragraphs, "<p>"+strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>")+"</p>")
+			}
+		}
+		return &Document{HTML: strings.Join(paragraphs, "\n"), TOC: []Heading{}}, nil
+	default:
+		return Markdown(source)
+	}
+}
+
+// Cached - Render с кэшированием по ключу сущности. Изменившийся текст отрисовывается заново
+// даже без явного Invalidate.
+func Cached(key, format, source string) (*Document, error) {
+	hash := sha256.Sum256([]byte(format + "\x00" + source))
+	if document := documents.get(key, hash); document != nil {
+		return document, nil
+	}
+
+	document, err := Render(format, source)
+	if err != nil {
+		return nil, err
+	}
+
+	documents.put(key, hash, document)
+	return document, nil
+}
+
+// Invalidate удаляет документы сущностей из кэша, вызывается при их изменении
+func Invalidate(keys ...string) {
+	documents.mu.Lock()
+	defer documents.mu.Unlock()
+
+	for _, key := range keys {
+		if element, ok := documents.entries[key]; ok {
+			documents.order.Remove(element)
+			delete(documents.entries, key)
+		}
+	}
+}
+
+// Key строит ключ кэша, например Key("lesson", 42)
+func Key(kind string, id uint) string {
+	return kind + ":" + strconv.FormatUint(uint64(id), 10)
+}
+
+func (c *cache) get(key string, hash [32]byte) *Document {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if entry.hash != hash {
+		return nil
+	}
+
+	c.order.MoveToFront(element)
+	return entry.document
+}
+
+func (c *cache) put(key string, hash [32]byte, document *Document) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &cacheEntry{key: key, hash: hash, document: document}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, hash: hash, document: document})
+
+	if c.order.Len() > cacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}